@@ -0,0 +1,149 @@
+package actions
+
+import (
+	"crypto/subtle"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/oysterprotocol/brokernode/actions/utils"
+	"github.com/oysterprotocol/brokernode/jobs"
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+)
+
+/*AdminResource is a resource for the on-call endpoints which inspect and trigger the jobs*/
+type AdminResource struct {
+	buffalo.Resource
+}
+
+// Response structs
+type listJobsRes struct {
+	Jobs []jobs.JobStatus `json:"jobs"`
+}
+
+type runJobRes struct {
+	Name    string `json:"name"`
+	Started bool   `json:"started"`
+}
+
+type stuckTreasureRes struct {
+	GenesisHash   string    `json:"genesisHash"`
+	Idx           int64     `json:"idx"`
+	Address       string    `json:"address"`
+	LastAttemptAt time.Time `json:"lastAttemptAt"`
+}
+
+type treasureAttachmentReportRes struct {
+	SignedStatusCounts map[string]int     `json:"signedStatusCounts"`
+	NumAttachErrors    int                `json:"numAttachErrors"`
+	AttachErrors       []stuckTreasureRes `json:"attachErrors"`
+}
+
+type iriNodeRes struct {
+	URI                                string    `json:"uri"`
+	Healthy                            bool      `json:"healthy"`
+	Latency                            string    `json:"latency"`
+	LatestMilestoneIndex               int64     `json:"latestMilestoneIndex"`
+	LatestSolidSubtangleMilestoneIndex int64     `json:"latestSolidSubtangleMilestoneIndex"`
+	LastCheck                          time.Time `json:"lastCheck"`
+	LastError                          string    `json:"lastError,omitempty"`
+}
+
+type listIriNodesRes struct {
+	Nodes []iriNodeRes `json:"nodes"`
+}
+
+/*RequireAdminToken only lets through requests with "Authorization: Bearer <ADMIN_API_TOKEN>".  The admin endpoints
+are disabled when ADMIN_API_TOKEN is not set.*/
+func RequireAdminToken(next buffalo.Handler) buffalo.Handler {
+	return func(c buffalo.Context) error {
+		adminToken := os.Getenv("ADMIN_API_TOKEN")
+		if adminToken == "" {
+			return c.Error(404, errors.New("admin API is disabled"))
+		}
+
+		authorization := c.Request().Header.Get("Authorization")
+		if subtle.ConstantTimeCompare([]byte(authorization), []byte("Bearer "+adminToken)) != 1 {
+			return c.Error(401, errors.New("invalid admin token"))
+		}
+		return next(c)
+	}
+}
+
+/*ListJobs returns the schedule and the recent runs of every job*/
+func (admin *AdminResource) ListJobs(c buffalo.Context) error {
+	res := listJobsRes{
+		Jobs: jobs.GetJobStatuses(),
+	}
+	return c.Render(200, actions_utils.Render.JSON(res))
+}
+
+/*RunJob starts a run of the job right away, its schedule is not changed*/
+func (admin *AdminResource) RunJob(c buffalo.Context) error {
+	name := c.Param("name")
+
+	switch err := jobs.RunJobNow(name); err {
+	case nil:
+	case jobs.ErrJobNotFound:
+		return c.Error(404, err)
+	case jobs.ErrJobAlreadyRunning, jobs.ErrJobRunningElsewhere:
+		return c.Error(409, err)
+	default:
+		return c.Error(500, err)
+	}
+
+	res := runJobRes{
+		Name:    name,
+		Started: true,
+	}
+	return c.Render(202, actions_utils.Render.JSON(res))
+}
+
+/*GetTreasureAttachmentReport returns the number of treasures in each signed status and the treasures which are
+stuck in TreasureAttachError, oldest attempt first*/
+func (admin *AdminResource) GetTreasureAttachmentReport(c buffalo.Context) error {
+	counts, err := models.GetTreasureCountsBySignedStatus()
+	if err != nil {
+		return c.Error(500, err)
+	}
+	treasures, err := models.GetAllTreasuresBySignedStatus(models.TreasureAttachError)
+	if err != nil {
+		return c.Error(500, err)
+	}
+
+	res := treasureAttachmentReportRes{
+		SignedStatusCounts: counts,
+		NumAttachErrors:    len(treasures),
+		AttachErrors:       []stuckTreasureRes{},
+	}
+	for _, treasure := range treasures {
+		res.AttachErrors = append(res.AttachErrors, stuckTreasureRes{
+			GenesisHash:   treasure.GenesisHash,
+			Idx:           treasure.Idx,
+			Address:       treasure.Address,
+			LastAttemptAt: treasure.UpdatedAt,
+		})
+	}
+	return c.Render(200, actions_utils.Render.JSON(res))
+}
+
+/*ListIriNodes returns the health of every IRI node the broker sends its requests to*/
+func (admin *AdminResource) ListIriNodes(c buffalo.Context) error {
+	res := listIriNodesRes{
+		Nodes: []iriNodeRes{},
+	}
+	for _, status := range services.IriNodes.GetStatuses() {
+		res.Nodes = append(res.Nodes, iriNodeRes{
+			URI:                                status.URI,
+			Healthy:                            status.Healthy,
+			Latency:                            status.Latency.String(),
+			LatestMilestoneIndex:               status.LatestMilestoneIndex,
+			LatestSolidSubtangleMilestoneIndex: status.LatestSolidSubtangleMilestoneIndex,
+			LastCheck:                          status.LastCheck,
+			LastError:                          status.LastError,
+		})
+	}
+	return c.Render(200, actions_utils.Render.JSON(res))
+}
@@ -0,0 +1,105 @@
+package actions
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+func (suite *ActionSuite) Test_AdminListJobs() {
+	os.Setenv("ADMIN_API_TOKEN", "secret")
+	defer os.Unsetenv("ADMIN_API_TOKEN")
+
+	req := suite.JSON("/admin/jobs")
+	req.Headers["Authorization"] = "Bearer secret"
+	res := req.Get()
+	suite.Equal(200, res.Code)
+
+	resParsed := listJobsRes{}
+	bodyBytes, err := ioutil.ReadAll(res.Body)
+	suite.Nil(err)
+	suite.Nil(json.Unmarshal(bodyBytes, &resParsed))
+
+	names := make(map[string]bool)
+	for _, job := range resParsed.Jobs {
+		names[job.Name] = true
+	}
+	suite.True(names["bury_treasure_addresses"])
+	suite.True(names["verify_data_maps"])
+}
+
+func (suite *ActionSuite) Test_AdminRunJob_UnknownJob() {
+	os.Setenv("ADMIN_API_TOKEN", "secret")
+	defer os.Unsetenv("ADMIN_API_TOKEN")
+
+	req := suite.JSON("/admin/jobs/not_a_job/run")
+	req.Headers["Authorization"] = "Bearer secret"
+	res := req.Post(nil)
+	suite.Equal(404, res.Code)
+}
+
+func (suite *ActionSuite) Test_AdminJobs_RequiresToken() {
+	res := suite.JSON("/admin/jobs").Get()
+	suite.Equal(404, res.Code)
+
+	os.Setenv("ADMIN_API_TOKEN", "secret")
+	defer os.Unsetenv("ADMIN_API_TOKEN")
+
+	req := suite.JSON("/admin/jobs")
+	req.Headers["Authorization"] = "Bearer wrong"
+	res = req.Get()
+	suite.Equal(401, res.Code)
+}
+
+func (suite *ActionSuite) Test_AdminTreasureAttachmentReport() {
+	os.Setenv("ADMIN_API_TOKEN", "secret")
+	defer os.Unsetenv("ADMIN_API_TOKEN")
+
+	for _, signedStatus := range []models.SignedStatus{models.TreasureAttachError, models.TreasureSigned} {
+		treasure := models.Treasure{
+			ETHAddr:      oyster_utils.RandSeq(40, []rune("abcdef0123456789")),
+			ETHKey:       oyster_utils.RandSeq(64, []rune("abcdef0123456789")),
+			PRLAmount:    "1",
+			PRLStatus:    models.PRLWaiting,
+			GenesisHash:  "abcdef",
+			Address:      oyster_utils.RandSeq(81, oyster_utils.TrytesAlphabet),
+			SignedStatus: signedStatus,
+		}
+		suite.Nil(suite.DB.Create(&treasure))
+	}
+
+	req := suite.JSON("/admin/treasures/attachment")
+	req.Headers["Authorization"] = "Bearer secret"
+	res := req.Get()
+	suite.Equal(200, res.Code)
+
+	resParsed := treasureAttachmentReportRes{}
+	bodyBytes, err := ioutil.ReadAll(res.Body)
+	suite.Nil(err)
+	suite.Nil(json.Unmarshal(bodyBytes, &resParsed))
+
+	suite.Equal(1, resParsed.NumAttachErrors)
+	suite.Equal("abcdef", resParsed.AttachErrors[0].GenesisHash)
+	suite.Equal(1, resParsed.SignedStatusCounts["TreasureAttachError"])
+	suite.Equal(1, resParsed.SignedStatusCounts["TreasureSigned"])
+}
+
+func (suite *ActionSuite) Test_AdminListIriNodes() {
+	os.Setenv("ADMIN_API_TOKEN", "secret")
+	defer os.Unsetenv("ADMIN_API_TOKEN")
+
+	req := suite.JSON("/admin/iri-nodes")
+	req.Headers["Authorization"] = "Bearer secret"
+	res := req.Get()
+	suite.Equal(200, res.Code)
+
+	resParsed := listIriNodesRes{}
+	bodyBytes, err := ioutil.ReadAll(res.Body)
+	suite.Nil(err)
+	suite.Nil(json.Unmarshal(bodyBytes, &resParsed))
+
+	suite.True(len(resParsed.Nodes) > 0)
+}
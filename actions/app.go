@@ -33,6 +33,15 @@ func App() *buffalo.App {
 		app.GET("/status", statusResource.CheckStatus)
 
 		actions_v3.RegisterApi(app)
+
+		// Admin endpoints for on-call (:3000/admin)
+		admin := app.Group("/admin")
+		admin.Use(RequireAdminToken)
+		adminResource := AdminResource{}
+		admin.GET("jobs", adminResource.ListJobs)
+		admin.POST("jobs/{name}/run", adminResource.RunJob)
+		admin.GET("treasures/attachment", adminResource.GetTreasureAttachmentReport)
+		admin.GET("iri-nodes", adminResource.ListIriNodes)
 	}
 
 	oyster_utils.StartProfile()
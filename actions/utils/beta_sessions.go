@@ -0,0 +1,107 @@
+package actions_utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+)
+
+/*CancelTokenHeader carries the token the client got when it created an alpha session, which it cancels the session
+with.*/
+const CancelTokenHeader = "X-Cancel-Token"
+
+/*AuthorizeSessionCancel checks that the request to cancel the session comes from whoever created it: the client
+holding the cancel token of an alpha session, or the alpha broker of a beta session.*/
+func AuthorizeSessionCancel(c buffalo.Context, session models.UploadSession) error {
+	if session.Type != models.SessionTypeBeta {
+		if !session.IsCancelToken(c.Request().Header.Get(CancelTokenHeader)) {
+			return errors.New("a valid cancel token is required to cancel the session")
+		}
+		return nil
+	}
+
+	alphaETHAddr, err := VerifyBrokerRequest(c)
+	if err != nil {
+		return err
+	}
+	if peerAddress := GetPeerAddress(alphaETHAddr); session.PeerAddress.Valid && peerAddress != session.PeerAddress {
+		return fmt.Errorf("broker %v did not create the session", alphaETHAddr)
+	}
+	return nil
+}
+
+/*CheckBetaInvoice returns the quote of this broker for the beta session the alpha broker asks for, or an error if the
+invoice of the alpha broker pays less than it.*/
+func CheckBetaInvoice(invoice models.Invoice, fileSizeBytes uint64, storageLengthInYears int) (models.Quote, error) {
+	quote := models.GetQuote(fileSizeBytes, storageLengthInYears)
+	if invoice.Cost.LessThan(quote.TotalCost) {
+		return quote, fmt.Errorf("the invoice cost of %v PRL is less than the %v PRL this broker charges",
+			invoice.Cost, quote.TotalCost)
+	}
+	return quote, nil
+}
+
+/*CancelBetaSession tells the beta broker of an alpha session, or the peer brokers of an N-broker alpha session, to
+cancel their sessions as well.  If a broker can't be reached, its RemoveUnpaidUploadSession job removes the session
+once it expires instead.*/
+func CancelBetaSession(session models.UploadSession, apiVersion string) error {
+	if session.Type != models.SessionTypeAlpha {
+		return nil
+	}
+
+	peers, err := session.GetPeers()
+	if err != nil {
+		return err
+	}
+	if session.BetaIP.Valid && session.BetaSessionID.Valid {
+		peers = append(peers, models.SessionPeer{
+			BrokerIP:  session.BetaIP.String,
+			SessionID: session.BetaSessionID.String,
+		})
+	}
+	return CancelPeerSessions(peers, apiVersion)
+}
+
+/*CancelPeerSessions tells each of the brokers to cancel its session.  All of them are told even if some fail, and
+the last error is returned.*/
+func CancelPeerSessions(peers []models.SessionPeer, apiVersion string) error {
+	var lastErr error
+	for _, peer := range peers {
+		if err := cancelPeerSession(peer, apiVersion); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func cancelPeerSession(peer models.SessionPeer, apiVersion string) error {
+	// Should we be hardcoding the port?
+	peerURL := fmt.Sprintf("%v:3000/api/%v/upload-sessions/%v", peer.BrokerIP, apiVersion, peer.SessionID)
+	res, err := services.SendBrokerRequest(http.MethodDelete, peerURL, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// the session may already be removed
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("broker %v failed to cancel session %v with status %v", peer.BrokerIP, peer.SessionID,
+			res.StatusCode)
+	}
+	return nil
+}
+
+/*GetPeerAddress returns the address of the broker with ETH address ethAddress, which the beta session of the broker
+asks for the progress of the alpha session.*/
+func GetPeerAddress(ethAddress string) nulls.String {
+	brokernode, err := models.GetBrokernodeByETHAddress(ethAddress)
+	if err != nil {
+		return nulls.String{}
+	}
+	return nulls.NewString(brokernode.Address)
+}
@@ -0,0 +1,126 @@
+package actions_utils
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/utils"
+	"github.com/oysterprotocol/brokernode/utils/eth_gateway"
+)
+
+const (
+	/*BrokerRequestMaxAge is how far the timestamp of a signed request may be from the clock of the broker which
+	receives it.*/
+	BrokerRequestMaxAge = 5 * time.Minute
+
+	maxBrokerNonceLength = 64
+)
+
+/*brokerNonceDBID is the badger DB of the nonces of received broker requests.  It is a unique DB, since the global
+DB is only opened when the data maps are stored in SQL.*/
+var brokerNonceDBID = []string{"broker_nonce"}
+
+/*nonceMutex makes checking and storing a nonce atomic.*/
+var nonceMutex sync.Mutex
+
+/*VerifyBrokerRequest checks that the request was signed by one of the brokers in the brokernodes table, recently and
+only once.  Returns the ETH address of the broker.  The body of the request can still be read afterwards.*/
+func VerifyBrokerRequest(c buffalo.Context) (string, error) {
+	address, err := VerifyBrokerSignature(c)
+	if err != nil {
+		return "", err
+	}
+
+	if isKnown, err := models.IsKnownBrokernode(address); err != nil || !isKnown {
+		return "", fmt.Errorf("broker %v is not a known broker", address)
+	}
+	return address, nil
+}
+
+/*VerifyBrokerSignature checks that the request was signed recently and only once, by any broker.  Returns the ETH
+address of the broker.  The body of the request can still be read afterwards.*/
+func VerifyBrokerSignature(c buffalo.Context) (string, error) {
+	req := c.Request()
+
+	timestamp := req.Header.Get(services.BrokerTimestampHeader)
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", errors.New("broker request is not signed")
+	}
+	if age := time.Since(time.Unix(signedAt, 0)); age > BrokerRequestMaxAge || age < -BrokerRequestMaxAge {
+		return "", errors.New("broker request has expired")
+	}
+
+	nonce := req.Header.Get(services.BrokerNonceHeader)
+	if nonce == "" || len(nonce) > maxBrokerNonceLength {
+		return "", errors.New("broker request has no valid nonce")
+	}
+
+	signature, err := hex.DecodeString(strings.TrimPrefix(req.Header.Get(services.BrokerSignatureHeader), "0x"))
+	if err != nil {
+		return "", errors.New("broker request has no valid signature")
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	hash := services.GetBrokerRequestHash(req.Method, req.URL.Path, timestamp, nonce, body)
+	pubKey, err := crypto.SigToPub(hash, signature)
+	if err != nil {
+		return "", errors.New("broker request has no valid signature")
+	}
+	address := crypto.PubkeyToAddress(*pubKey).Hex()
+	if !strings.EqualFold(address, req.Header.Get(services.BrokerAddressHeader)) {
+		return "", errors.New("broker request is not signed by " + req.Header.Get(services.BrokerAddressHeader))
+	}
+
+	if err := useBrokerNonce(address, nonce); err != nil {
+		return "", err
+	}
+	return address, nil
+}
+
+/*useBrokerNonce stores the nonce of a broker until its requests expire, and fails if it was already used.*/
+func useBrokerNonce(address string, nonce string) error {
+	key := oyster_utils.GetBadgerKey([]string{strings.ToLower(address), nonce})
+
+	nonceMutex.Lock()
+	defer nonceMutex.Unlock()
+
+	kvs, err := oyster_utils.BatchGetFromUniqueDB(brokerNonceDBID, &oyster_utils.KVKeys{key})
+	if err != nil {
+		return err
+	}
+	if _, isUsed := (*kvs)[key]; isUsed {
+		return errors.New("broker request has already been received")
+	}
+
+	// a request may be received up to BrokerRequestMaxAge after the time it claims to be signed at
+	return oyster_utils.BatchSetToUniqueDB(brokerNonceDBID, &oyster_utils.KVPairs{key: nonce}, 2*BrokerRequestMaxAge)
+}
+
+/*AddSigningBrokernodeForTest adds this broker to the brokernodes table, so that the requests it signs with
+eth_gateway.MainWalletPrivateKey are verified.  It is shared by the action tests of each api version.*/
+func AddSigningBrokernodeForTest() error {
+	return models.DB.Save(&models.Brokernode{
+		Address:    "http://" + oyster_utils.RandSeq(8, []rune("abcdef0123456789")) + ":3000",
+		ETHAddress: nulls.NewString(crypto.PubkeyToAddress(eth_gateway.MainWalletPrivateKey.PublicKey).Hex()),
+		Status:     models.BrokernodeActive,
+	})
+}
@@ -0,0 +1,98 @@
+package actions_utils_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/x/sessions"
+	"github.com/oysterprotocol/brokernode/actions/utils"
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+func Test_VerifyBrokerRequest(t *testing.T) {
+	app := newBrokerAuthTestApp()
+	models.DB.RawQuery("DELETE FROM brokernodes").All(&[]models.Brokernode{})
+
+	req := newSignedBrokerRequest(t, "hello")
+	oyster_utils.AssertTrue(sendBrokerRequest(app, req) == 401, t, "unknown brokers should be rejected")
+
+	oyster_utils.AssertNoError(actions_utils.AddSigningBrokernodeForTest(), t, "")
+
+	req = newSignedBrokerRequest(t, "hello")
+	res := httptest.NewRecorder()
+	app.ServeHTTP(res, req)
+	oyster_utils.AssertTrue(res.Code == 200, t, "signed requests of known brokers should be accepted")
+	oyster_utils.AssertStringEqual(res.Body.String(), "hello", t)
+
+	replay := httptest.NewRequest("POST", "/beta", bytes.NewBufferString("hello"))
+	replay.Header = req.Header
+	oyster_utils.AssertTrue(sendBrokerRequest(app, replay) == 401, t, "replayed requests should be rejected")
+
+	tampered := newSignedBrokerRequest(t, "hello")
+	tampered.Body = ioutil.NopCloser(bytes.NewBufferString("goodbye"))
+	oyster_utils.AssertTrue(sendBrokerRequest(app, tampered) == 401, t, "tampered requests should be rejected")
+
+	unsigned := httptest.NewRequest("POST", "/beta", bytes.NewBufferString("hello"))
+	oyster_utils.AssertTrue(sendBrokerRequest(app, unsigned) == 401, t, "unsigned requests should be rejected")
+}
+
+func Test_VerifyBrokerRequest_WithoutKvStore(t *testing.T) {
+	// the global DB is only opened when the data maps are stored in SQL
+	if oyster_utils.GetBadgerDb() != nil {
+		oyster_utils.AssertNoError(oyster_utils.CloseKvStore(), t, "")
+		defer oyster_utils.InitKvStore()
+	}
+	app := newBrokerAuthTestApp()
+	oyster_utils.AssertNoError(actions_utils.AddSigningBrokernodeForTest(), t, "")
+
+	req := newSignedBrokerRequest(t, "hello")
+	oyster_utils.AssertTrue(sendBrokerRequest(app, req) == 200, t, "signed requests should be accepted")
+
+	replay := httptest.NewRequest("POST", "/beta", bytes.NewBufferString("hello"))
+	replay.Header = req.Header
+	oyster_utils.AssertTrue(sendBrokerRequest(app, replay) == 401, t, "replayed requests should be rejected")
+}
+
+func Test_VerifyBrokerRequest_Expired(t *testing.T) {
+	app := newBrokerAuthTestApp()
+
+	req := newSignedBrokerRequest(t, "hello")
+	req.Header.Set(services.BrokerTimestampHeader, "1500000000")
+	oyster_utils.AssertTrue(sendBrokerRequest(app, req) == 401, t, "expired requests should be rejected")
+}
+
+func newBrokerAuthTestApp() *buffalo.App {
+	app := buffalo.New(buffalo.Options{
+		SessionStore: sessions.Null{},
+		WorkerOff:    true,
+	})
+	app.POST("/beta", func(c buffalo.Context) error {
+		if _, err := actions_utils.VerifyBrokerRequest(c); err != nil {
+			return c.Error(401, err)
+		}
+		body, err := ioutil.ReadAll(c.Request().Body)
+		if err != nil {
+			return c.Error(500, err)
+		}
+		return c.Render(200, actions_utils.Render.String(string(body)))
+	})
+	return app
+}
+
+func newSignedBrokerRequest(t *testing.T, body string) *http.Request {
+	req := httptest.NewRequest("POST", "/beta", bytes.NewBufferString(body))
+	oyster_utils.AssertNoError(services.SignBrokerRequest(req, []byte(body)), t, "")
+	return req
+}
+
+func sendBrokerRequest(app *buffalo.App, req *http.Request) int {
+	res := httptest.NewRecorder()
+	app.ServeHTTP(res, req)
+	return res.Code
+}
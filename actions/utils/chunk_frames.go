@@ -0,0 +1,30 @@
+package actions_utils
+
+import (
+	"mime"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/oysterprotocol/brokernode/models"
+)
+
+const chunkFrameRequestKey = "chunk_frame_request"
+
+/*SetContentType overrides the content type of every request with contentType, like middleware.SetContentType, but
+remembers first whether the chunks of an upload request are sent as frames.*/
+func SetContentType(contentType string) buffalo.MiddlewareFunc {
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			mediaType, _, err := mime.ParseMediaType(c.Request().Header.Get("Content-Type"))
+			c.Set(chunkFrameRequestKey, err == nil && mediaType == models.ChunkFrameContentType)
+
+			c.Request().Header.Set("Content-Type", contentType)
+			return next(c)
+		}
+	}
+}
+
+/*IsChunkFrameRequest returns whether the chunks of the upload request are sent as frames instead of JSON.*/
+func IsChunkFrameRequest(c buffalo.Context) bool {
+	isChunkFrameRequest, _ := c.Value(chunkFrameRequestKey).(bool)
+	return isChunkFrameRequest
+}
@@ -47,7 +47,10 @@ func CreateBuffaloApp() *buffalo.App {
 	}))
 
 	// Set the request content type to JSON
-	app.Use(middleware.SetContentType("application/json"))
+	app.Use(SetContentType("application/json"))
+
+	// Reject the uploads of clients over their quotas
+	app.Use(UploadQuotaMiddleware(NewUploadQuotas(GetUploadQuotaConfig())))
 
 	if ENV == "development" {
 		app.Use(middleware.ParameterLogger)
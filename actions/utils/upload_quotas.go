@@ -0,0 +1,401 @@
+package actions_utils
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+const (
+	/*QuotaSessions limits the number of sessions a client uploads to at once.*/
+	QuotaSessions = "sessions"
+	/*QuotaChunksPerMinute limits the number of chunks a client uploads per minute.*/
+	QuotaChunksPerMinute = "chunks_per_minute"
+	/*QuotaBytesPerDay limits the size of the upload requests of a client per day.*/
+	QuotaBytesPerDay = "bytes_per_day"
+
+	uploadUsageKey = "upload_usage"
+)
+
+/*uploadSessionPath matches the upload session endpoints of every API version.*/
+var uploadSessionPath = regexp.MustCompile(`^/api/v\d+/upload-sessions(?:/([^/]+))?/?$`)
+
+/*UploadQuotaConfig are the limits of each client of the upload endpoints.  A limit of 0 means unlimited.*/
+type UploadQuotaConfig struct {
+	/*MaxSessions is the max number of sessions a client uploads to at once.  A session stops counting once no
+	chunks were sent to it for SessionIdleTimeout.*/
+	MaxSessions        int
+	SessionIdleTimeout time.Duration
+	MaxChunksPerMinute int
+	MaxBytesPerDay     int64
+	/*TrustForwardedFor identifies clients by the X-Forwarded-For header, for brokers behind a proxy.*/
+	TrustForwardedFor bool
+}
+
+/*UploadQuotas tracks how much each client, by IP, uploads to this broker.  The clients are not tracked by ETH
+address, since the broker generates a new one for each session.*/
+type UploadQuotas struct {
+	mutex     sync.Mutex
+	config    UploadQuotaConfig
+	clients   map[string]*clientUsage
+	lastPrune time.Time
+}
+
+type clientUsage struct {
+	/*sessions are the last time each session of the client was used.*/
+	sessions          map[string]time.Time
+	chunksWindowStart time.Time
+	chunks            int
+	bytesWindowStart  time.Time
+	bytes             int64
+}
+
+/*uploadUsage is what the handler of an upload request reports back to the middleware.*/
+type uploadUsage struct {
+	createdSessionID string
+	numChunks        int
+	quotas           *UploadQuotas
+	clientKeys       []string
+	body             *countingReader
+	/*isRejectionCounted is set once a rejection of the request is counted, so that it is counted only once.*/
+	isRejectionCounted bool
+}
+
+/*countingReader counts the bytes read from the body of a request, and fails the read which puts the client over
+its bytes per day.*/
+type countingReader struct {
+	body       io.ReadCloser
+	bytesRead  int64
+	quotas     *UploadQuotas
+	clientKeys []string
+	quotaErr   *UploadQuotaError
+}
+
+/*UploadQuotaError is the quota an upload request exceeded, and how long until the client may try again.*/
+type UploadQuotaError struct {
+	Quota      string
+	RetryAfter time.Duration
+}
+
+/*GetUploadQuotaConfig reads the quotas from the UPLOAD_QUOTA_* env vars.*/
+func GetUploadQuotaConfig() UploadQuotaConfig {
+	config := UploadQuotaConfig{
+		MaxSessions:        int(getQuotaEnv("UPLOAD_QUOTA_MAX_SESSIONS")),
+		SessionIdleTimeout: 10 * time.Minute,
+		MaxChunksPerMinute: int(getQuotaEnv("UPLOAD_QUOTA_CHUNKS_PER_MINUTE")),
+		MaxBytesPerDay:     getQuotaEnv("UPLOAD_QUOTA_BYTES_PER_DAY"),
+		TrustForwardedFor:  os.Getenv("UPLOAD_QUOTA_TRUST_FORWARDED_FOR") == "true",
+	}
+	if v := os.Getenv("UPLOAD_QUOTA_SESSION_IDLE_TIMEOUT"); v != "" {
+		if timeout, err := time.ParseDuration(v); err == nil && timeout > 0 {
+			config.SessionIdleTimeout = timeout
+		} else {
+			oyster_utils.LogIfError(fmt.Errorf("invalid UPLOAD_QUOTA_SESSION_IDLE_TIMEOUT: %v", v), nil)
+		}
+	}
+	return config
+}
+
+/*NewUploadQuotas returns the tracker of the quotas in config.*/
+func NewUploadQuotas(config UploadQuotaConfig) *UploadQuotas {
+	return &UploadQuotas{
+		config:  config,
+		clients: make(map[string]*clientUsage),
+	}
+}
+
+/*UploadQuotaMiddleware rejects the upload requests of a client which is over one of its quotas with a 429.  Other
+requests, including the ones from alpha brokers creating beta sessions, are not limited.*/
+func UploadQuotaMiddleware(quotas *UploadQuotas) buffalo.MiddlewareFunc {
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			sessionID, isUploadRequest := getUploadRequest(c.Request())
+			if !isUploadRequest {
+				return next(c)
+			}
+
+			clientKeys := quotas.getClientKeys(c.Request())
+			if quotaErr := quotas.admit(clientKeys, sessionID, c.Request().ContentLength, time.Now()); quotaErr != nil {
+				IsUploadQuotaExceeded(c, quotaErr)
+				return c.Error(429, quotaErr)
+			}
+
+			body := &countingReader{body: c.Request().Body, quotas: quotas, clientKeys: clientKeys}
+			c.Request().Body = body
+			usage := &uploadUsage{quotas: quotas, clientKeys: clientKeys, body: body}
+			c.Set(uploadUsageKey, usage)
+
+			err := next(c)
+
+			// a handler which could not read the body because of the quota only returns the read error
+			if err != nil && body.quotaErr != nil {
+				IsUploadQuotaExceeded(c, body.quotaErr)
+				err = c.Error(429, body.quotaErr)
+			}
+
+			if usage.createdSessionID != "" {
+				sessionID = usage.createdSessionID
+			}
+			// a handler which rejects the request may not read all of its body
+			numBytes := body.bytesRead
+			if c.Request().ContentLength > numBytes {
+				numBytes = c.Request().ContentLength
+			}
+			quotas.record(clientKeys, sessionID, usage.numChunks, numBytes, time.Now())
+			return err
+		}
+	}
+}
+
+/*RecordUploadSessionCreated counts the new session towards the quota of the client.*/
+func RecordUploadSessionCreated(c buffalo.Context, sessionID string) {
+	if usage, ok := c.Value(uploadUsageKey).(*uploadUsage); ok {
+		usage.createdSessionID = sessionID
+	}
+}
+
+/*RecordChunksReceived counts the chunks of the upload request towards the quota of the client.*/
+func RecordChunksReceived(c buffalo.Context, numChunks int) {
+	if usage, ok := c.Value(uploadUsageKey).(*uploadUsage); ok {
+		usage.numChunks += numChunks
+	}
+}
+
+/*CheckUploadQuota returns an *UploadQuotaError if the chunks recorded and the bytes read so far put the client
+over its chunks per minute or bytes per day.  Handlers which store the chunks of a request in batches call it
+after each batch.*/
+func CheckUploadQuota(c buffalo.Context) error {
+	usage, ok := c.Value(uploadUsageKey).(*uploadUsage)
+	if !ok {
+		return nil
+	}
+	if quotaErr := usage.quotas.check(usage.clientKeys, usage.numChunks, usage.body.bytesRead,
+		time.Now()); quotaErr != nil {
+		return quotaErr
+	}
+	return nil
+}
+
+/*IsUploadQuotaExceeded returns whether err is an *UploadQuotaError.  If it is, the rejection is counted, once per
+request, and the Retry-After header of the response is set.*/
+func IsUploadQuotaExceeded(c buffalo.Context, err error) bool {
+	quotaErr, ok := err.(*UploadQuotaError)
+	if !ok {
+		return false
+	}
+	usage, hasUsage := c.Value(uploadUsageKey).(*uploadUsage)
+	if !hasUsage || !usage.isRejectionCounted {
+		services.PrometheusWrapper.CounterIncrement(services.PrometheusWrapper.CounterUploadQuotaRejections,
+			quotaErr.Quota)
+	}
+	if hasUsage {
+		usage.isRejectionCounted = true
+	}
+	c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(quotaErr.RetryAfter.Seconds()))))
+	return true
+}
+
+func (e *UploadQuotaError) Error() string {
+	return fmt.Sprintf("upload quota %v exceeded, try again in %v", e.Quota, e.RetryAfter.Round(time.Second))
+}
+
+/*admit checks the quotas of the clients before an upload request.  sessionID is empty for requests which create a
+session.  Returns the exceeded quota, or nil.*/
+func (q *UploadQuotas) admit(clientKeys []string, sessionID string, contentLength int64,
+	now time.Time) *UploadQuotaError {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.prune(now)
+
+	// the length is -1 when it is not known up front, the bytes are still counted once they are read
+	requestBytes := contentLength
+	if requestBytes < 0 {
+		requestBytes = 0
+	}
+
+	for _, key := range clientKeys {
+		usage := q.getClientUsage(key, now)
+
+		if _, isActive := usage.sessions[sessionID]; q.config.MaxSessions > 0 && (sessionID == "" || !isActive) &&
+			len(usage.sessions) >= q.config.MaxSessions {
+			return &UploadQuotaError{QuotaSessions, usage.nextSessionIdleAt(q.config.SessionIdleTimeout).Sub(now)}
+		}
+		if sessionID == "" {
+			continue
+		}
+		if q.config.MaxChunksPerMinute > 0 && usage.chunks >= q.config.MaxChunksPerMinute {
+			return &UploadQuotaError{QuotaChunksPerMinute, usage.chunksWindowStart.Add(time.Minute).Sub(now)}
+		}
+		if q.config.MaxBytesPerDay > 0 && usage.bytes+requestBytes > q.config.MaxBytesPerDay {
+			return &UploadQuotaError{QuotaBytesPerDay, usage.bytesWindowStart.Add(24 * time.Hour).Sub(now)}
+		}
+	}
+
+	// concurrent requests to a new session count as one session as soon as the first is admitted
+	if sessionID != "" {
+		for _, key := range clientKeys {
+			q.clients[key].sessions[sessionID] = now
+		}
+	}
+	return nil
+}
+
+/*check returns the exceeded quota if the chunks and bytes of a request which is still being read put the clients
+over their chunks per minute or bytes per day, or nil.*/
+func (q *UploadQuotas) check(clientKeys []string, numChunks int, numBytes int64, now time.Time) *UploadQuotaError {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for _, key := range clientKeys {
+		usage := q.getClientUsage(key, now)
+		if q.config.MaxChunksPerMinute > 0 && usage.chunks+numChunks > q.config.MaxChunksPerMinute {
+			return &UploadQuotaError{QuotaChunksPerMinute, usage.chunksWindowStart.Add(time.Minute).Sub(now)}
+		}
+		if q.config.MaxBytesPerDay > 0 && usage.bytes+numBytes > q.config.MaxBytesPerDay {
+			return &UploadQuotaError{QuotaBytesPerDay, usage.bytesWindowStart.Add(24 * time.Hour).Sub(now)}
+		}
+	}
+	return nil
+}
+
+/*record counts what an upload request used towards the quotas of the clients.*/
+func (q *UploadQuotas) record(clientKeys []string, sessionID string, numChunks int, numBytes int64, now time.Time) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for _, key := range clientKeys {
+		usage := q.getClientUsage(key, now)
+		if sessionID != "" {
+			usage.sessions[sessionID] = now
+		}
+		usage.chunks += numChunks
+		usage.bytes += numBytes
+	}
+}
+
+/*getClientUsage returns the usage of the client, starting new windows and dropping idle sessions.*/
+func (q *UploadQuotas) getClientUsage(key string, now time.Time) *clientUsage {
+	usage, ok := q.clients[key]
+	if !ok {
+		usage = &clientUsage{sessions: make(map[string]time.Time)}
+		q.clients[key] = usage
+	}
+
+	for sessionID, lastUsed := range usage.sessions {
+		if now.Sub(lastUsed) >= q.config.SessionIdleTimeout {
+			delete(usage.sessions, sessionID)
+		}
+	}
+	if now.Sub(usage.chunksWindowStart) >= time.Minute {
+		usage.chunksWindowStart = now
+		usage.chunks = 0
+	}
+	if now.Sub(usage.bytesWindowStart) >= 24*time.Hour {
+		usage.bytesWindowStart = now
+		usage.bytes = 0
+	}
+	return usage
+}
+
+/*prune forgets the clients which have no active session and nothing left to count, at most once a minute.*/
+func (q *UploadQuotas) prune(now time.Time) {
+	if now.Sub(q.lastPrune) < time.Minute {
+		return
+	}
+	q.lastPrune = now
+
+	for key := range q.clients {
+		usage := q.getClientUsage(key, now)
+		if len(usage.sessions) == 0 && usage.chunks == 0 && usage.bytes == 0 {
+			delete(q.clients, key)
+		}
+	}
+}
+
+/*getClientKeys returns the keys the quotas of the client who sent the request are tracked by, which is only its IP.*/
+func (q *UploadQuotas) getClientKeys(req *http.Request) []string {
+	ip := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		ip = host
+	}
+	if forwardedFor := req.Header.Get("X-Forwarded-For"); q.config.TrustForwardedFor && forwardedFor != "" {
+		ip = strings.TrimSpace(strings.Split(forwardedFor, ",")[0])
+	}
+
+	return []string{"ip:" + ip}
+}
+
+func (usage *clientUsage) nextSessionIdleAt(idleTimeout time.Duration) time.Time {
+	var next time.Time
+	for _, lastUsed := range usage.sessions {
+		if idleAt := lastUsed.Add(idleTimeout); next.IsZero() || idleAt.Before(next) {
+			next = idleAt
+		}
+	}
+	return next
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	if r.quotaErr != nil {
+		return 0, r.quotaErr
+	}
+
+	n, err := r.body.Read(p)
+	r.bytesRead += int64(n)
+	// the length of a request may not be known up front, so the bytes are checked while they are read
+	quotaErr := r.quotas.check(r.clientKeys, 0, r.bytesRead, time.Now())
+	if quotaErr != nil && quotaErr.Quota == QuotaBytesPerDay {
+		r.quotaErr = quotaErr
+		return n, quotaErr
+	}
+	return n, err
+}
+
+func (r *countingReader) Close() error {
+	return r.body.Close()
+}
+
+/*getUploadRequest returns whether the request creates a session or uploads chunks to one, and the id of the
+session it uploads to.*/
+func getUploadRequest(req *http.Request) (string, bool) {
+	match := uploadSessionPath.FindStringSubmatch(req.URL.Path)
+	if match == nil {
+		return "", false
+	}
+
+	sessionID := match[1]
+	switch {
+	case req.Method == http.MethodPost && sessionID == "":
+		return "", true
+	case req.Method == http.MethodPut && sessionID != "" && sessionID != "beta":
+		return sessionID, true
+	}
+	return "", false
+}
+
+/*getQuotaEnv parses the env var as a non-negative number, or returns 0 (unlimited) if it is not set or not valid.*/
+func getQuotaEnv(envName string) int64 {
+	v := os.Getenv(envName)
+	if v == "" {
+		return 0
+	}
+	value, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || value < 0 {
+		oyster_utils.LogIfError(fmt.Errorf("invalid %v: %v", envName, v), nil)
+		return 0
+	}
+	return value
+}
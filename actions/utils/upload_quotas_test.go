@@ -0,0 +1,158 @@
+package actions_utils_test
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/x/sessions"
+	"github.com/oysterprotocol/brokernode/actions/utils"
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/utils"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func Test_UploadQuotaMiddleware_MaxSessions(t *testing.T) {
+	app := newUploadQuotaTestApp(actions_utils.UploadQuotaConfig{
+		MaxSessions:        1,
+		SessionIdleTimeout: time.Minute,
+	})
+
+	oyster_utils.AssertTrue(sendUploadRequest(app, "POST", "/api/v3/upload-sessions", "", "1.1.1.1") == 200, t,
+		"the first session should be created")
+	oyster_utils.AssertTrue(sendUploadRequest(app, "PUT", "/api/v3/upload-sessions/new-session", "ABC",
+		"1.1.1.1") == 202, t, "chunks should be accepted for the created session")
+	oyster_utils.AssertTrue(sendUploadRequest(app, "POST", "/api/v3/upload-sessions", "", "1.1.1.1") == 429, t,
+		"a second session should be rejected")
+	oyster_utils.AssertTrue(sendUploadRequest(app, "PUT", "/api/v3/upload-sessions/other-session", "ABC",
+		"1.1.1.1") == 429, t, "chunks for a second session should be rejected")
+	oyster_utils.AssertTrue(sendUploadRequest(app, "POST", "/api/v3/upload-sessions", "", "2.2.2.2") == 200, t,
+		"other clients should not be limited")
+	oyster_utils.AssertTrue(sendUploadRequest(app, "POST", "/api/v3/upload-sessions/beta", "", "1.1.1.1") == 200,
+		t, "beta sessions should not be limited")
+}
+
+func Test_UploadQuotaMiddleware_ChunksPerMinute(t *testing.T) {
+	app := newUploadQuotaTestApp(actions_utils.UploadQuotaConfig{
+		MaxChunksPerMinute: 5,
+		SessionIdleTimeout: time.Minute,
+	})
+
+	// each request has 3 chunks, which the v2 handler checks once they are stored
+	oyster_utils.AssertTrue(sendUploadRequest(app, "PUT", "/api/v2/upload-sessions/1", "ABC", "1.1.1.1") == 202,
+		t, "")
+	oyster_utils.AssertTrue(sendUploadRequest(app, "PUT", "/api/v2/upload-sessions/1", "ABC", "1.1.1.1") == 429,
+		t, "chunks over the quota should be rejected while the request is handled")
+	oyster_utils.AssertTrue(sendUploadRequest(app, "PUT", "/api/v2/upload-sessions/1", "ABC", "1.1.1.1") == 429,
+		t, "chunks over the quota should be rejected")
+}
+
+func Test_UploadQuotaMiddleware_BytesPerDay(t *testing.T) {
+	app := newUploadQuotaTestApp(actions_utils.UploadQuotaConfig{
+		MaxBytesPerDay:     5,
+		SessionIdleTimeout: time.Minute,
+	})
+
+	oyster_utils.AssertTrue(sendUploadRequest(app, "PUT", "/api/v3/upload-sessions/1", "ABCD", "1.1.1.1") == 202,
+		t, "")
+
+	res := httptest.NewRecorder()
+	req := httptest.NewRequest("PUT", "/api/v3/upload-sessions/2", strings.NewReader("ABCD"))
+	req.RemoteAddr = "1.1.1.1:1234"
+	app.ServeHTTP(res, req)
+	oyster_utils.AssertTrue(res.Code == 429, t, "bytes over the quota should be rejected")
+	oyster_utils.AssertTrue(res.Header().Get("Retry-After") != "", t, "")
+
+	oyster_utils.AssertTrue(sendUploadRequest(app, "PUT", "/api/v3/upload-sessions/1", "ABCD", "2.2.2.2") == 202,
+		t, "other clients should not be limited")
+}
+
+func Test_UploadQuotaMiddleware_BytesPerDayUnknownLength(t *testing.T) {
+	app := newUploadQuotaTestApp(actions_utils.UploadQuotaConfig{
+		MaxBytesPerDay:     5,
+		SessionIdleTimeout: time.Minute,
+	})
+
+	// the bytes are checked while the body is read
+	res := httptest.NewRecorder()
+	req := httptest.NewRequest("PUT", "/api/v3/upload-sessions/1", strings.NewReader("ABCDEFGH"))
+	req.ContentLength = -1
+	app.ServeHTTP(res, req)
+	oyster_utils.AssertTrue(res.Code == 429, t, "bytes over the quota should be rejected")
+}
+
+func Test_UploadQuotaMiddleware_RejectionCountedOnce(t *testing.T) {
+	app := newUploadQuotaTestApp(actions_utils.UploadQuotaConfig{
+		MaxBytesPerDay:     5,
+		SessionIdleTimeout: time.Minute,
+	})
+
+	counterIncrement := services.PrometheusWrapper.CounterIncrement
+	defer func() { services.PrometheusWrapper.CounterIncrement = counterIncrement }()
+	numRejections := 0
+	services.PrometheusWrapper.CounterIncrement = func(counter *prometheus.CounterVec, labelValues ...string) {
+		numRejections++
+	}
+
+	// the handler counts the rejection of the read, and the middleware does not count it again
+	res := httptest.NewRecorder()
+	req := httptest.NewRequest("PUT", "/api/v2/upload-sessions/framed", strings.NewReader("ABCDEFGH"))
+	req.ContentLength = -1
+	app.ServeHTTP(res, req)
+	oyster_utils.AssertTrue(res.Code == 429, t, "bytes over the quota should be rejected")
+	oyster_utils.AssertTrue(numRejections == 1, t, "the rejection should be counted once")
+}
+
+func newUploadQuotaTestApp(config actions_utils.UploadQuotaConfig) *buffalo.App {
+	app := buffalo.New(buffalo.Options{
+		SessionStore: sessions.Null{},
+		WorkerOff:    true,
+	})
+	app.Use(actions_utils.UploadQuotaMiddleware(actions_utils.NewUploadQuotas(config)))
+
+	create := func(c buffalo.Context) error {
+		actions_utils.RecordUploadSessionCreated(c, "new-session")
+		return c.Render(200, actions_utils.Render.JSON(map[string]bool{"success": true}))
+	}
+	// stores the chunks in one batch and checks the quota after it
+	updateV2 := func(c buffalo.Context) error {
+		actions_utils.RecordChunksReceived(c, 3)
+		if err := actions_utils.CheckUploadQuota(c); actions_utils.IsUploadQuotaExceeded(c, err) {
+			return c.Error(429, err)
+		}
+		return c.Render(202, actions_utils.Render.JSON(map[string]bool{"success": true}))
+	}
+	// reads the body before storing the chunks
+	updateV3 := func(c buffalo.Context) error {
+		if _, err := ioutil.ReadAll(c.Request().Body); err != nil {
+			return c.Error(400, err)
+		}
+		actions_utils.RecordChunksReceived(c, 3)
+		return c.Render(202, actions_utils.Render.JSON(map[string]bool{"success": true}))
+	}
+	app.POST("/api/v2/upload-sessions", create)
+	app.POST("/api/v3/upload-sessions", create)
+	app.POST("/api/v3/upload-sessions/beta", create)
+	// reads the body and rejects the request itself when the read is over the quota
+	updateFramed := func(c buffalo.Context) error {
+		if _, err := ioutil.ReadAll(c.Request().Body); actions_utils.IsUploadQuotaExceeded(c, err) {
+			return c.Error(429, err)
+		}
+		return c.Render(202, actions_utils.Render.JSON(map[string]bool{"success": true}))
+	}
+	app.PUT("/api/v2/upload-sessions/framed", updateFramed)
+	app.PUT("/api/v2/upload-sessions/{id}", updateV2)
+	app.PUT("/api/v3/upload-sessions/{id}", updateV3)
+	return app
+}
+
+func sendUploadRequest(app *buffalo.App, method string, url string, body string, ip string) int {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	req.RemoteAddr = ip + ":1234"
+	res := httptest.NewRecorder()
+	app.ServeHTTP(res, req)
+	return res.Code
+}
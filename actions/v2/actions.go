@@ -3,6 +3,7 @@ package actions_v2
 import (
 	"github.com/gobuffalo/buffalo"
 	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/services/blobstore"
 	"github.com/oysterprotocol/brokernode/utils/eth_gateway"
 )
 
@@ -10,6 +11,7 @@ import (
 var IotaWrapper = services.IotaWrapper
 var EthWrapper = eth_gateway.EthWrapper
 var PrometheusWrapper = services.PrometheusWrapper
+var BlobStore = blobstore.Store
 
 func RegisterApi(app *buffalo.App) *buffalo.App {
 	apiV2 := app.Group("/api/v2")
@@ -20,6 +22,28 @@ func RegisterApi(app *buffalo.App) *buffalo.App {
 	apiV2.PUT("upload-sessions/{id}", uploadSessionResourceV2.Update)
 	apiV2.POST("upload-sessions/beta", uploadSessionResourceV2.CreateBeta)
 	apiV2.GET("upload-sessions/{id}", uploadSessionResourceV2.GetPaymentStatus)
+	apiV2.DELETE("upload-sessions/{id}", uploadSessionResourceV2.Delete)
+
+	// Quotes, so clients know what an upload costs before they start it
+	quoteResource := QuoteResource{}
+	apiV2.POST("quote", quoteResource.Create)
+
+	// Session progress, which the alpha and beta brokers of a session ask each other for
+	sessionProgressResource := SessionProgressResource{}
+	apiV2.GET("session-progress/{genesisHash}", sessionProgressResource.Get)
+
+	// Brokernodes, which announce themselves to each other
+	brokernodeResource := BrokernodeResource{}
+	apiV2.GET("brokernodes", brokernodeResource.List)
+	apiV2.POST("brokernodes", brokernodeResource.Create)
+
+	// Verification reports
+	verificationReportResource := VerificationReportResource{}
+	apiV2.GET("verification-reports/{genesisHash}", verificationReportResource.Get)
+
+	// Downloads
+	downloadResource := DownloadResource{}
+	apiV2.GET("downloads/{genesisHash}", downloadResource.Get)
 
 	// Webnodes
 	webnodeResource := WebnodeResource{}
@@ -0,0 +1,110 @@
+package actions_v2
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/oysterprotocol/brokernode/actions/utils"
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+/*BrokernodeResource is the registry of the brokers this broker knows about.*/
+type BrokernodeResource struct {
+	buffalo.Resource
+}
+
+// Request Response structs
+
+type brokernodeRes struct {
+	Address    string    `json:"address"`
+	APIURL     string    `json:"apiUrl"`
+	ETHAddress string    `json:"ethAddress"`
+	Capacity   int       `json:"capacity"`
+	Version    string    `json:"version"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+}
+
+type brokernodeListRes struct {
+	Brokernodes []brokernodeRes `json:"brokernodes"`
+}
+
+/*List returns the brokers which passed their last health check, so that clients can pick a beta broker.*/
+func (br *BrokernodeResource) List(c buffalo.Context) error {
+	start := PrometheusWrapper.TimeNow()
+	defer PrometheusWrapper.HistogramSeconds(PrometheusWrapper.HistogramBrokernodeResourceList, start)
+
+	brokernodes, err := models.GetActiveBrokernodes()
+	if err != nil {
+		return c.Error(500, err)
+	}
+
+	res := brokernodeListRes{Brokernodes: []brokernodeRes{}}
+	for _, brokernode := range brokernodes {
+		res.Brokernodes = append(res.Brokernodes, getBrokernodeRes(brokernode))
+	}
+
+	return c.Render(200, actions_utils.Render.JSON(res))
+}
+
+/*Create adds the broker which signed the request to the registry, or updates what it announced before.  The broker
+is listed once it passes a health check.*/
+func (br *BrokernodeResource) Create(c buffalo.Context) error {
+	start := PrometheusWrapper.TimeNow()
+	defer PrometheusWrapper.HistogramSeconds(PrometheusWrapper.HistogramBrokernodeResourceCreate, start)
+
+	ethAddress, err := actions_utils.VerifyBrokerSignature(c)
+	if err != nil {
+		return c.Error(401, err)
+	}
+
+	req := models.BrokernodeAnnouncement{}
+	if err := oyster_utils.ParseReqBody(c.Request(), &req); err != nil {
+		return c.Error(400, fmt.Errorf("Invalid request, unable to parse request body  %v", err))
+	}
+	if !isBrokernodeURL(req.Address) || (req.APIURL != "" && !isBrokernodeURL(req.APIURL)) {
+		return c.Error(400, errors.New("address and apiUrl must be http or https URLs"))
+	}
+	if req.Capacity < 0 {
+		return c.Error(400, errors.New("capacity can't be negative"))
+	}
+
+	announcement := models.Brokernode{
+		Address:    req.Address,
+		ETHAddress: nulls.NewString(ethAddress),
+		Capacity:   req.Capacity,
+	}
+	if req.APIURL != "" {
+		announcement.APIURL = nulls.NewString(req.APIURL)
+	}
+	if req.Version != "" {
+		announcement.Version = nulls.NewString(req.Version)
+	}
+
+	brokernode, err := models.AnnounceBrokernode(announcement)
+	if err != nil {
+		return c.Error(500, err)
+	}
+
+	return c.Render(200, actions_utils.Render.JSON(getBrokernodeRes(brokernode)))
+}
+
+func getBrokernodeRes(brokernode models.Brokernode) brokernodeRes {
+	return brokernodeRes{
+		Address:    brokernode.Address,
+		APIURL:     brokernode.GetAPIURL(),
+		ETHAddress: brokernode.ETHAddress.String,
+		Capacity:   brokernode.Capacity,
+		Version:    brokernode.Version.String,
+		LastSeenAt: brokernode.LastSeenAt.Time,
+	}
+}
+
+func isBrokernodeURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
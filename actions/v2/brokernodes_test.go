@@ -0,0 +1,73 @@
+package actions_v2
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/utils/eth_gateway"
+)
+
+func (suite *ActionSuite) Test_BrokernodesCreate() {
+	os.Setenv(models.BrokernodeAllowlistEnv, eth_gateway.MainWalletAddress.Hex())
+	defer os.Unsetenv(models.BrokernodeAllowlistEnv)
+
+	res := postSignedBrokerRequest(suite, "/api/v2/brokernodes", map[string]interface{}{
+		"address":  "http://1.2.3.4:3000",
+		"apiUrl":   "https://broker.example.com/",
+		"capacity": 1000,
+		"version":  "1.0.0",
+	})
+	suite.Equal(200, res.Code)
+
+	brokernodes := []models.Brokernode{}
+	suite.Nil(suite.DB.All(&brokernodes))
+	suite.Equal(1, len(brokernodes))
+	suite.Equal(models.BrokernodePending, brokernodes[0].Status)
+	suite.Equal("https://broker.example.com", brokernodes[0].GetAPIURL())
+	suite.Equal(1000, brokernodes[0].Capacity)
+	suite.True(brokernodes[0].ETHAddress.Valid)
+
+	// pending brokers are not listed until they pass a health check
+	res = suite.JSON("/api/v2/brokernodes").Get()
+	suite.Equal(200, res.Code)
+	listRes := brokernodeListRes{}
+	suite.Nil(json.Unmarshal(res.Body.Bytes(), &listRes))
+	suite.Equal(0, len(listRes.Brokernodes))
+
+	suite.Nil(brokernodes[0].UpdateHealth(true, time.Hour, time.Now()))
+
+	res = suite.JSON("/api/v2/brokernodes").Get()
+	suite.Equal(200, res.Code)
+	suite.Nil(json.Unmarshal(res.Body.Bytes(), &listRes))
+	suite.Equal(1, len(listRes.Brokernodes))
+	suite.Equal("http://1.2.3.4:3000", listRes.Brokernodes[0].Address)
+	suite.Equal("1.0.0", listRes.Brokernodes[0].Version)
+}
+
+func (suite *ActionSuite) Test_BrokernodesCreate_Unapproved() {
+	res := postSignedBrokerRequest(suite, "/api/v2/brokernodes", map[string]interface{}{
+		"address": "http://1.2.3.4:3000",
+	})
+	suite.Equal(200, res.Code)
+
+	brokernodes := []models.Brokernode{}
+	suite.Nil(suite.DB.All(&brokernodes))
+	suite.Equal(1, len(brokernodes))
+	suite.Equal(models.BrokernodeUnapproved, brokernodes[0].Status)
+}
+
+func (suite *ActionSuite) Test_BrokernodesCreate_InvalidAddress() {
+	res := postSignedBrokerRequest(suite, "/api/v2/brokernodes", map[string]interface{}{
+		"address": "1.2.3.4",
+	})
+	suite.Equal(400, res.Code)
+}
+
+func (suite *ActionSuite) Test_BrokernodesCreate_Unsigned() {
+	res := suite.JSON("/api/v2/brokernodes").Post(map[string]interface{}{
+		"address": "http://1.2.3.4:3000",
+	})
+	suite.Equal(401, res.Code)
+}
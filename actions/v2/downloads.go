@@ -0,0 +1,172 @@
+package actions_v2
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/iotaledger/iota.go/transaction"
+	"github.com/iotaledger/iota.go/trinary"
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+const (
+	/*MaxChunksPerDownload is the max number of chunks which can be requested at once.*/
+	MaxChunksPerDownload = 10000
+	/*MaxStartIdxOfUnknownFile limits how far the hash chain is followed for a file whose data maps the broker does
+	not have.*/
+	MaxStartIdxOfUnknownFile = 100000
+)
+
+/*DownloadResource lets clients use the broker as a gateway to download files from the tangle.*/
+type DownloadResource struct {
+	buffalo.Resource
+}
+
+// Response structs
+
+type downloadChunkRes struct {
+	Idx     int64  `json:"idx"`
+	Found   bool   `json:"found"`
+	Message string `json:"message,omitempty"`
+}
+
+type downloadErrorRes struct {
+	Error string `json:"error"`
+}
+
+/*Get streams the chunks from startIdx to endIdx of the file with the genesis hash in index order, one JSON object
+per line.  The messages are returned as they are on the tangle, so they are still encrypted.*/
+func (d *DownloadResource) Get(c buffalo.Context) error {
+	start := PrometheusWrapper.TimeNow()
+	defer PrometheusWrapper.HistogramSeconds(PrometheusWrapper.HistogramDownloadResourceGet, start)
+
+	startIdx, err := strconv.ParseInt(c.Param("startIdx"), 10, 64)
+	if err != nil || startIdx < 0 {
+		return c.Error(400, errors.New("startIdx must be a non-negative integer"))
+	}
+	endIdx, err := strconv.ParseInt(c.Param("endIdx"), 10, 64)
+	if err != nil || endIdx < startIdx {
+		return c.Error(400, errors.New("endIdx must be an integer no less than startIdx"))
+	}
+	if endIdx-startIdx+1 > MaxChunksPerDownload {
+		return c.Error(400, fmt.Errorf("at most %v chunks can be requested at once", MaxChunksPerDownload))
+	}
+
+	genesisHash := c.Param("genesisHash")
+	numChunks, err := models.GetNumChunksOfGenesisHash(genesisHash)
+	if err != nil {
+		oyster_utils.LogIfError(err, nil)
+		return c.Error(500, err)
+	}
+
+	var addresses []string
+	hasDataMaps := false
+	if numChunks > 0 {
+		if startIdx >= int64(numChunks) {
+			return c.Error(400, fmt.Errorf("startIdx must be less than the %v chunks of the file", numChunks))
+		}
+		if endIdx >= int64(numChunks) {
+			endIdx = int64(numChunks) - 1
+		}
+
+		addresses, hasDataMaps, err = models.GetDataMapAddresses(genesisHash, startIdx, endIdx)
+		if err != nil {
+			return c.Error(500, err)
+		}
+	}
+	if !hasDataMaps {
+		// anyone can make the broker follow the hash chain, so only its first chunks are allowed
+		if startIdx > MaxStartIdxOfUnknownFile {
+			return c.Error(400, fmt.Errorf("startIdx must be at most %v", MaxStartIdxOfUnknownFile))
+		}
+		addresses, err = oyster_utils.ComputeChunkAddresses(genesisHash, startIdx, int(endIdx-startIdx+1))
+		if err != nil {
+			return c.Error(400, err)
+		}
+	}
+
+	res := c.Response()
+	res.Header().Set("Content-Type", "application/x-ndjson")
+	res.WriteHeader(200)
+	encoder := json.NewEncoder(res)
+
+	for i := 0; i < len(addresses); i += services.MaxNumberOfAddressPerFindTransactionRequest {
+		end := i + services.MaxNumberOfAddressPerFindTransactionRequest
+		if end > len(addresses) {
+			end = len(addresses)
+		}
+
+		hashes := make([]trinary.Hash, end-i)
+		for j, address := range addresses[i:end] {
+			hashes[j] = trinary.Hash(address)
+		}
+
+		transactionsMap, err := IotaWrapper.FindTransactions(hashes)
+		if err != nil {
+			// the status has already been sent, so the error ends the stream instead
+			oyster_utils.LogIfError(err, nil)
+			return encoder.Encode(downloadErrorRes{Error: err.Error()})
+		}
+
+		for j, hash := range hashes {
+			chunk := downloadChunkRes{Idx: startIdx + int64(i+j)}
+			if transactions := transactionsMap[hash]; len(transactions) > 0 {
+				chunk.Found = true
+				chunk.Message = string(selectChunkTransaction(transactions).SignatureMessageFragment)
+			}
+			if err := encoder.Encode(chunk); err != nil {
+				// the client went away
+				return nil
+			}
+		}
+
+		if flusher, ok := res.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+	return nil
+}
+
+/*selectChunkTransaction picks the transaction of a chunk from those at its address.  Anyone can send transactions
+to the address, so the latest one attached by a broker is preferred, else the latest one.*/
+func selectChunkTransaction(transactions []transaction.Transaction) transaction.Transaction {
+	selected := -1
+	for i, t := range transactions {
+		if !isOysterTransaction(t) {
+			continue
+		}
+		if selected == -1 || isAttachedLater(t, transactions[selected]) {
+			selected = i
+		}
+	}
+	if selected != -1 {
+		return transactions[selected]
+	}
+
+	selected = 0
+	for i, t := range transactions {
+		if isAttachedLater(t, transactions[selected]) {
+			selected = i
+		}
+	}
+	return transactions[selected]
+}
+
+func isOysterTransaction(t transaction.Transaction) bool {
+	return strings.HasPrefix(string(t.Tag), string(services.OysterTag)) ||
+		strings.HasPrefix(string(t.Tag), string(services.OysterTagHook))
+}
+
+func isAttachedLater(t transaction.Transaction, other transaction.Transaction) bool {
+	if t.AttachmentTimestamp != other.AttachmentTimestamp {
+		return t.AttachmentTimestamp > other.AttachmentTimestamp
+	}
+	return t.Timestamp > other.Timestamp
+}
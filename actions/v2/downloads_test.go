@@ -0,0 +1,153 @@
+package actions_v2
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/iotaledger/iota.go/transaction"
+	"github.com/iotaledger/iota.go/trinary"
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+const downloadGenesisHash = "abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789"
+
+func (suite *ActionSuite) Test_Download() {
+	addresses, err := oyster_utils.ComputeChunkAddresses(downloadGenesisHash, 2, 4)
+	suite.Nil(err)
+
+	messages := []trinary.Trytes{"MESSAGEA", "MESSAGEB", "", "MESSAGED"}
+
+	IotaWrapper = services.IotaService{
+		FindTransactions: func(hashes []trinary.Hash) (map[trinary.Hash][]transaction.Transaction, error) {
+			suite.Equal(len(addresses), len(hashes))
+			transactionsMap := make(map[trinary.Hash][]transaction.Transaction)
+			for i, hash := range hashes {
+				suite.Equal(trinary.Hash(addresses[i]), hash)
+				// the chunk at index 4 is missing from the tangle
+				if messages[i] != "" {
+					transactionsMap[hash] = []transaction.Transaction{{
+						Address:                  hash,
+						SignatureMessageFragment: messages[i],
+					}}
+				}
+			}
+			return transactionsMap, nil
+		},
+	}
+
+	res := suite.JSON("/api/v2/downloads/" + downloadGenesisHash + "?startIdx=2&endIdx=5").Get()
+	suite.Equal(200, res.Code)
+
+	chunks := []downloadChunkRes{}
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		chunk := downloadChunkRes{}
+		suite.Nil(json.Unmarshal(scanner.Bytes(), &chunk))
+		chunks = append(chunks, chunk)
+	}
+
+	suite.Equal(len(addresses), len(chunks))
+	suite.Equal(downloadChunkRes{Idx: 2, Found: true, Message: "MESSAGEA"}, chunks[0])
+	suite.Equal(downloadChunkRes{Idx: 3, Found: true, Message: "MESSAGEB"}, chunks[1])
+	suite.Equal(downloadChunkRes{Idx: 4, Found: false}, chunks[2])
+	suite.Equal(downloadChunkRes{Idx: 5, Found: true, Message: "MESSAGED"}, chunks[3])
+}
+
+func (suite *ActionSuite) Test_Download_TangleError() {
+	IotaWrapper = services.IotaService{
+		FindTransactions: func(hashes []trinary.Hash) (map[trinary.Hash][]transaction.Transaction, error) {
+			return nil, errors.New("node unavailable")
+		},
+	}
+
+	res := suite.JSON("/api/v2/downloads/" + downloadGenesisHash + "?startIdx=0&endIdx=1").Get()
+	suite.Equal(200, res.Code)
+
+	errRes := downloadErrorRes{}
+	suite.Nil(json.Unmarshal(res.Body.Bytes(), &errRes))
+	suite.Equal("node unavailable", errRes.Error)
+}
+
+func (suite *ActionSuite) Test_Download_InvalidRange() {
+	res := suite.JSON("/api/v2/downloads/" + downloadGenesisHash + "?startIdx=5&endIdx=2").Get()
+	suite.Equal(400, res.Code)
+
+	res = suite.JSON("/api/v2/downloads/" + downloadGenesisHash + "?startIdx=0&endIdx=10000").Get()
+	suite.Equal(400, res.Code)
+
+	res = suite.JSON("/api/v2/downloads/nothex?startIdx=0&endIdx=1").Get()
+	suite.Equal(400, res.Code)
+}
+
+func (suite *ActionSuite) Test_Download_KnownFile() {
+	session := models.UploadSession{
+		GenesisHash:   downloadGenesisHash,
+		NumChunks:     4,
+		FileSizeBytes: 4000,
+		Type:          models.SessionTypeAlpha,
+	}
+	vErr, err := suite.DB.ValidateAndCreate(&session)
+	suite.Nil(err)
+	suite.False(vErr.HasAny())
+
+	IotaWrapper = services.IotaService{
+		FindTransactions: func(hashes []trinary.Hash) (map[trinary.Hash][]transaction.Transaction, error) {
+			// endIdx is capped to the last chunk of the file
+			suite.Equal(2, len(hashes))
+			return map[trinary.Hash][]transaction.Transaction{}, nil
+		},
+	}
+
+	res := suite.JSON("/api/v2/downloads/" + downloadGenesisHash + "?startIdx=2&endIdx=9").Get()
+	suite.Equal(200, res.Code)
+
+	res = suite.JSON("/api/v2/downloads/" + downloadGenesisHash + "?startIdx=4&endIdx=9").Get()
+	suite.Equal(400, res.Code)
+}
+
+func (suite *ActionSuite) Test_Download_UnknownFileStartIdxTooLarge() {
+	res := suite.JSON(fmt.Sprintf("/api/v2/downloads/%v?startIdx=%v&endIdx=%v", downloadGenesisHash,
+		MaxStartIdxOfUnknownFile+1, MaxStartIdxOfUnknownFile+1)).Get()
+	suite.Equal(400, res.Code)
+
+	// a known file without data maps is limited as well
+	session := models.UploadSession{
+		GenesisHash:   downloadGenesisHash,
+		NumChunks:     MaxStartIdxOfUnknownFile + 10,
+		FileSizeBytes: 4000,
+		Type:          models.SessionTypeAlpha,
+	}
+	vErr, err := suite.DB.ValidateAndCreate(&session)
+	suite.Nil(err)
+	suite.False(vErr.HasAny())
+
+	res = suite.JSON(fmt.Sprintf("/api/v2/downloads/%v?startIdx=%v&endIdx=%v", downloadGenesisHash,
+		MaxStartIdxOfUnknownFile+1, MaxStartIdxOfUnknownFile+1)).Get()
+	suite.Equal(400, res.Code)
+}
+
+func (suite *ActionSuite) Test_SelectChunkTransaction() {
+	spam := transaction.Transaction{SignatureMessageFragment: "SPAM", AttachmentTimestamp: 3000}
+	attached := transaction.Transaction{
+		SignatureMessageFragment: "MESSAGE",
+		Tag:                      services.OysterTag + "999999999999999",
+		AttachmentTimestamp:      1000,
+	}
+	reattached := transaction.Transaction{
+		SignatureMessageFragment: "MESSAGE2",
+		Tag:                      services.OysterTag + "999999999999999",
+		AttachmentTimestamp:      2000,
+	}
+
+	suite.Equal("MESSAGE2", string(selectChunkTransaction(
+		[]transaction.Transaction{attached, spam, reattached}).SignatureMessageFragment))
+
+	// without an oyster transaction, the latest one is used
+	older := transaction.Transaction{SignatureMessageFragment: "OLDER", AttachmentTimestamp: 1000}
+	suite.Equal("SPAM", string(selectChunkTransaction(
+		[]transaction.Transaction{older, spam}).SignatureMessageFragment))
+}
@@ -0,0 +1,70 @@
+package actions_v2
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/oysterprotocol/brokernode/actions/utils"
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/utils"
+	"github.com/oysterprotocol/brokernode/utils/eth_gateway"
+)
+
+/*QuoteResource tells clients what an upload costs before they start a session.*/
+type QuoteResource struct {
+	buffalo.Resource
+}
+
+// Request Response structs
+
+type quoteCreateReq struct {
+	FileSizeBytes        uint64 `json:"fileSizeBytes"`
+	StorageLengthInYears int    `json:"storageLengthInYears"`
+}
+
+type quoteCreateRes struct {
+	models.Quote
+	// GasCostInWei is the ETH the brokers spend to pay each other and bury the treasures, out of the storage cost.
+	GasCostInWei string `json:"gasCostInWei"`
+}
+
+/*Create returns the cost of storing a file of the size for the number of years, broken down into the PRL which pays
+the brokers, the PRL buried in treasures, and the ETH gas the brokers spend on it.*/
+func (qr *QuoteResource) Create(c buffalo.Context) error {
+	start := PrometheusWrapper.TimeNow()
+	defer PrometheusWrapper.HistogramSeconds(PrometheusWrapper.HistogramQuoteResourceCreate, start)
+
+	req := quoteCreateReq{}
+	if err := oyster_utils.ParseReqBody(c.Request(), &req); err != nil {
+		return c.Error(400, fmt.Errorf("Invalid request, unable to parse request body  %v", err))
+	}
+	if req.FileSizeBytes == 0 || req.StorageLengthInYears <= 0 {
+		return c.Error(400, errors.New("fileSizeBytes and storageLengthInYears must be greater than 0"))
+	}
+
+	quote := models.GetQuote(req.FileSizeBytes, req.StorageLengthInYears)
+
+	// one PRL payment to the beta broker, then a PRL payment and a bury for the treasure of each sector.  The
+	// sectors are counted with the buried pearls, as GetPRLsPerTreasure does.
+	totalChunks := oyster_utils.GetTotalFileChunkIncludingBuriedPearlsUsingNumChunks(quote.NumChunks)
+	numTreasures := int64(math.Ceil(float64(totalChunks) / float64(oyster_utils.FileSectorInChunkSize)))
+	gasPerPRLSend, err := EthWrapper.CalculateGasNeeded(eth_gateway.GasLimitPRLSend)
+	if err != nil {
+		return c.Error(500, err)
+	}
+	gasPerPRLBury, err := EthWrapper.CalculateGasNeeded(eth_gateway.GasLimitPRLBury)
+	if err != nil {
+		return c.Error(500, err)
+	}
+	gasPerTreasure := new(big.Int).Add(gasPerPRLSend, gasPerPRLBury)
+	gasCost := new(big.Int).Add(gasPerPRLSend, new(big.Int).Mul(gasPerTreasure, big.NewInt(numTreasures)))
+
+	res := quoteCreateRes{
+		Quote:        quote,
+		GasCostInWei: gasCost.String(),
+	}
+	return c.Render(200, actions_utils.Render.JSON(res))
+}
@@ -0,0 +1,57 @@
+package actions_v2
+
+import (
+	"encoding/json"
+	"math/big"
+
+	"github.com/oysterprotocol/brokernode/utils"
+	"github.com/oysterprotocol/brokernode/utils/eth_gateway"
+)
+
+func (suite *ActionSuite) Test_QuotesCreate() {
+	defer func(ethWrapper eth_gateway.Eth) { EthWrapper = ethWrapper }(EthWrapper)
+	EthWrapper = eth_gateway.Eth{
+		CalculateGasNeeded: func(desiredGasLimit uint64) (*big.Int, error) {
+			return new(big.Int).SetUint64(desiredGasLimit), nil
+		},
+	}
+
+	res := suite.JSON("/api/v2/quote").Post(map[string]interface{}{
+		"fileSizeBytes":        123,
+		"storageLengthInYears": 2,
+	})
+	suite.Equal(200, res.Code)
+
+	resParsed := quoteCreateRes{}
+	suite.Nil(json.Unmarshal(res.Body.Bytes(), &resParsed))
+
+	suite.Equal(1, resParsed.NumSectors)
+	suite.Equal("0.03125", resParsed.TotalCost.String())
+	suite.Equal("0.015625", resParsed.TreasureCost.String())
+	suite.Equal("0.015625", resParsed.StorageCost.String())
+	// a payment to beta, then a payment and a bury for the one treasure
+	suite.Equal(big.NewInt(int64(2*eth_gateway.GasLimitPRLSend+eth_gateway.GasLimitPRLBury)).String(),
+		resParsed.GasCostInWei)
+
+	// a full sector of chunks needs a second treasure once its pearls are buried
+	res = suite.JSON("/api/v2/quote").Post(map[string]interface{}{
+		"fileSizeBytes":        (oyster_utils.FileSectorInChunkSize - 1) * oyster_utils.FileChunkSizeInByte,
+		"storageLengthInYears": 2,
+	})
+	suite.Equal(200, res.Code)
+
+	resParsed = quoteCreateRes{}
+	suite.Nil(json.Unmarshal(res.Body.Bytes(), &resParsed))
+
+	suite.Equal(oyster_utils.FileSectorInChunkSize, resParsed.NumChunks)
+	suite.Equal(big.NewInt(int64(3*eth_gateway.GasLimitPRLSend+2*eth_gateway.GasLimitPRLBury)).String(),
+		resParsed.GasCostInWei)
+}
+
+func (suite *ActionSuite) Test_QuotesCreate_InvalidRequest() {
+	res := suite.JSON("/api/v2/quote").Post(map[string]interface{}{
+		"fileSizeBytes":        123,
+		"storageLengthInYears": 0,
+	})
+	suite.Equal(400, res.Code)
+}
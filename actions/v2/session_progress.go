@@ -0,0 +1,48 @@
+package actions_v2
+
+import (
+	"errors"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/oysterprotocol/brokernode/actions/utils"
+	"github.com/oysterprotocol/brokernode/models"
+)
+
+/*SessionProgressResource lets the other broker of an upload session ask how far this broker got attaching it.*/
+type SessionProgressResource struct {
+	buffalo.Resource
+}
+
+/*Get returns the progress of the session with the genesis hash.  Once the session is completed it is reported as
+finished.  The request must be signed by one of the brokers in the brokernodes table.*/
+func (sp *SessionProgressResource) Get(c buffalo.Context) error {
+	start := PrometheusWrapper.TimeNow()
+	defer PrometheusWrapper.HistogramSeconds(PrometheusWrapper.HistogramSessionProgressResourceGet, start)
+
+	if _, err := actions_utils.VerifyBrokerRequest(c); err != nil {
+		return c.Error(401, err)
+	}
+
+	genesisHash := c.Param("genesisHash")
+
+	sessions := []models.UploadSession{}
+	if err := models.DB.Where("genesis_hash = ?", genesisHash).All(&sessions); err != nil {
+		return c.Error(500, err)
+	}
+	if len(sessions) > 0 {
+		return c.Render(200, actions_utils.Render.JSON(sessions[0].GetProgress()))
+	}
+
+	completedCount, err := models.DB.Where("genesis_hash = ?", genesisHash).Count(&models.CompletedUpload{})
+	if err != nil {
+		return c.Error(500, err)
+	}
+	if completedCount == 0 {
+		return c.Error(404, errors.New("no upload session for genesis hash "+genesisHash))
+	}
+
+	return c.Render(200, actions_utils.Render.JSON(models.SessionProgress{
+		GenesisHash: genesisHash,
+		Finished:    true,
+	}))
+}
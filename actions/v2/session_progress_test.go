@@ -0,0 +1,61 @@
+package actions_v2
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+func (suite *ActionSuite) Test_GetSessionProgress() {
+	session := models.UploadSession{
+		GenesisHash:     oyster_utils.RandSeq(6, []rune("abcdef0123456789")),
+		NumChunks:       10,
+		FileSizeBytes:   10000,
+		Type:            models.SessionTypeBeta,
+		NextIdxToAttach: 6,
+		NextIdxToVerify: 9,
+	}
+	vErr, err := suite.DB.ValidateAndCreate(&session)
+	suite.Nil(err)
+	suite.False(vErr.HasAny())
+
+	addSigningBrokernode(suite)
+	res := getSignedBrokerRequest(suite, "/api/v2/session-progress/"+session.GenesisHash)
+	suite.Equal(200, res.Code)
+
+	resParsed := models.SessionProgress{}
+	bodyBytes, err := ioutil.ReadAll(res.Body)
+	suite.Nil(err)
+	suite.Nil(json.Unmarshal(bodyBytes, &resParsed))
+
+	suite.Equal(session.GenesisHash, resParsed.GenesisHash)
+	suite.Equal(models.SessionTypeBeta, resParsed.Type)
+	suite.Equal(10, resParsed.NumChunks)
+	suite.Equal(int64(6), resParsed.NextIdxToAttach)
+	suite.Equal(int64(9), resParsed.NextIdxToVerify)
+	suite.False(resParsed.Finished)
+}
+
+func (suite *ActionSuite) Test_GetSessionProgress_NotFound() {
+	addSigningBrokernode(suite)
+	res := getSignedBrokerRequest(suite,
+		"/api/v2/session-progress/"+oyster_utils.RandSeq(6, []rune("abcdef0123456789")))
+	suite.Equal(404, res.Code)
+}
+
+func (suite *ActionSuite) Test_GetSessionProgress_Unsigned() {
+	res := suite.JSON("/api/v2/session-progress/" + oyster_utils.RandSeq(6, []rune("abcdef0123456789"))).Get()
+	suite.Equal(401, res.Code)
+}
+
+func getSignedBrokerRequest(suite *ActionSuite, url string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", url, nil)
+	suite.Nil(services.SignBrokerRequest(req, nil))
+	res := httptest.NewRecorder()
+	suite.App.ServeHTTP(res, req)
+	return res
+}
@@ -73,7 +73,8 @@ func (usr *TransactionBrokernodeResource) Create(c buffalo.Context) error {
 	dataMap, dataMapNotFoundErr := models.GetChunkForWebnodePoW()
 
 	existingAddresses := oyster_utils.StringsJoin(req.CurrentList, oyster_utils.StringsJoinDelim)
-	brokernodeNotFoundErr := models.DB.Where("address NOT IN (?)", existingAddresses).First(&brokernode)
+	brokernodeNotFoundErr := models.DB.Where("status = ? AND address NOT IN (?)", models.BrokernodeActive,
+		existingAddresses).First(&brokernode)
 
 	// DB results error if First() does not return any error.
 	if dataMapNotFoundErr != nil {
@@ -1,10 +1,9 @@
 package actions_v2
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
 	"github.com/oysterprotocol/brokernode/utils/eth_gateway"
+	"io"
 	"net/http"
 	"os"
 	"strconv"
@@ -14,6 +13,8 @@ import (
 	"github.com/gobuffalo/pop/nulls"
 	"github.com/oysterprotocol/brokernode/actions/utils"
 	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/services/blobstore"
 	"github.com/oysterprotocol/brokernode/utils"
 	"github.com/pkg/errors"
 	"gopkg.in/segmentio/analytics-go.v3"
@@ -34,13 +35,22 @@ type uploadSessionCreateReqV2 struct {
 	AlphaTreasureIndexes []int          `json:"alphaTreasureIndexes"`
 	Invoice              models.Invoice `json:"invoice"`
 	Version              uint32         `json:"version"`
+
+	// N-broker mode.  The client lists the peer brokers, and alpha tells each of them its range of chunks.  All
+	// but the first peer are told the merged treasure indexes.
+	PeerIPs         []string                 `json:"peerIps,omitempty"`
+	Range           *oyster_utils.IndexRange `json:"range,omitempty"`
+	TreasureIndexes []int                    `json:"treasureIndexes,omitempty"`
 }
 
 type uploadSessionCreateResV2 struct {
-	ID            string               `json:"id"`
-	UploadSession models.UploadSession `json:"uploadSession"`
-	BetaSessionID string               `json:"betaSessionId"`
-	Invoice       models.Invoice       `json:"invoice"`
+	ID             string               `json:"id"`
+	UploadSession  models.UploadSession `json:"uploadSession"`
+	BetaSessionID  string               `json:"betaSessionId"`
+	PeerSessionIDs []string             `json:"peerSessionIds,omitempty"`
+	Invoice        models.Invoice       `json:"invoice"`
+	// Sent back in the X-Cancel-Token header to cancel the session.
+	CancelToken string `json:"cancelToken"`
 }
 
 type uploadSessionCreateBetaResV2 struct {
@@ -55,6 +65,12 @@ type UploadSessionUpdateReqV2 struct {
 	Chunks []models.ChunkReq `json:"chunks"`
 }
 
+type uploadSessionUpdateErrResV2 struct {
+	Error           string                 `json:"error"`
+	ChunkErrors     []models.ChunkReqError `json:"chunkErrors"`
+	NumChunksStored int                    `json:"numChunksStored"`
+}
+
 type paymentStatusCreateResV2 struct {
 	ID            string `json:"id"`
 	PaymentStatus string `json:"paymentStatus"`
@@ -62,6 +78,9 @@ type paymentStatusCreateResV2 struct {
 
 var NumChunksLimit = -1 //unlimited
 
+/*MaxNumPeerBrokers is the max number of peer brokers an upload can be spread across, besides alpha.*/
+const MaxNumPeerBrokers = 9
+
 func init() {
 
 }
@@ -97,6 +116,13 @@ func (usr *UploadSessionResourceV2) Create(c buffalo.Context) error {
 		return err
 	}
 
+	if len(req.PeerIPs) > 0 && req.BetaIP != "" {
+		return c.Error(400, errors.New("betaIp and peerIps can't both be set"))
+	}
+	if len(req.PeerIPs) > MaxNumPeerBrokers {
+		return c.Error(400, fmt.Errorf("An upload can be spread across at most %v peer brokers", MaxNumPeerBrokers))
+	}
+
 	alphaEthAddr, privKey, _ := EthWrapper.GenerateEthAddr()
 
 	// Start Alpha Session.
@@ -131,6 +157,12 @@ func (usr *UploadSessionResourceV2) Create(c buffalo.Context) error {
 		}
 	}
 
+	cancelToken, err := alphaSession.NewCancelToken()
+	if err != nil {
+		oyster_utils.LogIfError(err, nil)
+		return c.Error(500, err)
+	}
+
 	vErr, err := alphaSession.StartUploadSession()
 	if err != nil || vErr.HasAny() {
 		err = fmt.Errorf("StartUploadSession error: %v and validation error: %v", err, vErr)
@@ -148,35 +180,28 @@ func (usr *UploadSessionResourceV2) Create(c buffalo.Context) error {
 	// Start Beta Session.
 	var betaSessionID = ""
 	var betaTreasureIndexes []int
+	var peers []models.SessionPeer
 	hasBeta := req.BetaIP != ""
-	if hasBeta {
-		betaReq, err := json.Marshal(req)
-		if err != nil {
-			oyster_utils.LogIfError(err, nil)
-			c.Error(400, err)
-			return err
+	hasPeers := len(req.PeerIPs) > 0
+	if hasPeers {
+		var err error
+		if peers, betaTreasureIndexes, err = startPeerSessions(req, &alphaSession); err != nil {
+			return c.Error(400, err)
 		}
-
-		reqBetaBody := bytes.NewBuffer(betaReq)
-
+	} else if hasBeta {
 		// Should we be hardcoding the port?
 		betaURL := req.BetaIP + ":3000/api/v2/upload-sessions/beta"
-		betaRes, err := http.Post(betaURL, "application/json", reqBetaBody)
-		defer betaRes.Body.Close() // we need to close the connection
-		if err != nil {
-			oyster_utils.LogIfError(err, nil)
-			c.Error(400, err)
-			return err
-		}
 		betaSessionRes := &uploadSessionCreateBetaResV2{}
-		if err := oyster_utils.ParseResBody(betaRes, betaSessionRes); err != nil {
-			err = fmt.Errorf("Unable to communicate with Beta node: %v", err)
+		if err := services.SendSignedBrokerRequest(http.MethodPost, betaURL, req, betaSessionRes); err != nil {
 			// This should consider as BadRequest since the client pick the beta node.
 			c.Error(400, err)
 			return err
 		}
 
 		betaSessionID = betaSessionRes.ID
+		alphaSession.BetaIP = nulls.NewString(req.BetaIP)
+		alphaSession.BetaSessionID = nulls.NewString(betaSessionID)
+		alphaSession.PeerAddress = nulls.NewString(req.BetaIP + ":3000")
 
 		betaTreasureIndexes = betaSessionRes.BetaTreasureIndexes
 		alphaSession.ETHAddrBeta = betaSessionRes.UploadSession.ETHAddrBeta
@@ -188,9 +213,13 @@ func (usr *UploadSessionResourceV2) Create(c buffalo.Context) error {
 		return err
 	}
 
-	models.NewBrokerBrokerTransaction(&alphaSession)
+	if hasPeers {
+		models.NewPeerBrokerBrokerTransactions(&alphaSession, peers)
+	} else {
+		models.NewBrokerBrokerTransaction(&alphaSession)
+	}
 
-	if hasBeta {
+	if hasBeta || hasPeers {
 		mergedIndexes, _ := oyster_utils.MergeIndexes(req.AlphaTreasureIndexes, betaTreasureIndexes,
 			oyster_utils.FileSectorInChunkSize, req.NumChunks)
 
@@ -234,18 +263,76 @@ func (usr *UploadSessionResourceV2) Create(c buffalo.Context) error {
 		ID:            alphaSession.ID.String(),
 		BetaSessionID: betaSessionID,
 		Invoice:       invoice,
+		CancelToken:   cancelToken,
+	}
+	for _, peer := range peers {
+		res.PeerSessionIDs = append(res.PeerSessionIDs, peer.SessionID)
 	}
 	//go waitForTransferAndNotifyBeta(
 	//	res.UploadSession.ETHAddrAlpha.String, res.UploadSession.ETHAddrBeta.String, res.ID)
 
+	actions_utils.RecordUploadSessionCreated(c, res.ID)
 	return c.Render(200, actions_utils.Render.JSON(res))
 }
 
-// Update uploads a chunk associated with an upload session.
+/*startPeerSessions creates the sessions of an N-broker upload on the peer brokers.  The chunks are split into a
+range for alpha and one for each peer, and the alpha session is updated with them.  Returns the peers and the
+treasure indexes of the first peer, which alpha merges with its own like it does with those of beta.  If a peer
+fails, the sessions already created on the other peers are canceled.*/
+func startPeerSessions(req uploadSessionCreateReqV2, alphaSession *models.UploadSession) ([]models.SessionPeer,
+	[]int, error) {
+	if alphaSession.NumChunks < len(req.PeerIPs)+1 {
+		return nil, nil, fmt.Errorf("A file of %v chunks can't be spread across %v brokers", alphaSession.NumChunks,
+			len(req.PeerIPs)+1)
+	}
+
+	ranges := oyster_utils.PartitionIndexes(alphaSession.NumChunks, len(req.PeerIPs)+1)
+	alphaSession.RangeStartIdx = nulls.NewInt64(int64(ranges[0].Start))
+	alphaSession.RangeEndIdx = nulls.NewInt64(int64(ranges[0].End))
+
+	peers := []models.SessionPeer{}
+	var firstPeerTreasureIndexes []int
+	peerReq := req
+	peerReq.PeerIPs = nil
+	for i, peerIP := range req.PeerIPs {
+		peerReq.Range = &ranges[i+1]
+
+		// Should we be hardcoding the port?
+		peerURL := peerIP + ":3000/api/v2/upload-sessions/beta"
+		peerSessionRes := &uploadSessionCreateBetaResV2{}
+		if err := services.SendSignedBrokerRequest(http.MethodPost, peerURL, peerReq, peerSessionRes); err != nil {
+			oyster_utils.LogIfError(actions_utils.CancelPeerSessions(peers, "v2"), nil)
+			return nil, nil, err
+		}
+
+		peers = append(peers, models.SessionPeer{
+			BrokerIP:  peerIP,
+			SessionID: peerSessionRes.ID,
+			ETHAddr:   peerSessionRes.UploadSession.ETHAddrBeta.String,
+			Range:     ranges[i+1],
+		})
+
+		if i == 0 {
+			// the other peers use the treasure indexes alpha and the first peer agree on
+			firstPeerTreasureIndexes = peerSessionRes.BetaTreasureIndexes
+			peerReq.TreasureIndexes, _ = oyster_utils.MergeIndexes(req.AlphaTreasureIndexes, firstPeerTreasureIndexes,
+				oyster_utils.FileSectorInChunkSize, req.NumChunks)
+		}
+	}
+
+	return peers, firstPeerTreasureIndexes, alphaSession.SetPeers(peers)
+}
+
+// Update uploads a chunk associated with an upload session.  The chunks are sent either as JSON or, with the
+// models.ChunkFrameContentType content type, as frames.
 func (usr *UploadSessionResourceV2) Update(c buffalo.Context) error {
 	start := PrometheusWrapper.TimeNow()
 	defer PrometheusWrapper.HistogramSeconds(PrometheusWrapper.HistogramUploadSessionResourceUpdate, start)
 
+	if actions_utils.IsChunkFrameRequest(c) {
+		return updateWithChunkFrames(c)
+	}
+
 	req := UploadSessionUpdateReqV2{}
 	if err := oyster_utils.ParseReqBody(c.Request(), &req); err != nil {
 		err = fmt.Errorf("Invalid request, unable to parse request body  %v", err)
@@ -276,6 +363,13 @@ func (usr *UploadSessionResourceV2) Update(c buffalo.Context) error {
 		return err
 	}
 
+	if chunkErrors := uploadSession.ValidateChunkReqs(req.Chunks); len(chunkErrors) > 0 {
+		return c.Render(400, actions_utils.Render.JSON(uploadSessionUpdateErrResV2{
+			Error:       "Invalid chunks, none of the chunks were stored",
+			ChunkErrors: chunkErrors,
+		}))
+	}
+
 	treasureIdxMap, err := uploadSession.GetTreasureIndexes()
 
 	if oyster_utils.DataMapStorageMode == oyster_utils.DataMapsInBadger {
@@ -303,14 +397,100 @@ func (usr *UploadSessionResourceV2) Update(c buffalo.Context) error {
 			models.DataMapsTimeToLive)
 	}()
 
+	actions_utils.RecordChunksReceived(c, len(req.Chunks))
 	return c.Render(202, actions_utils.Render.JSON(map[string]bool{"success": true}))
 }
 
-// CreateBeta creates an upload session on the beta broker.
+/*updateWithChunkFrames stores the chunks of a framed upload request while they are read, ChunkFrameBatchSize
+chunks at a time, so that the request is never held in memory.*/
+func updateWithChunkFrames(c buffalo.Context) error {
+	uploadSession := &models.UploadSession{}
+	if err := models.DB.Find(uploadSession, c.Param("id")); err != nil {
+		oyster_utils.LogIfError(err, nil)
+		return c.Error(400, err)
+	}
+
+	treasureIdxMap, err := uploadSession.GetTreasureIndexes()
+	if err != nil {
+		oyster_utils.LogIfError(err, nil)
+		return c.Error(500, err)
+	}
+
+	if oyster_utils.DataMapStorageMode == oyster_utils.DataMapsInBadger {
+		dbID := []string{oyster_utils.InProgressDir, uploadSession.GenesisHash, oyster_utils.MessageDir}
+		if db := oyster_utils.GetOrInitUniqueBadgerDB(dbID); db == nil {
+			err := errors.New("error creating unique badger DB for messages")
+			oyster_utils.LogIfError(err, nil)
+			return c.Error(400, err)
+		}
+	}
+
+	reader := models.NewChunkFrameReader(c.Request().Body)
+	numChunksStored := 0
+	for {
+		chunks, readErr := reader.ReadBatch(models.ChunkFrameBatchSize)
+		if actions_utils.IsUploadQuotaExceeded(c, readErr) {
+			return c.Render(429, actions_utils.Render.JSON(uploadSessionUpdateErrResV2{
+				Error:           readErr.Error(),
+				NumChunksStored: numChunksStored,
+			}))
+		}
+		if readErr != nil && readErr != io.EOF {
+			return c.Render(400, actions_utils.Render.JSON(uploadSessionUpdateErrResV2{
+				Error:           fmt.Sprintf("Invalid frame after %v chunks: %v", numChunksStored+len(chunks), readErr),
+				NumChunksStored: numChunksStored,
+			}))
+		}
+
+		if len(chunks) > 0 {
+			if chunkErrors := uploadSession.ValidateChunkReqs(chunks); len(chunkErrors) > 0 {
+				return c.Render(400, actions_utils.Render.JSON(uploadSessionUpdateErrResV2{
+					Error:           "Invalid chunks, the chunks of this batch and the ones after it were not stored",
+					ChunkErrors:     chunkErrors,
+					NumChunksStored: numChunksStored,
+				}))
+			}
+			// stored before the next batch is read, so that a slow store slows down the client
+			if err := models.ProcessAndStoreChunkData(chunks, uploadSession.GenesisHash, treasureIdxMap,
+				models.DataMapsTimeToLive); err != nil {
+				return c.Render(500, actions_utils.Render.JSON(uploadSessionUpdateErrResV2{
+					Error:           "Unable to store the chunks of this batch",
+					NumChunksStored: numChunksStored,
+				}))
+			}
+			actions_utils.RecordChunksReceived(c, len(chunks))
+			numChunksStored += len(chunks)
+
+			if err := actions_utils.CheckUploadQuota(c); actions_utils.IsUploadQuotaExceeded(c, err) {
+				return c.Render(429, actions_utils.Render.JSON(uploadSessionUpdateErrResV2{
+					Error:           err.Error(),
+					NumChunksStored: numChunksStored,
+				}))
+			}
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+	}
+
+	return c.Render(202, actions_utils.Render.JSON(map[string]interface{}{
+		"success":         true,
+		"numChunksStored": numChunksStored,
+	}))
+}
+
+// CreateBeta creates an upload session on the beta broker.  Only the brokers in the brokernodes table may create
+// beta sessions, so the request must be signed by one of them.
 func (usr *UploadSessionResourceV2) CreateBeta(c buffalo.Context) error {
 	start := PrometheusWrapper.TimeNow()
 	defer PrometheusWrapper.HistogramSeconds(PrometheusWrapper.HistogramUploadSessionResourceCreateBeta, start)
 
+	alphaETHAddr, err := actions_utils.VerifyBrokerRequest(c)
+	if err != nil {
+		return c.Error(401, err)
+	}
+
 	req := uploadSessionCreateReqV2{}
 	if err := oyster_utils.ParseReqBody(c.Request(), &req); err != nil {
 		err = fmt.Errorf("Invalid request, unable to parse request body  %v", err)
@@ -318,6 +498,11 @@ func (usr *UploadSessionResourceV2) CreateBeta(c buffalo.Context) error {
 		return err
 	}
 
+	// the session is started with the price of this broker, which the alpha broker must pay at least
+	if _, err := actions_utils.CheckBetaInvoice(req.Invoice, req.FileSizeBytes, req.StorageLengthInYears); err != nil {
+		return c.Error(400, err)
+	}
+
 	betaTreasureIndexes := oyster_utils.GenerateInsertedIndexesForPearl(oyster_utils.ConvertToByte(req.FileSizeBytes))
 
 	// Generates ETH address.
@@ -329,12 +514,18 @@ func (usr *UploadSessionResourceV2) CreateBeta(c buffalo.Context) error {
 		NumChunks:            req.NumChunks,
 		FileSizeBytes:        req.FileSizeBytes,
 		StorageLengthInYears: req.StorageLengthInYears,
-		TotalCost:            req.Invoice.Cost,
 		ETHAddrAlpha:         req.Invoice.EthAddress,
 		ETHAddrBeta:          nulls.NewString(betaEthAddr.Hex()),
 		ETHPrivateKey:        privKey,
 		Version:              req.Version,
 	}
+	if req.Range != nil {
+		u.RangeStartIdx = nulls.NewInt64(int64(req.Range.Start))
+		u.RangeEndIdx = nulls.NewInt64(int64(req.Range.End))
+	} else {
+		// the alpha and beta brokers of an N-broker upload do not attach each other's chunks
+		u.PeerAddress = actions_utils.GetPeerAddress(alphaETHAddr)
+	}
 
 	defer oyster_utils.TimeTrack(time.Now(), "actions/upload_sessions: create_beta_session", analytics.NewProperties().
 		Set("id", u.ID).
@@ -368,8 +559,11 @@ func (usr *UploadSessionResourceV2) CreateBeta(c buffalo.Context) error {
 		return err
 	}
 
-	mergedIndexes, err := oyster_utils.MergeIndexes(req.AlphaTreasureIndexes, betaTreasureIndexes,
-		oyster_utils.FileSectorInChunkSize, req.NumChunks)
+	mergedIndexes := req.TreasureIndexes
+	if len(mergedIndexes) == 0 {
+		mergedIndexes, err = oyster_utils.MergeIndexes(req.AlphaTreasureIndexes, betaTreasureIndexes,
+			oyster_utils.FileSectorInChunkSize, req.NumChunks)
+	}
 
 	if len(mergedIndexes) == 0 && oyster_utils.BrokerMode != oyster_utils.TestModeNoTreasure {
 		err := errors.New("no indexes selected for treasure")
@@ -464,3 +658,38 @@ func (usr *UploadSessionResourceV2) GetPaymentStatus(c buffalo.Context) error {
 
 	return c.Render(200, actions_utils.Render.JSON(res))
 }
+
+/* Delete cancels an unpaid upload session.  Its data, batches in S3 and treasures are deleted, and the beta or peer
+brokers are told to cancel their sessions as well.  Only the client which created an alpha session, with its cancel
+token, and the alpha broker of a beta session may cancel it. */
+func (usr *UploadSessionResourceV2) Delete(c buffalo.Context) error {
+	start := PrometheusWrapper.TimeNow()
+	defer PrometheusWrapper.HistogramSeconds(PrometheusWrapper.HistogramUploadSessionResourceDelete, start)
+
+	session := models.UploadSession{}
+	if err := models.DB.Find(&session, c.Param("id")); err != nil {
+		return c.Error(404, fmt.Errorf("Error in finding session for id %v", c.Param("id")))
+	}
+
+	if err := actions_utils.AuthorizeSessionCancel(c, session); err != nil {
+		return c.Error(403, err)
+	}
+
+	if session.PaymentStatus == models.PaymentStatusConfirmed ||
+		EthWrapper.CheckPRLBalance(eth_gateway.StringToAddress(session.ETHAddrAlpha.String)).Int64() > 0 {
+		return c.Error(409, errors.New("Session has already been paid and cannot be canceled"))
+	}
+
+	if session.StorageMethod == models.StorageMethodS3 {
+		if err := BlobStore.DeleteObjectKeys(blobstore.DefaultBucketName, session.GenesisHash+"/"); err != nil {
+			oyster_utils.LogIfError(err, nil)
+			return c.Error(500, err)
+		}
+	}
+	if err := models.DeleteUploadSession(session); err != nil {
+		return c.Error(500, err)
+	}
+	oyster_utils.LogIfError(actions_utils.CancelBetaSession(session, "v2"), nil)
+
+	return c.Render(200, actions_utils.Render.JSON(map[string]bool{"success": true}))
+}
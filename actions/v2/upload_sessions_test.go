@@ -1,17 +1,22 @@
 package actions_v2
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"github.com/oysterprotocol/brokernode/utils"
 	"github.com/oysterprotocol/brokernode/utils/eth_gateway"
 	"io/ioutil"
 	"math/big"
+	"net/http/httptest"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/gobuffalo/pop/nulls"
+	"github.com/oysterprotocol/brokernode/actions/utils"
 	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/services/blobstore"
 )
 
 type mockWaitForTransfer struct {
@@ -113,12 +118,14 @@ func (suite *ActionSuite) Test_UploadSessionsCreateBeta() {
 
 	genHash := oyster_utils.RandSeq(8, []rune("abcdef0123456789"))
 
-	res := suite.JSON("/api/v2/upload-sessions/beta").Post(map[string]interface{}{
+	addSigningBrokernode(suite)
+	res := postSignedBrokerRequest(suite, "/api/v2/upload-sessions/beta", map[string]interface{}{
 		"genesisHash":          genHash,
 		"fileSizeBytes":        123,
 		"numChunks":            2,
 		"storageLengthInYears": 1,
 		"alphaTreasureIndexes": []int{1},
+		"invoice":              map[string]interface{}{"cost": 1},
 	})
 
 	// Parse response
@@ -132,6 +139,7 @@ func (suite *ActionSuite) Test_UploadSessionsCreateBeta() {
 	suite.Equal(genHash, resParsed.UploadSession.GenesisHash)
 	suite.Equal(uint64(123), resParsed.UploadSession.FileSizeBytes)
 	suite.Equal(models.SessionTypeBeta, resParsed.UploadSession.Type)
+	suite.True(resParsed.UploadSession.PeerAddress.Valid)
 	suite.Equal(1, len(resParsed.BetaTreasureIndexes))
 	suite.NotEqual(0, resParsed.Invoice.Cost)
 	suite.NotEqual("", resParsed.Invoice.EthAddress)
@@ -159,6 +167,94 @@ func (suite *ActionSuite) Test_UploadSessionsCreateBeta() {
 	suite.Equal(1, len(brokerTx))
 }
 
+func (suite *ActionSuite) Test_UploadSessionsCreateBeta_Range() {
+	mockWaitForTransfer := mockWaitForTransfer{
+		output_error: nil,
+		output_int:   big.NewInt(100),
+	}
+	mockSendPrl := mockSendPrl{}
+
+	EthWrapper = eth_gateway.Eth{
+		WaitForTransfer: mockWaitForTransfer.waitForTransfer,
+		SendPRL:         mockSendPrl.sendPrl,
+		GenerateEthAddr: eth_gateway.EthWrapper.GenerateEthAddr,
+		GenerateKeys:    eth_gateway.EthWrapper.GenerateKeys,
+	}
+
+	genHash := oyster_utils.RandSeq(8, []rune("abcdef0123456789"))
+
+	addSigningBrokernode(suite)
+	res := postSignedBrokerRequest(suite, "/api/v2/upload-sessions/beta", map[string]interface{}{
+		"genesisHash":          genHash,
+		"fileSizeBytes":        3000,
+		"numChunks":            30,
+		"storageLengthInYears": 1,
+		"alphaTreasureIndexes": []int{1},
+		"invoice":              map[string]interface{}{"cost": 1},
+		"range":                map[string]int{"start": 10, "end": 19},
+		"treasureIndexes":      []int{1, 2},
+	})
+	suite.Equal(200, res.Code)
+
+	resParsed := uploadSessionCreateBetaResV2{}
+	bodyBytes, err := ioutil.ReadAll(res.Body)
+	suite.Nil(err)
+	suite.Nil(json.Unmarshal(bodyBytes, &resParsed))
+
+	session := resParsed.UploadSession
+	suite.Equal(models.SessionTypeBeta, session.Type)
+	suite.Equal(int64(10), session.RangeStartIdx.Int64)
+	suite.Equal(int64(19), session.RangeEndIdx.Int64)
+	suite.Equal(int64(19), session.NextIdxToAttach)
+	suite.False(session.PeerAddress.Valid)
+	suite.Equal([]int{1, 2}, resParsed.BetaTreasureIndexes)
+}
+
+func (suite *ActionSuite) Test_UploadSessionsCreateBeta_InvoiceTooLow() {
+	genHash := oyster_utils.RandSeq(8, []rune("abcdef0123456789"))
+
+	addSigningBrokernode(suite)
+	res := postSignedBrokerRequest(suite, "/api/v2/upload-sessions/beta", map[string]interface{}{
+		"genesisHash":          genHash,
+		"fileSizeBytes":        123,
+		"numChunks":            2,
+		"storageLengthInYears": 1,
+		"alphaTreasureIndexes": []int{1},
+		"invoice":              map[string]interface{}{"cost": 0.001},
+	})
+	suite.Equal(400, res.Code)
+
+	count, err := suite.DB.Where("genesis_hash = ?", genHash).Count(&models.UploadSession{})
+	suite.Nil(err)
+	suite.Equal(0, count)
+}
+
+func (suite *ActionSuite) Test_UploadSessionsCreate_BetaAndPeers() {
+	res := suite.JSON("/api/v2/upload-sessions").Post(map[string]interface{}{
+		"genesisHash":          oyster_utils.RandSeq(8, []rune("abcdef0123456789")),
+		"fileSizeBytes":        123,
+		"numChunks":            2,
+		"storageLengthInYears": 1,
+		"betaIp":               "1.1.1.1",
+		"peerIps":              []string{"2.2.2.2"},
+	})
+
+	suite.Equal(400, res.Code)
+}
+
+func (suite *ActionSuite) Test_UploadSessionsCreateBeta_Unsigned() {
+	addSigningBrokernode(suite)
+	res := suite.JSON("/api/v2/upload-sessions/beta").Post(map[string]interface{}{
+		"genesisHash":          oyster_utils.RandSeq(8, []rune("abcdef0123456789")),
+		"fileSizeBytes":        123,
+		"numChunks":            2,
+		"storageLengthInYears": 1,
+		"alphaTreasureIndexes": []int{1},
+	})
+
+	suite.Equal(401, res.Code)
+}
+
 func (suite *ActionSuite) Test_UploadSessionsGetPaymentStatus_Paid() {
 	//setup
 	mockCheckPRLBalance := mockCheckPRLBalance{}
@@ -329,3 +425,208 @@ func (v *mockCheckPRLBalance) checkPRLBalance(addr common.Address) *big.Int {
 	v.input_addr = addr
 	return v.output_int
 }
+
+func (suite *ActionSuite) Test_UploadSessionsUpdate_ChunkFrames() {
+	uploadSession := models.UploadSession{
+		Type:          models.SessionTypeAlpha,
+		GenesisHash:   oyster_utils.RandSeq(6, []rune("abcdef0123456789")),
+		NumChunks:     10,
+		FileSizeBytes: 9000,
+	}
+	vErr, err := uploadSession.StartUploadSession()
+	suite.Nil(err)
+	suite.False(vErr.HasAny())
+	uploadSession.MakeTreasureIdxMap([]int{5}, []string{"0000000001"})
+
+	body := bytes.Buffer{}
+	for i := 0; i < 10; i++ {
+		suite.Nil(models.WriteChunkFrame(&body, models.ChunkReq{Idx: i, Hash: uploadSession.GenesisHash, Data: "ABC"}))
+	}
+	req := httptest.NewRequest("PUT", "/api/v2/upload-sessions/"+fmt.Sprint(uploadSession.ID), &body)
+	req.Header.Set("Content-Type", models.ChunkFrameContentType)
+	res := httptest.NewRecorder()
+	suite.App.ServeHTTP(res, req)
+	suite.Equal(202, res.Code)
+
+	receivedIndexes, err := uploadSession.GetReceivedChunkIndexes()
+	suite.Nil(err)
+	suite.Equal([]int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, receivedIndexes)
+}
+
+func (suite *ActionSuite) Test_UploadSessionsUpdate_ChunkFramesTruncated() {
+	uploadSession := models.UploadSession{
+		Type:          models.SessionTypeAlpha,
+		GenesisHash:   oyster_utils.RandSeq(6, []rune("abcdef0123456789")),
+		NumChunks:     10,
+		FileSizeBytes: 9000,
+	}
+	vErr, err := uploadSession.StartUploadSession()
+	suite.Nil(err)
+	suite.False(vErr.HasAny())
+	uploadSession.MakeTreasureIdxMap([]int{5}, []string{"0000000001"})
+
+	body := bytes.Buffer{}
+	suite.Nil(models.WriteChunkFrame(&body, models.ChunkReq{Idx: 0, Hash: uploadSession.GenesisHash, Data: "ABC"}))
+	req := httptest.NewRequest("PUT", "/api/v2/upload-sessions/"+fmt.Sprint(uploadSession.ID),
+		bytes.NewReader(body.Bytes()[:body.Len()-1]))
+	req.Header.Set("Content-Type", models.ChunkFrameContentType)
+	res := httptest.NewRecorder()
+	suite.App.ServeHTTP(res, req)
+	suite.Equal(400, res.Code)
+
+	resParsed := uploadSessionUpdateErrResV2{}
+	suite.Nil(json.Unmarshal(res.Body.Bytes(), &resParsed))
+	suite.Equal(0, resParsed.NumChunksStored)
+}
+
+func (suite *ActionSuite) Test_UploadSessionsDelete_Unpaid() {
+	mockCheckPRLBalance := mockCheckPRLBalance{
+		output_int: big.NewInt(0),
+	}
+	EthWrapper = eth_gateway.Eth{
+		CheckPRLBalance: mockCheckPRLBalance.checkPRLBalance,
+		GenerateEthAddr: eth_gateway.EthWrapper.GenerateEthAddr,
+		GenerateKeys:    eth_gateway.EthWrapper.GenerateKeys,
+	}
+
+	genHash := oyster_utils.RandSeq(8, []rune("abcdef0123456789"))
+	res := suite.JSON("/api/v2/upload-sessions").Post(map[string]interface{}{
+		"genesisHash":          genHash,
+		"fileSizeBytes":        123,
+		"numChunks":            2,
+		"storageLengthInYears": 1,
+	})
+	suite.Equal(200, res.Code)
+	resParsed := uploadSessionCreateResV2{}
+	suite.Nil(json.Unmarshal(res.Body.Bytes(), &resParsed))
+
+	// only the client holding the cancel token may cancel the session
+	res = suite.JSON("/api/v2/upload-sessions/" + resParsed.ID).Delete()
+	suite.Equal(403, res.Code)
+	suite.False(mockCheckPRLBalance.hasCalled)
+
+	req := suite.JSON("/api/v2/upload-sessions/" + resParsed.ID)
+	req.Headers[actions_utils.CancelTokenHeader] = resParsed.CancelToken
+	res = req.Delete()
+	suite.Equal(200, res.Code)
+	suite.True(mockCheckPRLBalance.hasCalled)
+
+	count, err := suite.DB.Where("genesis_hash = ?", genHash).Count(&models.UploadSession{})
+	suite.Nil(err)
+	suite.Equal(0, count)
+	count, err = suite.DB.Where("genesis_hash = ?", genHash).Count(&models.BrokerBrokerTransaction{})
+	suite.Nil(err)
+	suite.Equal(0, count)
+}
+
+func (suite *ActionSuite) Test_UploadSessionsDelete_Paid() {
+	mockCheckPRLBalance := mockCheckPRLBalance{}
+	EthWrapper = eth_gateway.Eth{
+		CheckPRLBalance: mockCheckPRLBalance.checkPRLBalance,
+	}
+
+	uploadSession := models.UploadSession{
+		GenesisHash:   oyster_utils.RandSeq(8, []rune("abcdef0123456789")),
+		FileSizeBytes: 123,
+		NumChunks:     2,
+		PaymentStatus: models.PaymentStatusConfirmed,
+	}
+	cancelToken, err := uploadSession.NewCancelToken()
+	suite.Nil(err)
+	suite.Nil(suite.DB.Save(&uploadSession))
+
+	req := suite.JSON("/api/v2/upload-sessions/" + fmt.Sprint(uploadSession.ID))
+	req.Headers[actions_utils.CancelTokenHeader] = cancelToken
+	res := req.Delete()
+	suite.Equal(409, res.Code)
+	suite.False(mockCheckPRLBalance.hasCalled)
+
+	session := models.UploadSession{}
+	suite.Nil(suite.DB.Find(&session, uploadSession.ID))
+}
+
+func (suite *ActionSuite) Test_UploadSessionsDelete_S3Batches() {
+	mockCheckPRLBalance := mockCheckPRLBalance{
+		output_int: big.NewInt(0),
+	}
+	EthWrapper = eth_gateway.Eth{
+		CheckPRLBalance: mockCheckPRLBalance.checkPRLBalance,
+	}
+
+	uploadSession := models.UploadSession{
+		GenesisHash:   oyster_utils.RandSeq(8, []rune("abcdef0123456789")),
+		FileSizeBytes: 123,
+		NumChunks:     2,
+		Type:          models.SessionTypeAlpha,
+		PaymentStatus: models.PaymentStatusInvoiced,
+		StorageMethod: models.StorageMethodS3,
+	}
+	cancelToken, err := uploadSession.NewCancelToken()
+	suite.Nil(err)
+	suite.Nil(suite.DB.Save(&uploadSession))
+	suite.Nil(BlobStore.SetObject(blobstore.DefaultBucketName, uploadSession.GenesisHash+"/0", "[]"))
+
+	req := suite.JSON("/api/v2/upload-sessions/" + fmt.Sprint(uploadSession.ID))
+	req.Headers[actions_utils.CancelTokenHeader] = cancelToken
+	res := req.Delete()
+	suite.Equal(200, res.Code)
+
+	keys, err := BlobStore.ListObjectKeys(blobstore.DefaultBucketName, uploadSession.GenesisHash+"/")
+	suite.Nil(err)
+	suite.Equal(0, len(keys))
+}
+
+func (suite *ActionSuite) Test_UploadSessionsDelete_Beta() {
+	mockCheckPRLBalance := mockCheckPRLBalance{
+		output_int: big.NewInt(0),
+	}
+	EthWrapper = eth_gateway.Eth{
+		CheckPRLBalance: mockCheckPRLBalance.checkPRLBalance,
+	}
+
+	uploadSession := models.UploadSession{
+		GenesisHash:   oyster_utils.RandSeq(8, []rune("abcdef0123456789")),
+		FileSizeBytes: 123,
+		NumChunks:     2,
+		Type:          models.SessionTypeBeta,
+		PaymentStatus: models.PaymentStatusInvoiced,
+	}
+	suite.Nil(suite.DB.Save(&uploadSession))
+
+	// only the alpha broker may cancel a beta session
+	res := suite.JSON("/api/v2/upload-sessions/" + fmt.Sprint(uploadSession.ID)).Delete()
+	suite.Equal(403, res.Code)
+
+	addSigningBrokernode(suite)
+	req := httptest.NewRequest("DELETE", "/api/v2/upload-sessions/"+fmt.Sprint(uploadSession.ID), nil)
+	suite.Nil(services.SignBrokerRequest(req, nil))
+	res = httptest.NewRecorder()
+	suite.App.ServeHTTP(res, req)
+	suite.Equal(200, res.Code)
+
+	count, err := suite.DB.Where("id = ?", uploadSession.ID).Count(&models.UploadSession{})
+	suite.Nil(err)
+	suite.Equal(0, count)
+}
+
+func (suite *ActionSuite) Test_UploadSessionsDelete_DoesntExist() {
+	res := suite.JSON("/api/v2/upload-sessions/" + oyster_utils.RandSeq(8, []rune("abcdef0123456789"))).Delete()
+	suite.Equal(404, res.Code)
+}
+
+/*addSigningBrokernode adds this broker to the brokernodes table, so that the requests it signs are accepted.*/
+func addSigningBrokernode(suite *ActionSuite) {
+	suite.Nil(actions_utils.AddSigningBrokernodeForTest())
+}
+
+func postSignedBrokerRequest(suite *ActionSuite, url string, body interface{}) *httptest.ResponseRecorder {
+	bodyBytes, err := json.Marshal(body)
+	suite.Nil(err)
+
+	req := httptest.NewRequest("POST", url, bytes.NewReader(bodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	suite.Nil(services.SignBrokerRequest(req, bodyBytes))
+	res := httptest.NewRecorder()
+	suite.App.ServeHTTP(res, req)
+	return res
+}
@@ -0,0 +1,37 @@
+package actions_v2
+
+import (
+	"errors"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/oysterprotocol/brokernode/actions/utils"
+	"github.com/oysterprotocol/brokernode/models"
+)
+
+type VerificationReportResource struct {
+	buffalo.Resource
+}
+
+// Response structs
+
+type verificationReportRes struct {
+	models.VerificationReport
+	Complete bool `json:"complete"`
+}
+
+/*Get returns how the chunks of the upload with the genesis hash compared to the tangle when they were verified.*/
+func (vr *VerificationReportResource) Get(c buffalo.Context) error {
+	report, err := models.GetVerificationReport(c.Param("genesisHash"))
+	if err != nil {
+		return c.Error(500, err)
+	}
+	if report == nil {
+		return c.Error(404, errors.New("no verification report for genesis hash "+c.Param("genesisHash")))
+	}
+
+	res := verificationReportRes{
+		VerificationReport: *report,
+		Complete:           report.IsComplete(),
+	}
+	return c.Render(200, actions_utils.Render.JSON(res))
+}
@@ -0,0 +1,37 @@
+package actions_v2
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+func (suite *ActionSuite) Test_GetVerificationReport() {
+	genesisHash := oyster_utils.RandSeq(6, []rune("abcdef0123456789"))
+	suite.Nil(models.RecordVerificationResult(genesisHash, 0, 4, models.VerificationResult{
+		ChunksMatching:    4,
+		ChunksNotAttached: 1,
+		ReattachCount:     1,
+	}))
+
+	res := suite.JSON("/api/v2/verification-reports/" + genesisHash).Get()
+	suite.Equal(200, res.Code)
+
+	resParsed := verificationReportRes{}
+	bodyBytes, err := ioutil.ReadAll(res.Body)
+	suite.Nil(err)
+	suite.Nil(json.Unmarshal(bodyBytes, &resParsed))
+
+	suite.Equal(genesisHash, resParsed.GenesisHash)
+	suite.Equal(4, resParsed.ChunksMatching)
+	suite.Equal(1, resParsed.ChunksNotAttached)
+	suite.Equal(1, resParsed.ReattachCount)
+	suite.False(resParsed.Complete)
+}
+
+func (suite *ActionSuite) Test_GetVerificationReport_NotFound() {
+	res := suite.JSON("/api/v2/verification-reports/" + oyster_utils.RandSeq(6, []rune("abcdef0123456789"))).Get()
+	suite.Equal(404, res.Code)
+}
@@ -3,6 +3,7 @@ package actions_v3
 import (
 	"github.com/gobuffalo/buffalo"
 	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/services/blobstore"
 	"github.com/oysterprotocol/brokernode/utils/eth_gateway"
 )
 
@@ -10,12 +11,16 @@ import (
 var IotaWrapper = services.IotaWrapper
 var EthWrapper = eth_gateway.EthWrapper
 var PrometheusWrapper = services.PrometheusWrapper
+var BlobStore = blobstore.Store
 
 func RegisterApi(app *buffalo.App) *buffalo.App {
 	apiV3 := app.Group("/api/v3")
 
 	uploadSessionResourceV3 := UploadSessionResourceV3{}
 	apiV3.PUT("upload-sessions/{id}", uploadSessionResourceV3.Update)
+	apiV3.GET("upload-sessions/{id}", uploadSessionResourceV3.GetPaymentStatus)
+	apiV3.GET("upload-sessions/{id}/manifest", uploadSessionResourceV3.GetManifest)
+	apiV3.DELETE("upload-sessions/{id}", uploadSessionResourceV3.Delete)
 	apiV3.POST("upload-sessions", uploadSessionResourceV3.Create)
 	apiV3.POST("upload-sessions/beta", uploadSessionResourceV3.CreateBeta)
 
@@ -5,8 +5,10 @@ import (
 	"testing"
 
 	"github.com/gobuffalo/suite"
+	"github.com/orcaman/concurrent-map"
 	"github.com/oysterprotocol/brokernode/actions/utils"
 	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/services/blobstore"
 	"github.com/oysterprotocol/brokernode/utils"
 )
 
@@ -21,6 +23,8 @@ func (suite *ActionSuite) SetupTest() {
 
 	EthWrapper = eth_gateway.EthWrapper
 	IotaWrapper = services.IotaWrapper
+	BlobStore = blobstore.NewMemoryStore()
+	cachedData = cmap.New()
 }
 
 func Test_ActionSuite(t *testing.T) {
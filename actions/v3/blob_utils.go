@@ -0,0 +1,133 @@
+package actions_v3
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/orcaman/concurrent-map"
+	"github.com/oysterprotocol/brokernode/services/blobstore"
+)
+
+var bucketPrefix string
+var counter uint64
+
+var cachedData cmap.ConcurrentMap
+
+func init() {
+	if v := os.Getenv("DISPLAY_NAME"); v != "" {
+		bucketPrefix = v
+	} else {
+		bucketPrefix = "unknown"
+	}
+	bucketPrefix = strings.Replace(bucketPrefix, "_", "-", -1)
+
+	cachedData = cmap.New()
+}
+
+/* Create unique bucket name. */
+func createUniqueBucketName() string {
+	atomic.AddUint64(&counter, 1)
+	return strings.ToLower(fmt.Sprintf("%v-%v-%v", bucketPrefix, time.Now().Format("2006-01-02t15.04.05z07.00"), counter))
+}
+
+/* Create a private bucket with bucketName. */
+func createBucket(bucketName string) error {
+	return BlobStore.CreateBucket(bucketName)
+}
+
+/* Delete bucket as bucketName. Must make sure no object inside the bucket*/
+func deleteBucket(bucketName string) error {
+	return BlobStore.DeleteBucket(bucketName)
+}
+
+func getObject(bucketName string, objectKey string, cached bool) (string, error) {
+	if cached {
+		if value, ok := cachedData.Get(getKey(bucketName, objectKey)); ok {
+			return value.(string), nil
+		}
+	}
+
+	data, err := BlobStore.GetObject(bucketName, objectKey)
+	if err == nil {
+		cachedData.Set(getKey(bucketName, objectKey), data)
+	}
+	return data, err
+}
+
+func setObject(bucketName string, objectKey string, data string) error {
+	err := BlobStore.SetObject(bucketName, objectKey, data)
+	if err == nil {
+		cachedData.Set(getKey(bucketName, objectKey), data)
+	}
+	return err
+}
+
+func setObjectVersion(bucketName string, objectKey string, data string, version string) error {
+	err := BlobStore.SetObjectVersion(bucketName, objectKey, data, version)
+	if err == nil {
+		cachedData.Set(getKey(bucketName, objectKey), data)
+	}
+	return err
+}
+
+func deleteObject(bucketName string, objectKey string) error {
+	cachedData.Remove(getKey(bucketName, objectKey))
+
+	return BlobStore.DeleteObject(bucketName, objectKey)
+}
+
+func listObjectKeys(bucketName string, objectKeyPrefix string) ([]string, error) {
+	return BlobStore.ListObjectKeys(bucketName, objectKeyPrefix)
+}
+
+func deleteObjectKeys(bucketName string, objectKeyPrefix string) error {
+	for _, key := range cachedData.Keys() {
+		if strings.HasPrefix(key, getKey(bucketName, objectKeyPrefix)) {
+			cachedData.Remove(key)
+		}
+	}
+
+	return BlobStore.DeleteObjectKeys(bucketName, objectKeyPrefix)
+}
+
+// Get Object operation on default bucket
+func getDefaultBucketObject(objectKey string, cached bool) (string, error) {
+	return getObject(blobstore.DefaultBucketName, objectKey, cached)
+}
+
+// Get Object operation on default bucket, along with the version of the object
+func getDefaultBucketObjectVersion(objectKey string) (string, string, error) {
+	return BlobStore.GetObjectVersion(blobstore.DefaultBucketName, objectKey)
+}
+
+// Set Object operation on default bucket
+func setDefaultBucketObject(objectKey string, data string) error {
+	return setObject(blobstore.DefaultBucketName, objectKey, data)
+}
+
+// Set Object operation on default bucket, only if the object is still at version
+func setDefaultBucketObjectVersion(objectKey string, data string, version string) error {
+	return setObjectVersion(blobstore.DefaultBucketName, objectKey, data, version)
+}
+
+// Delete Object operation on default bucket with particular prefix
+func deleteDefaultBucketObject(objectKey string) error {
+	return deleteObject(blobstore.DefaultBucketName, objectKey)
+}
+
+// List Object operation on default bucket with particular prefix
+func listDefaultBucketObjectKeys(objectKeyPrefix string) ([]string, error) {
+	return listObjectKeys(blobstore.DefaultBucketName, objectKeyPrefix)
+}
+
+// Delete all the object operation on default bucket with particular prefix
+func deleteDefaultBucketObjectKeys(objectKeyPrefix string) error {
+	return deleteObjectKeys(blobstore.DefaultBucketName, objectKeyPrefix)
+}
+
+func getKey(bucketName string, objectKey string) string {
+	return fmt.Sprintf("%v:%v", bucketName, objectKey)
+}
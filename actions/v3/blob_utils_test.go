@@ -8,12 +8,7 @@ func (suite *ActionSuite) Test_GenerateDifferentBucketName() {
 }
 
 func (suite *ActionSuite) Test_CreateAndDeleteBucket() {
-	if !isS3Enabled() {
-		return
-	}
-
 	bucket := createUniqueBucketName()
-	print(bucket)
 	err := createBucket(bucket)
 
 	suite.Nil(err)
@@ -23,10 +18,6 @@ func (suite *ActionSuite) Test_CreateAndDeleteBucket() {
 }
 
 func (suite *ActionSuite) Test_SetAndGetAndDeleteObject() {
-	if !isS3Enabled() {
-		return
-	}
-
 	bucket := createUniqueBucketName()
 	suite.Nil(createBucket(bucket))
 
@@ -48,10 +39,6 @@ func (suite *ActionSuite) Test_SetAndGetAndDeleteObject() {
 }
 
 func (suite *ActionSuite) Test_ListObject() {
-	if !isS3Enabled() {
-		return
-	}
-
 	bucket := createUniqueBucketName()
 	suite.Nil(createBucket(bucket))
 
@@ -60,15 +47,11 @@ func (suite *ActionSuite) Test_ListObject() {
 		suite.Nil(setObject(bucket, k, "data"))
 	}
 
-	awsPagingSize = 2
-
 	l, err := listObjectKeys(bucket, "o")
 
 	suite.Nil(err)
 	suite.Equal(objectKeys, l)
 
-	awsPagingSize = 1000
-
 	// Clean up the bucket
 	for _, k := range objectKeys {
 		suite.Nil(deleteObject(bucket, k))
@@ -77,12 +60,6 @@ func (suite *ActionSuite) Test_ListObject() {
 }
 
 func (suite *ActionSuite) Test_BatchDelete() {
-	if !isS3Enabled() {
-		return
-	}
-
-	awsPagingSize = 2
-
 	bucket := createUniqueBucketName()
 	suite.Nil(createBucket(bucket))
 
@@ -103,7 +80,4 @@ func (suite *ActionSuite) Test_BatchDelete() {
 	suite.True(len(l) == 0)
 
 	suite.Nil(deleteBucket(bucket))
-
-	awsPagingSize = 1000
-
 }
@@ -3,6 +3,8 @@ package actions_v3
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"sort"
 	"strconv"
@@ -11,12 +13,19 @@ import (
 	"github.com/gobuffalo/pop/nulls"
 	"github.com/oysterprotocol/brokernode/actions/utils"
 	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/services/blobstore"
 	"github.com/oysterprotocol/brokernode/utils"
+	"github.com/oysterprotocol/brokernode/utils/eth_gateway"
 	"github.com/pkg/errors"
 )
 
 const (
-	BatchSize = 25
+	BatchSize = models.ChunkBatchSize
+
+	// maxChunkBatchSetAttempts is how many times the chunks of a batch are merged with the stored ones, when the
+	// batch object keeps being set by other requests in between.
+	maxChunkBatchSetAttempts = 5
 )
 
 type UploadSessionResourceV3 struct {
@@ -35,6 +44,9 @@ type uploadSessionCreateReqV3 struct {
 	StorageLengthInYears int            `json:"storageLengthInYears"`
 	Invoice              models.Invoice `json:"invoice"`
 	Version              uint32         `json:"version"`
+
+	// N-broker mode is only supported by v2.  The field is read so that such requests are rejected.
+	PeerIPs []string `json:"peerIps,omitempty"`
 }
 
 type uploadSessionCreateBetaResV3 struct {
@@ -47,6 +59,33 @@ type uploadSessionCreateResV3 struct {
 	ID            string `json:"id"`
 	BetaSessionID string `json:"betaSessionId"`
 	BatchSize     int    `json:"batchSize"`
+	// Sent back in the X-Cancel-Token header to cancel the session.
+	CancelToken string `json:"cancelToken"`
+}
+
+type uploadSessionUpdateErrResV3 struct {
+	Error           string                 `json:"error"`
+	ChunkErrors     []models.ChunkReqError `json:"chunkErrors"`
+	NumChunksStored int                    `json:"numChunksStored"`
+}
+
+type uploadSessionManifestResV3 struct {
+	ID          string                    `json:"id"`
+	NumChunks   int                       `json:"numChunks"`
+	BatchSize   int                       `json:"batchSize"`
+	NumReceived int                       `json:"numReceived"`
+	Received    []oyster_utils.IndexRange `json:"received"`
+	Missing     []oyster_utils.IndexRange `json:"missing"`
+}
+
+type uploadSessionStatusResV3 struct {
+	ID                  string         `json:"id"`
+	PaymentStatus       string         `json:"paymentStatus"`
+	AllDataReady        bool           `json:"allDataReady"`
+	AttachProgress      float64        `json:"attachProgress"`
+	VerifyProgress      float64        `json:"verifyProgress"`
+	TreasureResponsible bool           `json:"treasureResponsible"`
+	TreasureSigning     map[string]int `json:"treasureSigning"`
 }
 
 var NumChunksLimit = -1 //unlimited
@@ -57,11 +96,17 @@ func init() {
 	}
 }
 
-// Update uploads a chunk associated with an upload session.
+// Update uploads a chunk associated with an upload session.  The chunks are sent either as JSON or, with the
+// models.ChunkFrameContentType content type, as frames.
 func (usr *UploadSessionResourceV3) Update(c buffalo.Context) error {
-	req, err := validateAndGetUpdateReq(c)
-	if err != nil {
-		return c.Error(400, err)
+	isChunkFrameRequest := actions_utils.IsChunkFrameRequest(c)
+
+	req := uploadSessionUpdateReqV3{}
+	var err error
+	if !isChunkFrameRequest {
+		if req, err = validateAndGetUpdateReq(c); err != nil {
+			return c.Error(400, err)
+		}
 	}
 
 	uploadSession := &models.UploadSession{}
@@ -77,19 +122,219 @@ func (usr *UploadSessionResourceV3) Update(c buffalo.Context) error {
 		return c.Error(400, errors.New("Using the wrong endpoint. This endpoint is for V3 only"))
 	}
 
-	fileIndex := req.Chunks[0].Idx / BatchSize
+	if isChunkFrameRequest {
+		return updateWithChunkFrames(c, uploadSession)
+	}
+
+	chunkErrors, err := storeChunkBatch(uploadSession, req.Chunks)
+	if err != nil {
+		return c.Error(500, err)
+	}
+	if len(chunkErrors) > 0 {
+		return c.Render(400, actions_utils.Render.JSON(uploadSessionUpdateErrResV3{
+			Error:       "Invalid chunks, none of the chunks were stored",
+			ChunkErrors: chunkErrors,
+		}))
+	}
+
+	actions_utils.RecordChunksReceived(c, len(req.Chunks))
+	return c.Render(202, actions_utils.Render.JSON(map[string]bool{"success": true}))
+}
+
+/* updateWithChunkFrames stores the chunks of a framed upload request while they are read, one batch object at a
+time.  A batch is stored once a chunk of another batch arrives.  The chunks stored together must be consecutive,
+and are merged with the ones of their batch already stored. */
+func updateWithChunkFrames(c buffalo.Context, uploadSession *models.UploadSession) error {
+	reader := models.NewChunkFrameReader(c.Request().Body)
+	numChunksStored := 0
+	batch := []models.ChunkReq{}
+	for {
+		chunk, readErr := reader.Read()
+		if actions_utils.IsUploadQuotaExceeded(c, readErr) {
+			return c.Render(429, actions_utils.Render.JSON(uploadSessionUpdateErrResV3{
+				Error:           readErr.Error(),
+				NumChunksStored: numChunksStored,
+			}))
+		}
+		if readErr != nil && readErr != io.EOF {
+			return c.Render(400, actions_utils.Render.JSON(uploadSessionUpdateErrResV3{
+				Error:           fmt.Sprintf("Invalid frame after %v chunks: %v", numChunksStored+len(batch), readErr),
+				NumChunksStored: numChunksStored,
+			}))
+		}
+
+		if len(batch) > 0 && (readErr == io.EOF || chunk.Idx/BatchSize != batch[0].Idx/BatchSize) {
+			if err := validateChunkBatch(batch); err != nil {
+				return c.Render(400, actions_utils.Render.JSON(uploadSessionUpdateErrResV3{
+					Error:           fmt.Sprintf("Invalid chunks after %v chunks: %v", numChunksStored, err),
+					NumChunksStored: numChunksStored,
+				}))
+			}
+			chunkErrors, err := storeChunkBatch(uploadSession, batch)
+			if err != nil {
+				return c.Error(500, err)
+			}
+			if len(chunkErrors) > 0 {
+				return c.Render(400, actions_utils.Render.JSON(uploadSessionUpdateErrResV3{
+					Error:           "Invalid chunks, the chunks of this batch and the ones after it were not stored",
+					ChunkErrors:     chunkErrors,
+					NumChunksStored: numChunksStored,
+				}))
+			}
+			actions_utils.RecordChunksReceived(c, len(batch))
+			numChunksStored += len(batch)
+			batch = []models.ChunkReq{}
+
+			if err := actions_utils.CheckUploadQuota(c); actions_utils.IsUploadQuotaExceeded(c, err) {
+				return c.Render(429, actions_utils.Render.JSON(uploadSessionUpdateErrResV3{
+					Error:           err.Error(),
+					NumChunksStored: numChunksStored,
+				}))
+			}
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+		batch = append(batch, chunk)
+	}
+
+	return c.Render(202, actions_utils.Render.JSON(map[string]interface{}{
+		"success":         true,
+		"numChunksStored": numChunksStored,
+	}))
+}
+
+/* storeChunkBatch validates the chunks of one batch and stores them in the object of the batch, together with the
+chunks of the batch which were stored before.  Returns the errors of the chunks which are not valid, in which case
+nothing is stored. */
+func storeChunkBatch(uploadSession *models.UploadSession, chunks []models.ChunkReq) ([]models.ChunkReqError, error) {
+	if chunkErrors := uploadSession.ValidateChunkReqs(chunks); len(chunkErrors) > 0 {
+		return chunkErrors, nil
+	}
+
+	fileIndex := chunks[0].Idx / BatchSize
 	objectKey := fmt.Sprintf("%v/%v", uploadSession.GenesisHash, fileIndex)
 
-	var data []byte
-	if data, err = json.Marshal(req.Chunks); err != nil {
-		return c.Error(500, fmt.Errorf("Unable to marshal ChunkReq to JSON with err %v", err))
+	// The merged chunks are only set if the batch object was not set since it was read, e.g. by a request to another
+	// broker replica, otherwise the chunks are merged again so that the chunks of neither request are lost.
+	for attempt := 1; ; attempt++ {
+		storedChunks, version, err := getExistingChunkBatch(objectKey)
+		if err != nil {
+			oyster_utils.LogIfError(err, nil)
+			return nil, fmt.Errorf("Unable to get the stored chunks from S3 with err: %v", err)
+		}
+
+		mergedChunks := mergeChunkBatch(storedChunks, chunks)
+		data, err := json.Marshal(mergedChunks)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to marshal ChunkReq to JSON with err %v", err)
+		}
+		err = setDefaultBucketObjectVersion(objectKey, string(data), version)
+		if err == blobstore.ErrObjectChanged && attempt < maxChunkBatchSetAttempts {
+			continue
+		}
+		if err != nil {
+			oyster_utils.LogIfError(err, nil)
+			return nil, fmt.Errorf("Unable to store data to S3 with err: %v", err)
+		}
+
+		// The manifest reads the received indexes from this record rather than from the batches.  The chunks are
+		// stored either way, if the record is not set the manifest reports them as missing and they are sent again.
+		receivedIndexes := make([]int, 0, len(mergedChunks))
+		for _, chunk := range mergedChunks {
+			receivedIndexes = append(receivedIndexes, chunk.Idx)
+		}
+		models.SetUploadBatchReceived(uploadSession.GenesisHash, fileIndex, receivedIndexes)
+		return nil, nil
+	}
+}
+
+/* GetManifest endpoint returns which chunk index ranges the broker has received and which are still missing,
+so a client can resume an interrupted upload. */
+func (usr *UploadSessionResourceV3) GetManifest(c buffalo.Context) error {
+	uploadSession := &models.UploadSession{}
+	if err := models.DB.Find(uploadSession, c.Param("id")); err != nil {
+		return c.Error(404, fmt.Errorf("Error in finding session for id %v", c.Param("id")))
 	}
-	if err = setDefaultBucketObject(objectKey, string(data)); err != nil {
+
+	receivedIndexes, err := uploadSession.GetReceivedChunkIndexes()
+	if err != nil {
 		oyster_utils.LogIfError(err, nil)
-		return c.Error(500, fmt.Errorf("Unable to store data to S3 with err: %v", err))
+		return c.Error(500, err)
+	}
+	if uploadSession.StorageMethod == models.StorageMethodS3 {
+		// Batches which have not been moved into the chunk storage by the jobs yet.
+		batchIndexes, err := models.GetUploadBatchReceivedIndexes(uploadSession.GenesisHash)
+		if err != nil {
+			oyster_utils.LogIfError(err, nil)
+			return c.Error(500, err)
+		}
+		receivedIndexes = mergeUniqueIndexes(receivedIndexes, batchIndexes)
+	}
+	sort.Ints(receivedIndexes)
+
+	numChunks := uploadSession.GetNumChunksFromClient()
+	res := uploadSessionManifestResV3{
+		ID:          uploadSession.ID.String(),
+		NumChunks:   numChunks,
+		BatchSize:   BatchSize,
+		NumReceived: len(receivedIndexes),
+		Received:    oyster_utils.IndexesToRanges(receivedIndexes),
+		Missing:     oyster_utils.GetMissingIndexRanges(receivedIndexes, numChunks),
 	}
 
-	return c.Render(202, actions_utils.Render.JSON(map[string]bool{"success": true}))
+	return c.Render(200, actions_utils.Render.JSON(res))
+}
+
+/* GetPaymentStatus endpoint reports the payment status and upload progress of a session, along with how many of its
+treasures are in each signing state. */
+func (usr *UploadSessionResourceV3) GetPaymentStatus(c buffalo.Context) error {
+	session := &models.UploadSession{}
+	if err := models.DB.Find(session, c.Param("id")); err != nil {
+		return c.Error(404, fmt.Errorf("Error in finding session for id %v", c.Param("id")))
+	}
+
+	if session.StorageMethod != models.StorageMethodS3 {
+		return c.Error(400, errors.New("Using the wrong endpoint. This endpoint is for V3 only"))
+	}
+
+	// Force to check the status
+	if session.PaymentStatus != models.PaymentStatusConfirmed {
+		balance := EthWrapper.CheckPRLBalance(eth_gateway.StringToAddress(session.ETHAddrAlpha.String))
+		if balance.Int64() > 0 {
+			previousPaymentStatus := session.PaymentStatus
+			session.PaymentStatus = models.PaymentStatusConfirmed
+			if err := models.DB.Save(session); err != nil {
+				oyster_utils.LogIfError(err, nil)
+				session.PaymentStatus = previousPaymentStatus
+			} else {
+				models.SetBrokerTransactionToPaid(*session)
+			}
+		}
+	}
+
+	treasures := []models.Treasure{}
+	if err := models.DB.Where("genesis_hash = ?", session.GenesisHash).All(&treasures); err != nil {
+		oyster_utils.LogIfError(err, nil)
+		return c.Error(500, err)
+	}
+	treasureSigning := make(map[string]int)
+	for _, treasure := range treasures {
+		treasureSigning[models.SignedStatusMap[treasure.SignedStatus]]++
+	}
+
+	res := uploadSessionStatusResV3{
+		ID:                  session.ID.String(),
+		PaymentStatus:       session.GetPaymentStatus(),
+		AllDataReady:        session.AllDataReady == models.AllDataReady,
+		AttachProgress:      session.GetProgressPercentage(session.NextIdxToAttach),
+		VerifyProgress:      session.GetProgressPercentage(session.NextIdxToVerify),
+		TreasureResponsible: session.TreasureResponsibilityStatus != models.TreasureNotResponsible,
+		TreasureSigning:     treasureSigning,
+	}
+
+	return c.Render(200, actions_utils.Render.JSON(res))
 }
 
 /* Create endpoint. */
@@ -101,6 +346,8 @@ func (usr *UploadSessionResourceV3) Create(c buffalo.Context) error {
 
 	alphaEthAddr, privKey, _ := EthWrapper.GenerateEthAddr()
 
+	quote := models.GetQuote(req.FileSizeBytes, req.StorageLengthInYears)
+
 	// Start Alpha Session.
 	alphaSession := models.UploadSession{
 		Type:                 models.SessionTypeAlpha,
@@ -108,6 +355,8 @@ func (usr *UploadSessionResourceV3) Create(c buffalo.Context) error {
 		FileSizeBytes:        req.FileSizeBytes,
 		NumChunks:            req.NumChunks,
 		StorageLengthInYears: req.StorageLengthInYears,
+		TotalCost:            quote.TotalCost,
+		TreasureCost:         quote.TreasureCost,
 		ETHAddrAlpha:         nulls.NewString(alphaEthAddr.Hex()),
 		ETHPrivateKey:        privKey,
 		Version:              req.Version,
@@ -117,46 +366,71 @@ func (usr *UploadSessionResourceV3) Create(c buffalo.Context) error {
 	hasBeta := req.BetaIP != ""
 	var betaSessionID = ""
 	if hasBeta {
+		req.Invoice = alphaSession.GetInvoice()
 		betaSessionRes, err := sendBetaWithUploadRequest(req)
 		if err != nil {
 			return c.Error(400, err)
 		}
 
 		betaSessionID = betaSessionRes.ID
+		alphaSession.BetaIP = nulls.NewString(req.BetaIP)
+		alphaSession.BetaSessionID = nulls.NewString(betaSessionID)
+		alphaSession.PeerAddress = nulls.NewString(req.BetaIP + ":3000")
 		alphaSession.ETHAddrBeta = nulls.NewString(betaSessionRes.ETHAddr)
 	}
 
+	cancelToken, err := alphaSession.NewCancelToken()
+	if err != nil {
+		oyster_utils.LogIfError(err, nil)
+		return c.Error(500, err)
+	}
 	if err := models.DB.Save(&alphaSession); err != nil {
 		oyster_utils.LogIfError(err, nil)
 		return c.Error(400, err)
 	}
 
+	buildHashChain(alphaSession)
+
 	res := uploadSessionCreateResV3{
 		ID:            alphaSession.ID.String(),
 		BetaSessionID: betaSessionID,
 		BatchSize:     BatchSize,
+		CancelToken:   cancelToken,
 	}
 
+	actions_utils.RecordUploadSessionCreated(c, res.ID)
 	return c.Render(200, actions_utils.Render.JSON(res))
 }
 
-/* CreateBeta endpoint. */
+/* CreateBeta endpoint.  The request must be signed by one of the brokers in the brokernodes table. */
 func (usr *UploadSessionResourceV3) CreateBeta(c buffalo.Context) error {
+	alphaETHAddr, err := actions_utils.VerifyBrokerRequest(c)
+	if err != nil {
+		return c.Error(401, err)
+	}
+
 	req, err := validateAndGetCreateReq(c)
 	if err != nil {
 		return err
 	}
 
+	quote, err := actions_utils.CheckBetaInvoice(req.Invoice, req.FileSizeBytes, req.StorageLengthInYears)
+	if err != nil {
+		return c.Error(400, err)
+	}
+
 	// Generates ETH address.
 	betaEthAddr, privKey, _ := EthWrapper.GenerateEthAddr()
 
 	u := models.UploadSession{
 		Type:                 models.SessionTypeBeta,
+		PeerAddress:          actions_utils.GetPeerAddress(alphaETHAddr),
 		GenesisHash:          req.GenesisHash,
 		NumChunks:            req.NumChunks,
 		FileSizeBytes:        req.FileSizeBytes,
 		StorageLengthInYears: req.StorageLengthInYears,
 		TotalCost:            req.Invoice.Cost,
+		TreasureCost:         quote.TreasureCost,
 		ETHAddrAlpha:         req.Invoice.EthAddress,
 		ETHAddrBeta:          nulls.NewString(betaEthAddr.Hex()),
 		ETHPrivateKey:        privKey,
@@ -167,6 +441,7 @@ func (usr *UploadSessionResourceV3) CreateBeta(c buffalo.Context) error {
 	if err := models.DB.Save(&u); err != nil {
 		return c.Error(400, err)
 	}
+	buildHashChain(u)
 
 	res := uploadSessionCreateBetaResV3{
 		ID: u.ID.String(),
@@ -175,6 +450,48 @@ func (usr *UploadSessionResourceV3) CreateBeta(c buffalo.Context) error {
 	return c.Render(200, actions_utils.Render.JSON(res))
 }
 
+/* buildHashChain builds the data maps of a new session in the background, as StartUploadSession does for v2, so
+that the chunks sent with their hash can be checked against the hash chain. */
+func buildHashChain(session models.UploadSession) {
+	go func() {
+		oyster_utils.LogIfError(models.BuildDataMapsForSession(session.GenesisHash, session.NumChunks), nil)
+	}()
+}
+
+/* Delete cancels an unpaid upload session.  Its batches in S3, data and treasures are deleted, and the beta broker is
+told to cancel its session as well.  Only the client which created an alpha session, with its cancel token, and the
+alpha broker of a beta session may cancel it. */
+func (usr *UploadSessionResourceV3) Delete(c buffalo.Context) error {
+	session := models.UploadSession{}
+	if err := models.DB.Find(&session, c.Param("id")); err != nil {
+		return c.Error(404, fmt.Errorf("Error in finding session for id %v", c.Param("id")))
+	}
+
+	if session.StorageMethod != models.StorageMethodS3 {
+		return c.Error(400, errors.New("Using the wrong endpoint. This endpoint is for V3 only"))
+	}
+
+	if err := actions_utils.AuthorizeSessionCancel(c, session); err != nil {
+		return c.Error(403, err)
+	}
+
+	if session.PaymentStatus == models.PaymentStatusConfirmed ||
+		EthWrapper.CheckPRLBalance(eth_gateway.StringToAddress(session.ETHAddrAlpha.String)).Int64() > 0 {
+		return c.Error(409, errors.New("Session has already been paid and cannot be canceled"))
+	}
+
+	if err := deleteDefaultBucketObjectKeys(session.GenesisHash + "/"); err != nil {
+		oyster_utils.LogIfError(err, nil)
+		return c.Error(500, err)
+	}
+	if err := models.DeleteUploadSession(session); err != nil {
+		return c.Error(500, err)
+	}
+	oyster_utils.LogIfError(actions_utils.CancelBetaSession(session, "v3"), nil)
+
+	return c.Render(200, actions_utils.Render.JSON(map[string]bool{"success": true}))
+}
+
 func validateAndGetCreateReq(c buffalo.Context) (uploadSessionCreateReqV3, error) {
 	req := uploadSessionCreateReqV3{}
 	if err := oyster_utils.ParseReqBody(c.Request(), &req); err != nil {
@@ -184,6 +501,9 @@ func validateAndGetCreateReq(c buffalo.Context) (uploadSessionCreateReqV3, error
 	if NumChunksLimit != -1 && req.NumChunks > NumChunksLimit {
 		return req, errors.New("This broker has a limit of " + fmt.Sprint(NumChunksLimit) + " file chunks.")
 	}
+	if len(req.PeerIPs) > 0 {
+		return req, errors.New("peerIps is not supported by v3, use the v2 endpoint for N-broker uploads")
+	}
 	return req, nil
 }
 
@@ -193,29 +513,92 @@ func validateAndGetUpdateReq(c buffalo.Context) (uploadSessionUpdateReqV3, error
 		return req, fmt.Errorf("Invalid request, unable to parse request body: %v", err)
 	}
 
-	if len(req.Chunks) > BatchSize {
-		return req, fmt.Errorf("Except chunks to be in a batch of size %v", BatchSize)
+	if err := validateChunkBatch(req.Chunks); err != nil {
+		return req, err
 	}
+	return req, nil
+}
 
-	sort.Sort(models.ChunkReqs(req.Chunks))
-	startValue := req.Chunks[0].Idx - 1
-	isIDUniqueIncrease := true
-	for _, chunk := range req.Chunks {
-		if startValue != chunk.Idx-1 {
-			isIDUniqueIncrease = false
-			break
+/* validateChunkBatch sorts the chunks, and checks that they are consecutive and all in the same batch. */
+func validateChunkBatch(chunks []models.ChunkReq) error {
+	if len(chunks) == 0 {
+		return errors.New("No chunks were provided")
+	}
+	if len(chunks) > BatchSize {
+		return fmt.Errorf("Except chunks to be in a batch of size %v", BatchSize)
+	}
+
+	sort.Sort(models.ChunkReqs(chunks))
+	for i := 1; i < len(chunks); i++ {
+		if chunks[i].Idx != chunks[i-1].Idx+1 {
+			return errors.New("Provided Id should be consecutive")
 		}
-		startValue = chunk.Idx
 	}
-	if !isIDUniqueIncrease {
-		return req, errors.New("Provided Id should be consecutive")
+	if chunks[0].Idx/BatchSize != chunks[len(chunks)-1].Idx/BatchSize {
+		return fmt.Errorf("Provided chunks should be in one batch of size %v", BatchSize)
 	}
-	return req, nil
+	return nil
+}
+
+/* getExistingChunkBatch returns the chunks of the batch object in S3 and its version, or no chunks and an empty
+version if the object does not exist. */
+func getExistingChunkBatch(objectKey string) ([]models.ChunkReq, string, error) {
+	objectKeys, err := listDefaultBucketObjectKeys(objectKey)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, key := range objectKeys {
+		if key == objectKey {
+			data, version, err := getDefaultBucketObjectVersion(objectKey)
+			if err != nil {
+				return nil, "", err
+			}
+			chunks, err := parseChunkBatch(objectKey, data)
+			return chunks, version, err
+		}
+	}
+	return []models.ChunkReq{}, "", nil
+}
+
+func parseChunkBatch(objectKey string, data string) ([]models.ChunkReq, error) {
+	chunks := []models.ChunkReq{}
+	if err := json.Unmarshal([]byte(data), &chunks); err != nil {
+		return nil, fmt.Errorf("Unable to parse the chunks of %v: %v", objectKey, err)
+	}
+	return chunks, nil
+}
+
+/* mergeChunkBatch returns the chunks of both batches sorted by index.  A chunk of newChunks replaces the stored
+chunk with the same index. */
+func mergeChunkBatch(storedChunks []models.ChunkReq, newChunks []models.ChunkReq) []models.ChunkReq {
+	chunksByIdx := make(map[int]models.ChunkReq)
+	for _, chunk := range append(storedChunks, newChunks...) {
+		chunksByIdx[chunk.Idx] = chunk
+	}
+
+	merged := make([]models.ChunkReq, 0, len(chunksByIdx))
+	for _, chunk := range chunksByIdx {
+		merged = append(merged, chunk)
+	}
+	sort.Sort(models.ChunkReqs(merged))
+	return merged
+}
+
+func mergeUniqueIndexes(a []int, b []int) []int {
+	seen := make(map[int]bool)
+	merged := []int{}
+	for _, idx := range append(a, b...) {
+		if !seen[idx] {
+			seen[idx] = true
+			merged = append(merged, idx)
+		}
+	}
+	return merged
 }
 
 func sendBetaWithUploadRequest(req uploadSessionCreateReqV3) (uploadSessionCreateBetaResV3, error) {
 	betaSessionRes := uploadSessionCreateBetaResV3{}
 	betaURL := req.BetaIP + ":3000/api/v3/upload-sessions/beta"
-	err := oyster_utils.SendHttpReq(betaURL, req, betaSessionRes)
+	err := services.SendSignedBrokerRequest(http.MethodPost, betaURL, req, &betaSessionRes)
 	return betaSessionRes, err
 }
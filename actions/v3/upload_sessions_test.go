@@ -0,0 +1,503 @@
+package actions_v3
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http/httptest"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/oysterprotocol/brokernode/actions/utils"
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/services/blobstore"
+	"github.com/oysterprotocol/brokernode/utils"
+	"github.com/oysterprotocol/brokernode/utils/eth_gateway"
+	"github.com/shopspring/decimal"
+)
+
+type mockCheckPRLBalance struct {
+	hasCalled  bool
+	input_addr common.Address
+	output_int *big.Int
+}
+
+func (suite *ActionSuite) Test_UploadSessionsGetPaymentStatus_Paid() {
+	mockCheckPRLBalance := mockCheckPRLBalance{}
+	EthWrapper = eth_gateway.Eth{
+		CheckPRLBalance: mockCheckPRLBalance.checkPRLBalance,
+	}
+
+	uploadSession := models.UploadSession{
+		GenesisHash:     oyster_utils.RandSeq(8, []rune("abcdef0123456789")),
+		NumChunks:       200,
+		PaymentStatus:   models.PaymentStatusConfirmed,
+		AllDataReady:    models.AllDataReady,
+		NextIdxToAttach: 100,
+		NextIdxToVerify: 50,
+		StorageMethod:   models.StorageMethodS3,
+	}
+	suite.Nil(suite.DB.Save(&uploadSession))
+
+	treasure := models.Treasure{
+		GenesisHash:  uploadSession.GenesisHash,
+		SignedStatus: models.TreasureSigned,
+	}
+	suite.Nil(suite.DB.Save(&treasure))
+
+	resParsed := getPaymentStatus(uploadSession, suite)
+
+	suite.Equal("confirmed", resParsed.PaymentStatus)
+	suite.True(resParsed.AllDataReady)
+	suite.Equal(float64(50), resParsed.AttachProgress)
+	suite.Equal(float64(25), resParsed.VerifyProgress)
+	suite.Equal(map[string]int{"TreasureSigned": 1}, resParsed.TreasureSigning)
+	suite.False(mockCheckPRLBalance.hasCalled)
+}
+
+func (suite *ActionSuite) Test_UploadSessionsGetPaymentStatus_NoConfirmButCheckComplete() {
+	mockCheckPRLBalance := mockCheckPRLBalance{
+		output_int: big.NewInt(10),
+	}
+	EthWrapper = eth_gateway.Eth{
+		CheckPRLBalance: mockCheckPRLBalance.checkPRLBalance,
+	}
+
+	uploadSession := models.UploadSession{
+		GenesisHash:   oyster_utils.RandSeq(8, []rune("abcdef0123456789")),
+		NumChunks:     2,
+		PaymentStatus: models.PaymentStatusInvoiced,
+		ETHAddrAlpha:  nulls.NewString("alpha"),
+		StorageMethod: models.StorageMethodS3,
+	}
+	suite.Nil(suite.DB.Save(&uploadSession))
+
+	resParsed := getPaymentStatus(uploadSession, suite)
+
+	suite.Equal("confirmed", resParsed.PaymentStatus)
+	suite.False(resParsed.AllDataReady)
+	suite.True(mockCheckPRLBalance.hasCalled)
+	suite.Equal(eth_gateway.StringToAddress(uploadSession.ETHAddrAlpha.String), mockCheckPRLBalance.input_addr)
+
+	session := models.UploadSession{}
+	suite.Nil(suite.DB.Find(&session, resParsed.ID))
+	suite.Equal(models.PaymentStatusConfirmed, session.PaymentStatus)
+}
+
+func (suite *ActionSuite) Test_UploadSessionsGetPaymentStatus_NotS3Session() {
+	uploadSession := models.UploadSession{
+		GenesisHash:   oyster_utils.RandSeq(8, []rune("abcdef0123456789")),
+		NumChunks:     2,
+		StorageMethod: models.StorageMethodBadger,
+	}
+	suite.Nil(suite.DB.Save(&uploadSession))
+
+	res := suite.JSON("/api/v3/upload-sessions/" + fmt.Sprint(uploadSession.ID)).Get()
+
+	suite.Equal(400, res.Code)
+}
+
+func (suite *ActionSuite) Test_UploadSessionsGetManifest_NothingReceived() {
+	uploadSession := models.UploadSession{
+		GenesisHash:   oyster_utils.RandSeq(8, []rune("abcdef0123456789")),
+		NumChunks:     60,
+		StorageMethod: models.StorageMethodS3,
+	}
+	suite.Nil(suite.DB.Save(&uploadSession))
+
+	res := suite.JSON("/api/v3/upload-sessions/" + fmt.Sprint(uploadSession.ID) + "/manifest").Get()
+	suite.Equal(200, res.Code)
+
+	resParsed := uploadSessionManifestResV3{}
+	bodyBytes, err := ioutil.ReadAll(res.Body)
+	suite.Nil(err)
+	suite.Nil(json.Unmarshal(bodyBytes, &resParsed))
+
+	suite.Equal(60, resParsed.NumChunks)
+	suite.Equal(BatchSize, resParsed.BatchSize)
+	suite.Equal(0, resParsed.NumReceived)
+	suite.Equal(0, len(resParsed.Received))
+	suite.Equal([]oyster_utils.IndexRange{{Start: 0, End: 59}}, resParsed.Missing)
+}
+
+func (suite *ActionSuite) Test_UploadSessionsGetManifest_PartialBatch() {
+	uploadSession := models.UploadSession{
+		GenesisHash:   oyster_utils.RandSeq(8, []rune("abcdef0123456789")),
+		NumChunks:     60,
+		StorageMethod: models.StorageMethodS3,
+	}
+	suite.Nil(suite.DB.Save(&uploadSession))
+
+	// only the chunks which were sent are reported, not the whole batch
+	res := suite.JSON("/api/v3/upload-sessions/" + fmt.Sprint(uploadSession.ID)).Put(map[string]interface{}{
+		"chunks": []models.ChunkReq{
+			{Idx: 3, Hash: uploadSession.GenesisHash, Data: "ABC"},
+			{Idx: 4, Hash: uploadSession.GenesisHash, Data: "ABC"},
+		},
+	})
+	suite.Equal(202, res.Code)
+
+	res = suite.JSON("/api/v3/upload-sessions/" + fmt.Sprint(uploadSession.ID) + "/manifest").Get()
+	suite.Equal(200, res.Code)
+
+	resParsed := uploadSessionManifestResV3{}
+	suite.Nil(json.Unmarshal(res.Body.Bytes(), &resParsed))
+
+	suite.Equal(2, resParsed.NumReceived)
+	suite.Equal([]oyster_utils.IndexRange{{Start: 3, End: 4}}, resParsed.Received)
+	suite.Equal([]oyster_utils.IndexRange{{Start: 0, End: 2}, {Start: 5, End: 59}}, resParsed.Missing)
+}
+
+func (suite *ActionSuite) Test_UploadSessionsUpdate_InvalidChunks() {
+	uploadSession := models.UploadSession{
+		GenesisHash:   oyster_utils.RandSeq(8, []rune("abcdef0123456789")),
+		NumChunks:     2,
+		StorageMethod: models.StorageMethodS3,
+	}
+	suite.Nil(suite.DB.Save(&uploadSession))
+
+	res := suite.JSON("/api/v3/upload-sessions/" + fmt.Sprint(uploadSession.ID)).Put(map[string]interface{}{
+		"chunks": []models.ChunkReq{
+			{Idx: 1, Hash: uploadSession.GenesisHash, Data: "ABC"},
+			{Idx: 2, Hash: uploadSession.GenesisHash, Data: "ABC"},
+		},
+	})
+	suite.Equal(400, res.Code)
+
+	resParsed := uploadSessionUpdateErrResV3{}
+	bodyBytes, err := ioutil.ReadAll(res.Body)
+	suite.Nil(err)
+	suite.Nil(json.Unmarshal(bodyBytes, &resParsed))
+
+	suite.Equal(1, len(resParsed.ChunkErrors))
+	suite.Equal(2, resParsed.ChunkErrors[0].Idx)
+
+	keys, err := listDefaultBucketObjectKeys(uploadSession.GenesisHash + "/")
+	suite.Nil(err)
+	suite.Equal(0, len(keys))
+}
+
+func getPaymentStatus(session models.UploadSession, suite *ActionSuite) uploadSessionStatusResV3 {
+	res := suite.JSON("/api/v3/upload-sessions/" + fmt.Sprint(session.ID)).Get()
+	suite.Equal(200, res.Code)
+
+	resParsed := uploadSessionStatusResV3{}
+	bodyBytes, err := ioutil.ReadAll(res.Body)
+	suite.Nil(err)
+	suite.Nil(json.Unmarshal(bodyBytes, &resParsed))
+
+	return resParsed
+}
+
+func (v *mockCheckPRLBalance) checkPRLBalance(addr common.Address) *big.Int {
+	v.hasCalled = true
+	v.input_addr = addr
+	return v.output_int
+}
+
+func (suite *ActionSuite) Test_UploadSessionsUpdate_ChunkFrames() {
+	uploadSession := models.UploadSession{
+		GenesisHash:   oyster_utils.RandSeq(8, []rune("abcdef0123456789")),
+		NumChunks:     30,
+		StorageMethod: models.StorageMethodS3,
+	}
+	suite.Nil(suite.DB.Save(&uploadSession))
+
+	chunks := []models.ChunkReq{}
+	for i := 0; i < 30; i++ {
+		chunks = append(chunks, models.ChunkReq{Idx: i, Hash: uploadSession.GenesisHash, Data: "ABC"})
+	}
+
+	res := putChunkFrames(suite, "/api/v3/upload-sessions/"+fmt.Sprint(uploadSession.ID), chunks)
+	suite.Equal(202, res.Code)
+
+	// one object for each batch
+	keys, err := listDefaultBucketObjectKeys(uploadSession.GenesisHash + "/")
+	suite.Nil(err)
+	suite.Equal(2, len(keys))
+
+	data, err := getDefaultBucketObject(uploadSession.GenesisHash+"/1", false)
+	suite.Nil(err)
+	storedChunks := []models.ChunkReq{}
+	suite.Nil(json.Unmarshal([]byte(data), &storedChunks))
+	suite.Equal(chunks[BatchSize:], storedChunks)
+}
+
+func (suite *ActionSuite) Test_UploadSessionsUpdate_ChunkFramesInvalidChunks() {
+	uploadSession := models.UploadSession{
+		GenesisHash:   oyster_utils.RandSeq(8, []rune("abcdef0123456789")),
+		NumChunks:     30,
+		StorageMethod: models.StorageMethodS3,
+	}
+	suite.Nil(suite.DB.Save(&uploadSession))
+
+	chunks := []models.ChunkReq{}
+	for i := 0; i < 30; i++ {
+		chunks = append(chunks, models.ChunkReq{Idx: i, Hash: uploadSession.GenesisHash, Data: "ABC"})
+	}
+	chunks[27].Hash = "abcdef"
+
+	res := putChunkFrames(suite, "/api/v3/upload-sessions/"+fmt.Sprint(uploadSession.ID), chunks)
+	suite.Equal(400, res.Code)
+
+	resParsed := uploadSessionUpdateErrResV3{}
+	suite.Nil(json.Unmarshal(res.Body.Bytes(), &resParsed))
+	suite.Equal(BatchSize, resParsed.NumChunksStored)
+	suite.Equal(1, len(resParsed.ChunkErrors))
+	suite.Equal(27, resParsed.ChunkErrors[0].Idx)
+
+	keys, err := listDefaultBucketObjectKeys(uploadSession.GenesisHash + "/")
+	suite.Nil(err)
+	suite.Equal(1, len(keys))
+}
+
+func (suite *ActionSuite) Test_UploadSessionsUpdate_MergesPartialBatches() {
+	uploadSession := models.UploadSession{
+		GenesisHash:   oyster_utils.RandSeq(8, []rune("abcdef0123456789")),
+		NumChunks:     4,
+		StorageMethod: models.StorageMethodS3,
+	}
+	suite.Nil(suite.DB.Save(&uploadSession))
+
+	chunks := []models.ChunkReq{}
+	for i := 0; i < 4; i++ {
+		chunks = append(chunks, models.ChunkReq{Idx: i, Hash: uploadSession.GenesisHash, Data: "ABC"})
+	}
+
+	res := suite.JSON("/api/v3/upload-sessions/" + fmt.Sprint(uploadSession.ID)).Put(map[string]interface{}{
+		"chunks": chunks[2:],
+	})
+	suite.Equal(202, res.Code)
+	res = putChunkFrames(suite, "/api/v3/upload-sessions/"+fmt.Sprint(uploadSession.ID), chunks[:2])
+	suite.Equal(202, res.Code)
+
+	// the second request does not overwrite the chunks of the first one
+	data, err := getDefaultBucketObject(uploadSession.GenesisHash+"/0", false)
+	suite.Nil(err)
+	storedChunks := []models.ChunkReq{}
+	suite.Nil(json.Unmarshal([]byte(data), &storedChunks))
+	suite.Equal(chunks, storedChunks)
+}
+
+/* racingBlobStore sets an object right before the first conditional set, as a request to another broker replica
+would. */
+type racingBlobStore struct {
+	blobstore.BlobStore
+	objectKey string
+	data      string
+	hasRaced  bool
+}
+
+func (s *racingBlobStore) SetObjectVersion(bucketName string, objectKey string, data string, version string) error {
+	if !s.hasRaced {
+		s.hasRaced = true
+		s.BlobStore.SetObject(bucketName, s.objectKey, s.data)
+	}
+	return s.BlobStore.SetObjectVersion(bucketName, objectKey, data, version)
+}
+
+func (suite *ActionSuite) Test_UploadSessionsUpdate_MergesConcurrentPartialBatches() {
+	uploadSession := models.UploadSession{
+		GenesisHash:   oyster_utils.RandSeq(8, []rune("abcdef0123456789")),
+		NumChunks:     4,
+		StorageMethod: models.StorageMethodS3,
+	}
+	suite.Nil(suite.DB.Save(&uploadSession))
+
+	chunks := []models.ChunkReq{}
+	for i := 0; i < 4; i++ {
+		chunks = append(chunks, models.ChunkReq{Idx: i, Hash: uploadSession.GenesisHash, Data: "ABC"})
+	}
+	otherData, err := json.Marshal(chunks[2:])
+	suite.Nil(err)
+
+	defer func(store blobstore.BlobStore) { BlobStore = store }(BlobStore)
+	BlobStore = &racingBlobStore{BlobStore: BlobStore, objectKey: uploadSession.GenesisHash + "/0",
+		data: string(otherData)}
+
+	res := suite.JSON("/api/v3/upload-sessions/" + fmt.Sprint(uploadSession.ID)).Put(map[string]interface{}{
+		"chunks": chunks[:2],
+	})
+	suite.Equal(202, res.Code)
+
+	// the chunks set in between are read and merged again instead of being overwritten
+	data, err := getDefaultBucketObject(uploadSession.GenesisHash+"/0", false)
+	suite.Nil(err)
+	storedChunks := []models.ChunkReq{}
+	suite.Nil(json.Unmarshal([]byte(data), &storedChunks))
+	suite.Equal(chunks, storedChunks)
+}
+
+func (suite *ActionSuite) Test_UploadSessionsUpdate_ChunkFramesNotConsecutive() {
+	uploadSession := models.UploadSession{
+		GenesisHash:   oyster_utils.RandSeq(8, []rune("abcdef0123456789")),
+		NumChunks:     4,
+		StorageMethod: models.StorageMethodS3,
+	}
+	suite.Nil(suite.DB.Save(&uploadSession))
+
+	res := putChunkFrames(suite, "/api/v3/upload-sessions/"+fmt.Sprint(uploadSession.ID), []models.ChunkReq{
+		{Idx: 0, Hash: uploadSession.GenesisHash, Data: "ABC"},
+		{Idx: 1, Hash: uploadSession.GenesisHash, Data: "ABC"},
+		{Idx: 3, Hash: uploadSession.GenesisHash, Data: "ABC"},
+	})
+	suite.Equal(400, res.Code)
+
+	keys, err := listDefaultBucketObjectKeys(uploadSession.GenesisHash + "/")
+	suite.Nil(err)
+	suite.Equal(0, len(keys))
+}
+
+func putChunkFrames(suite *ActionSuite, url string, chunks []models.ChunkReq) *httptest.ResponseRecorder {
+	body := bytes.Buffer{}
+	for _, chunk := range chunks {
+		suite.Nil(models.WriteChunkFrame(&body, chunk))
+	}
+
+	req := httptest.NewRequest("PUT", url, &body)
+	req.Header.Set("Content-Type", models.ChunkFrameContentType)
+	res := httptest.NewRecorder()
+	suite.App.ServeHTTP(res, req)
+	return res
+}
+
+func (suite *ActionSuite) Test_UploadSessionsDelete_Unpaid() {
+	mockCheckPRLBalance := mockCheckPRLBalance{
+		output_int: big.NewInt(0),
+	}
+	EthWrapper = eth_gateway.Eth{
+		CheckPRLBalance: mockCheckPRLBalance.checkPRLBalance,
+	}
+
+	uploadSession := models.UploadSession{
+		GenesisHash:   oyster_utils.RandSeq(8, []rune("abcdef0123456789")),
+		NumChunks:     2,
+		PaymentStatus: models.PaymentStatusInvoiced,
+		ETHAddrAlpha:  nulls.NewString("alpha"),
+		StorageMethod: models.StorageMethodS3,
+	}
+	cancelToken, err := uploadSession.NewCancelToken()
+	suite.Nil(err)
+	suite.Nil(suite.DB.Save(&uploadSession))
+	suite.Nil(setDefaultBucketObject(uploadSession.GenesisHash+"/0", "[]"))
+	suite.Nil(models.SetUploadBatchReceived(uploadSession.GenesisHash, 0, []int{}))
+	suite.Nil(suite.DB.Save(&models.Treasure{GenesisHash: uploadSession.GenesisHash}))
+
+	// a wrong cancel token is rejected before the balance is checked
+	req := suite.JSON("/api/v3/upload-sessions/" + fmt.Sprint(uploadSession.ID))
+	req.Headers[actions_utils.CancelTokenHeader] = "wrong"
+	res := req.Delete()
+	suite.Equal(403, res.Code)
+	suite.False(mockCheckPRLBalance.hasCalled)
+
+	req = suite.JSON("/api/v3/upload-sessions/" + fmt.Sprint(uploadSession.ID))
+	req.Headers[actions_utils.CancelTokenHeader] = cancelToken
+	res = req.Delete()
+	suite.Equal(200, res.Code)
+	suite.True(mockCheckPRLBalance.hasCalled)
+
+	count, err := suite.DB.Where("id = ?", uploadSession.ID).Count(&models.UploadSession{})
+	suite.Nil(err)
+	suite.Equal(0, count)
+	count, err = suite.DB.Where("genesis_hash = ?", uploadSession.GenesisHash).Count(&models.Treasure{})
+	suite.Nil(err)
+	suite.Equal(0, count)
+	keys, err := listDefaultBucketObjectKeys(uploadSession.GenesisHash + "/")
+	suite.Nil(err)
+	suite.Equal(0, len(keys))
+	count, err = suite.DB.Where("genesis_hash = ?", uploadSession.GenesisHash).Count(&models.UploadBatch{})
+	suite.Nil(err)
+	suite.Equal(0, count)
+}
+
+func (suite *ActionSuite) Test_UploadSessionsDelete_HasBalance() {
+	mockCheckPRLBalance := mockCheckPRLBalance{
+		output_int: big.NewInt(10),
+	}
+	EthWrapper = eth_gateway.Eth{
+		CheckPRLBalance: mockCheckPRLBalance.checkPRLBalance,
+	}
+
+	uploadSession := models.UploadSession{
+		GenesisHash:   oyster_utils.RandSeq(8, []rune("abcdef0123456789")),
+		NumChunks:     2,
+		PaymentStatus: models.PaymentStatusInvoiced,
+		ETHAddrAlpha:  nulls.NewString("alpha"),
+		StorageMethod: models.StorageMethodS3,
+	}
+	cancelToken, err := uploadSession.NewCancelToken()
+	suite.Nil(err)
+	suite.Nil(suite.DB.Save(&uploadSession))
+	suite.Nil(setDefaultBucketObject(uploadSession.GenesisHash+"/0", "[]"))
+
+	req := suite.JSON("/api/v3/upload-sessions/" + fmt.Sprint(uploadSession.ID))
+	req.Headers[actions_utils.CancelTokenHeader] = cancelToken
+	res := req.Delete()
+	suite.Equal(409, res.Code)
+
+	session := models.UploadSession{}
+	suite.Nil(suite.DB.Find(&session, uploadSession.ID))
+	keys, err := listDefaultBucketObjectKeys(uploadSession.GenesisHash + "/")
+	suite.Nil(err)
+	suite.Equal(1, len(keys))
+}
+
+func (suite *ActionSuite) Test_UploadSessionsCreate_PeerIPs() {
+	genHash := oyster_utils.RandSeq(8, []rune("abcdef0123456789"))
+	res := suite.JSON("/api/v3/upload-sessions").Post(map[string]interface{}{
+		"genesisHash":          genHash,
+		"fileSizeBytes":        123,
+		"numChunks":            2,
+		"storageLengthInYears": 1,
+		"peerIps":              []string{"http://1.1.1.1"},
+	})
+	suite.Equal(400, res.Code)
+
+	count, err := suite.DB.Where("genesis_hash = ?", genHash).Count(&models.UploadSession{})
+	suite.Nil(err)
+	suite.Equal(0, count)
+}
+
+func (suite *ActionSuite) Test_UploadSessionsCreateBeta() {
+	suite.Nil(actions_utils.AddSigningBrokernodeForTest())
+	reqBody := map[string]interface{}{
+		"genesisHash":          oyster_utils.RandSeq(8, []rune("abcdef0123456789")),
+		"fileSizeBytes":        123,
+		"numChunks":            2,
+		"storageLengthInYears": 1,
+		"invoice":              map[string]interface{}{"cost": 0.001},
+	}
+
+	res := suite.JSON("/api/v3/upload-sessions/beta").Post(reqBody)
+	suite.Equal(401, res.Code)
+
+	// the invoice pays less than this broker charges
+	signedRes := postSignedBetaRequest(suite, reqBody)
+	suite.Equal(400, signedRes.Code)
+
+	reqBody["invoice"] = map[string]interface{}{"cost": 1}
+	signedRes = postSignedBetaRequest(suite, reqBody)
+	suite.Equal(200, signedRes.Code)
+
+	resParsed := uploadSessionCreateBetaResV3{}
+	suite.Nil(json.Unmarshal(signedRes.Body.Bytes(), &resParsed))
+	session := models.UploadSession{}
+	suite.Nil(suite.DB.Find(&session, resParsed.ID))
+	suite.Equal(models.SessionTypeBeta, session.Type)
+	suite.Equal("1", session.TotalCost.String())
+	suite.True(session.TreasureCost.GreaterThan(decimal.Zero))
+}
+
+func postSignedBetaRequest(suite *ActionSuite, reqBody map[string]interface{}) *httptest.ResponseRecorder {
+	body, err := json.Marshal(reqBody)
+	suite.Nil(err)
+	req := httptest.NewRequest("POST", "/api/v3/upload-sessions/beta", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	suite.Nil(services.SignBrokerRequest(req, body))
+	res := httptest.NewRecorder()
+	suite.App.ServeHTTP(res, req)
+	return res
+}
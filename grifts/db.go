@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/gobuffalo/pop/nulls"
 	"github.com/iotaledger/iota.go/trinary"
 	"github.com/markbates/grift/grift"
 	"github.com/oysterprotocol/brokernode/jobs"
@@ -372,6 +373,39 @@ var _ = grift.Namespace("db", func() {
 		return nil
 	})
 
+	grift.Desc("print_verification_report", "Prints the verification report of a genesis hash")
+	grift.Add("print_verification_report", func(c *grift.Context) error {
+
+		if len(c.Args) == 0 {
+			err := errors.New("pass the genesis hash of the report")
+			fmt.Println(err)
+			return err
+		}
+
+		report, err := models.GetVerificationReport(c.Args[0])
+		if err != nil {
+			fmt.Println(err)
+			return err
+		}
+		if report == nil {
+			fmt.Println("No verification report for genesis hash " + c.Args[0])
+			return nil
+		}
+
+		fmt.Println("____________________________________________")
+		fmt.Println("Genesis hash:        " + report.GenesisHash)
+		fmt.Println("Number of chunks:    " + strconv.Itoa(report.NumChunks))
+		fmt.Println("Chunks matching:     " + strconv.Itoa(report.ChunksMatching))
+		fmt.Println("Chunks not attached: " + strconv.Itoa(report.ChunksNotAttached))
+		fmt.Println("Chunks mismatched:   " + strconv.Itoa(report.ChunksMismatched))
+		fmt.Println("Reattach count:      " + strconv.Itoa(report.ReattachCount))
+		fmt.Println("Last verified at:    " + report.LastVerifiedAt.String())
+		fmt.Println("Complete:            " + strconv.FormatBool(report.IsComplete()))
+		fmt.Println("____________________________________________")
+
+		return nil
+	})
+
 	grift.Desc("print_genesis_hashes", "Prints the stored genesis hashes")
 	grift.Add("print_genesis_hashes", func(c *grift.Context) error {
 
@@ -434,6 +468,7 @@ var _ = grift.Namespace("db", func() {
 				if brokerIP != hostIP {
 					vErr, err := models.DB.ValidateAndCreate(&models.Brokernode{
 						Address: "http://" + brokerIP + ":3000",
+						Status:  models.BrokernodeActive,
 					})
 					if err != nil || len(vErr.Errors) != 0 {
 						fmt.Println(err)
@@ -447,6 +482,7 @@ var _ = grift.Namespace("db", func() {
 				if brokerIP != hostIP {
 					vErr, err := models.DB.ValidateAndCreate(&models.Brokernode{
 						Address: "http://" + brokerIP + ":3000",
+						Status:  models.BrokernodeActive,
 					})
 					if err != nil || len(vErr.Errors) != 0 {
 						fmt.Println(err)
@@ -462,6 +498,50 @@ var _ = grift.Namespace("db", func() {
 		return nil
 	})
 
+	grift.Desc("add_brokernode", "add a brokernode with the ETH address it signs its requests with, "+
+		"i.e. add_brokernode http://1.2.3.4:3000 0x...")
+	grift.Add("add_brokernode", func(c *grift.Context) error {
+
+		if len(c.Args) < 2 || !common.IsHexAddress(c.Args[1]) {
+			err := errors.New("expected the address of the brokernode and its ETH address")
+			fmt.Println(err)
+			return err
+		}
+
+		vErr, err := models.DB.ValidateAndCreate(&models.Brokernode{
+			Address:    c.Args[0],
+			ETHAddress: nulls.NewString(common.HexToAddress(c.Args[1]).Hex()),
+			Status:     models.BrokernodeActive,
+		})
+		if err != nil || len(vErr.Errors) != 0 {
+			fmt.Println(err)
+			fmt.Println(vErr)
+			return err
+		}
+
+		fmt.Println("Successfully added brokernode to database!")
+		return nil
+	})
+
+	grift.Desc("approve_brokernode", "approve a brokernode which announced itself, by the ETH address it signs its "+
+		"requests with, i.e. approve_brokernode 0x...")
+	grift.Add("approve_brokernode", func(c *grift.Context) error {
+
+		if len(c.Args) < 1 || !common.IsHexAddress(c.Args[0]) {
+			err := errors.New("expected the ETH address of the brokernode")
+			fmt.Println(err)
+			return err
+		}
+
+		if err := models.ApproveBrokernode(c.Args[0]); err != nil {
+			fmt.Println(err)
+			return err
+		}
+
+		fmt.Println("Successfully approved brokernode!")
+		return nil
+	})
+
 	grift.Desc("print_brokernodes", "print brokernodes")
 	grift.Add("print_brokernodes", func(c *grift.Context) error {
 
@@ -0,0 +1,40 @@
+package jobs
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/utils"
+	"github.com/oysterprotocol/brokernode/utils/eth_gateway"
+)
+
+/*AnnounceBrokernode tells each approved broker in the registry the address, API URL, capacity and version of this
+broker, so that they add it to their registries.  Returns the number of brokers which accepted the announcement.*/
+func AnnounceBrokernode(PrometheusWrapper services.PrometheusService,
+	announcement models.BrokernodeAnnouncement) (int, error) {
+	start := PrometheusWrapper.TimeNow()
+	defer PrometheusWrapper.HistogramSeconds(PrometheusWrapper.HistogramAnnounceBrokernode, start)
+
+	brokernodes, err := models.GetBrokernodesToHealthCheck()
+	if err != nil {
+		return 0, err
+	}
+
+	numAnnounced := 0
+	for _, brokernode := range brokernodes {
+		if strings.EqualFold(brokernode.ETHAddress.String, eth_gateway.MainWalletAddress.Hex()) ||
+			brokernode.Address == announcement.Address {
+			continue
+		}
+
+		err := services.SendSignedBrokerRequest(http.MethodPost, brokernode.GetAPIURL()+"/api/v2/brokernodes",
+			announcement, &models.BrokernodeAnnouncement{})
+		oyster_utils.LogIfError(err, map[string]interface{}{"brokernodeAddress": brokernode.Address})
+		if err == nil {
+			numAnnounced++
+		}
+	}
+	return numAnnounced, nil
+}
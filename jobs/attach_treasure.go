@@ -9,27 +9,41 @@ import (
 	"time"
 )
 
-/*AttachTreasuresToTangle calls attachment and verification methods for treasures*/
+/*AttachTreasuresToTangle calls attachment and verification methods for treasures.  Treasures which failed to
+attach are retried once they have not been updated since retryThresholdTime, and attached treasures which are
+still not on the tangle at verifyThresholdTime are attached again.*/
 func AttachTreasuresToTangle(iotaWrapper services.IotaService, PrometheusWrapper services.PrometheusService,
-	thresholdTime time.Time) {
+	retryThresholdTime time.Time, verifyThresholdTime time.Time) (int, error) {
 
 	start := PrometheusWrapper.TimeNow()
 	defer PrometheusWrapper.HistogramSeconds(PrometheusWrapper.HistogramAttachTreasuresToTangle, start)
 
-	AttachTreasureTransactions(iotaWrapper)
-	VerifyTreasureTransactions(iotaWrapper, thresholdTime)
+	numAttached, attachErr := AttachTreasureTransactions(iotaWrapper, retryThresholdTime)
+	numVerified, verifyErr := VerifyTreasureTransactions(iotaWrapper, verifyThresholdTime)
+	if attachErr != nil {
+		return numAttached + numVerified, attachErr
+	}
+	return numAttached + numVerified, verifyErr
 }
 
-/*AttachTreasureTransactions is responsible for attaching the treasures to the tangle*/
-func AttachTreasureTransactions(iotaWrapper services.IotaService) {
+/*AttachTreasureTransactions is responsible for attaching the treasures to the tangle.  Returns the number of
+treasures attached.*/
+func AttachTreasureTransactions(iotaWrapper services.IotaService, retryThresholdTime time.Time) (int, error) {
 	var vErr *validate.Errors
-	treasuresToAttach, err := models.GetTreasuresToBuryBySignedStatus([]models.SignedStatus{models.TreasureSigned,
-		models.TreasureAttachError})
+	treasuresToAttach, err := models.GetTreasuresToBuryBySignedStatus([]models.SignedStatus{models.TreasureSigned})
+	if err != nil {
+		oyster_utils.LogIfError(err, nil)
+		return 0, err
+	}
+	treasuresToRetry, err := models.GetTreasuresBySignedStatusAndUpdateTime(
+		[]models.SignedStatus{models.TreasureAttachError}, retryThresholdTime)
 	if err != nil {
 		oyster_utils.LogIfError(err, nil)
-		return
+		return 0, err
 	}
+	treasuresToAttach = append(treasuresToAttach, treasuresToRetry...)
 
+	numAttached := 0
 	for _, treasure := range treasuresToAttach {
 		chunk := oyster_utils.ChunkData{
 			Address:     treasure.Address,
@@ -43,6 +57,9 @@ func AttachTreasureTransactions(iotaWrapper services.IotaService) {
 		displayString := "SUCCESS"
 		if err == nil {
 			newStatus = models.TreasureSignedAndAttached
+		} else if err == services.ErrAttachPending {
+			displayString = "PENDING"
+			newStatus = models.TreasureAttachPending
 		} else {
 			displayString = "ERROR"
 			newStatus = models.TreasureAttachError
@@ -55,19 +72,23 @@ func AttachTreasureTransactions(iotaWrapper services.IotaService) {
 		if err != nil || vErr.HasAny() {
 			displayString = "ERROR"
 		}
+		if displayString == "SUCCESS" {
+			numAttached++
+		}
 		logTreasureAttachmentResult("attach_treasure attempted: "+displayString, treasure)
 	}
+	return numAttached, nil
 }
 
 /*VerifyTreasureTransactions verifies the treasures that are supposedly attached to the tangle.
 It will also set treasures to an error state if they have timed out or if what is on the tangle does
-not match our records.*/
-func VerifyTreasureTransactions(iotaWrapper services.IotaService, thresholdTime time.Time) {
+not match our records.  Returns the number of treasures checked.*/
+func VerifyTreasureTransactions(iotaWrapper services.IotaService, thresholdTime time.Time) (int, error) {
 	treasuresToAttach, err := models.GetTreasuresToBuryBySignedStatus([]models.SignedStatus{
-		models.TreasureSignedAndAttached})
+		models.TreasureSignedAndAttached, models.TreasureAttachPending})
 	if err != nil {
 		oyster_utils.LogIfError(err, nil)
-		return
+		return 0, err
 	}
 
 	for _, treasure := range treasuresToAttach {
@@ -86,6 +107,7 @@ func VerifyTreasureTransactions(iotaWrapper services.IotaService, thresholdTime
 
 		handleAttachmentResults(filteredChunks, treasure, thresholdTime)
 	}
+	return len(treasuresToAttach), nil
 }
 
 func handleAttachmentResults(filteredChunks services.FilteredChunk, treasure models.Treasure,
@@ -18,7 +18,7 @@ func (suite *JobsSuite) Test_AttachTreasureTransactions_success() {
 	makeOneTreasureOfEachSignedStatus(suite)
 
 	// call method under test
-	jobs.AttachTreasureTransactions(IotaMock)
+	jobs.AttachTreasureTransactions(IotaMock, time.Now().Add(time.Minute))
 
 	/*
 		Expectations:
@@ -61,7 +61,7 @@ func (suite *JobsSuite) Test_AttachTreasureTransactions_error() {
 	makeOneTreasureOfEachSignedStatus(suite)
 
 	// call method under test
-	jobs.AttachTreasureTransactions(IotaMock)
+	jobs.AttachTreasureTransactions(IotaMock, time.Now().Add(time.Minute))
 
 	/*
 		Expectations:
@@ -97,6 +97,57 @@ func (suite *JobsSuite) Test_AttachTreasureTransactions_error() {
 	suite.Equal(1, numTreasureSignedAndAttached)
 }
 
+func (suite *JobsSuite) Test_AttachTreasureTransactions_pending() {
+	IotaMock.DoPoW = func(chunks []oyster_utils.ChunkData) error {
+		return services.ErrAttachPending
+	}
+
+	// create one treasure for each SignedStatus
+	makeOneTreasureOfEachSignedStatus(suite)
+
+	// call method under test
+	numAttached, err := jobs.AttachTreasureTransactions(IotaMock, time.Now().Add(time.Minute))
+	suite.Nil(err)
+	suite.Equal(0, numAttached)
+
+	// the queued treasures are not attached until they are verified on the tangle
+	treasures := []models.Treasure{}
+	suite.Nil(suite.DB.Where("signed_status = ?", models.TreasureAttachPending).All(&treasures))
+	suite.Equal(3, len(treasures))
+	suite.Nil(suite.DB.Where("signed_status = ?", models.TreasureSignedAndAttached).All(&treasures))
+	suite.Equal(1, len(treasures))
+}
+
+func (suite *JobsSuite) Test_AttachTreasureTransactions_retry_delay() {
+	IotaMock.DoPoW = func(chunks []oyster_utils.ChunkData) error {
+		return nil
+	}
+
+	// create one treasure for each SignedStatus
+	makeOneTreasureOfEachSignedStatus(suite)
+
+	// call method under test, the treasure in TreasureAttachError has failed too recently to be retried
+	jobs.AttachTreasureTransactions(IotaMock, time.Now().Add(-1*time.Hour))
+
+	numTreasureAttachError := 0
+	numTreasureSignedAndAttached := 0
+
+	treasures := []models.Treasure{}
+	suite.DB.All(&treasures)
+
+	for _, treasure := range treasures {
+		if treasure.SignedStatus == models.TreasureAttachError {
+			numTreasureAttachError++
+		}
+		if treasure.SignedStatus == models.TreasureSignedAndAttached {
+			numTreasureSignedAndAttached++
+		}
+	}
+
+	suite.Equal(1, numTreasureAttachError)
+	suite.Equal(2, numTreasureSignedAndAttached)
+}
+
 func (suite *JobsSuite) Test_VerifyTreasureTransactions_error_while_verifying() {
 	IotaMock.VerifyChunkMessagesMatchRecord = func(chunks []oyster_utils.ChunkData) (filteredChunks services.FilteredChunk, err error) {
 		return services.FilteredChunk{
@@ -147,9 +198,9 @@ func (suite *JobsSuite) Test_VerifyTreasureTransactions_success() {
 
 	/*
 		Expectations:
-			-there will be 2 treasures with SignedStatus TreasureSignedAndAttachmentVerified. 1 was created in
-			makeOneTreasureOfEachSignedStatus() and 1 other will have this status after
-			we call the method under test
+			-there will be 3 treasures with SignedStatus TreasureSignedAndAttachmentVerified. 1 was created in
+			makeOneTreasureOfEachSignedStatus() and the attached and the pending treasures will have this status
+			after we call the method under test
 			-there will be no treasures with SignedStatus TreasureSignedAndAttached
 	*/
 
@@ -168,7 +219,7 @@ func (suite *JobsSuite) Test_VerifyTreasureTransactions_success() {
 		}
 	}
 
-	suite.Equal(2, numTreasureSignedAndAttachmentVerified)
+	suite.Equal(3, numTreasureSignedAndAttachmentVerified)
 	suite.Equal(0, numTreasureSignedAndAttached)
 }
 
@@ -189,9 +240,9 @@ func (suite *JobsSuite) Test_VerifyTreasureTransactions_does_not_match_record()
 
 	/*
 		Expectations:
-			-there will be 2 treasures with SignedStatus TreasureAttachError. 1 was created in
-			makeOneTreasureOfEachSignedStatus() and 1 other will have this status after
-			we call the method under test
+			-there will be 3 treasures with SignedStatus TreasureAttachError. 1 was created in
+			makeOneTreasureOfEachSignedStatus() and the attached and the pending treasures will have this
+			status after we call the method under test
 			-there will be no treasures with SignedStatus TreasureSignedAndAttached
 	*/
 
@@ -210,7 +261,7 @@ func (suite *JobsSuite) Test_VerifyTreasureTransactions_does_not_match_record()
 		}
 	}
 
-	suite.Equal(2, numTreasureAttachError)
+	suite.Equal(3, numTreasureAttachError)
 	suite.Equal(0, numTreasureSignedAndAttached)
 }
 
@@ -265,9 +316,9 @@ func (suite *JobsSuite) Test_VerifyTreasureTransactions_not_attached_timed_out()
 
 	/*
 		Expectations:
-			-the chunk is not attached and has timed out, so there will be 2 treasures with
+			-the chunks are not attached and have timed out, so there will be 3 treasures with
 			SignedStatus TreasureAttachError. 1 was created in makeOneTreasureOfEachSignedStatus()
-			and 1 other will have this status after we call the method under test
+			and the attached and the pending treasures will have this status after we call the method under test
 			-there will be no treasures with SignedStatus TreasureSignedAndAttached
 	*/
 
@@ -286,7 +337,7 @@ func (suite *JobsSuite) Test_VerifyTreasureTransactions_not_attached_timed_out()
 		}
 	}
 
-	suite.Equal(2, numTreasureAttachError)
+	suite.Equal(3, numTreasureAttachError)
 	suite.Equal(0, numTreasureSignedAndAttached)
 }
 
@@ -1,26 +1,33 @@
 package jobs
 
 import (
+	"github.com/dgraph-io/badger"
 	"github.com/oysterprotocol/brokernode/utils"
 )
 
-/*BadgerDbGc run garbage collector on current database to do compaction. It will spike the LSTM activity as a result.*/
-func BadgerDbGc() {
+/*BadgerDbGc run garbage collector on current database to do compaction. It will spike the LSTM activity as a result.
+It returns the number of value log files which were rewritten.*/
+func BadgerDbGc() (int, error) {
 	db := oyster_utils.GetBadgerDb()
 	if db == nil {
-		return
+		return 0, nil
 	}
 
 	// TODO:  Make sure this will work with the new DB changes.  Do we need to call this for every db?
 
 	// It is recommended that this method be called during periods of low activity in your system, or periodically
+	numRewritten := 0
 	for {
 		// One call would only result in removal of at max one log file. As an optimization,
 		// you could also immediately re-run it whenever it returns nil error.
 		// According BadgerDB GoDoc, it is recommended to be 0.5.
 		err := db.RunValueLogGC(0.5)
+		if err == badger.ErrNoRewrite {
+			return numRewritten, nil
+		}
 		if err != nil {
-			break
+			return numRewritten, err
 		}
+		numRewritten++
 	}
 }
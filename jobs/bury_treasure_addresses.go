@@ -11,47 +11,51 @@ import (
 	"time"
 )
 
-func BuryTreasureAddresses(thresholdTime time.Time, PrometheusWrapper services.PrometheusService) {
+func BuryTreasureAddresses(thresholdTime time.Time, PrometheusWrapper services.PrometheusService) (int, error) {
 
 	start := PrometheusWrapper.TimeNow()
 	defer PrometheusWrapper.HistogramSeconds(PrometheusWrapper.HistogramBuryTreasureAddresses, start)
 
-	if oyster_utils.BrokerMode == oyster_utils.ProdMode &&
-		oyster_utils.PaymentMode == oyster_utils.UserIsPaying {
+	if oyster_utils.BrokerMode != oyster_utils.ProdMode ||
+		oyster_utils.PaymentMode != oyster_utils.UserIsPaying {
+		return 0, nil
+	}
 
-		CheckPRLTransactions()
-		CheckGasTransactions()
-		CheckBuryTransactions()
+	return runJobSteps(
+		CheckPRLTransactions,
+		CheckGasTransactions,
+		CheckBuryTransactions,
 
 		// TODO: we may want to re-use the same nonce when a transaction
 		// is considered timed-out, so we can replace the existing transaction
 		// with more gas
-		SetTimedOutTransactionsToError(thresholdTime)
-		StageTransactionsWithErrorsForRetry()
+		func() (int, error) { return SetTimedOutTransactionsToError(thresholdTime) },
+		StageTransactionsWithErrorsForRetry,
 
-		SendPRLsToWaitingTreasureAddresses()
-		SendGasToTreasureAddresses()
-		InvokeBury()
-		CheckForReclaimableGas(thresholdTime.Add(-1 * time.Since(thresholdTime)))
+		SendPRLsToWaitingTreasureAddresses,
+		SendGasToTreasureAddresses,
+		InvokeBury,
+		func() (int, error) { return CheckForReclaimableGas(thresholdTime.Add(-1 * time.Since(thresholdTime))) },
 		/* The network could be extremely congested and if we wait a while, it may be worth reclaiming gas later.
 		So passing in a time for us to wait before we give up on attempting to reclaim gas if we have not already
 		started the reclaim attempt*/
 
 		/* TODO:  Enable this method after we have sent
 		the PRLs to all the treasure addresses.  For now keep disabled so we don't lose them.
-		PurgeFinishedTreasure()
+		PurgeFinishedTreasure,
 		*/
-	}
+	)
 }
 
-func CheckPRLTransactions() {
+func CheckPRLTransactions() (int, error) {
 	prlsPending, err := models.GetTreasuresToBuryByPRLStatus([]models.PRLStatus{models.PRLPending})
 	if err != nil {
 		fmt.Println("Cannot get treasures with prls pending in bury_treasure_addresses: " + err.Error())
 		// already captured error in upstream function
-		return
+		return 0, err
 	}
 
+	numConfirmed := 0
 	for _, pending := range prlsPending {
 		prlBalance := EthWrapper.CheckPRLBalance(eth_gateway.StringToAddress(pending.ETHAddr))
 		expectedPRLBalance := pending.GetPRLAmount()
@@ -69,21 +73,24 @@ func CheckPRLTransactions() {
 					"validation errors in bury_treasure_addresses in CheckPRLTransactions.", vErr, nil)
 				continue
 			}
+			numConfirmed++
 			oyster_utils.LogToSegment("bury_treasure_addresses: CheckPRLTransactions", analytics.NewProperties().
 				Set("new_status", models.PRLStatusMap[pending.PRLStatus]).
 				Set("eth_address", pending.ETHAddr))
 		}
 	}
+	return numConfirmed, nil
 }
 
-func CheckGasTransactions() {
+func CheckGasTransactions() (int, error) {
 	gasPending, err := models.GetTreasuresToBuryByPRLStatus([]models.PRLStatus{models.GasPending})
 	if err != nil {
 		fmt.Println("Cannot get treasures with gas pending in bury_treasure_addresses: " + err.Error())
 		// already captured error in upstream function
-		return
+		return 0, err
 	}
 
+	numConfirmed := 0
 	for _, pending := range gasPending {
 		ethBalance := EthWrapper.CheckETHBalance(eth_gateway.StringToAddress(pending.ETHAddr))
 		if ethBalance.Int64() > 0 {
@@ -99,21 +106,24 @@ func CheckGasTransactions() {
 					"validation errors in bury_treasure_addresses in CheckGasTransactions.", vErr, nil)
 				continue
 			}
+			numConfirmed++
 			oyster_utils.LogToSegment("bury_treasure_addresses: CheckGasTransactions", analytics.NewProperties().
 				Set("new_status", models.PRLStatusMap[pending.PRLStatus]).
 				Set("eth_address", pending.ETHAddr))
 		}
 	}
+	return numConfirmed, nil
 }
 
-func CheckBuryTransactions() {
+func CheckBuryTransactions() (int, error) {
 	buryPending, err := models.GetTreasuresToBuryByPRLStatus([]models.PRLStatus{models.BuryPending})
 	if err != nil {
 		fmt.Println("Cannot get treasures with burial pending in bury_treasure_addresses: " + err.Error())
 		// already captured error in upstream function
-		return
+		return 0, err
 	}
 
+	numConfirmed := 0
 	for _, pending := range buryPending {
 		buried, err := EthWrapper.CheckBuriedState(eth_gateway.StringToAddress(pending.ETHAddr))
 		if err != nil {
@@ -137,11 +147,13 @@ func CheckBuryTransactions() {
 					"validation errors in bury_treasure_addresses in CheckBuryTransactions.", vErr, nil)
 				continue
 			}
+			numConfirmed++
 			oyster_utils.LogToSegment("bury_treasure_addresses: CheckBuryTransactions", analytics.NewProperties().
 				Set("new_status", models.PRLStatusMap[pending.PRLStatus]).
 				Set("eth_address", pending.ETHAddr))
 		}
 	}
+	return numConfirmed, nil
 }
 
 /*CheckForReclaimableGas - after the treasure has been buried, this method will check if there is
@@ -149,7 +161,7 @@ leftover eth at the treasure address and if it's enough to try to reclaim it.  I
 start the reclaim.  This method will also check existing gas reclaims--if the gas is no longer worth
 reclaiming (because it has succeeded, or network congestion makes it impractical) it will set it
 to success.*/
-func CheckForReclaimableGas(thresholdTime time.Time) {
+func CheckForReclaimableGas(thresholdTime time.Time) (int, error) {
 	reclaimableAddresses, err := models.GetTreasuresToBuryByPRLStatus([]models.PRLStatus{
 		models.GasReclaimPending,
 		models.BuryConfirmed})
@@ -157,9 +169,10 @@ func CheckForReclaimableGas(thresholdTime time.Time) {
 		fmt.Println("Cannot get treasures with gas reclaim pending or burials confirmed " +
 			"in bury_treasure_addresses: " + err.Error())
 		// already captured error in upstream function
-		return
+		return 0, err
 	}
 
+	numReclaiming := 0
 	for _, reclaimable := range reclaimableAddresses {
 		worthReclaimingGas, gasToReclaim, err := EthWrapper.CheckIfWorthReclaimingGas(
 			eth_gateway.StringToAddress(reclaimable.ETHAddr), eth_gateway.GasLimitETHSend)
@@ -194,14 +207,16 @@ func CheckForReclaimableGas(thresholdTime time.Time) {
 
 		if reclaimingSuccess {
 			reclaimable.PRLStatus = models.GasReclaimPending
+			numReclaiming++
 		} else {
 			reclaimable.PRLStatus = models.GasReclaimError
 		}
 		models.DB.ValidateAndUpdate(&reclaimable)
 	}
+	return numReclaiming, nil
 }
 
-func SetTimedOutTransactionsToError(thresholdTime time.Time) {
+func SetTimedOutTransactionsToError(thresholdTime time.Time) (int, error) {
 	timedOutTransactions, err := models.GetTreasuresToBuryByPRLStatusAndUpdateTime([]models.PRLStatus{
 		models.PRLPending,
 		models.GasPending,
@@ -212,9 +227,10 @@ func SetTimedOutTransactionsToError(thresholdTime time.Time) {
 	if err != nil {
 		fmt.Println("Cannot get timed out treasures in bury_treasure_addresses: " + err.Error())
 		// already captured error in upstream function
-		return
+		return 0, err
 	}
 
+	numTimedOut := 0
 	for _, timedOutTransaction := range timedOutTransactions {
 		oldStatus := timedOutTransaction.PRLStatus
 		timedOutTransaction.PRLStatus = models.PRLStatus(int((timedOutTransaction.PRLStatus)-1) * -1)
@@ -228,14 +244,16 @@ func SetTimedOutTransactionsToError(thresholdTime time.Time) {
 				"validation errors in bury_treasure_addresses in SetTimedOutTransactionsToError.", vErr, nil)
 			continue
 		}
+		numTimedOut++
 		oyster_utils.LogToSegment("bury_treasure_addresses: SetTimedOutTransactionsToError", analytics.NewProperties().
 			Set("old_status", models.PRLStatusMap[oldStatus]).
 			Set("new_status", models.PRLStatusMap[timedOutTransaction.PRLStatus]).
 			Set("eth_address", timedOutTransaction.ETHAddr))
 	}
+	return numTimedOut, nil
 }
 
-func StageTransactionsWithErrorsForRetry() {
+func StageTransactionsWithErrorsForRetry() (int, error) {
 	erroredTransactions, err := models.GetTreasuresToBuryByPRLStatus([]models.PRLStatus{
 		models.PRLError,
 		models.GasError,
@@ -245,9 +263,10 @@ func StageTransactionsWithErrorsForRetry() {
 	if err != nil {
 		fmt.Println("Cannot get error'd treasures in bury_treasure_addresses: " + err.Error())
 		// already captured error in upstream function
-		return
+		return 0, err
 	}
 
+	numStaged := 0
 	for _, errorTransaction := range erroredTransactions {
 		errorTransaction.PRLStatus = models.PRLStatus(int(errorTransaction.PRLStatus) * -1)
 		vErr, err := models.DB.ValidateAndUpdate(&errorTransaction)
@@ -260,52 +279,81 @@ func StageTransactionsWithErrorsForRetry() {
 				"validation errors in bury_treasure_addresses in StageTransactionsWithErrorsForRetry.", vErr, nil)
 			continue
 		}
+		numStaged++
 	}
 
 	if len(erroredTransactions) > 0 {
 		oyster_utils.LogToSegment("bury_treasure_addresses: StageTransactionsWithErrorsForRetry", analytics.NewProperties().
 			Set("num_error'd_transactions", fmt.Sprint(len(erroredTransactions))))
 	}
+	return numStaged, nil
 }
 
-func SendPRLsToWaitingTreasureAddresses() {
+func SendPRLsToWaitingTreasureAddresses() (int, error) {
 
 	waitingForPRLS, err := models.GetTreasuresToBuryByPRLStatus([]models.PRLStatus{models.PRLWaiting})
 	if err != nil {
 		fmt.Println("Cannot get treasures awaiting PRLs in bury_treasure_addresses: " + err.Error())
 		// already captured error in upstream function
-		return
+		return 0, err
+	}
+
+	// Another broker replica may be processing the same treasures.
+	waitingForPRLS, err = models.ClaimTreasures(waitingForPRLS, oyster_utils.BrokerInstanceID)
+	if err != nil {
+		oyster_utils.LogIfError(fmt.Errorf("Cannot claim treasures awaiting PRLs in bury_treasure_addresses: %v", err),
+			nil)
+		return 0, err
 	}
 
 	for _, waitingAddress := range waitingForPRLS {
 		sendPRL(waitingAddress)
 	}
+	return len(waitingForPRLS), nil
 }
 
-func SendGasToTreasureAddresses() {
+func SendGasToTreasureAddresses() (int, error) {
 	waitingForGas, err := models.GetTreasuresToBuryByPRLStatus([]models.PRLStatus{models.PRLConfirmed})
 	if err != nil {
 		fmt.Println("Cannot get treasures awaiting gas in bury_treasure_addresses: " + err.Error())
 		// already captured error in upstream function
-		return
+		return 0, err
+	}
+
+	// Another broker replica may be processing the same treasures.
+	waitingForGas, err = models.ClaimTreasures(waitingForGas, oyster_utils.BrokerInstanceID)
+	if err != nil {
+		oyster_utils.LogIfError(fmt.Errorf("Cannot claim treasures awaiting gas in bury_treasure_addresses: %v", err),
+			nil)
+		return 0, err
 	}
 
 	for _, waitingAddress := range waitingForGas {
 		sendGas(waitingAddress)
 	}
+	return len(waitingForGas), nil
 }
 
-func InvokeBury() {
+func InvokeBury() (int, error) {
 	readyToInvokeBury, err := models.GetTreasuresToBuryByPRLStatus([]models.PRLStatus{models.GasConfirmed})
 	if err != nil {
 		fmt.Println("Cannot get treasures awaiting bury() in bury_treasure_addresses: " + err.Error())
 		// already captured error in upstream function
-		return
+		return 0, err
+	}
+
+	// Another broker replica may be processing the same treasures.
+	readyToInvokeBury, err = models.ClaimTreasures(readyToInvokeBury, oyster_utils.BrokerInstanceID)
+	if err != nil {
+		oyster_utils.LogIfError(fmt.Errorf("Cannot claim treasures awaiting bury() in bury_treasure_addresses: %v", err),
+			nil)
+		return 0, err
 	}
 
 	for _, buryAddress := range readyToInvokeBury {
 		buryPRL(buryAddress)
 	}
+	return len(readyToInvokeBury), nil
 }
 
 func PurgeFinishedTreasure() {
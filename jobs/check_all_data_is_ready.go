@@ -7,21 +7,22 @@ import (
 )
 
 /*CheckAllDataIsReady checks if all data for sessions has been stored*/
-func CheckAllDataIsReady(PrometheusWrapper services.PrometheusService) {
+func CheckAllDataIsReady(PrometheusWrapper services.PrometheusService) (int, error) {
 
 	start := PrometheusWrapper.TimeNow()
 	defer PrometheusWrapper.HistogramSeconds(PrometheusWrapper.HistogramCheckAllDataIsReady, start)
 
-	CheckSessionsWithIncompleteData()
+	return CheckSessionsWithIncompleteData()
 }
 
 /*CheckSessionsWithIncompleteData grabs the sessions with incomplete data
-and checks if they are complete.*/
-func CheckSessionsWithIncompleteData() {
+and checks if they are complete.  Returns the number of sessions checked.*/
+func CheckSessionsWithIncompleteData() (int, error) {
 	sessions, err := models.GetSessionsWithIncompleteData()
 
 	if err != nil {
 		oyster_utils.LogIfError(err, nil)
+		return 0, err
 	}
 
 	for _, session := range sessions {
@@ -35,4 +36,5 @@ func CheckSessionsWithIncompleteData() {
 			models.DB.ValidateAndUpdate(&u)
 		}
 	}
+	return len(sessions), nil
 }
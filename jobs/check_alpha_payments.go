@@ -11,22 +11,28 @@ import (
 
 /* CheckAlphaPayments handles the operations around checking the status of payments to alpha and
 initiating the payment to beta */
-func CheckAlphaPayments(PrometheusWrapper services.PrometheusService) {
+func CheckAlphaPayments(PrometheusWrapper services.PrometheusService) (int, error) {
 	start := PrometheusWrapper.TimeNow()
 	defer PrometheusWrapper.HistogramSeconds(PrometheusWrapper.HistogramCheckAlphaPayments, start)
 
-	CheckPaymentToAlpha()
-	SendGasToAlphaTransactionAddress()
-	CheckGasPayments()
-	SendPaymentToBeta()
+	return runJobSteps(
+		CheckPaymentToAlpha,
+		SendGasToAlphaTransactionAddress,
+		CheckGasPayments,
+		SendPaymentToBeta,
+	)
 }
 
 /* CheckPaymentToAlpha checks whether the PRL payment has arrived to alpha, and if this is true and the
 session is a beta session, it will set the beta payment status to pending */
-func CheckPaymentToAlpha() {
-	brokerTxs, _ := models.GetTransactionsBySessionTypesAndPaymentStatuses([]int{},
+func CheckPaymentToAlpha() (int, error) {
+	brokerTxs, err := models.GetTransactionsBySessionTypesAndPaymentStatuses([]int{},
 		[]models.PaymentStatus{models.BrokerTxAlphaPaymentPending})
+	if err != nil {
+		return 0, err
+	}
 
+	numConfirmed := 0
 	for _, brokerTx := range brokerTxs {
 		balance := EthWrapper.CheckPRLBalance(eth_gateway.StringToAddress(brokerTx.ETHAddrAlpha))
 		if balance.Int64() > 0 && balance.Int64() >= brokerTx.GetTotalCostInWei().Int64() {
@@ -46,6 +52,7 @@ func CheckPaymentToAlpha() {
 				continue
 			}
 
+			numConfirmed++
 			models.SetUploadSessionToPaid(brokerTx)
 			oyster_utils.LogToSegment("check_alpha_payments: CheckPaymentToAlpha - alpha_confirmed",
 				analytics.NewProperties().
@@ -53,15 +60,28 @@ func CheckPaymentToAlpha() {
 					Set("alpha_address", brokerTx.ETHAddrAlpha))
 		}
 	}
+	return numConfirmed, nil
 }
 
 /* SendGasToAlphaTransactionAddress gets the transactions for which the alpha address has received payment but the
 gas has not been sent, and initiates sending the gas */
-func SendGasToAlphaTransactionAddress() {
-	brokerTxs, _ := models.GetTransactionsBySessionTypesAndPaymentStatuses([]int{models.SessionTypeAlpha},
+func SendGasToAlphaTransactionAddress() (int, error) {
+	brokerTxs, err := models.GetTransactionsBySessionTypesAndPaymentStatuses([]int{models.SessionTypeAlpha},
 		[]models.PaymentStatus{models.BrokerTxAlphaPaymentConfirmed})
+	if err != nil {
+		return 0, err
+	}
+
+	// the transactions of an N-broker upload share the alpha address, which is sent the gas for all of them at once
+	gasSentTo := make(map[string]bool)
 
 	for _, brokerTx := range brokerTxs {
+		if gasSentTo[brokerTx.ETHAddrAlpha] {
+			brokerTx.PaymentStatus = models.BrokerTxGasPaymentPending
+			oyster_utils.LogIfError(models.DB.Save(&brokerTx), nil)
+			continue
+		}
+
 		hasEnoughGas, gasToSend, err := addressHasEnoughGas(brokerTx.ETHAddrAlpha)
 
 		if err != nil {
@@ -85,6 +105,7 @@ func SendGasToAlphaTransactionAddress() {
 			oyster_utils.LogIfError(err, nil)
 			continue
 		}
+		gasSentTo[brokerTx.ETHAddrAlpha] = true
 
 		previousPaymentStatus := brokerTx.PaymentStatus
 		brokerTx.PaymentStatus = models.BrokerTxGasPaymentPending
@@ -96,14 +117,19 @@ func SendGasToAlphaTransactionAddress() {
 			continue
 		}
 	}
+	return len(gasSentTo), nil
 }
 
 /* CheckGasPayments checks the status of gas payments to the alpha
 transaction address that are currently in progress */
-func CheckGasPayments() {
-	brokerTxs, _ := models.GetTransactionsBySessionTypesAndPaymentStatuses([]int{models.SessionTypeAlpha},
+func CheckGasPayments() (int, error) {
+	brokerTxs, err := models.GetTransactionsBySessionTypesAndPaymentStatuses([]int{models.SessionTypeAlpha},
 		[]models.PaymentStatus{models.BrokerTxGasPaymentPending})
+	if err != nil {
+		return 0, err
+	}
 
+	numConfirmed := 0
 	for _, brokerTx := range brokerTxs {
 
 		hasEnoughGas, _, err := addressHasEnoughGas(brokerTx.ETHAddrAlpha)
@@ -115,14 +141,17 @@ func CheckGasPayments() {
 
 		if hasEnoughGas {
 			brokerTx.PaymentStatus = models.BrokerTxGasPaymentConfirmed
-			err = models.DB.Save(&brokerTx)
+			if err = models.DB.Save(&brokerTx); err == nil {
+				numConfirmed++
+			}
 			continue
 		}
 	}
+	return numConfirmed, nil
 }
 
 /* addressHasEnoughGas will be called on the alpha address to determine if it has enough
-gas to send the PRL to the beta address */
+gas to send the PRL to the beta addresses */
 func addressHasEnoughGas(address string) (bool, *big.Int, error) {
 	gasBalance := EthWrapper.CheckETHBalance(eth_gateway.StringToAddress(address))
 
@@ -132,6 +161,14 @@ func addressHasEnoughGas(address string) (bool, *big.Int, error) {
 		return false, big.NewInt(0), err
 	}
 
+	numSends, err := models.GetNumBetaPaymentsToSend(address)
+	if err != nil {
+		return false, big.NewInt(0), err
+	}
+	if numSends > 1 {
+		gasNeeded = new(big.Int).Mul(gasNeeded, big.NewInt(int64(numSends)))
+	}
+
 	gasToSend := new(big.Int).Sub(gasNeeded, gasBalance)
 
 	if gasToSend.Int64() <= 0 {
@@ -142,23 +179,41 @@ func addressHasEnoughGas(address string) (bool, *big.Int, error) {
 
 /* SendPaymentToBeta gets the transactions for which the alpha address has received payment but the beta address
 has not, and calls a method on those transactions to start the beta payment */
-func SendPaymentToBeta() {
-	brokerTxs, _ := models.GetTransactionsBySessionTypesAndPaymentStatuses([]int{models.SessionTypeAlpha},
+func SendPaymentToBeta() (int, error) {
+	brokerTxs, err := models.GetTransactionsBySessionTypesAndPaymentStatuses([]int{models.SessionTypeAlpha},
 		[]models.PaymentStatus{models.BrokerTxGasPaymentConfirmed})
+	if err != nil {
+		return 0, err
+	}
+
+	// the transactions of an N-broker upload share the alpha address, which sends the PRL to one beta at a time so
+	// that the sends don't get the same nonce
+	prlSentFrom := make(map[string]bool)
 
 	for _, brokerTx := range brokerTxs {
+		if prlSentFrom[brokerTx.ETHAddrAlpha] {
+			continue
+		}
+		if isPending, err := models.HasPendingBetaPayment(brokerTx.ETHAddrAlpha); err != nil || isPending {
+			continue
+		}
+
 		balance := EthWrapper.CheckPRLBalance(eth_gateway.StringToAddress(brokerTx.ETHAddrAlpha))
-		checkAndSendHalfPrlToBeta(brokerTx, balance)
+		if checkAndSendPrlShareToBeta(brokerTx, balance) {
+			prlSentFrom[brokerTx.ETHAddrAlpha] = true
+		}
 	}
+	return len(prlSentFrom), nil
 }
 
-/* checkAndSendHalfPrlToBeta checks whether beta has already received the transaction, and
-if not, sends it half the PRL and marks beta payment status as pending */
-func checkAndSendHalfPrlToBeta(brokerTx models.BrokerBrokerTransaction, balance *big.Int) {
+/* checkAndSendPrlShareToBeta checks whether beta has already received the transaction, and
+if not, sends it its share of the PRL and marks beta payment status as pending.  Beta gets half the PRL, or in
+N-broker mode the part of the total cost of its range of chunks.  Returns whether the PRL was sent */
+func checkAndSendPrlShareToBeta(brokerTx models.BrokerBrokerTransaction, balance *big.Int) bool {
 	if brokerTx.Type != models.SessionTypeAlpha ||
 		brokerTx.PaymentStatus != models.BrokerTxGasPaymentConfirmed ||
 		brokerTx.ETHAddrBeta == "" {
-		return
+		return false
 	}
 
 	betaAddr := eth_gateway.StringToAddress(brokerTx.ETHAddrBeta)
@@ -167,12 +222,15 @@ func checkAndSendHalfPrlToBeta(brokerTx models.BrokerBrokerTransaction, balance
 		brokerTx.PaymentStatus = models.BrokerTxBetaPaymentConfirmed
 		err := models.DB.Save(&brokerTx)
 		oyster_utils.LogIfError(err, nil)
-		return
+		return false
 	}
 
 	var splitAmount big.Int
-	splitAmount.Set(balance)
-	splitAmount.Div(balance, big.NewInt(2))
+	if brokerTx.NumChunks > 0 {
+		splitAmount.Set(brokerTx.GetBetaShareInWei())
+	} else {
+		splitAmount.Div(balance, big.NewInt(2))
+	}
 
 	privateKey, err := eth_gateway.StringToPrivateKey(brokerTx.DecryptEthKey())
 	if err != nil {
@@ -191,9 +249,10 @@ func checkAndSendHalfPrlToBeta(brokerTx models.BrokerBrokerTransaction, balance
 		err := models.DB.Save(&brokerTx)
 		oyster_utils.LogIfError(err, nil)
 
-		oyster_utils.LogToSegment("check_alpha_payments: CheckAndSendHalfPrlToBeta - beta_transaction_started",
+		oyster_utils.LogToSegment("check_alpha_payments: CheckAndSendPrlShareToBeta - beta_transaction_started",
 			analytics.NewProperties().
 				Set("beta_address", brokerTx.ETHAddrBeta).
 				Set("alpha_address", brokerTx.ETHAddrAlpha))
 	}
+	return sendSuccess
 }
@@ -350,6 +350,44 @@ func (suite *JobsSuite) Test_SendPaymentToBeta_send_payment() {
 	suite.True(hasCalledSendPRL_checkAlphaPayments)
 }
 
+func (suite *JobsSuite) Test_SendPaymentToBeta_one_send_per_alpha_address() {
+	resetTestVariables_checkAlphaPayments(suite)
+	jobs.EthWrapper.CreateSendPRLMessage = eth_gateway.EthWrapper.CreateSendPRLMessage
+	jobs.EthWrapper.CheckPRLBalance = func(addr common.Address) *big.Int {
+		return big.NewInt(0)
+	}
+	numSends := 0
+	jobs.EthWrapper.SendPRLFromOyster = func(msg eth_gateway.OysterCallMsg) (bool, string, int64) {
+		numSends++
+		return true, "some__transaction_hash", 0
+	}
+
+	// the transactions of an N-broker upload share the alpha address
+	alphaAddr, key, _ := jobs.EthWrapper.GenerateEthAddr()
+	genesisHash := oyster_utils.RandSeq(64, []rune("abcde123456789"))
+	for i := 0; i < 2; i++ {
+		betaAddr, _, _ := jobs.EthWrapper.GenerateEthAddr()
+		vErr, err := suite.DB.ValidateAndCreate(&models.BrokerBrokerTransaction{
+			GenesisHash:   genesisHash,
+			Type:          models.SessionTypeAlpha,
+			ETHAddrAlpha:  alphaAddr.Hex(),
+			ETHAddrBeta:   betaAddr.Hex(),
+			ETHPrivateKey: key,
+			TotalCost:     totalCost,
+			PaymentStatus: models.BrokerTxGasPaymentConfirmed,
+		})
+		suite.Nil(err)
+		suite.False(vErr.HasAny())
+	}
+
+	jobs.SendPaymentToBeta()
+	suite.Equal(1, numSends)
+
+	// the second send waits for the first to arrive
+	jobs.SendPaymentToBeta()
+	suite.Equal(1, numSends)
+}
+
 func generateBrokerBrokerTransactions(suite *JobsSuite,
 	sessionType int,
 	paymentStatus models.PaymentStatus,
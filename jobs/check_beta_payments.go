@@ -8,34 +8,39 @@ import (
 	"github.com/oysterprotocol/brokernode/utils/eth_gateway"
 	"github.com/pkg/errors"
 	"gopkg.in/segmentio/analytics-go.v3"
-	"math/big"
 	"time"
 )
 
 /* CheckBetaPayments triggers the methods associated with checking beta payments */
-func CheckBetaPayments(thresholdDuration time.Duration, PrometheusWrapper services.PrometheusService) {
+func CheckBetaPayments(thresholdDuration time.Duration, PrometheusWrapper services.PrometheusService) (int, error) {
 	start := PrometheusWrapper.TimeNow()
 	defer PrometheusWrapper.HistogramSeconds(PrometheusWrapper.HistogramCheckBetaPayments, start)
 
-	CheckPaymentToBeta()
+	return runJobSteps(
+		CheckPaymentToBeta,
 
-	HandleErrorTransactionsIfAlpha()
+		HandleErrorTransactionsIfAlpha,
 
-	HandleTimedOutTransactionsIfAlpha(thresholdDuration)
-	/* make beta wait 3x as long as alpha so alpha has some chances to retry */
-	HandleTimedOutBetaPaymentIfBeta(thresholdDuration * time.Duration(3))
+		func() (int, error) { return HandleTimedOutTransactionsIfAlpha(thresholdDuration) },
+		/* make beta wait 3x as long as alpha so alpha has some chances to retry */
+		func() (int, error) { return HandleTimedOutBetaPaymentIfBeta(thresholdDuration * time.Duration(3)) },
 
-	PurgeCompletedTransactions()
+		PurgeCompletedTransactions,
+	)
 }
 
 /* CheckPaymentToBeta checks whether the payment to the beta address has arrived */
-func CheckPaymentToBeta() {
-	brokerTxs, _ := models.GetTransactionsBySessionTypesAndPaymentStatuses([]int{},
+func CheckPaymentToBeta() (int, error) {
+	brokerTxs, err := models.GetTransactionsBySessionTypesAndPaymentStatuses([]int{},
 		[]models.PaymentStatus{models.BrokerTxBetaPaymentPending})
+	if err != nil {
+		return 0, err
+	}
 
+	numConfirmed := 0
 	for _, brokerTx := range brokerTxs {
 		balance := EthWrapper.CheckPRLBalance(eth_gateway.StringToAddress(brokerTx.ETHAddrBeta))
-		expectedBalance := new(big.Int).Quo(brokerTx.GetTotalCostInWei(), big.NewInt(int64(2)))
+		expectedBalance := brokerTx.GetBetaShareInWei()
 		if balance.Int64() > 0 && balance.Int64() >= expectedBalance.Int64() {
 			previousBetaPaymentStatus := brokerTx.PaymentStatus
 			brokerTx.PaymentStatus = models.BrokerTxBetaPaymentConfirmed
@@ -45,6 +50,7 @@ func CheckPaymentToBeta() {
 				brokerTx.PaymentStatus = previousBetaPaymentStatus
 				continue
 			}
+			numConfirmed++
 			if brokerTx.Type == models.SessionTypeBeta {
 				ReportGoodAlphaToDRS(brokerTx)
 			}
@@ -54,17 +60,22 @@ func CheckPaymentToBeta() {
 					Set("alpha_address", brokerTx.ETHAddrAlpha))
 		}
 	}
+	return numConfirmed, nil
 }
 
 /* HandleTimedOutBetaPaymentIfBeta would wrap calls that would report the alpha broker to the DRS */
-func HandleTimedOutBetaPaymentIfBeta(thresholdDuration time.Duration) {
+func HandleTimedOutBetaPaymentIfBeta(thresholdDuration time.Duration) (int, error) {
 	thresholdTime := time.Now().Add(thresholdDuration)
-	brokerTxs, _ := models.GetTransactionsBySessionTypesPaymentStatusesAndTime([]int{models.SessionTypeBeta},
+	brokerTxs, err := models.GetTransactionsBySessionTypesPaymentStatusesAndTime([]int{models.SessionTypeBeta},
 		[]models.PaymentStatus{models.BrokerTxBetaPaymentPending}, thresholdTime)
+	if err != nil {
+		return 0, err
+	}
 
 	for _, brokerTx := range brokerTxs {
 		ReportBadAlphaToDRS(brokerTx)
 	}
+	return len(brokerTxs), nil
 }
 
 /* ReportBadAlphaToDRS is a stub of the method we will eventually use for beta to report alpha to the DRS */
@@ -110,12 +121,15 @@ func ReportGoodAlphaToDRS(brokerTx models.BrokerBrokerTransaction) {
 }
 
 /* HandleTimedOutTransactionsIfAlpha simply stages old transactions to be tried again */
-func HandleTimedOutTransactionsIfAlpha(thresholdDuration time.Duration) {
+func HandleTimedOutTransactionsIfAlpha(thresholdDuration time.Duration) (int, error) {
 	thresholdTime := time.Now().Add(thresholdDuration)
-	brokerTxs, _ := models.GetTransactionsBySessionTypesPaymentStatusesAndTime([]int{models.SessionTypeAlpha},
+	brokerTxs, err := models.GetTransactionsBySessionTypesPaymentStatusesAndTime([]int{models.SessionTypeAlpha},
 		[]models.PaymentStatus{
 			models.BrokerTxGasPaymentPending,
 			models.BrokerTxBetaPaymentPending}, thresholdTime)
+	if err != nil {
+		return 0, err
+	}
 
 	for _, brokerTx := range brokerTxs {
 		currentStatus := brokerTx.PaymentStatus
@@ -123,14 +137,18 @@ func HandleTimedOutTransactionsIfAlpha(thresholdDuration time.Duration) {
 		err := models.DB.Save(&brokerTx)
 		oyster_utils.LogIfError(err, nil)
 	}
+	return len(brokerTxs), nil
 }
 
 /* HandleErrorTransactionsIfAlpha simply stages error transactions to be tried again */
-func HandleErrorTransactionsIfAlpha() {
-	brokerTxs, _ := models.GetTransactionsBySessionTypesAndPaymentStatuses([]int{models.SessionTypeAlpha},
+func HandleErrorTransactionsIfAlpha() (int, error) {
+	brokerTxs, err := models.GetTransactionsBySessionTypesAndPaymentStatuses([]int{models.SessionTypeAlpha},
 		[]models.PaymentStatus{
 			models.BrokerTxGasPaymentError,
 			models.BrokerTxBetaPaymentError})
+	if err != nil {
+		return 0, err
+	}
 
 	for _, brokerTx := range brokerTxs {
 		currentStatus := brokerTx.PaymentStatus
@@ -138,9 +156,10 @@ func HandleErrorTransactionsIfAlpha() {
 		err := models.DB.Save(&brokerTx)
 		oyster_utils.LogIfError(err, nil)
 	}
+	return len(brokerTxs), nil
 }
 
 /* PurgeCompletedTransactions wraps a call which will delete any brokerTxs whose gas has been reclaimed */
-func PurgeCompletedTransactions() {
-	models.DeleteCompletedBrokerTransactions()
+func PurgeCompletedTransactions() (int, error) {
+	return 0, models.DeleteCompletedBrokerTransactions()
 }
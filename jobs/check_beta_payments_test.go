@@ -51,7 +51,9 @@ func (suite *JobsSuite) Test_CheckPaymentToBeta_payment_arrived() {
 		models.BrokerTxBetaPaymentPending,
 		1)
 
-	jobs.CheckPaymentToBeta()
+	numConfirmed, err := jobs.CheckPaymentToBeta()
+	suite.Nil(err)
+	suite.Equal(2, numConfirmed)
 
 	brokerTxs := returnAllBrokerBrokerTxs(suite)
 	suite.Equal(2, len(brokerTxs))
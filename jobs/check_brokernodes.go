@@ -0,0 +1,62 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/utils"
+	"gopkg.in/segmentio/analytics-go.v3"
+)
+
+var healthCheckClient = &http.Client{Timeout: 10 * time.Second}
+
+type brokernodeStatusRes struct {
+	Available bool `json:"available"`
+}
+
+/*CheckBrokernodes asks the status endpoint of each broker in the registry whether it is available.  A broker which
+has not been seen for expireAfter expires and is no longer checked.  Returns the number of brokers checked.*/
+func CheckBrokernodes(PrometheusWrapper services.PrometheusService, expireAfter time.Duration) (int, error) {
+	start := PrometheusWrapper.TimeNow()
+	defer PrometheusWrapper.HistogramSeconds(PrometheusWrapper.HistogramCheckBrokernodes, start)
+
+	brokernodes, err := models.GetBrokernodesToHealthCheck()
+	if err != nil {
+		oyster_utils.LogIfError(errors.New(err.Error()+" while getting the brokernodes in CheckBrokernodes"), nil)
+		return 0, err
+	}
+
+	for _, brokernode := range brokernodes {
+		isHealthy := isBrokernodeHealthy(brokernode)
+		brokernode.UpdateHealth(isHealthy, expireAfter, time.Now())
+
+		if brokernode.Status == models.BrokernodeExpired {
+			oyster_utils.LogToSegment("check_brokernodes: brokernode_expired", analytics.NewProperties().
+				Set("brokernode_address", brokernode.Address).
+				Set("failed_health_checks", brokernode.FailedHealthChecks))
+		}
+	}
+	return len(brokernodes), nil
+}
+
+func isBrokernodeHealthy(brokernode models.Brokernode) bool {
+	res, err := healthCheckClient.Get(brokernode.GetAPIURL() + "/status")
+	if err != nil {
+		return false
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return false
+	}
+
+	status := brokernodeStatusRes{}
+	if err := oyster_utils.ParseResBody(res, &status); err != nil {
+		oyster_utils.LogIfError(fmt.Errorf("invalid status of brokernode %v: %v", brokernode.Address, err), nil)
+		return false
+	}
+	return status.Available
+}
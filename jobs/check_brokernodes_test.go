@@ -0,0 +1,66 @@
+package jobs_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/oysterprotocol/brokernode/jobs"
+	"github.com/oysterprotocol/brokernode/models"
+)
+
+func (suite *JobsSuite) Test_CheckBrokernodes() {
+	available := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		suite.Equal("/status", r.URL.Path)
+		json.NewEncoder(w).Encode(map[string]bool{"available": true})
+	}))
+	defer available.Close()
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]bool{"available": false})
+	}))
+	defer unavailable.Close()
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	pending := createBrokernodeForTest(suite, models.Brokernode{Address: "http://1.2.3.4:3000",
+		APIURL: nulls.NewString(available.URL), Status: models.BrokernodePending})
+	deploying := createBrokernodeForTest(suite, models.Brokernode{Address: unavailable.URL,
+		LastSeenAt: nulls.NewTime(time.Now()), Status: models.BrokernodeActive})
+	gone := createBrokernodeForTest(suite, models.Brokernode{Address: unreachable.URL,
+		LastSeenAt: nulls.NewTime(time.Now().Add(-2 * time.Hour)), Status: models.BrokernodeActive})
+	// unapproved brokers are not checked
+	unapproved := createBrokernodeForTest(suite, models.Brokernode{Address: "http://5.6.7.8:3000",
+		APIURL: nulls.NewString(available.URL)})
+
+	numChecked, err := jobs.CheckBrokernodes(jobs.PrometheusWrapper, time.Hour)
+	suite.Nil(err)
+	suite.Equal(3, numChecked)
+
+	suite.Nil(suite.DB.Find(&pending, pending.ID))
+	suite.Equal(models.BrokernodeActive, pending.Status)
+	suite.True(pending.LastSeenAt.Valid)
+
+	suite.Nil(suite.DB.Find(&deploying, deploying.ID))
+	suite.Equal(models.BrokernodeUnreachable, deploying.Status)
+	suite.Equal(1, deploying.FailedHealthChecks)
+
+	suite.Nil(suite.DB.Find(&gone, gone.ID))
+	suite.Equal(models.BrokernodeExpired, gone.Status)
+
+	suite.Nil(suite.DB.Find(&unapproved, unapproved.ID))
+	suite.Equal(models.BrokernodeUnapproved, unapproved.Status)
+
+	// expired brokers are no longer checked
+	numChecked, err = jobs.CheckBrokernodes(jobs.PrometheusWrapper, time.Hour)
+	suite.Nil(err)
+	suite.Equal(2, numChecked)
+}
+
+func createBrokernodeForTest(suite *JobsSuite, brokernode models.Brokernode) models.Brokernode {
+	vErr, err := suite.DB.ValidateAndCreate(&brokernode)
+	suite.Nil(err)
+	suite.False(vErr.HasAny())
+	return brokernode
+}
@@ -13,54 +13,58 @@ import (
 )
 
 /* ClaimTreasureForWebnode handles all the operations needed to claim PRL for a webnode */
-func ClaimTreasureForWebnode(thresholdTime time.Time, PrometheusWrapper services.PrometheusService) {
+func ClaimTreasureForWebnode(thresholdTime time.Time, PrometheusWrapper services.PrometheusService) (int, error) {
 
 	start := PrometheusWrapper.TimeNow()
 	defer PrometheusWrapper.HistogramSeconds(PrometheusWrapper.HistogramClaimTreasureForWebnode, start)
 
-	if oyster_utils.BrokerMode == oyster_utils.ProdMode {
+	if oyster_utils.BrokerMode != oyster_utils.ProdMode {
+		return 0, nil
+	}
 
-		CheckOngoingGasTransactions()
-		CheckOngoingPRLClaims()
-		CheckOngoingGasReclaims()
+	return runJobSteps(
+		CheckOngoingGasTransactions,
+		CheckOngoingPRLClaims,
+		CheckOngoingGasReclaims,
 
-		ResendOldETHTransfers(thresholdTime)
-		ResendOldPRLClaims(thresholdTime)
-		ResendOldGasReclaims(thresholdTime)
+		func() (int, error) { return ResendOldETHTransfers(thresholdTime) },
+		func() (int, error) { return ResendOldPRLClaims(thresholdTime) },
+		func() (int, error) { return ResendOldGasReclaims(thresholdTime) },
 
-		ResendErroredETHTransfers()
-		ResendErroredPRLClaims()
-		ResendErroredGasReclaims()
+		ResendErroredETHTransfers,
+		ResendErroredPRLClaims,
+		ResendErroredGasReclaims,
 
-		SendGasForNewTreasureClaims()
-		StartNewTreasureClaims()
-		RetrieveLeftoverETHFromTreasureClaiming()
+		SendGasForNewTreasureClaims,
+		StartNewTreasureClaims,
+		RetrieveLeftoverETHFromTreasureClaiming,
 
-		PurgeCompletedTreasureClaims()
-	}
+		PurgeCompletedTreasureClaims,
+	)
 }
 
 /* CheckOngoingGasTransactions checks the status of gas transfers to
 treasure addresses that are currently in progress */
-func CheckOngoingGasTransactions() {
+func CheckOngoingGasTransactions() (int, error) {
 	gasPending, err := models.GetTreasureClaimsByGasStatus(models.GasTransferProcessing)
 	if err != nil {
 		fmt.Println("Cannot get webnode_treasure_claims with pending gas transfers: " + err.Error())
 		/* already captured error in upstream function */
-		return
+		return 0, err
 	}
 
 	if len(gasPending) <= 0 {
-		return
+		return 0, nil
 	}
 	gasToProcessTransaction, err := EthWrapper.CalculateGasNeeded(eth_gateway.GasLimitPRLClaim)
 	if err != nil {
 		fmt.Println("Cannot calculate gas needed in webnode_treasure_claims with pending " +
 			"gas transfers: " + err.Error())
 		/* already captured error in upstream function */
-		return
+		return 0, err
 	}
 
+	numConfirmed := 0
 	for _, pending := range gasPending {
 		ethBalance := EthWrapper.CheckETHBalance(eth_gateway.StringToAddress(pending.TreasureETHAddr))
 		if ethBalance.Int64() >= gasToProcessTransaction.Int64() {
@@ -78,23 +82,26 @@ func CheckOngoingGasTransactions() {
 				oyster_utils.LogIfError(err, nil)
 				continue
 			}
+			numConfirmed++
 			oyster_utils.LogToSegment("claim_treasure_for_webnode: CheckOngoingGasTransactions", analytics.NewProperties().
 				Set("new_status", models.GasTransferStatusMap[pending.GasStatus]).
 				Set("eth_address_to", pending.TreasureETHAddr))
 		}
 	}
+	return numConfirmed, nil
 }
 
 /* CheckOngoingPRLClaims checks the claimClock of an address we are in the process of trying to claim PRL from
 to see if it has changed from what it was initially--if it has, the transaction is complete */
-func CheckOngoingPRLClaims() {
+func CheckOngoingPRLClaims() (int, error) {
 	prlsPending, err := models.GetTreasureClaimsByPRLStatus(models.PRLClaimProcessing)
 	if err != nil {
 		fmt.Println("Cannot get webnode_treasure_claims with pending PRL retrieval: " + err.Error())
 		/* already captured error in upstream function */
-		return
+		return 0, err
 	}
 
+	numConfirmed := 0
 	for _, pending := range prlsPending {
 
 		claimClock, err := EthWrapper.CheckClaimClock(eth_gateway.StringToAddress(pending.TreasureETHAddr))
@@ -120,23 +127,26 @@ func CheckOngoingPRLClaims() {
 				oyster_utils.LogIfError(err, nil)
 				continue
 			}
+			numConfirmed++
 			oyster_utils.LogToSegment("claim_treasure_for_webnode: CheckOngoingPRLClaims",
 				analytics.NewProperties().
 					Set("new_status", models.PRLClaimStatusMap[pending.ClaimPRLStatus]).
 					Set("eth_address_from", pending.TreasureETHAddr))
 		}
 	}
+	return numConfirmed, nil
 }
 
 /* CheckOngoingGasReclaims checks the status of gas reclaims that are currently in progress */
-func CheckOngoingGasReclaims() {
+func CheckOngoingGasReclaims() (int, error) {
 	gasReclaimPending, err := models.GetTreasureClaimsByGasStatus(models.GasTransferLeftoversReclaimProcessing)
 	if err != nil {
 		fmt.Println("Cannot get webnode_treasure_claims with pending gas transfers: " + err.Error())
 		/* already captured error in upstream function */
-		return
+		return 0, err
 	}
 
+	numReclaimed := 0
 	for _, pending := range gasReclaimPending {
 		ethBalance := EthWrapper.CheckETHBalance(eth_gateway.StringToAddress(pending.TreasureETHAddr))
 		if ethBalance.Int64() > 0 {
@@ -152,23 +162,26 @@ func CheckOngoingGasReclaims() {
 				/* won't be able to reclaim whatever is left, just set to success */
 				pending.GasStatus = models.GasTransferLeftoversReclaimSuccess
 				models.DB.ValidateAndUpdate(&pending)
+				numReclaimed++
 			}
 		} else {
 			fmt.Println("Finished reclaiming gas from  " + pending.TreasureETHAddr + " in CheckOngoingGasReclaims() " +
 				"in claim_treasure_for_webnode")
 			pending.GasStatus = models.GasTransferLeftoversReclaimSuccess
 			models.DB.ValidateAndUpdate(&pending)
+			numReclaimed++
 		}
 	}
+	return numReclaimed, nil
 }
 
 /* ResendOldETHTransfers will retry gas transfers that are still processing by the time of the threshold */
-func ResendOldETHTransfers(thresholdTime time.Time) {
+func ResendOldETHTransfers(thresholdTime time.Time) (int, error) {
 	oldGasTransfers, err := models.GetTreasureClaimsWithTimedOutGasTransfers(thresholdTime)
 
 	if err != nil {
 		oyster_utils.LogIfError(fmt.Errorf("Error getting timed out gas transfers: %v", err), nil)
-		return
+		return 0, err
 	}
 	if len(oldGasTransfers) > 0 {
 
@@ -178,16 +191,19 @@ func ResendOldETHTransfers(thresholdTime time.Time) {
 				Set("genesis_hash", transfer.GenesisHash))
 		}
 
-		SendGas(oldGasTransfers)
+		if err := SendGas(oldGasTransfers); err != nil {
+			return 0, err
+		}
 	}
+	return len(oldGasTransfers), nil
 }
 
 /* ResendOldPRLClaims will retry claims that are still processing by the time of the threshold */
-func ResendOldPRLClaims(thresholdTime time.Time) {
+func ResendOldPRLClaims(thresholdTime time.Time) (int, error) {
 	oldPRLClaims, err := models.GetTreasureClaimsWithTimedOutPRLClaims(thresholdTime)
 	if err != nil {
 		oyster_utils.LogIfError(fmt.Errorf("Error getting timed out gas transfers: %v", err), nil)
-		return
+		return 0, err
 	}
 	if len(oldPRLClaims) > 0 {
 		for _, claim := range oldPRLClaims {
@@ -198,28 +214,30 @@ func ResendOldPRLClaims(thresholdTime time.Time) {
 
 		ClaimPRL(oldPRLClaims)
 	}
+	return len(oldPRLClaims), nil
 }
 
 /* ResendOldGasReclaims will reset timed out gas reclaims to a previous state to trigger a retry */
-func ResendOldGasReclaims(thresholdTime time.Time) {
+func ResendOldGasReclaims(thresholdTime time.Time) (int, error) {
 	oldGasReclaims, err := models.GetTreasureClaimsWithTimedOutGasReclaims(thresholdTime)
 	if err != nil {
 		oyster_utils.LogIfError(fmt.Errorf("Error getting timed out gas reclaims: %v", err), nil)
-		return
+		return 0, err
 	}
 	for _, reclaim := range oldGasReclaims {
 		/* reset it back to a prior state so we will try again */
 		reclaim.GasStatus = models.GasTransferSuccess
 		models.DB.ValidateAndUpdate(&reclaim)
 	}
+	return len(oldGasReclaims), nil
 }
 
 /* ResendErroredETHTransfers will retry gas transfers for earlier gas transfers with an error */
-func ResendErroredETHTransfers() {
+func ResendErroredETHTransfers() (int, error) {
 	gasTransferErrors, err := models.GetTreasureClaimsByGasStatus(models.GasTransferError)
 	if err != nil {
 		oyster_utils.LogIfError(fmt.Errorf("Error getting webnode treasure claims whose gas transfers errored: %v", err), nil)
-		return
+		return 0, err
 	}
 	if len(gasTransferErrors) > 0 {
 
@@ -229,16 +247,19 @@ func ResendErroredETHTransfers() {
 				Set("genesis_hash", transfer.GenesisHash))
 		}
 
-		SendGas(gasTransferErrors)
+		if err := SendGas(gasTransferErrors); err != nil {
+			return 0, err
+		}
 	}
+	return len(gasTransferErrors), nil
 }
 
 /* ResendErroredPRLClaims will retry PRL claims if a previous claim attempt had an error */
-func ResendErroredPRLClaims() {
+func ResendErroredPRLClaims() (int, error) {
 	prlTransferErrors, err := models.GetTreasureClaimsByPRLStatus(models.PRLClaimError)
 	if err != nil {
 		oyster_utils.LogIfError(fmt.Errorf("Error getting webnode treasure claims whose PRL transfers errored: %v", err), nil)
-		return
+		return 0, err
 	}
 	if len(prlTransferErrors) > 0 {
 
@@ -251,28 +272,30 @@ func ResendErroredPRLClaims() {
 
 		ClaimPRL(prlTransferErrors)
 	}
+	return len(prlTransferErrors), nil
 }
 
 /* ResendErroredGasReclaims sets the errored gas reclaims back to a previous state so we will try again */
-func ResendErroredGasReclaims() {
+func ResendErroredGasReclaims() (int, error) {
 	errorGasReclaims, err := models.GetTreasureClaimsByGasStatus(models.GasTransferLeftoversReclaimError)
 	if err != nil {
 		oyster_utils.LogIfError(fmt.Errorf("Error getting errored gas reclaims: %v", err), nil)
-		return
+		return 0, err
 	}
 	for _, reclaim := range errorGasReclaims {
 		/* reset it back to a prior state so we will try again */
 		reclaim.GasStatus = models.GasTransferSuccess
 		models.DB.ValidateAndUpdate(&reclaim)
 	}
+	return len(errorGasReclaims), nil
 }
 
 /* SendGasForNewTreasureClaims will send gas to new treasure claims so we will be able to invoke claim() */
-func SendGasForNewTreasureClaims() {
+func SendGasForNewTreasureClaims() (int, error) {
 	needGas, err := models.GetTreasureClaimsByGasStatus(models.GasTransferNotStarted)
 	if err != nil {
 		oyster_utils.LogIfError(fmt.Errorf("Error getting webnode treasure claims whose addresses need gas: %v", err), nil)
-		return
+		return 0, err
 	}
 	if len(needGas) > 0 {
 
@@ -282,17 +305,20 @@ func SendGasForNewTreasureClaims() {
 				Set("genesis_hash", transfer.GenesisHash))
 		}
 
-		SendGas(needGas)
+		if err := SendGas(needGas); err != nil {
+			return 0, err
+		}
 	}
+	return len(needGas), nil
 }
 
 /* StartNewTreasureClaims will initiate PRL claims for treasure addresses that have gas but have not had their PRL
 claimed yet*/
-func StartNewTreasureClaims() {
+func StartNewTreasureClaims() (int, error) {
 	readyClaims, err := models.GetTreasureClaimsByGasAndPRLStatus(models.GasTransferSuccess, models.PRLClaimNotStarted)
 	if err != nil {
 		oyster_utils.LogIfError(fmt.Errorf("Error getting ready claims: %v", err), nil)
-		return
+		return 0, err
 	}
 	if len(readyClaims) > 0 {
 
@@ -305,16 +331,18 @@ func StartNewTreasureClaims() {
 
 		ClaimPRL(readyClaims)
 	}
+	return len(readyClaims), nil
 }
 
 /* RetrieveLeftoverETHFromTreasureClaiming will retrieve leftover gas at the treasure addresses if there is enough to
 justify the transaction */
-func RetrieveLeftoverETHFromTreasureClaiming() {
+func RetrieveLeftoverETHFromTreasureClaiming() (int, error) {
 	completedClaims, err := models.GetTreasureClaimsByGasAndPRLStatus(models.GasTransferSuccess, models.PRLClaimSuccess)
 	if err != nil {
 		oyster_utils.LogIfError(fmt.Errorf("Error getting completed claims: %v", err), nil)
-		return
+		return 0, err
 	}
+	numReclaiming := 0
 	for _, completedClaim := range completedClaims {
 		worthReclaimingGas, gasToReclaim, err := EthWrapper.CheckIfWorthReclaimingGas(
 			eth_gateway.StringToAddress(completedClaim.TreasureETHAddr), eth_gateway.GasLimitETHSend)
@@ -347,17 +375,19 @@ func RetrieveLeftoverETHFromTreasureClaiming() {
 				"in claim_treasure_for_webnode")
 			completedClaim.GasStatus = models.GasTransferLeftoversReclaimProcessing
 			models.DB.ValidateAndUpdate(&completedClaim)
+			numReclaiming++
 		}
 
 	}
+	return numReclaiming, nil
 }
 
 /* SendGas wraps call to eth_gatway's SendETH method and sets GasStatus to GasTransferProcessing */
-func SendGas(treasuresThatNeedGas []models.WebnodeTreasureClaim) {
+func SendGas(treasuresThatNeedGas []models.WebnodeTreasureClaim) error {
 	gasToClaim, err := EthWrapper.CalculateGasNeeded(eth_gateway.GasLimitPRLClaim)
 	if err != nil {
 		oyster_utils.LogIfError(fmt.Errorf("Error determining gas to send: %v", err), nil)
-		return
+		return err
 	}
 	for _, treasureClaim := range treasuresThatNeedGas {
 
@@ -386,6 +416,7 @@ func SendGas(treasuresThatNeedGas []models.WebnodeTreasureClaim) {
 		treasureClaim.GasTxNonce = nonce
 		models.DB.ValidateAndUpdate(&treasureClaim)
 	}
+	return nil
 }
 
 /*ClaimPRL wraps calls eth_gatway's ClaimPRLs method and sets PRLStatus to PRLClaimProcessing */
@@ -459,10 +490,11 @@ func SetClaimClockIfUnset(treasureClaim *models.WebnodeTreasureClaim) error {
 }
 
 /* PurgeCompletedTreasureClaims purges claims whose GasStatus is GasTransferLeftoversReclaimSuccess */
-func PurgeCompletedTreasureClaims() {
+func PurgeCompletedTreasureClaims() (int, error) {
 	err := models.DeleteCompletedTreasureClaims()
 	if err != nil {
 		oyster_utils.LogIfError(fmt.Errorf("Error purging completed treasure claims: %v", err), nil)
-		return
+		return 0, err
 	}
+	return 0, nil
 }
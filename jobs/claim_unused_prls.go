@@ -11,45 +11,49 @@ import (
 	"time"
 )
 
-func ClaimUnusedPRLs(thresholdTime time.Time, PrometheusWrapper services.PrometheusService) {
+func ClaimUnusedPRLs(thresholdTime time.Time, PrometheusWrapper services.PrometheusService) (int, error) {
 
 	start := PrometheusWrapper.TimeNow()
 	defer PrometheusWrapper.HistogramSeconds(PrometheusWrapper.HistogramClaimUnusedPRLs, start)
 
-	if oyster_utils.BrokerMode == oyster_utils.ProdMode &&
-		oyster_utils.PaymentMode == oyster_utils.UserIsPaying {
+	if oyster_utils.BrokerMode != oyster_utils.ProdMode ||
+		oyster_utils.PaymentMode != oyster_utils.UserIsPaying {
+		return 0, nil
+	}
 
-		CheckProcessingGasTransactions()
-		CheckProcessingPRLTransactions()
-		CheckProcessingGasReclaims()
+	return runJobSteps(
+		CheckProcessingGasTransactions,
+		CheckProcessingPRLTransactions,
+		CheckProcessingGasReclaims,
 
-		ResendTimedOutGasTransfers(thresholdTime)
-		ResendTimedOutPRLTransfers(thresholdTime)
-		ResendTimedOutGasReclaims(thresholdTime)
+		func() (int, error) { return ResendTimedOutGasTransfers(thresholdTime) },
+		func() (int, error) { return ResendTimedOutPRLTransfers(thresholdTime) },
+		func() (int, error) { return ResendTimedOutGasReclaims(thresholdTime) },
 
-		ResendErroredGasTransfers()
-		ResendErroredPRLTransfers()
+		ResendErroredGasTransfers,
+		ResendErroredPRLTransfers,
 
-		SendGasForNewClaims()
-		StartNewClaims()
+		SendGasForNewClaims,
+		StartNewClaims,
 
-		RetrieveLeftoverETH(thresholdTime.Add(-1 * time.Since(thresholdTime)))
+		func() (int, error) { return RetrieveLeftoverETH(thresholdTime.Add(-1 * time.Since(thresholdTime))) },
 		/* The network could be extremely congested and if we wait a while, it may be worth reclaiming gas later.
 		So passing in a time for us to wait before we give up on attempting to reclaim gas if we have not already
 		started the reclaim attempt*/
 
-		PurgeCompletedClaims()
-	}
+		PurgeCompletedClaims,
+	)
 }
 
-func CheckProcessingGasTransactions() {
+func CheckProcessingGasTransactions() (int, error) {
 	gasPending, err := models.GetRowsByGasStatus(models.GasTransferProcessing)
 	if err != nil {
 		fmt.Println("Cannot get completed_uploads with pending gas transfers: " + err.Error())
 		// already captured error in upstream function
-		return
+		return 0, err
 	}
 
+	numConfirmed := 0
 	for _, pending := range gasPending {
 		ethBalance := EthWrapper.CheckETHBalance(eth_gateway.StringToAddress(pending.ETHAddr))
 		if ethBalance.Int64() > 0 {
@@ -66,21 +70,24 @@ func CheckProcessingGasTransactions() {
 					"validation errors in claim_unused_prls in CheckProcessingGasTransaction", vErr, nil)
 				continue
 			}
+			numConfirmed++
 			oyster_utils.LogToSegment("claim_unused_prls: CheckProcessingGasTransactions", analytics.NewProperties().
 				Set("new_status", models.GasTransferStatusMap[pending.GasStatus]).
 				Set("eth_address", pending.ETHAddr))
 		}
 	}
+	return numConfirmed, nil
 }
 
-func CheckProcessingPRLTransactions() {
+func CheckProcessingPRLTransactions() (int, error) {
 	prlsPending, err := models.GetRowsByPRLStatus(models.PRLClaimProcessing)
 	if err != nil {
 		fmt.Println("Cannot get completed_uploads with pending PRL retrieval: " + err.Error())
 		// already captured error in upstream function
-		return
+		return 0, err
 	}
 
+	numConfirmed := 0
 	for _, pending := range prlsPending {
 		prlBalance := EthWrapper.CheckPRLBalance(eth_gateway.StringToAddress(pending.ETHAddr))
 		if prlBalance.Int64() == int64(0) {
@@ -97,21 +104,24 @@ func CheckProcessingPRLTransactions() {
 					"validation errors in claim_unused_prls in CheckProcessingPRLTransactions", vErr, nil)
 				continue
 			}
+			numConfirmed++
 			oyster_utils.LogToSegment("claim_unused_prls: CheckProcessingPRLTransactions", analytics.NewProperties().
 				Set("new_status", models.PRLClaimStatusMap[pending.PRLStatus]).
 				Set("eth_address", pending.ETHAddr))
 		}
 	}
+	return numConfirmed, nil
 }
 
-func CheckProcessingGasReclaims() {
+func CheckProcessingGasReclaims() (int, error) {
 	gasReclaimPending, err := models.GetRowsByGasStatus(models.GasTransferLeftoversReclaimProcessing)
 	if err != nil {
 		fmt.Println("Cannot get completed_uploads with pending gas transfers: " + err.Error())
 		// already captured error in upstream function
-		return
+		return 0, err
 	}
 
+	numReclaimed := 0
 	for _, pending := range gasReclaimPending {
 		ethBalance := EthWrapper.CheckETHBalance(eth_gateway.StringToAddress(pending.ETHAddr))
 		if ethBalance.Int64() > 0 {
@@ -127,23 +137,26 @@ func CheckProcessingGasReclaims() {
 				// won't be able to reclaim whatever is left, just set to success
 				pending.GasStatus = models.GasTransferLeftoversReclaimSuccess
 				models.DB.ValidateAndUpdate(&pending)
+				numReclaimed++
 			}
 		} else {
 			fmt.Println("Finished reclaiming gas from  " + pending.ETHAddr + " in CheckProcessingGasReclaims " +
 				"in claim_unused_prls")
 			pending.GasStatus = models.GasTransferLeftoversReclaimSuccess
 			models.DB.ValidateAndUpdate(&pending)
+			numReclaimed++
 		}
 	}
+	return numReclaimed, nil
 }
 
 // for gas transfers that are still processing by the time of the threshold
-func ResendTimedOutGasTransfers(thresholdTime time.Time) {
+func ResendTimedOutGasTransfers(thresholdTime time.Time) (int, error) {
 	timedOutGasTransfers, err := models.GetTimedOutGasTransfers(thresholdTime)
 
 	if err != nil {
 		oyster_utils.LogIfError(fmt.Errorf("Error getting timed out gas transfers: %v", err), nil)
-		return
+		return 0, err
 	}
 	if len(timedOutGasTransfers) > 0 {
 
@@ -153,16 +166,19 @@ func ResendTimedOutGasTransfers(thresholdTime time.Time) {
 				Set("genesis_hash", transfer.GenesisHash))
 		}
 
-		InitiateGasTransfer(timedOutGasTransfers)
+		if err := InitiateGasTransfer(timedOutGasTransfers); err != nil {
+			return 0, err
+		}
 	}
+	return len(timedOutGasTransfers), nil
 }
 
 // for prl transfers that are still processing by the time of the threshold
-func ResendTimedOutPRLTransfers(thresholdTime time.Time) {
+func ResendTimedOutPRLTransfers(thresholdTime time.Time) (int, error) {
 	timedOutPRLTransfers, err := models.GetTimedOutPRLTransfers(thresholdTime)
 	if err != nil {
 		oyster_utils.LogIfError(fmt.Errorf("Error getting timed out gas transfers: %v", err), nil)
-		return
+		return 0, err
 	}
 	if len(timedOutPRLTransfers) > 0 {
 		for _, transfer := range timedOutPRLTransfers {
@@ -173,28 +189,30 @@ func ResendTimedOutPRLTransfers(thresholdTime time.Time) {
 
 		InitiatePRLClaim(timedOutPRLTransfers)
 	}
+	return len(timedOutPRLTransfers), nil
 }
 
 // for leftover gas reclaims that are still processing by the time of the threshold
-func ResendTimedOutGasReclaims(thresholdTime time.Time) {
+func ResendTimedOutGasReclaims(thresholdTime time.Time) (int, error) {
 	timedOutGasReclaims, err := models.GetTimedOutGasReclaims(thresholdTime)
 	if err != nil {
 		oyster_utils.LogIfError(fmt.Errorf("Error getting timed out gas reclaims: %v", err), nil)
-		return
+		return 0, err
 	}
 	for _, reclaim := range timedOutGasReclaims {
 		// reset it back to a prior state so we will try again
 		reclaim.GasStatus = models.GasTransferSuccess
 		models.DB.ValidateAndUpdate(&reclaim)
 	}
+	return len(timedOutGasReclaims), nil
 }
 
 // for gas transfers that are in an error state
-func ResendErroredGasTransfers() {
+func ResendErroredGasTransfers() (int, error) {
 	gasTransferErrors, err := models.GetRowsByGasStatus(models.GasTransferError)
 	if err != nil {
 		oyster_utils.LogIfError(fmt.Errorf("Error getting completed uploads whose gas transfers errored: %v", err), nil)
-		return
+		return 0, err
 	}
 	if len(gasTransferErrors) > 0 {
 
@@ -204,16 +222,19 @@ func ResendErroredGasTransfers() {
 				Set("genesis_hash", transfer.GenesisHash))
 		}
 
-		InitiateGasTransfer(gasTransferErrors)
+		if err := InitiateGasTransfer(gasTransferErrors); err != nil {
+			return 0, err
+		}
 	}
+	return len(gasTransferErrors), nil
 }
 
 // for prl transfers that are in an error state
-func ResendErroredPRLTransfers() {
+func ResendErroredPRLTransfers() (int, error) {
 	prlTransferErrors, err := models.GetRowsByPRLStatus(models.PRLClaimError)
 	if err != nil {
 		oyster_utils.LogIfError(fmt.Errorf("Error getting completed uploads whose PRL transfers errored: %v", err), nil)
-		return
+		return 0, err
 	}
 	if len(prlTransferErrors) > 0 {
 
@@ -225,14 +246,21 @@ func ResendErroredPRLTransfers() {
 
 		InitiatePRLClaim(prlTransferErrors)
 	}
+	return len(prlTransferErrors), nil
 }
 
 // for new claims with no gas
-func SendGasForNewClaims() {
+func SendGasForNewClaims() (int, error) {
 	needGas, err := models.GetUnusedPRLsThatAreReadyForClaiming()
 	if err != nil {
 		oyster_utils.LogIfError(fmt.Errorf("Error getting completed uploads whose addresses need gas: %v", err), nil)
-		return
+		return 0, err
+	}
+	// Another broker replica may be processing the same completed uploads.
+	needGas, err = models.ClaimCompletedUploads(needGas, oyster_utils.BrokerInstanceID)
+	if err != nil {
+		oyster_utils.LogIfError(fmt.Errorf("Error claiming completed uploads whose addresses need gas: %v", err), nil)
+		return 0, err
 	}
 	needGasHavePRLs := []models.CompletedUpload{}
 	for _, completedUpload := range needGas {
@@ -258,16 +286,25 @@ func SendGasForNewClaims() {
 				Set("genesis_hash", transfer.GenesisHash))
 		}
 
-		InitiateGasTransfer(needGasHavePRLs)
+		if err := InitiateGasTransfer(needGasHavePRLs); err != nil {
+			return 0, err
+		}
 	}
+	return len(needGasHavePRLs), nil
 }
 
 // for claims whose gas transfers succeeded but there is still unclaimed PRL
-func StartNewClaims() {
+func StartNewClaims() (int, error) {
 	readyClaims, err := models.GetRowsByGasAndPRLStatus(models.GasTransferSuccess, models.PRLClaimNotStarted)
 	if err != nil {
 		oyster_utils.LogIfError(fmt.Errorf("Error getting ready claims: %v", err), nil)
-		return
+		return 0, err
+	}
+	// Another broker replica may be processing the same completed uploads.
+	readyClaims, err = models.ClaimCompletedUploads(readyClaims, oyster_utils.BrokerInstanceID)
+	if err != nil {
+		oyster_utils.LogIfError(fmt.Errorf("Error claiming ready claims: %v", err), nil)
+		return 0, err
 	}
 	if len(readyClaims) > 0 {
 
@@ -279,15 +316,17 @@ func StartNewClaims() {
 
 		InitiatePRLClaim(readyClaims)
 	}
+	return len(readyClaims), nil
 }
 
 /*RetrieveLeftoverETH is for claims whose gas transfers and PRL retrievals succeeded but there is some leftover ETH*/
-func RetrieveLeftoverETH(thresholdTime time.Time) {
+func RetrieveLeftoverETH(thresholdTime time.Time) (int, error) {
 	completedClaims, err := models.GetRowsByGasAndPRLStatus(models.GasTransferSuccess, models.PRLClaimSuccess)
 	if err != nil {
 		oyster_utils.LogIfError(fmt.Errorf("Error getting completed claims: %v", err), nil)
-		return
+		return 0, err
 	}
+	numReclaiming := 0
 	for _, completedClaim := range completedClaims {
 		worthReclaimingGas, gasToReclaim, err := EthWrapper.CheckIfWorthReclaimingGas(
 			eth_gateway.StringToAddress(completedClaim.ETHAddr), eth_gateway.GasLimitETHSend)
@@ -322,19 +361,21 @@ func RetrieveLeftoverETH(thresholdTime time.Time) {
 
 		if reclaimingSuccess {
 			completedClaim.GasStatus = models.GasTransferLeftoversReclaimProcessing
+			numReclaiming++
 		} else {
 			completedClaim.GasStatus = models.GasTransferLeftoversReclaimError
 		}
 		models.DB.ValidateAndUpdate(&completedClaim)
 	}
+	return numReclaiming, nil
 }
 
 // wraps call to eth_gatway's SendETH method and sets GasStatus to GasTransferProcessing
-func InitiateGasTransfer(uploadsThatNeedGas []models.CompletedUpload) {
+func InitiateGasTransfer(uploadsThatNeedGas []models.CompletedUpload) error {
 	gasToSend, err := EthWrapper.CalculateGasNeeded(eth_gateway.GasLimitPRLSend)
 	if err != nil {
 		oyster_utils.LogIfError(fmt.Errorf("Error determining gas to send: %v", err), nil)
-		return
+		return err
 	}
 	for _, upload := range uploadsThatNeedGas {
 		_, txHash, nonce, err := EthWrapper.SendETH(
@@ -352,6 +393,7 @@ func InitiateGasTransfer(uploadsThatNeedGas []models.CompletedUpload) {
 		upload.GasTxNonce = nonce
 		models.DB.ValidateAndUpdate(&upload)
 	}
+	return nil
 }
 
 // wraps calls eth_gatway's SendPRLFromOyster method and sets PRLStatus to PRLClaimProcessing
@@ -393,6 +435,6 @@ func InitiatePRLClaim(uploadsWithUnclaimedPRLs []models.CompletedUpload) {
 }
 
 // purge claims whose GasStatus is GasTransferLeftoversReclaimSuccess
-func PurgeCompletedClaims() {
-	models.DeleteCompletedClaims()
+func PurgeCompletedClaims() (int, error) {
+	return 0, models.DeleteCompletedClaims()
 }
@@ -10,7 +10,9 @@ import (
 	"gopkg.in/segmentio/analytics-go.v3"
 )
 
-func FlushOldWebNodes(thresholdTime time.Time, PrometheusWrapper services.PrometheusService) {
+/*FlushOldWebNodes deletes the webnodes which have not been updated since thresholdTime.  Returns the number of
+webnodes deleted.*/
+func FlushOldWebNodes(thresholdTime time.Time, PrometheusWrapper services.PrometheusService) (int, error) {
 
 	start := PrometheusWrapper.TimeNow()
 	defer PrometheusWrapper.HistogramSeconds(PrometheusWrapper.HistogramFlushOldWebNodes, start)
@@ -20,9 +22,10 @@ func FlushOldWebNodes(thresholdTime time.Time, PrometheusWrapper services.Promet
 
 	if err != nil {
 		oyster_utils.LogIfError(err, nil)
-		return
+		return 0, err
 	}
 
+	numFlushed := 0
 	for i := 0; i < len(webnodes); i++ {
 		oyster_utils.LogToSegment("flush_old_wednodes: flushing_old_webnode", analytics.NewProperties().
 			Set("webnode_id", fmt.Sprint(webnodes[i].ID)).
@@ -31,5 +34,9 @@ func FlushOldWebNodes(thresholdTime time.Time, PrometheusWrapper services.Promet
 		webnode := webnodes[i]
 		err := models.DB.Destroy(&webnode)
 		oyster_utils.LogIfError(err, nil)
+		if err == nil {
+			numFlushed++
+		}
 	}
+	return numFlushed, nil
 }
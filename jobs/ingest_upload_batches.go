@@ -0,0 +1,165 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/services/blobstore"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+/*errUploadBatchNotChecked is returned when the session of a batch could not be read, so the batch is kept.*/
+var errUploadBatchNotChecked = errors.New("unable to check the chunks of the upload batch")
+
+/*IngestUploadBatches moves the chunk batches that v3 uploads store in the blob store into the chunk storage,
+so that the chunks can be attached like the chunks of a v2 upload.  Returns the number of chunks ingested.*/
+func IngestUploadBatches(PrometheusWrapper services.PrometheusService) (int, error) {
+
+	start := PrometheusWrapper.TimeNow()
+	defer PrometheusWrapper.HistogramSeconds(PrometheusWrapper.HistogramIngestUploadBatches, start)
+
+	sessions, err := models.GetSessionsWithDataInBlobStore()
+	if err != nil {
+		return 0, err
+	}
+
+	numIngested := 0
+	for _, session := range sessions {
+		numIngested += ingestUploadBatchesForSession(session)
+	}
+	return numIngested, nil
+}
+
+func ingestUploadBatchesForSession(session models.UploadSession) int {
+	// V3 sessions are not started with StartUploadSession, so the hash chain is built in the background by Create.
+	// It is built here if it did not finish.
+	if !session.CheckIfAllHashesAreReady() {
+		if err := models.BuildDataMapsForSession(session.GenesisHash, session.NumChunks); err != nil {
+			oyster_utils.LogIfError(err, nil)
+			return 0
+		}
+	}
+
+	treasureIdxMap, err := session.GetTreasureIndexes()
+	if err != nil {
+		return 0
+	}
+
+	prefix := session.GenesisHash + "/"
+	objectKeys, err := BlobStore.ListObjectKeys(blobstore.DefaultBucketName, prefix)
+	if err != nil {
+		return 0
+	}
+
+	numIngested := 0
+	for _, objectKey := range objectKeys {
+		data, version, err := BlobStore.GetObjectVersion(blobstore.DefaultBucketName, objectKey)
+		if err != nil {
+			oyster_utils.LogIfError(err, map[string]interface{}{"objectKey": objectKey})
+			continue
+		}
+
+		chunks, chunkErrors, err := getUploadBatch(session, objectKey, data)
+		if err == errUploadBatchNotChecked {
+			oyster_utils.LogIfError(err, map[string]interface{}{"objectKey": objectKey})
+			continue
+		}
+		if err != nil {
+			// The batch will never become valid, remove it so that the manifest reports the chunks as missing
+			// and the client uploads them again.
+			oyster_utils.LogIfError(fmt.Errorf("Dropping upload batch %v: %v", objectKey, err), nil)
+		}
+		if len(chunkErrors) > 0 {
+			// Only the invalid chunks are dropped, the manifest reports them as missing.
+			oyster_utils.LogIfError(fmt.Errorf("Dropping %v chunks of upload batch %v, chunk %v is invalid: %v",
+				len(chunkErrors), objectKey, chunkErrors[0].Idx, chunkErrors[0].Error), nil)
+		}
+		if len(chunks) > 0 {
+			// The batch is kept until its chunks are stored, so that it is ingested again on the next run.
+			if err := models.ProcessAndStoreChunkData(chunks, session.GenesisHash, treasureIdxMap,
+				models.DataMapsTimeToLive); err != nil {
+				continue
+			}
+			numIngested += len(chunks)
+		}
+
+		// The client may have uploaded the batch again while it was ingested, in which case the new batch is
+		// ingested on the next run.
+		err = BlobStore.DeleteObjectVersion(blobstore.DefaultBucketName, objectKey, version)
+		if err == blobstore.ErrObjectChanged {
+			continue
+		}
+		if err != nil {
+			oyster_utils.LogIfError(err, nil)
+			continue
+		}
+		// The manifest reports the ingested chunks from the chunk storage from now on.
+		if batchIdx, err := strconv.Atoi(strings.TrimPrefix(objectKey, prefix)); err == nil {
+			models.DeleteUploadBatch(session.GenesisHash, batchIdx)
+		}
+	}
+
+	receivedIndexes, err := session.GetReceivedChunkIndexes()
+	if err != nil || len(receivedIndexes) < session.GetNumChunksFromClient() {
+		return numIngested
+	}
+
+	session.AllDataReady = models.AllDataReady
+	vErr, err := models.DB.ValidateAndUpdate(&session)
+	oyster_utils.LogIfError(err, nil)
+	oyster_utils.LogIfValidationError("error marking v3 session as all data ready", vErr, nil)
+	return numIngested
+}
+
+/*getUploadBatch parses the batch stored under objectKey and returns its valid chunks, and an error for each chunk
+which does not belong to the batch or is invalid.  Returns an error if the batch itself can't be parsed.*/
+func getUploadBatch(session models.UploadSession, objectKey string, data string) ([]models.ChunkReq,
+	[]models.ChunkReqError, error) {
+	batchIdx, err := strconv.Atoi(strings.TrimPrefix(objectKey, session.GenesisHash+"/"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid batch key")
+	}
+
+	var chunks []models.ChunkReq
+	if err := json.Unmarshal([]byte(data), &chunks); err != nil {
+		return nil, nil, err
+	}
+
+	minIdx := batchIdx * models.ChunkBatchSize
+	maxIdx := oyster_utils.IntMin((batchIdx+1)*models.ChunkBatchSize, session.NumChunks) - 1
+	chunkErrors := []models.ChunkReqError{}
+	var chunksInBatch []models.ChunkReq
+	for _, chunk := range chunks {
+		if chunk.Idx < minIdx || chunk.Idx > maxIdx {
+			chunkErrors = append(chunkErrors, models.ChunkReqError{Idx: chunk.Idx,
+				Error: fmt.Sprintf("Index is outside of the batch range [%v, %v]", minIdx, maxIdx)})
+			continue
+		}
+		chunksInBatch = append(chunksInBatch, chunk)
+	}
+	if len(chunksInBatch) == 0 {
+		return nil, chunkErrors, nil
+	}
+
+	invalidIdxs := make(map[int]bool)
+	for _, chunkErr := range session.ValidateChunkReqs(chunksInBatch) {
+		if chunkErr.Idx < 0 {
+			return nil, nil, errUploadBatchNotChecked
+		}
+		invalidIdxs[chunkErr.Idx] = true
+		chunkErrors = append(chunkErrors, chunkErr)
+	}
+
+	var validChunks []models.ChunkReq
+	for _, chunk := range chunksInBatch {
+		if !invalidIdxs[chunk.Idx] {
+			validChunks = append(validChunks, chunk)
+		}
+	}
+	return validChunks, chunkErrors, nil
+}
@@ -0,0 +1,149 @@
+package jobs_test
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/oysterprotocol/brokernode/jobs"
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services/blobstore"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+func (suite *JobsSuite) Test_IngestUploadBatches_AllBatches() {
+	jobs.BlobStore = blobstore.NewMemoryStore()
+	defer func() { jobs.BlobStore = blobstore.Store }()
+
+	u := createS3SessionForTest(suite, 30)
+	chunkReqs := GenerateChunkRequests(30, u.GenesisHash)
+	setUploadBatchForTest(suite, u.GenesisHash, 0, chunkReqs[0:25])
+	setUploadBatchForTest(suite, u.GenesisHash, 1, chunkReqs[25:30])
+
+	jobs.IngestUploadBatches(jobs.PrometheusWrapper)
+
+	session := models.UploadSession{}
+	suite.Nil(suite.DB.Find(&session, u.ID))
+	suite.Equal(models.AllDataReady, session.AllDataReady)
+
+	receivedIndexes, err := session.GetReceivedChunkIndexes()
+	suite.Nil(err)
+	suite.Equal(30, len(receivedIndexes))
+
+	keys, err := jobs.BlobStore.ListObjectKeys(blobstore.DefaultBucketName, u.GenesisHash+"/")
+	suite.Nil(err)
+	suite.Equal(0, len(keys))
+
+	// the records of the ingested batches are removed with them
+	batchIndexes, err := models.GetUploadBatchReceivedIndexes(u.GenesisHash)
+	suite.Nil(err)
+	suite.Equal(0, len(batchIndexes))
+}
+
+func (suite *JobsSuite) Test_IngestUploadBatches_MissingAndInvalidBatches() {
+	jobs.BlobStore = blobstore.NewMemoryStore()
+	defer func() { jobs.BlobStore = blobstore.Store }()
+
+	u := createS3SessionForTest(suite, 60)
+	chunkReqs := GenerateChunkRequests(60, u.GenesisHash)
+	setUploadBatchForTest(suite, u.GenesisHash, 0, chunkReqs[0:25])
+	// Chunks stored under the wrong batch.
+	setUploadBatchForTest(suite, u.GenesisHash, 1, chunkReqs[50:60])
+
+	jobs.IngestUploadBatches(jobs.PrometheusWrapper)
+
+	session := models.UploadSession{}
+	suite.Nil(suite.DB.Find(&session, u.ID))
+	suite.Equal(models.AllDataNotReady, session.AllDataReady)
+
+	receivedIndexes, err := session.GetReceivedChunkIndexes()
+	suite.Nil(err)
+	suite.Equal(25, len(receivedIndexes))
+
+	keys, err := jobs.BlobStore.ListObjectKeys(blobstore.DefaultBucketName, u.GenesisHash+"/")
+	suite.Nil(err)
+	suite.Equal(0, len(keys))
+}
+
+func (suite *JobsSuite) Test_IngestUploadBatches_InvalidData() {
+	jobs.BlobStore = blobstore.NewMemoryStore()
+	defer func() { jobs.BlobStore = blobstore.Store }()
+
+	u := createS3SessionForTest(suite, 30)
+	chunkReqs := GenerateChunkRequests(30, u.GenesisHash)
+	chunkReqs[3].Data = "not trytes"
+	setUploadBatchForTest(suite, u.GenesisHash, 0, chunkReqs[0:25])
+	setUploadBatchForTest(suite, u.GenesisHash, 1, chunkReqs[25:30])
+
+	numIngested, err := jobs.IngestUploadBatches(jobs.PrometheusWrapper)
+	suite.Nil(err)
+	suite.Equal(29, numIngested)
+
+	session := models.UploadSession{}
+	suite.Nil(suite.DB.Find(&session, u.ID))
+	suite.Equal(models.AllDataNotReady, session.AllDataReady)
+
+	// only the invalid chunk is dropped, so that the client uploads it again
+	receivedIndexes, err := session.GetReceivedChunkIndexes()
+	suite.Nil(err)
+	suite.Equal(29, len(receivedIndexes))
+	suite.NotContains(receivedIndexes, 3)
+
+	keys, err := jobs.BlobStore.ListObjectKeys(blobstore.DefaultBucketName, u.GenesisHash+"/")
+	suite.Nil(err)
+	suite.Equal(0, len(keys))
+}
+
+func (suite *JobsSuite) Test_IngestUploadBatches_StoreFails() {
+	jobs.BlobStore = blobstore.NewMemoryStore()
+	defer func() { jobs.BlobStore = blobstore.Store }()
+
+	// the chunks are stored in the global DB in SQL mode, which is closed here
+	defer oyster_utils.SetStorageMode(oyster_utils.DataMapStorageMode)
+	oyster_utils.SetStorageMode(oyster_utils.DataMapsInSQL)
+
+	u := createS3SessionForTest(suite, 30)
+	chunkReqs := GenerateChunkRequests(30, u.GenesisHash)
+	setUploadBatchForTest(suite, u.GenesisHash, 0, chunkReqs[0:25])
+
+	suite.Nil(oyster_utils.CloseKvStore())
+	numIngested, err := jobs.IngestUploadBatches(jobs.PrometheusWrapper)
+	suite.Nil(oyster_utils.InitKvStore())
+	suite.Nil(err)
+	suite.Equal(0, numIngested)
+
+	// the batch is kept, so that it is ingested on the next run
+	keys, err := jobs.BlobStore.ListObjectKeys(blobstore.DefaultBucketName, u.GenesisHash+"/")
+	suite.Nil(err)
+	suite.Equal(1, len(keys))
+	batchIndexes, err := models.GetUploadBatchReceivedIndexes(u.GenesisHash)
+	suite.Nil(err)
+	suite.Equal(25, len(batchIndexes))
+
+	numIngested, err = jobs.IngestUploadBatches(jobs.PrometheusWrapper)
+	suite.Nil(err)
+	suite.Equal(25, numIngested)
+}
+
+func createS3SessionForTest(suite *JobsSuite, numChunks int) models.UploadSession {
+	u := models.UploadSession{
+		Type:          models.SessionTypeAlpha,
+		GenesisHash:   oyster_utils.RandSeq(6, []rune("abcdef0123456789")),
+		NumChunks:     numChunks,
+		StorageMethod: models.StorageMethodS3,
+	}
+	suite.Nil(suite.DB.Save(&u))
+	return u
+}
+
+func setUploadBatchForTest(suite *JobsSuite, genesisHash string, batchIdx int, chunkReqs []models.ChunkReq) {
+	data, err := json.Marshal(chunkReqs)
+	suite.Nil(err)
+	objectKey := fmt.Sprintf("%v/%v", genesisHash, batchIdx)
+	suite.Nil(jobs.BlobStore.SetObject(blobstore.DefaultBucketName, objectKey, string(data)))
+
+	var indexes []int
+	for _, chunkReq := range chunkReqs {
+		indexes = append(indexes, chunkReq.Idx)
+	}
+	suite.Nil(models.SetUploadBatchReceived(genesisHash, batchIdx, indexes))
+}
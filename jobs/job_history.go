@@ -0,0 +1,241 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+const (
+	/*JobHistorySize is the number of runs kept for each job.*/
+	JobHistorySize = 20
+	/*JobLeaseDuration is how long a job holds its lease.  The lease is released when the job finishes, it only
+	expires if the broker replica died while running the job.*/
+	JobLeaseDuration = 30 * time.Minute
+	/*JobLeaseRenewInterval is how often a running job extends its lease, so that jobs running longer than
+	JobLeaseDuration keep it.*/
+	JobLeaseRenewInterval = JobLeaseDuration / 3
+)
+
+/*JobRun is the record of one run of a job.*/
+type JobRun struct {
+	Name           string    `json:"name"`
+	Manual         bool      `json:"manual"`
+	StartTime      time.Time `json:"startTime"`
+	EndTime        time.Time `json:"endTime"`
+	Duration       string    `json:"duration"`
+	Error          string    `json:"error,omitempty"`
+	ItemsProcessed int       `json:"itemsProcessed"`
+}
+
+/*JobStatus is the schedule and the recent runs of a job.*/
+type JobStatus struct {
+	Name      string `json:"name"`
+	Enabled   bool   `json:"enabled"`
+	Scheduled bool   `json:"scheduled"`
+	Interval  string `json:"interval"`
+	Jitter    string `json:"jitter"`
+	Running   bool   `json:"running"`
+	/*ConsecutiveFailures is the number of the last runs which failed, the job is backed off while it is not 0.*/
+	ConsecutiveFailures int `json:"consecutiveFailures"`
+	/*Runs are ordered from the newest to the oldest.*/
+	Runs []JobRun `json:"runs"`
+}
+
+var (
+	/*ErrJobNotFound is returned when there is no job with the requested name.*/
+	ErrJobNotFound = errors.New("job not found")
+	/*ErrJobAlreadyRunning is returned when a job is triggered while it is running.*/
+	ErrJobAlreadyRunning = errors.New("job is already running")
+	/*ErrJobRunningElsewhere is returned when another broker replica holds the lease of the job.*/
+	ErrJobRunningElsewhere = errors.New("job is running on another broker replica")
+)
+
+type jobHistory struct {
+	mutex               sync.Mutex
+	runs                map[string][]JobRun
+	running             map[string]bool
+	consecutiveFailures map[string]int
+}
+
+var history = jobHistory{
+	runs:                make(map[string][]JobRun),
+	running:             make(map[string]bool),
+	consecutiveFailures: make(map[string]int),
+}
+
+/*GetJobStatuses returns the schedule and the recent runs of every job.*/
+func GetJobStatuses() []JobStatus {
+	var statuses []JobStatus
+	for _, definition := range getRegisteredJobs() {
+		statuses = append(statuses, JobStatus{
+			Name:                definition.name,
+			Enabled:             definition.config.Enabled,
+			Scheduled:           definition.config.IsScheduled(),
+			Interval:            definition.config.Interval.String(),
+			Jitter:              definition.config.Jitter.String(),
+			Running:             history.isRunning(definition.name),
+			Runs:                history.getRuns(definition.name),
+			ConsecutiveFailures: history.getConsecutiveFailures(definition.name),
+		})
+	}
+	return statuses
+}
+
+/*RunJobNow starts a run of the job in the background, independent of its schedule.*/
+func RunJobNow(name string) error {
+	definition, ok := getRegisteredJob(name)
+	if !ok {
+		return ErrJobNotFound
+	}
+	if err := startJob(name); err != nil {
+		return err
+	}
+
+	go executeJob(definition, true)
+	return nil
+}
+
+/*runJob runs a scheduled job, unless it is still running from a manual trigger or on another broker replica.*/
+func runJob(definition jobDefinition) {
+	if err := startJob(definition.name); err != nil {
+		return
+	}
+
+	executeJob(definition, false)
+}
+
+/*startJob marks the job as running and takes its lease.  Every started job must be run with executeJob.*/
+func startJob(name string) error {
+	if !history.start(name) {
+		return ErrJobAlreadyRunning
+	}
+
+	acquired, err := models.AcquireJobLease(name, oyster_utils.BrokerInstanceID, JobLeaseDuration)
+	if err != nil || !acquired {
+		history.cancel(name)
+		if err != nil {
+			return err
+		}
+		return ErrJobRunningElsewhere
+	}
+	return nil
+}
+
+/*executeJob runs the job and records the run.  A panic of the job is recovered, so that it is reported and the
+job is still rescheduled.*/
+func executeJob(definition jobDefinition, manual bool) {
+	run := JobRun{
+		Name:      definition.name,
+		Manual:    manual,
+		StartTime: time.Now(),
+	}
+
+	done := make(chan struct{})
+	go renewJobLease(definition.name, done)
+
+	defer func() {
+		if r := recover(); r != nil {
+			run.Error = fmt.Sprintf("panic: %v", r)
+			PrometheusWrapper.CounterIncrement(PrometheusWrapper.CounterJobPanics, definition.name)
+			oyster_utils.LogIfError(fmt.Errorf("job %v panicked: %v", definition.name, r),
+				map[string]interface{}{"stack": string(debug.Stack())})
+		}
+		run.EndTime = time.Now()
+		run.Duration = run.EndTime.Sub(run.StartTime).String()
+		close(done)
+		models.ReleaseJobLease(definition.name, oyster_utils.BrokerInstanceID)
+		history.finish(run)
+	}()
+
+	itemsProcessed, err := definition.job()
+	run.ItemsProcessed = itemsProcessed
+	if err != nil {
+		run.Error = err.Error()
+	}
+}
+
+/*renewJobLease extends the lease of the job every JobLeaseRenewInterval until done is closed.*/
+func renewJobLease(name string, done <-chan struct{}) {
+	ticker := time.NewTicker(JobLeaseRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			acquired, err := models.AcquireJobLease(name, oyster_utils.BrokerInstanceID, JobLeaseDuration)
+			if err == nil && !acquired {
+				oyster_utils.LogIfError(fmt.Errorf("job %v lost its lease to another broker replica", name), nil)
+			}
+		}
+	}
+}
+
+func (h *jobHistory) start(name string) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.running[name] {
+		return false
+	}
+	h.running[name] = true
+	return true
+}
+
+func (h *jobHistory) finish(run JobRun) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	runs := append(h.runs[run.Name], run)
+	if len(runs) > JobHistorySize {
+		runs = runs[len(runs)-JobHistorySize:]
+	}
+	h.runs[run.Name] = runs
+	delete(h.running, run.Name)
+
+	if run.Error != "" {
+		h.consecutiveFailures[run.Name]++
+	} else {
+		delete(h.consecutiveFailures, run.Name)
+	}
+}
+
+func (h *jobHistory) cancel(name string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	delete(h.running, name)
+}
+
+func (h *jobHistory) isRunning(name string) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.running[name]
+}
+
+func (h *jobHistory) getRuns(name string) []JobRun {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	runs := h.runs[name]
+	newestFirst := make([]JobRun, len(runs))
+	for i, run := range runs {
+		newestFirst[len(runs)-1-i] = run
+	}
+	return newestFirst
+}
+
+func (h *jobHistory) getConsecutiveFailures(name string) int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.consecutiveFailures[name]
+}
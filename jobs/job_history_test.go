@@ -0,0 +1,50 @@
+package jobs_test
+
+import (
+	"time"
+
+	"github.com/oysterprotocol/brokernode/jobs"
+	"github.com/oysterprotocol/brokernode/services/blobstore"
+)
+
+func (suite *JobsSuite) Test_RunJobNow_RecordsRun() {
+	suite.Nil(jobs.RunJobNow("purge_completed_sessions"))
+
+	status := waitForJobRun(suite, "purge_completed_sessions")
+	suite.Equal(1, len(status.Runs))
+	suite.True(status.Runs[0].Manual)
+	suite.Equal("", status.Runs[0].Error)
+	suite.False(status.Runs[0].EndTime.Before(status.Runs[0].StartTime))
+}
+
+func (suite *JobsSuite) Test_RunJobNow_RecordsItemsProcessed() {
+	jobs.BlobStore = blobstore.NewMemoryStore()
+	defer func() { jobs.BlobStore = blobstore.Store }()
+
+	u := createS3SessionForTest(suite, 30)
+	chunkReqs := GenerateChunkRequests(30, u.GenesisHash)
+	setUploadBatchForTest(suite, u.GenesisHash, 1, chunkReqs[25:30])
+
+	suite.Nil(jobs.RunJobNow("ingest_upload_batches"))
+
+	status := waitForJobRun(suite, "ingest_upload_batches")
+	suite.Equal("", status.Runs[0].Error)
+	suite.Equal(5, status.Runs[0].ItemsProcessed)
+}
+
+func (suite *JobsSuite) Test_RunJobNow_UnknownJob() {
+	suite.Equal(jobs.ErrJobNotFound, jobs.RunJobNow("not_a_job"))
+}
+
+func waitForJobRun(suite *JobsSuite, name string) jobs.JobStatus {
+	for i := 0; i < 100; i++ {
+		for _, status := range jobs.GetJobStatuses() {
+			if status.Name == name && !status.Running && len(status.Runs) > 0 {
+				return status
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	suite.Fail("job did not finish: " + name)
+	return jobs.JobStatus{}
+}
@@ -0,0 +1,292 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+/*JobConfig decides if and how often a job is scheduled.*/
+type JobConfig struct {
+	Interval time.Duration
+	/*Jitter is the max random delay added to each Interval, so that jobs of several brokers do not run in lockstep.*/
+	Jitter  time.Duration
+	Enabled bool
+	/*BrokerModes are the broker modes in which the job runs.  Empty means every mode.*/
+	BrokerModes []oyster_utils.BrokerModeStatus
+	/*RequireUserIsPaying means the job only runs when the users pay for their own uploads.*/
+	RequireUserIsPaying bool
+}
+
+/*jobConfigFile is the format of each job's entry in the file at JOBS_CONFIG_FILE.  Fields which are not set keep
+the default value.*/
+type jobConfigFile struct {
+	Interval            *string  `json:"interval"`
+	Jitter              *string  `json:"jitter"`
+	Enabled             *bool    `json:"enabled"`
+	BrokerModes         []string `json:"brokerModes"`
+	RequireUserIsPaying *bool    `json:"requireUserIsPaying"`
+}
+
+/*jobDefinition is a job and its schedule.  The job returns the number of items it processed, and the error which
+made the run fail.*/
+type jobDefinition struct {
+	name   string
+	job    func() (int, error)
+	config JobConfig
+}
+
+var (
+	registeredJobs     []jobDefinition
+	registeredJobsOnce sync.Once
+)
+
+var brokerModeNames = map[string]oyster_utils.BrokerModeStatus{
+	"PROD_MODE":                oyster_utils.ProdMode,
+	"TEST_MODE_DUMMY_TREASURE": oyster_utils.TestModeDummyTreasure,
+	"TEST_MODE_NO_TREASURE":    oyster_utils.TestModeNoTreasure,
+}
+
+/*getDefaultJobDefinitions returns every job the broker knows about with its default schedule.*/
+func getDefaultJobDefinitions() []jobDefinition {
+	prodMode := []oyster_utils.BrokerModeStatus{oyster_utils.ProdMode}
+
+	return []jobDefinition{
+		{"flush_old_webnodes", flushOldWebnodesJob,
+			JobConfig{Interval: 5 * time.Minute, Enabled: true}},
+		{"process_unassigned_chunks", processUnassignedChunksJob,
+			JobConfig{Interval: time.Duration(services.GetProcessingFrequency()) * time.Second, Enabled: true}},
+		{"purge_completed_sessions", purgeCompletedSessionsJob,
+			JobConfig{Interval: 1 * time.Minute, Enabled: true}},
+		{"verify_data_maps", verifyDataMapsJob,
+			JobConfig{Interval: 60 * time.Second, Enabled: true}},
+		{"attach_treasures_to_tangle", attachTreasuresToTangleJob,
+			JobConfig{Interval: 1 * time.Minute, Enabled: true}},
+		{"process_lambda_retries", processLambdaRetriesJob,
+			JobConfig{Interval: 30 * time.Second, Enabled: true}},
+		{"reverify_completed_uploads", reverifyCompletedUploadsJob,
+			JobConfig{Interval: 1 * time.Hour, Jitter: 10 * time.Minute, Enabled: true}},
+		{"reconcile_peer_sessions", reconcilePeerSessionsJob,
+			JobConfig{Interval: 5 * time.Minute, Jitter: 30 * time.Second, Enabled: true}},
+		{"check_brokernodes", checkBrokernodesJob,
+			JobConfig{Interval: 5 * time.Minute, Jitter: 30 * time.Second, Enabled: true}},
+		{"announce_brokernode", announceBrokernodeJob,
+			JobConfig{Interval: 1 * time.Hour, Jitter: 5 * time.Minute, Enabled: true}},
+		{"process_paid_sessions", processPaidSessionsJob,
+			JobConfig{Interval: 20 * time.Second, Enabled: true}},
+		{"claim_treasure_for_webnode", claimTreasureForWebnodeJob,
+			JobConfig{Interval: 2 * time.Minute, Enabled: true}},
+		{"remove_unpaid_upload_session", removeUnpaidUploadSessionJob,
+			JobConfig{Interval: 24 * time.Hour, Enabled: true}},
+		{"check_all_data_is_ready", checkAllDataIsReadyJob,
+			JobConfig{Interval: 7 * time.Second, Enabled: true}},
+		{"ingest_upload_batches", ingestUploadBatchesJob,
+			JobConfig{Interval: 10 * time.Second, Enabled: true}},
+		{"store_completed_genesis_hashes", storeCompletedGenesisHashesJob,
+			JobConfig{Interval: 1 * time.Minute, Enabled: true, BrokerModes: prodMode}},
+		{"bury_treasure_addresses", buryTreasureAddressesJob,
+			JobConfig{Interval: 2 * time.Minute, Enabled: true, BrokerModes: prodMode, RequireUserIsPaying: true}},
+		{"claim_unused_prls", claimUnusedPRLsJob,
+			JobConfig{Interval: 10 * time.Minute, Enabled: true, BrokerModes: prodMode, RequireUserIsPaying: true}},
+		{"check_alpha_payments", checkAlphaPaymentsJob,
+			JobConfig{Interval: 10 * time.Second, Enabled: true, BrokerModes: prodMode, RequireUserIsPaying: true}},
+		{"check_beta_payments", checkBetaPaymentsJob,
+			JobConfig{Interval: 70 * time.Second, Enabled: true, BrokerModes: prodMode, RequireUserIsPaying: true}},
+		// Need to re-enable this.
+		{"badger_db_gc", badgerDbGcJob,
+			JobConfig{Interval: 10 * time.Minute, Enabled: false}},
+	}
+}
+
+/*getRegisteredJobs returns the job definitions of this broker, loading them the first time it is called.*/
+func getRegisteredJobs() []jobDefinition {
+	registeredJobsOnce.Do(func() {
+		registeredJobs = getJobDefinitions()
+	})
+	return registeredJobs
+}
+
+func getRegisteredJob(name string) (jobDefinition, bool) {
+	for _, definition := range getRegisteredJobs() {
+		if definition.name == name {
+			return definition, true
+		}
+	}
+	return jobDefinition{}, false
+}
+
+/*getJobDefinitions returns the jobs with their default schedule overridden by the file at JOBS_CONFIG_FILE and
+then by the JOB_<NAME>_INTERVAL, JOB_<NAME>_JITTER and JOB_<NAME>_ENABLED env vars.*/
+func getJobDefinitions() []jobDefinition {
+	definitions := getDefaultJobDefinitions()
+
+	configs := make(map[string]JobConfig)
+	for _, definition := range definitions {
+		configs[definition.name] = definition.config
+	}
+
+	configs, err := LoadJobConfigs(configs, os.Getenv("JOBS_CONFIG_FILE"))
+	oyster_utils.LogIfError(err, nil)
+
+	for i := range definitions {
+		definitions[i].config = configs[definitions[i].name]
+	}
+	return definitions
+}
+
+/*LoadJobConfigs applies the config file at configPath (if any) and the env vars to a copy of configs.  Invalid
+values are reported in the returned error and leave the affected setting unchanged.*/
+func LoadJobConfigs(configs map[string]JobConfig, configPath string) (map[string]JobConfig, error) {
+	loadedConfigs := make(map[string]JobConfig)
+	for name, config := range configs {
+		loadedConfigs[name] = config
+	}
+
+	var errs []string
+	if configPath != "" {
+		if err := applyJobConfigFile(loadedConfigs, configPath); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	for name, config := range loadedConfigs {
+		config, err := applyJobConfigEnv(name, config)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+		loadedConfigs[name] = config
+	}
+
+	if len(errs) > 0 {
+		return loadedConfigs, fmt.Errorf("Invalid job config: %v", strings.Join(errs, "; "))
+	}
+	return loadedConfigs, nil
+}
+
+/*IsScheduled returns whether the job should run with the broker's current modes.*/
+func (config JobConfig) IsScheduled() bool {
+	if !config.Enabled {
+		return false
+	}
+	if config.RequireUserIsPaying && oyster_utils.PaymentMode != oyster_utils.UserIsPaying {
+		return false
+	}
+	if len(config.BrokerModes) == 0 {
+		return true
+	}
+	for _, mode := range config.BrokerModes {
+		if mode == oyster_utils.BrokerMode {
+			return true
+		}
+	}
+	return false
+}
+
+func applyJobConfigFile(configs map[string]JobConfig, configPath string) error {
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+
+	fileConfigs := make(map[string]jobConfigFile)
+	if err := json.Unmarshal(data, &fileConfigs); err != nil {
+		return err
+	}
+
+	var errs []string
+	for name, fileConfig := range fileConfigs {
+		config, ok := configs[name]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("unknown job %v", name))
+			continue
+		}
+
+		if fileConfig.Interval != nil {
+			if config.Interval, err = parseInterval(*fileConfig.Interval, config.Interval); err != nil {
+				errs = append(errs, fmt.Sprintf("%v interval: %v", name, err))
+			}
+		}
+		if fileConfig.Jitter != nil {
+			if config.Jitter, err = time.ParseDuration(*fileConfig.Jitter); err != nil {
+				errs = append(errs, fmt.Sprintf("%v jitter: %v", name, err))
+			}
+		}
+		if fileConfig.Enabled != nil {
+			config.Enabled = *fileConfig.Enabled
+		}
+		if fileConfig.RequireUserIsPaying != nil {
+			config.RequireUserIsPaying = *fileConfig.RequireUserIsPaying
+		}
+		if fileConfig.BrokerModes != nil {
+			var brokerModes []oyster_utils.BrokerModeStatus
+			for _, modeName := range fileConfig.BrokerModes {
+				mode, ok := brokerModeNames[modeName]
+				if !ok {
+					errs = append(errs, fmt.Sprintf("%v broker mode: unknown mode %v", name, modeName))
+					continue
+				}
+				brokerModes = append(brokerModes, mode)
+			}
+			config.BrokerModes = brokerModes
+		}
+		configs[name] = config
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%v: %v", configPath, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+func applyJobConfigEnv(name string, config JobConfig) (JobConfig, error) {
+	envPrefix := "JOB_" + strings.ToUpper(name) + "_"
+
+	var errs []string
+	var err error
+	if v := os.Getenv(envPrefix + "INTERVAL"); v != "" {
+		if config.Interval, err = parseInterval(v, config.Interval); err != nil {
+			errs = append(errs, fmt.Sprintf("%vINTERVAL: %v", envPrefix, err))
+		}
+	}
+	if v := os.Getenv(envPrefix + "JITTER"); v != "" {
+		jitter, err := time.ParseDuration(v)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%vJITTER: %v", envPrefix, err))
+		} else {
+			config.Jitter = jitter
+		}
+	}
+	if v := os.Getenv(envPrefix + "ENABLED"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%vENABLED: %v", envPrefix, err))
+		} else {
+			config.Enabled = enabled
+		}
+	}
+
+	if len(errs) > 0 {
+		return config, errors.New(strings.Join(errs, ", "))
+	}
+	return config, nil
+}
+
+/*parseInterval parses a positive duration such as "90s" or "24h".  On error the current interval is returned.*/
+func parseInterval(v string, current time.Duration) (time.Duration, error) {
+	interval, err := time.ParseDuration(v)
+	if err != nil {
+		return current, err
+	}
+	if interval <= 0 {
+		return current, fmt.Errorf("interval must be positive")
+	}
+	return interval, nil
+}
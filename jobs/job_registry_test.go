@@ -0,0 +1,79 @@
+package jobs_test
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/oysterprotocol/brokernode/jobs"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+func (suite *JobsSuite) Test_LoadJobConfigs_ConfigFileAndEnv() {
+	configFile, err := ioutil.TempFile("", "jobs_config")
+	suite.Nil(err)
+	defer os.Remove(configFile.Name())
+	_, err = configFile.WriteString(`{
+		"test_job_a": {"interval": "30s", "jitter": "5s", "enabled": false},
+		"test_job_b": {"brokerModes": ["PROD_MODE"], "requireUserIsPaying": true}
+	}`)
+	suite.Nil(err)
+	suite.Nil(configFile.Close())
+
+	os.Setenv("JOB_TEST_JOB_A_ENABLED", "true")
+	defer os.Unsetenv("JOB_TEST_JOB_A_ENABLED")
+	os.Setenv("JOB_TEST_JOB_B_INTERVAL", "2m")
+	defer os.Unsetenv("JOB_TEST_JOB_B_INTERVAL")
+
+	defaults := map[string]jobs.JobConfig{
+		"test_job_a": {Interval: 10 * time.Second, Enabled: true},
+		"test_job_b": {Interval: 1 * time.Minute, Enabled: true},
+	}
+	configs, err := jobs.LoadJobConfigs(defaults, configFile.Name())
+	suite.Nil(err)
+
+	suite.Equal(30*time.Second, configs["test_job_a"].Interval)
+	suite.Equal(5*time.Second, configs["test_job_a"].Jitter)
+	suite.True(configs["test_job_a"].Enabled)
+
+	suite.Equal(2*time.Minute, configs["test_job_b"].Interval)
+	suite.Equal([]oyster_utils.BrokerModeStatus{oyster_utils.ProdMode}, configs["test_job_b"].BrokerModes)
+	suite.True(configs["test_job_b"].RequireUserIsPaying)
+
+	// The defaults are left untouched.
+	suite.Equal(10*time.Second, defaults["test_job_a"].Interval)
+}
+
+func (suite *JobsSuite) Test_LoadJobConfigs_InvalidValues() {
+	os.Setenv("JOB_TEST_JOB_A_INTERVAL", "-5s")
+	defer os.Unsetenv("JOB_TEST_JOB_A_INTERVAL")
+	os.Setenv("JOB_TEST_JOB_A_ENABLED", "maybe")
+	defer os.Unsetenv("JOB_TEST_JOB_A_ENABLED")
+
+	defaults := map[string]jobs.JobConfig{
+		"test_job_a": {Interval: 10 * time.Second, Enabled: true},
+	}
+	configs, err := jobs.LoadJobConfigs(defaults, "")
+
+	suite.NotNil(err)
+	suite.Equal(10*time.Second, configs["test_job_a"].Interval)
+	suite.True(configs["test_job_a"].Enabled)
+}
+
+func (suite *JobsSuite) Test_JobConfigIsScheduled() {
+	defer oyster_utils.ResetPaymentMode()
+
+	suite.False(jobs.JobConfig{Enabled: false}.IsScheduled())
+	suite.True(jobs.JobConfig{Enabled: true}.IsScheduled())
+
+	// JobsSuite runs in TestModeDummyTreasure.
+	suite.False(jobs.JobConfig{Enabled: true,
+		BrokerModes: []oyster_utils.BrokerModeStatus{oyster_utils.ProdMode}}.IsScheduled())
+	suite.True(jobs.JobConfig{Enabled: true,
+		BrokerModes: []oyster_utils.BrokerModeStatus{oyster_utils.ProdMode, oyster_utils.TestModeDummyTreasure}}.IsScheduled())
+
+	oyster_utils.SetPaymentMode(oyster_utils.OysterIsPaying)
+	suite.False(jobs.JobConfig{Enabled: true, RequireUserIsPaying: true}.IsScheduled())
+	oyster_utils.SetPaymentMode(oyster_utils.UserIsPaying)
+	suite.True(jobs.JobConfig{Enabled: true, RequireUserIsPaying: true}.IsScheduled())
+}
@@ -2,13 +2,14 @@ package jobs
 
 import (
 	"github.com/oysterprotocol/brokernode/utils/eth_gateway"
+	"math/rand"
 	"os"
-	"reflect"
-	"runtime"
 	"time"
 
 	"github.com/gobuffalo/buffalo/worker"
+	"github.com/oysterprotocol/brokernode/models"
 	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/services/blobstore"
 	"github.com/oysterprotocol/brokernode/utils"
 )
 
@@ -17,6 +18,10 @@ const (
 	BundleSize = 100
 	/*Duration is for one of our tags for error logging*/
 	Duration = "duration"
+	/*Jitter is the max random delay added to Duration*/
+	Jitter = "jitter"
+	/*MaxJobBackoff is the longest a failing job is delayed, unless its interval is longer*/
+	MaxJobBackoff = 30 * time.Minute
 	/*SecondsDelayForETHPolling is how long to wait between polling attempts for ethereum transactions*/
 	SecondsDelayForETHPolling = 1 * 60
 )
@@ -27,6 +32,7 @@ var (
 	IotaWrapper       = services.IotaWrapper
 	EthWrapper        = eth_gateway.EthWrapper
 	PrometheusWrapper = services.PrometheusWrapper
+	BlobStore         = blobstore.Store
 )
 
 func init() {
@@ -34,199 +40,205 @@ func init() {
 		return
 	}
 
-	registerHandlers(OysterWorker)
-	doWork(OysterWorker)
+	registerHandlers(OysterWorker, getRegisteredJobs())
+	doWork(OysterWorker, getRegisteredJobs())
 }
 
-func registerHandlers(oysterWorker *worker.Simple) {
-	oysterWorker.Register(getHandlerName(flushOldWebnodesHandler), flushOldWebnodesHandler)
-	oysterWorker.Register(getHandlerName(processUnassignedChunksHandler), processUnassignedChunksHandler)
-	oysterWorker.Register(getHandlerName(purgeCompletedSessionsHandler), purgeCompletedSessionsHandler)
-	oysterWorker.Register(getHandlerName(verifyDataMapsHandler), verifyDataMapsHandler)
-	oysterWorker.Register(getHandlerName(processPaidSessionsHandler), processPaidSessionsHandler)
-	oysterWorker.Register(getHandlerName(claimTreasureForWebnodeHandler), claimTreasureForWebnodeHandler)
-	oysterWorker.Register(getHandlerName(removeUnpaidUploadSessionHandler), removeUnpaidUploadSessionHandler)
-	oysterWorker.Register(getHandlerName(checkAllDataIsReadyHandler), checkAllDataIsReadyHandler)
-
-	oysterWorker.Register(getHandlerName(buryTreasureAddressesHandler), buryTreasureAddressesHandler)
-	oysterWorker.Register(getHandlerName(claimUnusedPRLsHandler), claimUnusedPRLsHandler)
-	oysterWorker.Register(getHandlerName(checkAlphaPaymentsHandler), checkAlphaPaymentsHandler)
-	oysterWorker.Register(getHandlerName(checkBetaPaymentsHandler), checkBetaPaymentsHandler)
-	oysterWorker.Register(getHandlerName(storeCompletedGenesisHashesHandler), storeCompletedGenesisHashesHandler)
-
-	// Need to re-enable this.
-	//oysterWorker.Register(getHandlerName(badgerDbGcHandler), badgerDbGcHandler)
+func registerHandlers(oysterWorker *worker.Simple, jobDefinitions []jobDefinition) {
+	for _, definition := range jobDefinitions {
+		oysterWorker.Register(definition.name, getJobHandler(definition))
+	}
 }
 
-func doWork(oysterWorker *worker.Simple) {
-	oysterWorkerPerformIn(flushOldWebnodesHandler,
-		worker.Args{Duration: 5 * time.Minute})
-
-	oysterWorkerPerformIn(processUnassignedChunksHandler,
-		worker.Args{Duration: time.Duration(services.GetProcessingFrequency()) * time.Second})
-
-	oysterWorkerPerformIn(purgeCompletedSessionsHandler,
-		worker.Args{Duration: 1 * time.Minute})
-
-	oysterWorkerPerformIn(verifyDataMapsHandler,
-		worker.Args{Duration: 60 * time.Second})
-
-	oysterWorkerPerformIn(processPaidSessionsHandler,
-		worker.Args{Duration: 20 * time.Second})
-
-	oysterWorkerPerformIn(claimTreasureForWebnodeHandler,
-		worker.Args{Duration: 2 * time.Minute})
-
-	oysterWorkerPerformIn(removeUnpaidUploadSessionHandler,
-		worker.Args{Duration: 24 * time.Hour})
-
-	oysterWorkerPerformIn(checkAllDataIsReadyHandler,
-		worker.Args{Duration: 7 * time.Second})
-
-	// 	oysterWorkerPerformIn(badgerDbGcHandler,
-	// 		worker.Args{Duration: 10 * time.Minute})
-
-	if oyster_utils.BrokerMode == oyster_utils.ProdMode {
-		oysterWorkerPerformIn(storeCompletedGenesisHashesHandler,
-			worker.Args{Duration: 1 * time.Minute})
+func doWork(oysterWorker *worker.Simple, jobDefinitions []jobDefinition) {
+	for _, definition := range jobDefinitions {
+		if !definition.config.IsScheduled() {
+			continue
+		}
+		oysterWorkerPerformIn(definition.name,
+			worker.Args{Duration: definition.config.Interval, Jitter: definition.config.Jitter})
 	}
+}
 
-	if oyster_utils.BrokerMode == oyster_utils.ProdMode && oyster_utils.PaymentMode == oyster_utils.UserIsPaying {
-		oysterWorkerPerformIn(buryTreasureAddressesHandler,
-			worker.Args{Duration: 2 * time.Minute})
-
-		oysterWorkerPerformIn(claimUnusedPRLsHandler,
-			worker.Args{Duration: 10 * time.Minute})
-
-		oysterWorkerPerformIn(checkAlphaPaymentsHandler,
-			worker.Args{Duration: 10 * time.Second})
+/*getJobHandler returns the worker handler which runs the job and schedules its next run, even if the job
+panicked.*/
+func getJobHandler(definition jobDefinition) worker.Handler {
+	return func(args worker.Args) error {
+		defer oysterWorkerPerformIn(definition.name, args)
 
-		oysterWorkerPerformIn(checkBetaPaymentsHandler,
-			worker.Args{Duration: 70 * time.Second})
+		runJob(definition)
+		return nil
 	}
 }
 
-func flushOldWebnodesHandler(args worker.Args) error {
+func flushOldWebnodesJob() (int, error) {
 	thresholdTime := time.Now().Add(-20 * time.Minute) // webnodes older than 20 minutes get deleted
-	FlushOldWebNodes(thresholdTime, PrometheusWrapper)
-
-	oysterWorkerPerformIn(flushOldWebnodesHandler, args)
-	return nil
+	return FlushOldWebNodes(thresholdTime, PrometheusWrapper)
 }
 
-func processUnassignedChunksHandler(args worker.Args) error {
-	if os.Getenv("TANGLE_MAINTENANCE") != "true" {
-		ProcessUnassignedChunks(IotaWrapper, PrometheusWrapper)
+func processUnassignedChunksJob() (int, error) {
+	if os.Getenv("TANGLE_MAINTENANCE") == "true" {
+		return 0, nil
 	}
-
-	oysterWorkerPerformIn(processUnassignedChunksHandler, args)
-	return nil
+	return ProcessUnassignedChunks(IotaWrapper, PrometheusWrapper)
 }
 
-func purgeCompletedSessionsHandler(args worker.Args) error {
-	PurgeCompletedSessions(PrometheusWrapper)
-
-	oysterWorkerPerformIn(purgeCompletedSessionsHandler, args)
-	return nil
+func purgeCompletedSessionsJob() (int, error) {
+	return PurgeCompletedSessions(PrometheusWrapper)
 }
 
-func verifyDataMapsHandler(args worker.Args) error {
+func verifyDataMapsJob() (int, error) {
 	thresholdTime := time.Now().Add(-3 * time.Minute) // wait 3 minutes before verifying a file
-	if os.Getenv("TANGLE_MAINTENANCE") != "true" {
-		VerifyDataMaps(IotaWrapper, PrometheusWrapper, thresholdTime)
+	if os.Getenv("TANGLE_MAINTENANCE") == "true" {
+		return 0, nil
 	}
+	return VerifyDataMaps(IotaWrapper, PrometheusWrapper, thresholdTime)
+}
 
-	oysterWorkerPerformIn(verifyDataMapsHandler, args)
-	return nil
+func attachTreasuresToTangleJob() (int, error) {
+	retryThresholdTime := time.Now().Add(-oyster_utils.GetEnvDuration("TREASURE_ATTACH_RETRY_DELAY", 5*time.Minute))
+	verifyThresholdTime := time.Now().Add(-oyster_utils.GetEnvDuration("TREASURE_ATTACH_VERIFY_TIMEOUT", 30*time.Minute))
+	if os.Getenv("TANGLE_MAINTENANCE") == "true" {
+		return 0, nil
+	}
+	return AttachTreasuresToTangle(IotaWrapper, PrometheusWrapper, retryThresholdTime, verifyThresholdTime)
 }
 
-func processPaidSessionsHandler(args worker.Args) error {
-	ProcessPaidSessions(PrometheusWrapper)
+func processLambdaRetriesJob() (int, error) {
+	if os.Getenv("TANGLE_MAINTENANCE") == "true" {
+		return 0, nil
+	}
+	result, err := services.ProcessLambdaRetries()
+	return result.Attached, err
+}
 
-	oysterWorkerPerformIn(processPaidSessionsHandler, args)
-	return nil
+func reverifyCompletedUploadsJob() (int, error) {
+	// each completed upload is verified again about once per REVERIFY_INTERVAL_PER_UPLOAD
+	reverifiedBefore := time.Now().Add(-oyster_utils.GetEnvDuration("REVERIFY_INTERVAL_PER_UPLOAD", 7*24*time.Hour))
+	if os.Getenv("TANGLE_MAINTENANCE") == "true" {
+		return 0, nil
+	}
+	return ReverifyCompletedUploads(IotaWrapper, PrometheusWrapper, reverifiedBefore,
+		oyster_utils.GetEnvInt("REVERIFY_UPLOADS_PER_RUN", 2), oyster_utils.GetEnvInt("REVERIFY_CHUNKS_PER_UPLOAD", 1000))
 }
 
-func buryTreasureAddressesHandler(args worker.Args) error {
-	thresholdTime := time.Now().Add(-18 * time.Hour) // consider a transaction timed out after 18 hours
-	BuryTreasureAddresses(thresholdTime, PrometheusWrapper)
+func reconcilePeerSessionsJob() (int, error) {
+	return ReconcilePeerSessions(PrometheusWrapper, oyster_utils.GetEnvDuration("PEER_STALL_THRESHOLD", time.Hour))
+}
 
-	oysterWorkerPerformIn(buryTreasureAddressesHandler, args)
-	return nil
+func checkBrokernodesJob() (int, error) {
+	return CheckBrokernodes(PrometheusWrapper, oyster_utils.GetEnvDuration("BROKERNODE_EXPIRY", 24*time.Hour))
 }
 
-func claimTreasureForWebnodeHandler(args worker.Args) error {
-	thresholdTime := time.Now().Add(-18 * time.Hour) // consider a transaction timed out after 18 hours
-	ClaimTreasureForWebnode(thresholdTime, PrometheusWrapper)
+func announceBrokernodeJob() (int, error) {
+	// brokers which do not set their address are not announced to the others
+	if os.Getenv("BROKERNODE_ADDRESS") == "" {
+		return 0, nil
+	}
+	return AnnounceBrokernode(PrometheusWrapper, models.BrokernodeAnnouncement{
+		Address:  os.Getenv("BROKERNODE_ADDRESS"),
+		APIURL:   os.Getenv("BROKERNODE_API_URL"),
+		Capacity: oyster_utils.GetEnvInt("BROKERNODE_CAPACITY", 0),
+		Version:  os.Getenv("BROKERNODE_VERSION"),
+	})
+}
 
-	oysterWorkerPerformIn(claimTreasureForWebnodeHandler, args)
-	return nil
+func processPaidSessionsJob() (int, error) {
+	return ProcessPaidSessions(PrometheusWrapper)
 }
 
-func claimUnusedPRLsHandler(args worker.Args) error {
+func buryTreasureAddressesJob() (int, error) {
 	thresholdTime := time.Now().Add(-18 * time.Hour) // consider a transaction timed out after 18 hours
-	ClaimUnusedPRLs(thresholdTime, PrometheusWrapper)
-
-	oysterWorkerPerformIn(claimUnusedPRLsHandler, args)
-	return nil
+	return BuryTreasureAddresses(thresholdTime, PrometheusWrapper)
 }
 
-func removeUnpaidUploadSessionHandler(args worker.Args) error {
-	RemoveUnpaidUploadSession(PrometheusWrapper)
+func claimTreasureForWebnodeJob() (int, error) {
+	thresholdTime := time.Now().Add(-18 * time.Hour) // consider a transaction timed out after 18 hours
+	return ClaimTreasureForWebnode(thresholdTime, PrometheusWrapper)
+}
 
-	oysterWorkerPerformIn(removeUnpaidUploadSessionHandler, args)
-	return nil
+func claimUnusedPRLsJob() (int, error) {
+	thresholdTime := time.Now().Add(-18 * time.Hour) // consider a transaction timed out after 18 hours
+	return ClaimUnusedPRLs(thresholdTime, PrometheusWrapper)
 }
 
-func checkAllDataIsReadyHandler(args worker.Args) error {
-	CheckAllDataIsReady(PrometheusWrapper)
+func removeUnpaidUploadSessionJob() (int, error) {
+	return RemoveUnpaidUploadSession(PrometheusWrapper)
+}
 
-	oysterWorkerPerformIn(checkAllDataIsReadyHandler, args)
-	return nil
+func checkAllDataIsReadyJob() (int, error) {
+	return CheckAllDataIsReady(PrometheusWrapper)
 }
 
-func checkAlphaPaymentsHandler(args worker.Args) error {
-	CheckAlphaPayments(PrometheusWrapper)
+func ingestUploadBatchesJob() (int, error) {
+	return IngestUploadBatches(PrometheusWrapper)
+}
 
-	oysterWorkerPerformIn(checkAlphaPaymentsHandler, args)
-	return nil
+func checkAlphaPaymentsJob() (int, error) {
+	return CheckAlphaPayments(PrometheusWrapper)
 }
 
-func checkBetaPaymentsHandler(args worker.Args) error {
+func checkBetaPaymentsJob() (int, error) {
 	durationToWaitBeforeTimingOut := time.Duration(-6 * time.Hour)
 	// consider a beta transaction timed out after 6 hours if on alpha
 	// consider a beta transaction timed out after 18 hours if on beta
-	CheckBetaPayments(durationToWaitBeforeTimingOut, PrometheusWrapper)
-
-	oysterWorkerPerformIn(checkBetaPaymentsHandler, args)
-	return nil
+	return CheckBetaPayments(durationToWaitBeforeTimingOut, PrometheusWrapper)
 }
 
-func storeCompletedGenesisHashesHandler(args worker.Args) error {
-	StoreCompletedGenesisHashes(PrometheusWrapper)
-
-	oysterWorkerPerformIn(storeCompletedGenesisHashesHandler, args)
-	return nil
+func storeCompletedGenesisHashesJob() (int, error) {
+	return StoreCompletedGenesisHashes(PrometheusWrapper)
 }
 
-func badgerDbGcHandler(args worker.Args) error {
-	BadgerDbGc()
+func badgerDbGcJob() (int, error) {
+	return BadgerDbGc()
+}
 
-	oysterWorkerPerformIn(badgerDbGcHandler, args)
-	return nil
+/*runJobSteps runs each step of a job, even after one of them failed, and returns the number of items processed by
+all of them and the first error.*/
+func runJobSteps(steps ...func() (int, error)) (int, error) {
+	numProcessed := 0
+	var firstErr error
+	for _, step := range steps {
+		n, err := step()
+		numProcessed += n
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return numProcessed, firstErr
 }
 
-func oysterWorkerPerformIn(handler worker.Handler, args worker.Args) {
+func oysterWorkerPerformIn(jobName string, args worker.Args) {
 	job := worker.Job{
 		Queue:   "default",
-		Handler: getHandlerName(handler),
+		Handler: jobName,
 		Args:    args,
 	}
-	oyster_utils.LogIfError(OysterWorker.PerformIn(job, args[Duration].(time.Duration)), nil)
+	delay := GetBackoffDuration(getDurationWithJitter(args), history.getConsecutiveFailures(jobName))
+	oyster_utils.LogIfError(OysterWorker.PerformIn(job, delay), nil)
 }
 
-// Return the name of the handler in full path.
-// ex: github.com/oysterprotocol/brokernode/jobs.flushOldWebnodesHandler
-func getHandlerName(i worker.Handler) string {
-	return runtime.FuncForPC(reflect.ValueOf(i).Pointer()).Name()
+func getDurationWithJitter(args worker.Args) time.Duration {
+	duration := args[Duration].(time.Duration)
+	if jitter, ok := args[Jitter].(time.Duration); ok && jitter > 0 {
+		duration += time.Duration(rand.Int63n(int64(jitter)))
+	}
+	return duration
+}
+
+/*GetBackoffDuration doubles the duration for each consecutive failure of a job, up to MaxJobBackoff.  Durations
+longer than MaxJobBackoff are not backed off.*/
+func GetBackoffDuration(duration time.Duration, consecutiveFailures int) time.Duration {
+	if duration >= MaxJobBackoff {
+		return duration
+	}
+
+	backoff := duration
+	for i := 0; i < consecutiveFailures && backoff < MaxJobBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > MaxJobBackoff {
+		backoff = MaxJobBackoff
+	}
+	return backoff
 }
@@ -4,6 +4,7 @@ import (
 	"github.com/oysterprotocol/brokernode/utils/eth_gateway"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/gobuffalo/suite"
 	"github.com/iotaledger/iota.go/transaction"
@@ -129,3 +130,13 @@ func SessionSetUpForTest(session *models.UploadSession, mergedIndexes []int,
 
 	return bulkChunkData
 }
+
+func (suite *JobsSuite) Test_GetBackoffDuration() {
+	suite.Equal(10*time.Second, jobs.GetBackoffDuration(10*time.Second, 0))
+	suite.Equal(20*time.Second, jobs.GetBackoffDuration(10*time.Second, 1))
+	suite.Equal(80*time.Second, jobs.GetBackoffDuration(10*time.Second, 3))
+	suite.Equal(jobs.MaxJobBackoff, jobs.GetBackoffDuration(10*time.Second, 20))
+
+	// Jobs which run less often than MaxJobBackoff keep their interval.
+	suite.Equal(24*time.Hour, jobs.GetBackoffDuration(24*time.Hour, 5))
+}
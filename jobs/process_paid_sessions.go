@@ -8,34 +8,40 @@ import (
 	"gopkg.in/segmentio/analytics-go.v3"
 )
 
-func ProcessPaidSessions(PrometheusWrapper services.PrometheusService) {
+/*ProcessPaidSessions buries the treasures of the paid sessions in their data maps.  Returns the number of sessions
+whose treasures were buried.*/
+func ProcessPaidSessions(PrometheusWrapper services.PrometheusService) (int, error) {
 
 	start := PrometheusWrapper.TimeNow()
 	defer PrometheusWrapper.HistogramSeconds(PrometheusWrapper.HistogramProcessPaidSessions, start)
 
-	BuryTreasureInDataMaps()
+	return BuryTreasureInDataMaps()
 }
 
-func BuryTreasureInDataMaps() error {
+func BuryTreasureInDataMaps() (int, error) {
 
 	unburiedSessions, err := models.GetSessionsThatNeedTreasure()
 
 	if err != nil {
 		oyster_utils.LogIfError(err, nil)
+		return 0, err
 	}
 
+	numBuried := 0
 	for _, unburiedSession := range unburiedSessions {
 
 		treasureIndex, err := unburiedSession.GetTreasureMap()
 
 		if err != nil {
 			oyster_utils.LogIfError(err, nil)
-			return err
+			return numBuried, err
 		}
 
-		BuryTreasure(treasureIndex, &unburiedSession)
+		if BuryTreasure(treasureIndex, &unburiedSession) == nil {
+			numBuried++
+		}
 	}
-	return nil
+	return numBuried, nil
 }
 
 func BuryTreasure(treasureIndexMap []models.TreasureMap, unburiedSession *models.UploadSession) error {
@@ -16,16 +16,23 @@ import (
 
 const PercentOfChunksToSkipVerification = 45
 
-func ProcessUnassignedChunks(iotaWrapper services.IotaService, PrometheusWrapper services.PrometheusService) {
+/*ProcessUnassignedChunks assigns the chunks of the ready sessions to the ready channels.  Returns the number of
+ready sessions.*/
+func ProcessUnassignedChunks(iotaWrapper services.IotaService,
+	PrometheusWrapper services.PrometheusService) (int, error) {
 
 	start := PrometheusWrapper.TimeNow()
 	defer PrometheusWrapper.HistogramSeconds(PrometheusWrapper.HistogramProcessUnassignedChunks, start)
 
-	sessions, _ := models.GetReadySessions()
+	sessions, err := models.GetReadySessions()
+	if err != nil {
+		return 0, err
+	}
 
 	if len(sessions) > 0 {
 		GetSessionUnassignedChunks(sessions, iotaWrapper)
 	}
+	return len(sessions), nil
 }
 
 func GetSessionUnassignedChunks(sessions []models.UploadSession, iotaWrapper services.IotaService) {
@@ -129,17 +136,15 @@ func FilterAndAssignChunksToChannels(chunksIn []oyster_utils.ChunkData, channels
 
 		if oyster_utils.PoWMode == oyster_utils.PoWEnabled && len(chunksIncludingTreasureChunks) > 0 {
 			session.UpdateIndexWithAttachedChunks(chunksIncludingTreasureChunks)
-			if os.Getenv("ENABLE_LAMBDA") == "true" {
-				iotaWrapper.SendChunksToLambda(&chunksIncludingTreasureChunks)
-			} else {
-				SendChunks(chunksIncludingTreasureChunks, channels, iotaWrapper, *session)
-			}
+			SendChunks(chunksIncludingTreasureChunks, channels, iotaWrapper, *session)
 		}
 	}
 }
 
 /*SkipVerificationOfFirstChunks will skip verifying for the first PercentOfChunksToSkipVerification% of chunks of
-the alpha session and the last PercentOfChunksToSkipVerification% of the beta session*/
+the alpha session and the last PercentOfChunksToSkipVerification% of the beta session.  In N-broker mode it skips
+verifying the range of chunks of this broker instead.  If this broker took over from the other broker of the
+session, it also skips verifying the chunks the other broker had not attached.*/
 func SkipVerificationOfFirstChunks(chunks []oyster_utils.ChunkData, session models.UploadSession) ([]oyster_utils.ChunkData,
 	[]oyster_utils.ChunkData) {
 
@@ -173,6 +178,32 @@ func SkipVerificationOfFirstChunks(chunks []oyster_utils.ChunkData, session mode
 		verifyMaxIdx = lenOfChunksToVerify - 1
 	}
 
+	if session.RangeStartIdx.Valid && session.RangeEndIdx.Valid {
+		// in N-broker mode each broker attaches its own range, and the alpha broker checks the tangle for the ranges
+		// of the others
+		skipVerifyMinIdx = int(session.RangeStartIdx.Int64)
+		skipVerifyMaxIdx = int(session.RangeEndIdx.Int64)
+		if session.Type == models.SessionTypeAlpha {
+			verifyMinIdx = skipVerifyMaxIdx + 1
+			verifyMaxIdx = numChunks - 1
+		} else {
+			verifyMinIdx = 0
+			verifyMaxIdx = skipVerifyMinIdx - 1
+		}
+	}
+
+	if session.PeerStatus == models.PeerTakenOver && session.PeerNextIdxToAttach.Valid {
+		// the other broker stalled, so nobody else attaches the chunks it had not attached yet
+		peerNextIdxToAttach := int(session.PeerNextIdxToAttach.Int64)
+		if session.Type == models.SessionTypeAlpha && peerNextIdxToAttach > skipVerifyMaxIdx {
+			skipVerifyMaxIdx = peerNextIdxToAttach
+			verifyMinIdx = skipVerifyMaxIdx + 1
+		} else if session.Type == models.SessionTypeBeta && peerNextIdxToAttach < skipVerifyMinIdx {
+			skipVerifyMinIdx = peerNextIdxToAttach
+			verifyMaxIdx = skipVerifyMinIdx - 1
+		}
+	}
+
 	if skipVerifyMinIdx == skipVerifyMaxIdx {
 		// very small file, don't bother with filtering
 		return []oyster_utils.ChunkData{}, chunks
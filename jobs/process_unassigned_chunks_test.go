@@ -3,6 +3,7 @@ package jobs_test
 import (
 	"time"
 
+	"github.com/gobuffalo/pop/nulls"
 	"github.com/iotaledger/iota.go/transaction"
 	"github.com/iotaledger/iota.go/trinary"
 	"github.com/oysterprotocol/brokernode/jobs"
@@ -15,7 +16,6 @@ var (
 	sendChunksToChannelMockCalled_process_unassigned_chunks              = false
 	verifyChunkMessagesMatchesRecordMockCalled_process_unassigned_chunks = false
 	findTransactionsMockCalled_process_unassigned_chunks                 = false
-	sendChunksToLambdaMockCalled_process_unassigned_chunks               = false
 	AllChunksCalled                                                      []oyster_utils.ChunkData
 	fakeFindTransactionsAddress                                          = "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
 )
@@ -104,7 +104,7 @@ func (suite *JobsSuite) Test_ProcessUnassignedChunks() {
 	// call method under test
 	jobs.ProcessUnassignedChunks(IotaMock, jobs.PrometheusWrapper)
 
-	suite.True(sendChunksToChannelMockCalled_process_unassigned_chunks || sendChunksToLambdaMockCalled_process_unassigned_chunks)
+	suite.True(sendChunksToChannelMockCalled_process_unassigned_chunks)
 	suite.True(verifyChunkMessagesMatchesRecordMockCalled_process_unassigned_chunks)
 	suite.Equal(4*(uploadSession1.NumChunks), len(AllChunksCalled))
 
@@ -454,7 +454,6 @@ func makeMocks_process_unassigned_chunks(iotaMock *services.IotaService) {
 	iotaMock.VerifyChunkMessagesMatchRecord = verifyChunkMessagesMatchesRecordMock_process_unassigned_chunks
 	iotaMock.SendChunksToChannel = sendChunksToChannelMock_process_unassigned_chunks
 	iotaMock.FindTransactions = findTransactions_process_unassigned_chunks
-	iotaMock.SendChunksToLambda = sendChunksToLambda_process_unassigned_chunks
 }
 
 func sendChunksToChannelMock_process_unassigned_chunks(chunks []oyster_utils.ChunkData, channel *models.ChunkChannel) {
@@ -499,9 +498,59 @@ func findTransactions_process_unassigned_chunks(addresses []trinary.Hash) (map[t
 	return addrToTransactionMap, nil
 }
 
-func sendChunksToLambda_process_unassigned_chunks(chunks *[]oyster_utils.ChunkData) {
-	sendChunksToLambdaMockCalled_process_unassigned_chunks = true
+func (suite *JobsSuite) Test_SkipVerificationOfFirstChunks_AlphaTakenOver() {
+	oyster_utils.SetBrokerMode(oyster_utils.TestModeNoTreasure)
+	defer oyster_utils.ResetBrokerMode()
 
-	// stored all the chunks that get sent to the mock so we can run tests on them.
-	AllChunksCalled = append(AllChunksCalled, *chunks...)
+	uploadSession := models.UploadSession{
+		GenesisHash:   oyster_utils.RandSeq(6, []rune("abcdef0123456789")),
+		NumChunks:     29,
+		FileSizeBytes: 3000,
+		Type:          models.SessionTypeAlpha,
+	}
+
+	bulkChunkData := SessionSetUpForTest(&uploadSession, []int{}, uploadSession.NumChunks)
+
+	// the beta broker stalled before it attached chunk 20
+	uploadSession.PeerStatus = models.PeerTakenOver
+	uploadSession.PeerNextIdxToAttach = nulls.NewInt64(20)
+
+	skipVerifyChunks, restOfChunks := jobs.SkipVerificationOfFirstChunks(bulkChunkData, uploadSession)
+
+	suite.Equal(len(bulkChunkData), len(skipVerifyChunks)+len(restOfChunks))
+	suite.True(len(skipVerifyChunks) > 0)
+	suite.True(len(restOfChunks) > 0)
+	for _, chunk := range skipVerifyChunks {
+		suite.True(chunk.Idx <= 20)
+	}
+	for _, chunk := range restOfChunks {
+		suite.True(chunk.Idx > 20)
+	}
+}
+
+func (suite *JobsSuite) Test_SkipVerificationOfFirstChunks_BetaRange() {
+	oyster_utils.SetBrokerMode(oyster_utils.TestModeNoTreasure)
+	defer oyster_utils.ResetBrokerMode()
+
+	uploadSession := models.UploadSession{
+		GenesisHash:   oyster_utils.RandSeq(6, []rune("abcdef0123456789")),
+		NumChunks:     29,
+		FileSizeBytes: 3000,
+		Type:          models.SessionTypeBeta,
+		RangeStartIdx: nulls.NewInt64(10),
+		RangeEndIdx:   nulls.NewInt64(19),
+	}
+
+	bulkChunkData := SessionSetUpForTest(&uploadSession, []int{}, uploadSession.NumChunks)
+
+	skipVerifyChunks, restOfChunks := jobs.SkipVerificationOfFirstChunks(bulkChunkData, uploadSession)
+
+	suite.Equal(len(bulkChunkData), len(skipVerifyChunks)+len(restOfChunks))
+	suite.Equal(10, len(skipVerifyChunks))
+	for _, chunk := range skipVerifyChunks {
+		suite.True(chunk.Idx >= 10 && chunk.Idx <= 19)
+	}
+	for _, chunk := range restOfChunks {
+		suite.True(chunk.Idx < 10 || chunk.Idx > 19)
+	}
 }
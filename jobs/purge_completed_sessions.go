@@ -14,7 +14,9 @@ import (
 
 var purgeMutex = &sync.Mutex{}
 
-func PurgeCompletedSessions(PrometheusWrapper services.PrometheusService) {
+/*PurgeCompletedSessions moves the completed sessions to completed_uploads.  Returns the number of genesis hashes
+purged.*/
+func PurgeCompletedSessions(PrometheusWrapper services.PrometheusService) (int, error) {
 
 	start := PrometheusWrapper.TimeNow()
 	defer PrometheusWrapper.HistogramSeconds(PrometheusWrapper.HistogramPurgeCompletedSessions, start)
@@ -26,11 +28,13 @@ func PurgeCompletedSessions(PrometheusWrapper services.PrometheusService) {
 	if err != nil {
 		oyster_utils.LogIfError(errors.New(err.Error()+" getting the completeGenesisHashes in "+
 			"purge_completed_sessions"), nil)
+		return 0, err
 	}
 
 	for _, genesisHash := range completeGenesisHashes {
 		purgeSessions(genesisHash)
 	}
+	return len(completeGenesisHashes), nil
 }
 
 func getAllCompletedGenesisHashes() ([]string, error) {
@@ -101,6 +105,10 @@ func purgeSessions(genesisHash string) {
 						"purge_completed_sessions"), nil)
 					return err
 				}
+				if err := models.CompleteVerificationReport(tx, genesisHash,
+					sessions[0].CreatedAt.AddDate(sessions[0].StorageLengthInYears, 0, 0)); err != nil {
+					return err
+				}
 			}
 		}
 		return nil
@@ -0,0 +1,76 @@
+package jobs
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/utils"
+	"gopkg.in/segmentio/analytics-go.v3"
+)
+
+/*ReconcilePeerSessions asks the other broker of each session which is still being attached how far it got.  If the
+other broker makes no progress for stallThreshold, this broker takes over the chunks it had not attached.  Returns
+the number of sessions checked.*/
+func ReconcilePeerSessions(PrometheusWrapper services.PrometheusService, stallThreshold time.Duration) (int, error) {
+	start := PrometheusWrapper.TimeNow()
+	defer PrometheusWrapper.HistogramSeconds(PrometheusWrapper.HistogramReconcilePeerSessions, start)
+
+	sessions, err := models.GetSessionsToReconcile()
+	if err != nil {
+		oyster_utils.LogIfError(errors.New(err.Error()+" while getting the sessions to reconcile in "+
+			"ReconcilePeerSessions"), nil)
+		return 0, err
+	}
+
+	for _, session := range sessions {
+		reconcilePeerSession(session, stallThreshold, time.Now())
+	}
+	return len(sessions), nil
+}
+
+func reconcilePeerSession(session models.UploadSession, stallThreshold time.Duration, now time.Time) {
+	progress := models.SessionProgress{}
+	err := services.SendSignedBrokerRequest(http.MethodGet,
+		session.PeerAddress.String+"/api/v2/session-progress/"+session.GenesisHash, nil, &progress)
+
+	switch {
+	case err == nil && progress.Finished:
+		session.PeerStatus = models.PeerFinished
+	case err == nil && (!session.PeerNextIdxToAttach.Valid ||
+		session.PeerNextIdxToAttach.Int64 != progress.NextIdxToAttach):
+		session.PeerNextIdxToAttach = nulls.NewInt64(progress.NextIdxToAttach)
+		session.PeerProgressAt = nulls.NewTime(now)
+	case !session.PeerProgressAt.Valid:
+		// the other broker could not be reached yet, so it has stalled since the first time we asked
+		session.PeerProgressAt = nulls.NewTime(now)
+	case now.Sub(session.PeerProgressAt.Time) >= stallThreshold:
+		takeOverPeerSession(&session)
+	default:
+		return
+	}
+
+	session.UpdatePeerProgress()
+}
+
+/*takeOverPeerSession marks the other broker of the session as stalled.  If it never reported any progress, none of
+its side of the file is assumed to be attached.*/
+func takeOverPeerSession(session *models.UploadSession) {
+	if !session.PeerNextIdxToAttach.Valid {
+		if session.Type == models.SessionTypeAlpha {
+			session.PeerNextIdxToAttach = nulls.NewInt64(int64(session.NumChunks - 1))
+		} else {
+			session.PeerNextIdxToAttach = nulls.NewInt64(0)
+		}
+	}
+	session.PeerStatus = models.PeerTakenOver
+
+	oyster_utils.LogToSegment("reconcile_peer_sessions: take_over_peer_session", analytics.NewProperties().
+		Set("genesis_hash", session.GenesisHash).
+		Set("peer_address", session.PeerAddress.String).
+		Set("peer_next_idx_to_attach", session.PeerNextIdxToAttach.Int64).
+		Set("next_idx_to_attach", session.NextIdxToAttach))
+}
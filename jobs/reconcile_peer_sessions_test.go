@@ -0,0 +1,101 @@
+package jobs_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/oysterprotocol/brokernode/jobs"
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+func (suite *JobsSuite) Test_ReconcilePeerSessions() {
+	peerRequests := 0
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peerRequests++
+		suite.NotEqual("", r.Header.Get(services.BrokerSignatureHeader))
+		json.NewEncoder(w).Encode(models.SessionProgress{NextIdxToAttach: 20})
+	}))
+	defer peer.Close()
+
+	session := createPeerSessionForTest(suite, peer.URL)
+
+	// the first answer of the peer starts the clock
+	numReconciled, err := jobs.ReconcilePeerSessions(jobs.PrometheusWrapper, time.Hour)
+	suite.Nil(err)
+	suite.Equal(1, numReconciled)
+	suite.Nil(suite.DB.Find(&session, session.ID))
+	suite.Equal(models.PeerActive, session.PeerStatus)
+	suite.Equal(int64(20), session.PeerNextIdxToAttach.Int64)
+	suite.True(session.PeerProgressAt.Valid)
+
+	// the peer made no progress for longer than the threshold
+	session.PeerProgressAt = nulls.NewTime(time.Now().Add(-2 * time.Hour))
+	suite.Nil(session.UpdatePeerProgress())
+
+	jobs.ReconcilePeerSessions(jobs.PrometheusWrapper, time.Hour)
+	suite.Nil(suite.DB.Find(&session, session.ID))
+	suite.Equal(models.PeerTakenOver, session.PeerStatus)
+	suite.Equal(int64(20), session.PeerNextIdxToAttach.Int64)
+
+	// the peer is not asked again once its chunks are taken over
+	numReconciled, err = jobs.ReconcilePeerSessions(jobs.PrometheusWrapper, time.Hour)
+	suite.Nil(err)
+	suite.Equal(0, numReconciled)
+	suite.Equal(2, peerRequests)
+}
+
+func (suite *JobsSuite) Test_ReconcilePeerSessions_PeerFinished() {
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(models.SessionProgress{NextIdxToAttach: -1, Finished: true})
+	}))
+	defer peer.Close()
+
+	session := createPeerSessionForTest(suite, peer.URL)
+
+	jobs.ReconcilePeerSessions(jobs.PrometheusWrapper, time.Hour)
+	suite.Nil(suite.DB.Find(&session, session.ID))
+	suite.Equal(models.PeerFinished, session.PeerStatus)
+}
+
+func (suite *JobsSuite) Test_ReconcilePeerSessions_PeerUnreachable() {
+	peer := httptest.NewServer(http.NotFoundHandler())
+	session := createPeerSessionForTest(suite, peer.URL)
+	peer.Close()
+
+	jobs.ReconcilePeerSessions(jobs.PrometheusWrapper, time.Hour)
+	suite.Nil(suite.DB.Find(&session, session.ID))
+	suite.Equal(models.PeerActive, session.PeerStatus)
+	suite.True(session.PeerProgressAt.Valid)
+	suite.False(session.PeerNextIdxToAttach.Valid)
+
+	// a peer which was never reached is assumed to have attached none of its chunks
+	session.PeerProgressAt = nulls.NewTime(time.Now().Add(-2 * time.Hour))
+	suite.Nil(session.UpdatePeerProgress())
+
+	jobs.ReconcilePeerSessions(jobs.PrometheusWrapper, time.Hour)
+	suite.Nil(suite.DB.Find(&session, session.ID))
+	suite.Equal(models.PeerTakenOver, session.PeerStatus)
+	suite.Equal(int64(session.NumChunks-1), session.PeerNextIdxToAttach.Int64)
+}
+
+func createPeerSessionForTest(suite *JobsSuite, peerAddress string) models.UploadSession {
+	session := models.UploadSession{
+		GenesisHash:    oyster_utils.RandSeq(6, []rune("abcdef0123456789")),
+		NumChunks:      30,
+		FileSizeBytes:  30000,
+		Type:           models.SessionTypeAlpha,
+		PaymentStatus:  models.PaymentStatusConfirmed,
+		TreasureStatus: models.TreasureInDataMapComplete,
+		AllDataReady:   models.AllDataReady,
+		PeerAddress:    nulls.NewString(peerAddress),
+	}
+	vErr, err := suite.DB.ValidateAndCreate(&session)
+	suite.Nil(err)
+	suite.False(vErr.HasAny())
+	return session
+}
@@ -2,9 +2,9 @@ package jobs
 
 import (
 	"errors"
-	"github.com/gobuffalo/pop"
 	"github.com/oysterprotocol/brokernode/models"
 	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/services/blobstore"
 	"github.com/oysterprotocol/brokernode/utils"
 	"github.com/oysterprotocol/brokernode/utils/eth_gateway"
 )
@@ -12,8 +12,9 @@ import (
 /*UnpaidExpirationInHour means number of hours before it should remove unpaid upload session. */
 const UnpaidExpirationInHour = 24
 
-/*RemoveUnpaidUploadSession cleans up upload_sessions and data_maps table for expired/unpaid session. */
-func RemoveUnpaidUploadSession(PrometheusWrapper services.PrometheusService) {
+/*RemoveUnpaidUploadSession cleans up the expired unpaid sessions, along with their data maps, batches in S3,
+treasures and pending broker_broker_transactions. */
+func RemoveUnpaidUploadSession(PrometheusWrapper services.PrometheusService) (int, error) {
 
 	start := PrometheusWrapper.TimeNow()
 	defer PrometheusWrapper.HistogramSeconds(PrometheusWrapper.HistogramRemoveUnpaidUploadSession, start)
@@ -25,77 +26,26 @@ func RemoveUnpaidUploadSession(PrometheusWrapper services.PrometheusService) {
 	if err != nil {
 		oyster_utils.LogIfError(errors.New(err.Error()+" while finding old unpaid sessions in "+
 			"remove_unpaid_upload_session"), nil)
-		return
+		return 0, err
 	}
 
+	numRemoved := 0
 	for _, session := range sessions {
 		balance := EthWrapper.CheckPRLBalance(eth_gateway.StringToAddress(session.ETHAddrAlpha.String))
 		if balance.Int64() > 0 {
 			continue
 		}
 
-		removeSession(session)
-	}
-}
-
-func removeSession(session models.UploadSession) error {
-	var err error
-	if oyster_utils.DataMapStorageMode == oyster_utils.DataMapsInBadger {
-		err = removeDataMapsFromBadger(session)
-	} else {
-		err = removeDataMapsFromSQL(session)
-	}
-	if err != nil {
-		return err
-	}
-
-	err = models.DB.RawQuery("DELETE FROM upload_sessions WHERE id = ?", session.ID).All(&[]models.UploadSession{})
-	if err != nil {
-		oyster_utils.LogIfError(err, nil)
-	}
-	return err
-}
-
-func removeDataMapsFromBadger(session models.UploadSession) error {
-	dbNameMessage := oyster_utils.GetBadgerDBName([]string{oyster_utils.InProgressDir,
-		session.GenesisHash, oyster_utils.MessageDir})
-	dbNameHash := oyster_utils.GetBadgerDBName([]string{oyster_utils.InProgressDir,
-		session.GenesisHash, oyster_utils.HashDir})
-
-	errMessage := oyster_utils.CloseUniqueKvStore(dbNameMessage)
-	if errMessage != nil {
-		oyster_utils.LogIfError(errors.New(errMessage.Error()+" deleting message data from "+
-			dbNameMessage+" in RemoveUnpaidUploadSession"), nil)
-		return errMessage
-	}
-	errHash := oyster_utils.CloseUniqueKvStore(dbNameHash)
-	if errHash != nil {
-		oyster_utils.LogIfError(errors.New(errHash.Error()+" deleting hash data from "+
-			dbNameHash+" in RemoveUnpaidUploadSession"), nil)
-		return errHash
-	}
-	return nil
-}
-
-func removeDataMapsFromSQL(session models.UploadSession) error {
-	dataMaps := []models.DataMap{}
-	err := models.DB.Transaction(func(tx *pop.Connection) error {
-		err := tx.RawQuery("DELETE FROM data_maps WHERE genesis_hash = ?", session.GenesisHash).All(&dataMaps)
-		return err
-	})
-	if err == nil {
-		var keys oyster_utils.KVKeys
-		for _, dm := range dataMaps {
-			keys = append(keys, dm.MsgID)
+		if session.StorageMethod == models.StorageMethodS3 {
+			if err := BlobStore.DeleteObjectKeys(blobstore.DefaultBucketName, session.GenesisHash+"/"); err != nil {
+				oyster_utils.LogIfError(errors.New(err.Error()+" while deleting the batches of an unpaid session in "+
+					"remove_unpaid_upload_session"), nil)
+				continue
+			}
 		}
-		err := oyster_utils.BatchDelete(&keys)
-		if err != nil {
-			oyster_utils.LogIfError(err, nil)
-			return err
+		if models.DeleteUploadSession(session) == nil {
+			numRemoved++
 		}
-	} else {
-		oyster_utils.LogIfError(errors.New(err.Error()+" in transaction in "+
-			"remove_unpaid_upload_session"), nil)
 	}
-	return err
+	return numRemoved, nil
 }
@@ -0,0 +1,135 @@
+package jobs
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/utils"
+	"gopkg.in/segmentio/analytics-go.v3"
+)
+
+/*ReverifyCompletedUploads checks a sample of the completed uploads against the tangle again, since snapshots of
+the tangle can prune their chunks, and attaches the missing chunks again for as long as their storage is paid for.
+Up to chunksPerUpload chunks of each upload are sampled.  It leaves the PoW to new uploads while there are any.
+Returns the number of chunks attached again.*/
+func ReverifyCompletedUploads(IotaWrapper services.IotaService, PrometheusWrapper services.PrometheusService,
+	reverifiedBefore time.Time, sampleSize int, chunksPerUpload int) (int, error) {
+
+	start := PrometheusWrapper.TimeNow()
+	defer PrometheusWrapper.HistogramSeconds(PrometheusWrapper.HistogramReverifyCompletedUploads, start)
+
+	readySessions, err := models.GetReadySessions()
+	if err != nil || len(readySessions) > 0 {
+		return 0, err
+	}
+
+	reports, err := models.GetReportsToReverify(reverifiedBefore, sampleSize)
+	if err != nil {
+		oyster_utils.LogIfError(errors.New(err.Error()+" while getting the uploads to verify again in "+
+			"ReverifyCompletedUploads"), nil)
+		return 0, err
+	}
+
+	reattached := 0
+	for _, report := range reports {
+		reattached += reverifyUpload(IotaWrapper, report, chunksPerUpload)
+	}
+	return reattached, nil
+}
+
+func reverifyUpload(IotaWrapper services.IotaService, report models.VerificationReport, chunksPerUpload int) int {
+	result := models.VerificationResult{}
+	chunksUnrecoverable := 0
+
+	// only the chunks this broker verified while the upload was in progress are verified again
+	sampledKeys := sampleChunkKeys(report.GenesisHash, report.FirstChunkIdx, report.LastChunkIdx, chunksPerUpload)
+
+	for i := 0; i < len(sampledKeys); i += services.MaxNumberOfAddressPerFindTransactionRequest {
+		stop := i + services.MaxNumberOfAddressPerFindTransactionRequest
+		if stop > len(sampledKeys) {
+			stop = len(sampledKeys)
+		}
+
+		keys := sampledKeys[i:stop]
+		chunks, err := models.GetMultiChunkData(oyster_utils.CompletedDir, report.GenesisHash, &keys)
+		if err != nil {
+			oyster_utils.LogIfError(errors.New(err.Error()+" getting chunk data in ReverifyCompletedUploads"), nil)
+			return result.ReattachCount
+		}
+
+		filteredChunks, err := IotaWrapper.VerifyChunksMatchRecord(chunks, false)
+		if err != nil {
+			oyster_utils.LogIfError(errors.New(err.Error()+" verifying chunks match record in "+
+				"ReverifyCompletedUploads"), nil)
+			return result.ReattachCount
+		}
+
+		// Chunks whose data has expired from the completed data maps cannot be attached again.
+		chunksUnrecoverable += len(keys) - len(chunks)
+		result.ChunksNotAttached += len(filteredChunks.NotAttached)
+		// A mismatched chunk is on the tangle with other data, attaching ours again would not replace it.
+		result.ChunksMismatched += len(filteredChunks.DoesNotMatchTangle)
+
+		for j := 0; j < len(filteredChunks.NotAttached); j += BundleSize {
+			end := j + BundleSize
+			if end > len(filteredChunks.NotAttached) {
+				end = len(filteredChunks.NotAttached)
+			}
+			err := IotaWrapper.DoPoW(filteredChunks.NotAttached[j:end])
+			if err == services.ErrAttachPending {
+				// the chunks were only queued, they are verified again with the next sample of the upload
+				continue
+			}
+			if err != nil {
+				oyster_utils.LogIfError(errors.New(err.Error()+" attaching chunks again in "+
+					"ReverifyCompletedUploads"), nil)
+				continue
+			}
+			result.ReattachCount += end - j
+		}
+	}
+
+	models.RecordReverificationResult(report.GenesisHash, result, chunksUnrecoverable)
+
+	if result.ChunksNotAttached > 0 || chunksUnrecoverable > 0 {
+		oyster_utils.LogToSegment("reverify_completed_uploads: chunks_missing", analytics.NewProperties().
+			Set("genesis_hash", report.GenesisHash).
+			Set("num_chunks_not_attached", result.ChunksNotAttached).
+			Set("num_chunks_reattached", result.ReattachCount).
+			Set("num_chunks_unrecoverable", chunksUnrecoverable))
+	}
+	return result.ReattachCount
+}
+
+/*sampleChunkKeys returns the keys of up to sampleSize random chunks from firstChunkIdx to lastChunkIdx, in the
+order of their indexes.*/
+func sampleChunkKeys(genesisHash string, firstChunkIdx int64, lastChunkIdx int64, sampleSize int) oyster_utils.KVKeys {
+	numChunks := lastChunkIdx - firstChunkIdx + 1
+	if numChunks <= 0 {
+		return oyster_utils.KVKeys{}
+	}
+	if numChunks <= int64(sampleSize) {
+		return *oyster_utils.GenerateBulkKeys(genesisHash, firstChunkIdx, lastChunkIdx)
+	}
+
+	sampled := make(map[int64]bool, sampleSize)
+	for len(sampled) < sampleSize {
+		sampled[firstChunkIdx+rand.Int63n(numChunks)] = true
+	}
+	indexes := make([]int64, 0, sampleSize)
+	for idx := range sampled {
+		indexes = append(indexes, idx)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+
+	keys := oyster_utils.KVKeys{}
+	for _, idx := range indexes {
+		keys = append(keys, oyster_utils.GetBadgerKey([]string{genesisHash, strconv.FormatInt(idx, 10)}))
+	}
+	return keys
+}
@@ -0,0 +1,118 @@
+package jobs_test
+
+import (
+	"time"
+
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/oysterprotocol/brokernode/jobs"
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+func (suite *JobsSuite) Test_ReverifyCompletedUploads() {
+	oyster_utils.SetStorageMode(oyster_utils.DataMapsInSQL)
+	defer oyster_utils.ResetDataMapStorageMode()
+
+	oyster_utils.SetBrokerMode(oyster_utils.TestModeNoTreasure)
+	defer oyster_utils.ResetBrokerMode()
+
+	genesisHash := suite.completeSessionForReverifyTest(30)
+
+	// the first 3 chunks were pruned by a snapshot
+	chunksVerified := 0
+	IotaMock.VerifyChunksMatchRecord = func(chunks []oyster_utils.ChunkData, checkChunkAndBranch bool) (filteredChunks services.FilteredChunk, err error) {
+		chunksVerified += len(chunks)
+		return services.FilteredChunk{
+			MatchesTangle:      chunks[3:],
+			NotAttached:        chunks[:3],
+			DoesNotMatchTangle: []oyster_utils.ChunkData{},
+		}, err
+	}
+	chunksAttached := 0
+	IotaMock.DoPoW = func(chunks []oyster_utils.ChunkData) error {
+		chunksAttached += len(chunks)
+		return nil
+	}
+
+	reattached, err := jobs.ReverifyCompletedUploads(IotaMock, jobs.PrometheusWrapper, time.Now(), 10, 12)
+
+	suite.Nil(err)
+	suite.Equal(12, chunksVerified)
+	suite.Equal(3, reattached)
+	suite.Equal(3, chunksAttached)
+
+	report, err := models.GetVerificationReport(genesisHash)
+	suite.Nil(err)
+	suite.Equal(3, report.ChunksNotAttached)
+	suite.Equal(3, report.ReattachCount)
+	suite.Equal(0, report.ChunksUnrecoverable)
+	suite.True(report.LastReverifiedAt.Valid)
+
+	// the upload is not sampled again until it is due
+	reattached, err = jobs.ReverifyCompletedUploads(IotaMock, jobs.PrometheusWrapper, time.Now().Add(-time.Hour), 10, 12)
+	suite.Nil(err)
+	suite.Equal(0, reattached)
+	suite.Equal(3, chunksAttached)
+}
+
+func (suite *JobsSuite) Test_ReverifyCompletedUploads_AttachPending() {
+	oyster_utils.SetStorageMode(oyster_utils.DataMapsInSQL)
+	defer oyster_utils.ResetDataMapStorageMode()
+
+	oyster_utils.SetBrokerMode(oyster_utils.TestModeNoTreasure)
+	defer oyster_utils.ResetBrokerMode()
+
+	genesisHash := suite.completeSessionForReverifyTest(30)
+
+	IotaMock.VerifyChunksMatchRecord = func(chunks []oyster_utils.ChunkData, checkChunkAndBranch bool) (filteredChunks services.FilteredChunk, err error) {
+		return services.FilteredChunk{
+			MatchesTangle:      []oyster_utils.ChunkData{},
+			NotAttached:        chunks,
+			DoesNotMatchTangle: []oyster_utils.ChunkData{},
+		}, err
+	}
+	// the lambdas only queue the chunks
+	IotaMock.DoPoW = func(chunks []oyster_utils.ChunkData) error {
+		return services.ErrAttachPending
+	}
+
+	reattached, err := jobs.ReverifyCompletedUploads(IotaMock, jobs.PrometheusWrapper, time.Now(), 10, 10)
+	suite.Nil(err)
+	suite.Equal(0, reattached)
+
+	report, err := models.GetVerificationReport(genesisHash)
+	suite.Nil(err)
+	suite.Equal(10, report.ChunksNotAttached)
+	suite.Equal(0, report.ReattachCount)
+}
+
+/*completeSessionForReverifyTest purges a verified session of numChunks chunks and returns its genesis hash.*/
+func (suite *JobsSuite) completeSessionForReverifyTest(numChunks int) string {
+	uploadSession := models.UploadSession{
+		GenesisHash:   oyster_utils.RandSeq(6, []rune("abcdef0123456789")),
+		FileSizeBytes: uint64(numChunks * 1000),
+		NumChunks:     numChunks,
+		Type:          models.SessionTypeBeta,
+		ETHAddrAlpha:  nulls.String{string("SOME_ALPHA_ETH_ADDRESS1"), true},
+		ETHAddrBeta:   nulls.String{string("SOME_BETA_ETH_ADDRESS1"), true},
+		ETHPrivateKey: "1111111111111111111111111111111111111111111111111111111111111111",
+	}
+
+	SessionSetUpForTest(&uploadSession, []int{15, 20}, uploadSession.NumChunks)
+
+	// complete the session and move its chunks to the completed data maps
+	session := models.UploadSession{}
+	suite.DB.Where("genesis_hash = ?", uploadSession.GenesisHash).First(&session)
+	session.TreasureStatus = models.TreasureInDataMapComplete
+	session.AllDataReady = models.AllDataReady
+	session.NextIdxToAttach = -1
+	session.NextIdxToVerify = -1
+	suite.DB.ValidateAndUpdate(&session)
+
+	suite.Nil(models.RecordVerificationResult(session.GenesisHash, 0, int64(session.NumChunks-1), models.VerificationResult{
+		ChunksMatching: session.NumChunks,
+	}))
+	jobs.PurgeCompletedSessions(jobs.PrometheusWrapper)
+	return session.GenesisHash
+}
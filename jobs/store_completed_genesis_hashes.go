@@ -10,7 +10,7 @@ import (
 
 /*StoreCompletedGenesisHashes will look for completed sessions and store their
 genesis hashes to sell to webnodes*/
-func StoreCompletedGenesisHashes(PrometheusWrapper services.PrometheusService) {
+func StoreCompletedGenesisHashes(PrometheusWrapper services.PrometheusService) (int, error) {
 
 	start := PrometheusWrapper.TimeNow()
 	defer PrometheusWrapper.HistogramSeconds(PrometheusWrapper.HistogramStoreCompletedGenesisHashes, start)
@@ -19,6 +19,7 @@ func StoreCompletedGenesisHashes(PrometheusWrapper services.PrometheusService) {
 	if err != nil {
 		oyster_utils.LogIfError(errors.New(err.Error()+" getting completeGenesisHashes in "+
 			"store_complete_genesis_hashes"), nil)
+		return 0, err
 	}
 
 	for _, genesisHash := range completeGenesisHashes {
@@ -61,4 +62,5 @@ func StoreCompletedGenesisHashes(PrometheusWrapper services.PrometheusService) {
 			return nil
 		})
 	}
+	return len(completeGenesisHashes), nil
 }
@@ -10,7 +10,8 @@ import (
 
 /*VerifyDataMaps will check sessions for which attachment has been completed, to make sure the chunks
 have been attached to the tangle.*/
-func VerifyDataMaps(IotaWrapper services.IotaService, PrometheusWrapper services.PrometheusService, thresholdTime time.Time) {
+func VerifyDataMaps(IotaWrapper services.IotaService, PrometheusWrapper services.PrometheusService,
+	thresholdTime time.Time) (int, error) {
 
 	start := PrometheusWrapper.TimeNow()
 	defer PrometheusWrapper.HistogramSeconds(PrometheusWrapper.HistogramVerifyDataMaps, start)
@@ -24,6 +25,7 @@ func VerifyDataMaps(IotaWrapper services.IotaService, PrometheusWrapper services
 	if err != nil {
 		oyster_utils.LogIfError(errors.New(err.Error()+" while getting sessions in VerifyDataMaps"), nil)
 	}
+	return len(sessions), err
 }
 
 func checkSessionChunks(IotaWrapper services.IotaService, sessionParam models.UploadSession) {
@@ -99,11 +101,7 @@ func adjustIndexes(session *models.UploadSession) {
 	if session.NextIdxToAttach == session.NextIdxToVerify {
 		chunks, _ := session.GetUnassignedChunksBySession(1)
 		if len(chunks) == 0 {
-			if session.Type == models.SessionTypeAlpha {
-				session.NextIdxToAttach = int64(session.NumChunks)
-			} else {
-				session.NextIdxToAttach = -1
-			}
+			session.NextIdxToAttach = session.GetStopIdx()
 			models.DB.ValidateAndUpdate(session)
 		}
 	}
@@ -154,8 +152,32 @@ func CheckChunks(IotaWrapper services.IotaService, unverifiedChunks []oyster_uti
 	session.DownGradeIndexesOnUnattachedChunks(nonTreasureChunksNoMatch)
 	session.DownGradeIndexesOnUnattachedChunks(filteredChunks.NotAttached)
 
+	if err == nil {
+		firstChunkIdx, lastChunkIdx := getChunkIdxRange(unverifiedChunks)
+		models.RecordVerificationResult(session.GenesisHash, firstChunkIdx, lastChunkIdx, models.VerificationResult{
+			ChunksMatching:    len(filteredChunks.MatchesTangle),
+			ChunksNotAttached: len(filteredChunks.NotAttached),
+			ChunksMismatched:  len(filteredChunks.DoesNotMatchTangle),
+			ReattachCount:     len(nonTreasureChunksNoMatch) + len(filteredChunks.NotAttached),
+		})
+	}
+
 	if len(filteredChunks.MatchesTangle) > 0 {
 		chunks := InsertTreasureChunks(nonTreasureChunksMatching, treasureChunks, *session)
 		session.UpdateIndexWithVerifiedChunks(chunks)
 	}
 }
+
+/*getChunkIdxRange returns the lowest and the highest index of the chunks.*/
+func getChunkIdxRange(chunks []oyster_utils.ChunkData) (int64, int64) {
+	firstChunkIdx, lastChunkIdx := chunks[0].Idx, chunks[0].Idx
+	for _, chunk := range chunks[1:] {
+		if chunk.Idx < firstChunkIdx {
+			firstChunkIdx = chunk.Idx
+		}
+		if chunk.Idx > lastChunkIdx {
+			lastChunkIdx = chunk.Idx
+		}
+	}
+	return firstChunkIdx, lastChunkIdx
+}
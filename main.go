@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/fatih/color"
 	"github.com/oysterprotocol/brokernode/actions"
+	"github.com/oysterprotocol/brokernode/services"
 	"github.com/oysterprotocol/brokernode/utils"
 	"log"
 	"math/rand"
@@ -66,6 +67,8 @@ func main() {
 		}
 	}
 
+	services.StartIriHealthChecks()
+
 	if err := app.Serve(); err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS `job_leases`;
\ No newline at end of file
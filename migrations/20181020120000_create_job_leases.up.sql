@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS `job_leases` (
+  `name`       varchar(255) NOT NULL,
+  `owner`      varchar(255) NOT NULL,
+  `expires_at` datetime     NOT NULL,
+  `created_at` datetime     NOT NULL,
+  `updated_at` datetime     NOT NULL,
+  PRIMARY KEY (`name`)
+)
+  ENGINE = InnoDB
+  DEFAULT CHARSET = latin1;
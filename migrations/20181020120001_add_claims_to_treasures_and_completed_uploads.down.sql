@@ -0,0 +1,4 @@
+call DropColumnIfExists(Database(), 'treasures', 'claimed_by');
+call DropColumnIfExists(Database(), 'treasures', 'claimed_until');
+call DropColumnIfExists(Database(), 'completed_uploads', 'claimed_by');
+call DropColumnIfExists(Database(), 'completed_uploads', 'claimed_until');
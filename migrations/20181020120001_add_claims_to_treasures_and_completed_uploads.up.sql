@@ -0,0 +1,4 @@
+call AddColumnUnlessExists(Database(), 'treasures', 'claimed_by', 'varchar(255) DEFAULT NULL');
+call AddColumnUnlessExists(Database(), 'treasures', 'claimed_until', 'datetime DEFAULT NULL');
+call AddColumnUnlessExists(Database(), 'completed_uploads', 'claimed_by', 'varchar(255) DEFAULT NULL');
+call AddColumnUnlessExists(Database(), 'completed_uploads', 'claimed_until', 'datetime DEFAULT NULL');
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS `lambda_retries`;
\ No newline at end of file
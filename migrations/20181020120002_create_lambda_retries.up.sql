@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS `lambda_retries` (
+  `id`              char(36)     NOT NULL,
+  `payload`         mediumtext   NOT NULL,
+  `num_chunks`      int(11)      NOT NULL,
+  `attempts`        int(11)      NOT NULL,
+  `status`          int(11)      NOT NULL,
+  `last_error`      text         DEFAULT NULL,
+  `next_attempt_at` datetime     NOT NULL,
+  `created_at`      datetime     NOT NULL,
+  `updated_at`      datetime     NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `lambda_retries_status_next_attempt_at_idx` (`status`, `next_attempt_at`)
+)
+  ENGINE = InnoDB
+  DEFAULT CHARSET = latin1;
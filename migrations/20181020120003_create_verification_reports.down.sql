@@ -0,0 +1 @@
+DROP TABLE IF EXISTS `verification_reports`;
\ No newline at end of file
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS `verification_reports` (
+  `id`                  char(36)     NOT NULL,
+  `genesis_hash`        varchar(255) NOT NULL,
+  `num_chunks`          int(11)      NOT NULL,
+  `chunks_matching`     int(11)      NOT NULL,
+  `chunks_not_attached` int(11)      NOT NULL,
+  `chunks_mismatched`   int(11)      NOT NULL,
+  `reattach_count`      int(11)      NOT NULL,
+  `last_verified_at`    datetime     NOT NULL,
+  `completed_at`        datetime     DEFAULT NULL,
+  `created_at`          datetime     NOT NULL,
+  `updated_at`          datetime     NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `verification_reports_genesis_hash_idx` (`genesis_hash`)
+)
+  ENGINE = InnoDB
+  DEFAULT CHARSET = latin1;
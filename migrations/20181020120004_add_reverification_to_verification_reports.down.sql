@@ -0,0 +1,3 @@
+call DropColumnIfExists(Database(), 'verification_reports', 'storage_expires_at');
+call DropColumnIfExists(Database(), 'verification_reports', 'last_reverified_at');
+call DropColumnIfExists(Database(), 'verification_reports', 'chunks_unrecoverable');
@@ -0,0 +1,3 @@
+call AddColumnUnlessExists(Database(), 'verification_reports', 'storage_expires_at', 'datetime DEFAULT NULL');
+call AddColumnUnlessExists(Database(), 'verification_reports', 'last_reverified_at', 'datetime DEFAULT NULL');
+call AddColumnUnlessExists(Database(), 'verification_reports', 'chunks_unrecoverable', 'int(11) NOT NULL DEFAULT 0');
@@ -0,0 +1,2 @@
+call DropColumnIfExists(Database(), 'upload_sessions', 'beta_ip');
+call DropColumnIfExists(Database(), 'upload_sessions', 'beta_session_id');
@@ -0,0 +1,2 @@
+call AddColumnUnlessExists(Database(), 'upload_sessions', 'beta_ip', 'varchar(255) DEFAULT NULL');
+call AddColumnUnlessExists(Database(), 'upload_sessions', 'beta_session_id', 'varchar(36) DEFAULT NULL');
@@ -0,0 +1 @@
+call DropColumnIfExists(Database(), 'brokernodes', 'eth_address');
@@ -0,0 +1 @@
+call AddColumnUnlessExists(Database(), 'brokernodes', 'eth_address', 'varchar(42) DEFAULT NULL');
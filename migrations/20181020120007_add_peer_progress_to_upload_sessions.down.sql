@@ -0,0 +1,4 @@
+call DropColumnIfExists(Database(), 'upload_sessions', 'peer_address');
+call DropColumnIfExists(Database(), 'upload_sessions', 'peer_next_idx_to_attach');
+call DropColumnIfExists(Database(), 'upload_sessions', 'peer_progress_at');
+call DropColumnIfExists(Database(), 'upload_sessions', 'peer_status');
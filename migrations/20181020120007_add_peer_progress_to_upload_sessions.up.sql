@@ -0,0 +1,4 @@
+call AddColumnUnlessExists(Database(), 'upload_sessions', 'peer_address', 'varchar(255) DEFAULT NULL');
+call AddColumnUnlessExists(Database(), 'upload_sessions', 'peer_next_idx_to_attach', 'bigint(20) DEFAULT NULL');
+call AddColumnUnlessExists(Database(), 'upload_sessions', 'peer_progress_at', 'datetime DEFAULT NULL');
+call AddColumnUnlessExists(Database(), 'upload_sessions', 'peer_status', 'int(11) NOT NULL DEFAULT 1');
@@ -0,0 +1,18 @@
+call DropColumnIfExists(Database(), 'upload_sessions', 'range_start_idx');
+call DropColumnIfExists(Database(), 'upload_sessions', 'range_end_idx');
+call DropColumnIfExists(Database(), 'upload_sessions', 'peers');
+call DropColumnIfExists(Database(), 'broker_broker_transactions', 'beta_share_chunks');
+call DropColumnIfExists(Database(), 'broker_broker_transactions', 'num_chunks');
+
+call DropKeyIfExists(
+    Database(),
+    'broker_broker_transactions',
+    'broker_broker_transactions_genesis_hash_idx',
+    1);  # non-unique, 1 for true
+
+call AddConstraintUnlessExists(
+    Database(),
+    'broker_broker_transactions',
+    'broker_broker_transactions_genesis_hash_idx',
+    'UNIQUE',
+    'UNIQUE KEY (`genesis_hash`)');
@@ -0,0 +1,19 @@
+call AddColumnUnlessExists(Database(), 'upload_sessions', 'range_start_idx', 'bigint(20) DEFAULT NULL');
+call AddColumnUnlessExists(Database(), 'upload_sessions', 'range_end_idx', 'bigint(20) DEFAULT NULL');
+call AddColumnUnlessExists(Database(), 'upload_sessions', 'peers', 'longtext DEFAULT NULL');
+call AddColumnUnlessExists(Database(), 'broker_broker_transactions', 'beta_share_chunks', 'int(11) NOT NULL DEFAULT 0');
+call AddColumnUnlessExists(Database(), 'broker_broker_transactions', 'num_chunks', 'int(11) NOT NULL DEFAULT 0');
+
+# an N-broker upload has a transaction for each peer, so the genesis hash is not unique any more
+call DropConstraintIfExists(
+    Database(),
+    'broker_broker_transactions',
+    'broker_broker_transactions_genesis_hash_idx',
+    'UNIQUE');
+
+call AddKeyUnlessExists(
+    Database(),
+    'broker_broker_transactions',
+    'broker_broker_transactions_genesis_hash_idx',
+    1, # non-unique, 1 for true
+    '(`genesis_hash`)');
@@ -0,0 +1,6 @@
+call DropColumnIfExists(Database(), 'brokernodes', 'api_url');
+call DropColumnIfExists(Database(), 'brokernodes', 'capacity');
+call DropColumnIfExists(Database(), 'brokernodes', 'version');
+call DropColumnIfExists(Database(), 'brokernodes', 'status');
+call DropColumnIfExists(Database(), 'brokernodes', 'last_seen_at');
+call DropColumnIfExists(Database(), 'brokernodes', 'failed_health_checks');
@@ -0,0 +1,9 @@
+call AddColumnUnlessExists(Database(), 'brokernodes', 'api_url', 'varchar(255) DEFAULT NULL');
+call AddColumnUnlessExists(Database(), 'brokernodes', 'capacity', 'int(11) NOT NULL DEFAULT 0');
+call AddColumnUnlessExists(Database(), 'brokernodes', 'version', 'varchar(64) DEFAULT NULL');
+call AddColumnUnlessExists(Database(), 'brokernodes', 'status', 'int(11) NOT NULL DEFAULT 1');
+call AddColumnUnlessExists(Database(), 'brokernodes', 'last_seen_at', 'datetime DEFAULT NULL');
+call AddColumnUnlessExists(Database(), 'brokernodes', 'failed_health_checks', 'int(11) NOT NULL DEFAULT 0');
+
+# the brokers added before the registry were added by the operator, so they stay active
+UPDATE brokernodes SET status = 3;
@@ -0,0 +1,2 @@
+call DropColumnIfExists(Database(), 'verification_reports', 'first_chunk_idx');
+call DropColumnIfExists(Database(), 'verification_reports', 'last_chunk_idx');
@@ -0,0 +1,3 @@
+call AddColumnUnlessExists(Database(), 'verification_reports', 'first_chunk_idx', 'bigint(20) NOT NULL DEFAULT 0');
+call AddColumnUnlessExists(Database(), 'verification_reports', 'last_chunk_idx', 'bigint(20) NOT NULL DEFAULT -1');
+UPDATE verification_reports SET last_chunk_idx = num_chunks - 1 WHERE last_chunk_idx = -1;
@@ -0,0 +1 @@
+call DropColumnIfExists(Database(), 'upload_sessions', 'cancel_token_hash');
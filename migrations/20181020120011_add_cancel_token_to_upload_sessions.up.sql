@@ -0,0 +1 @@
+call AddColumnUnlessExists(Database(), 'upload_sessions', 'cancel_token_hash', 'varchar(64) DEFAULT NULL');
@@ -0,0 +1 @@
+call DropColumnIfExists(Database(), 'upload_sessions', 'treasure_cost');
@@ -0,0 +1 @@
+call AddColumnUnlessExists(Database(), 'upload_sessions', 'treasure_cost', 'decimal(28, 18) NOT NULL DEFAULT 0');
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS `upload_batches`;
\ No newline at end of file
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS `upload_batches` (
+  `genesis_hash` varchar(255) NOT NULL,
+  `batch_idx`    int(11)      NOT NULL,
+  `num_received` int(11)      NOT NULL DEFAULT 0,
+  `received`     text         NOT NULL,
+  `created_at`   datetime     NOT NULL,
+  `updated_at`   datetime     NOT NULL,
+  PRIMARY KEY (`genesis_hash`, `batch_idx`)
+)
+  ENGINE = InnoDB
+  DEFAULT CHARSET = latin1;
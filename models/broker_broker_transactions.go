@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
 	"github.com/gobuffalo/uuid"
 	"github.com/gobuffalo/validate"
 	"github.com/oysterprotocol/brokernode/utils"
@@ -25,6 +26,10 @@ type BrokerBrokerTransaction struct {
 	ETHPrivateKey string          `json:"ethPrivateKey" db:"eth_private_key"`
 	TotalCost     decimal.Decimal `json:"totalCost" db:"total_cost"`
 	PaymentStatus PaymentStatus   `json:"paymentStatus" db:"payment_status"`
+
+	// In N-broker mode beta is paid for BetaShareChunks of the NumChunks chunks of the file.  0 means beta is paid half.
+	BetaShareChunks int `json:"betaShareChunks" db:"beta_share_chunks"`
+	NumChunks       int `json:"numChunks" db:"num_chunks"`
 }
 
 /* Payment status will hold the status of the payment of the broker_broker_transaction row */
@@ -195,6 +200,10 @@ func NewBrokerBrokerTransaction(session *UploadSession) bool {
 		TotalCost:     session.TotalCost,
 		PaymentStatus: paymentStatus,
 	}
+	if session.RangeStartIdx.Valid && session.RangeEndIdx.Valid {
+		brokerTx.BetaShareChunks = int(session.RangeEndIdx.Int64-session.RangeStartIdx.Int64) + 1
+		brokerTx.NumChunks = session.NumChunks
+	}
 
 	vErr, err := DB.ValidateAndCreate(&brokerTx)
 	oyster_utils.LogIfError(err, nil)
@@ -203,12 +212,54 @@ func NewBrokerBrokerTransaction(session *UploadSession) bool {
 	return err == nil && len(vErr.Errors) == 0
 }
 
+/*NewPeerBrokerBrokerTransactions creates a broker_broker_transaction for each peer of an N-broker alpha session,
+through which the peer is paid for its range of chunks.*/
+func NewPeerBrokerBrokerTransactions(session *UploadSession, peers []SessionPeer) bool {
+	allCreated := true
+	for _, peer := range peers {
+		peerSession := *session
+		peerSession.ETHAddrBeta = nulls.NewString(peer.ETHAddr)
+		peerSession.RangeStartIdx = nulls.NewInt64(int64(peer.Range.Start))
+		peerSession.RangeEndIdx = nulls.NewInt64(int64(peer.Range.End))
+		allCreated = NewBrokerBrokerTransaction(&peerSession) && allCreated
+	}
+	return allCreated
+}
+
 /*GetTotalCostInWei takes the TotalCost and converts it to wei units*/
 func (b *BrokerBrokerTransaction) GetTotalCostInWei() *big.Int {
 	float64Cost, _ := b.TotalCost.Float64()
 	return oyster_utils.ConvertToWeiUnit(big.NewFloat(float64Cost))
 }
 
+/*GetBetaShareInWei returns how much of the TotalCost is paid to beta, in wei units*/
+func (b *BrokerBrokerTransaction) GetBetaShareInWei() *big.Int {
+	if b.NumChunks <= 0 {
+		return new(big.Int).Quo(b.GetTotalCostInWei(), big.NewInt(2))
+	}
+	share := new(big.Int).Mul(b.GetTotalCostInWei(), big.NewInt(int64(b.BetaShareChunks)))
+	return share.Quo(share, big.NewInt(int64(b.NumChunks)))
+}
+
+/*GetNumBetaPaymentsToSend returns how many alpha transactions with the alpha address ethAddrAlpha have not sent
+PRL to their beta yet.  Each of them needs gas for its send.*/
+func GetNumBetaPaymentsToSend(ethAddrAlpha string) (int, error) {
+	count, err := DB.Where("eth_addr_alpha = ? AND type = ? AND payment_status IN (?, ?, ?)", ethAddrAlpha,
+		SessionTypeAlpha, BrokerTxAlphaPaymentConfirmed, BrokerTxGasPaymentPending,
+		BrokerTxGasPaymentConfirmed).Count(&BrokerBrokerTransaction{})
+	oyster_utils.LogIfError(err, nil)
+	return count, err
+}
+
+/*HasPendingBetaPayment returns whether an alpha transaction with the alpha address ethAddrAlpha has sent PRL to its
+beta which has not arrived yet.*/
+func HasPendingBetaPayment(ethAddrAlpha string) (bool, error) {
+	count, err := DB.Where("eth_addr_alpha = ? AND type = ? AND payment_status = ?", ethAddrAlpha,
+		SessionTypeAlpha, BrokerTxBetaPaymentPending).Count(&BrokerBrokerTransaction{})
+	oyster_utils.LogIfError(err, nil)
+	return count > 0, err
+}
+
 /*GetTransactionsBySessionTypesAndPaymentStatuses accepts an array of session types and payment statuses and returns
 broker_broker_transactions that match*/
 func GetTransactionsBySessionTypesAndPaymentStatuses(sessionTypes []int, paymentStatuses []PaymentStatus) ([]BrokerBrokerTransaction, error) {
@@ -303,11 +354,12 @@ func SetUploadSessionToPaid(brokerTx BrokerBrokerTransaction) error {
 }
 
 /* DeleteCompletedBrokerTransactions deletes any brokerTxs for which both alpha and beta are paid */
-func DeleteCompletedBrokerTransactions() {
+func DeleteCompletedBrokerTransactions() error {
 	err := DB.RawQuery("DELETE FROM broker_broker_transactions WHERE "+
 		"payment_status = ?",
 		BrokerTxBetaPaymentConfirmed,
 	).All(&[]BrokerBrokerTransaction{})
 
 	oyster_utils.LogIfError(err, nil)
+	return err
 }
@@ -116,6 +116,54 @@ func (suite *ModelSuite) Test_GetTotalCostInWei() {
 	suite.Equal(expectedTotalCostString, totalCostInWei.String())
 }
 
+func (suite *ModelSuite) Test_NewPeerBrokerBrokerTransactions() {
+
+	oyster_utils.SetBrokerMode(oyster_utils.ProdMode)
+	defer oyster_utils.ResetBrokerMode()
+
+	u := models.UploadSession{
+		Type:                 models.SessionTypeAlpha,
+		GenesisHash:          oyster_utils.RandSeq(6, []rune("abcdef0123456789")),
+		FileSizeBytes:        uint64(123),
+		NumChunks:            2,
+		StorageLengthInYears: 2,
+		ETHPrivateKey:        "abcdef1234567890",
+		ETHAddrAlpha:         nulls.NewString("0000000000"),
+		TotalCost:            totalCost,
+	}
+
+	vErr, err := u.StartUploadSession()
+	suite.Nil(err)
+	suite.False(vErr.HasAny())
+
+	peers := []models.SessionPeer{
+		{ETHAddr: "1111111111", Range: oyster_utils.IndexRange{Start: 1, End: 1}},
+		{ETHAddr: "2222222222", Range: oyster_utils.IndexRange{Start: 2, End: 2}},
+	}
+	suite.True(models.NewPeerBrokerBrokerTransactions(&u, peers))
+
+	brokerTxs := returnAllBrokerBrokerTxs(suite)
+	suite.Equal(2, len(brokerTxs))
+
+	for _, brokerTx := range brokerTxs {
+		suite.Equal(u.GenesisHash, brokerTx.GenesisHash)
+		suite.Equal(u.ETHAddrAlpha.String, brokerTx.ETHAddrAlpha)
+		suite.Equal(1, brokerTx.BetaShareChunks)
+		suite.Equal(u.NumChunks, brokerTx.NumChunks)
+	}
+	suite.NotEqual(brokerTxs[0].ETHAddrBeta, brokerTxs[1].ETHAddrBeta)
+}
+
+func (suite *ModelSuite) Test_GetBetaShareInWei() {
+	brokerTx := models.BrokerBrokerTransaction{TotalCost: totalCost}
+	suite.Equal("7812500000000000", brokerTx.GetBetaShareInWei().String())
+
+	// N-broker mode
+	brokerTx.BetaShareChunks = 1
+	brokerTx.NumChunks = 5
+	suite.Equal("3125000000000000", brokerTx.GetBetaShareInWei().String())
+}
+
 func (suite *ModelSuite) Test_GetTransactionsBySessionTypesAndPaymentStatuses_with_session_type() {
 
 	generateBrokerBrokerTransactions(
@@ -2,11 +2,18 @@ package models
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
 	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
 	"github.com/gobuffalo/uuid"
 	"github.com/gobuffalo/validate"
 	"github.com/gobuffalo/validate/validators"
-	"time"
+	"github.com/oysterprotocol/brokernode/utils"
 )
 
 type Brokernode struct {
@@ -14,8 +21,48 @@ type Brokernode struct {
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 	Address   string    `json:"address" db:"address"`
+
+	// ETHAddress signs the requests this broker sends to other brokers.
+	ETHAddress nulls.String `json:"eth_address" db:"eth_address"`
+
+	// APIURL, Capacity and Version are announced by the broker itself.  Capacity is the max number of chunks of an
+	// upload it accepts, 0 if unlimited.
+	APIURL   nulls.String `json:"api_url" db:"api_url"`
+	Capacity int          `json:"capacity" db:"capacity"`
+	Version  nulls.String `json:"version" db:"version"`
+
+	// LastSeenAt is when the broker last announced itself or passed a health check.
+	Status             int        `json:"status" db:"status"`
+	LastSeenAt         nulls.Time `json:"last_seen_at" db:"last_seen_at"`
+	FailedHealthChecks int        `json:"failed_health_checks" db:"failed_health_checks"`
+}
+
+/*BrokernodeAnnouncement is what a broker tells the other brokers about itself.*/
+type BrokernodeAnnouncement struct {
+	Address  string `json:"address"`
+	APIURL   string `json:"apiUrl"`
+	Capacity int    `json:"capacity"`
+	Version  string `json:"version"`
 }
 
+/*BrokernodeAllowlistEnv is a comma separated list of ETH addresses of brokers which are approved as soon as they
+announce themselves.*/
+const BrokernodeAllowlistEnv = "BROKERNODE_ALLOWLIST"
+
+const (
+	/*BrokernodeUnapproved means the broker announced itself but an operator has not approved it yet, so it is not
+	health checked*/
+	BrokernodeUnapproved int = iota + 1
+	/*BrokernodePending means the broker was approved but has not passed a health check yet*/
+	BrokernodePending
+	/*BrokernodeActive means the broker passed its last health check*/
+	BrokernodeActive
+	/*BrokernodeUnreachable means the broker failed its last health check*/
+	BrokernodeUnreachable
+	/*BrokernodeExpired means the broker was unreachable for too long, so it is no longer health checked*/
+	BrokernodeExpired
+)
+
 // String is not required by pop and may be deleted
 func (b Brokernode) String() string {
 	jb, _ := json.Marshal(b)
@@ -39,6 +86,14 @@ func (b *Brokernode) Validate(tx *pop.Connection) (*validate.Errors, error) {
 	), nil
 }
 
+/*BeforeCreate runs every time when Brokernode is created.*/
+func (b *Brokernode) BeforeCreate(tx *pop.Connection) error {
+	if b.Status == 0 {
+		b.Status = BrokernodeUnapproved
+	}
+	return nil
+}
+
 // ValidateCreate gets run every time you call "pop.ValidateAndCreate" method.
 // This method is not required and may be deleted.
 func (b *Brokernode) ValidateCreate(tx *pop.Connection) (*validate.Errors, error) {
@@ -50,3 +105,154 @@ func (b *Brokernode) ValidateCreate(tx *pop.Connection) (*validate.Errors, error
 func (b *Brokernode) ValidateUpdate(tx *pop.Connection) (*validate.Errors, error) {
 	return validate.NewErrors(), nil
 }
+
+/*IsKnownBrokernode returns whether ethAddress belongs to one of the active brokers in the brokernodes table.*/
+func IsKnownBrokernode(ethAddress string) (bool, error) {
+	count, err := DB.Where("LOWER(eth_address) = ? AND status = ?", strings.ToLower(ethAddress),
+		BrokernodeActive).Count(&Brokernode{})
+	oyster_utils.LogIfError(err, nil)
+	return count > 0, err
+}
+
+/*GetBrokernodeByETHAddress returns the broker in the brokernodes table which ethAddress belongs to.*/
+func GetBrokernodeByETHAddress(ethAddress string) (Brokernode, error) {
+	brokernode := Brokernode{}
+	err := DB.Where("LOWER(eth_address) = ?", strings.ToLower(ethAddress)).First(&brokernode)
+	oyster_utils.LogIfError(err, nil)
+	return brokernode, err
+}
+
+/*GetAPIURL returns the URL the API of the broker is reached at.  Brokers which were added before they could announce
+themselves only have their address.*/
+func (b Brokernode) GetAPIURL() string {
+	if b.APIURL.Valid && b.APIURL.String != "" {
+		return strings.TrimSuffix(b.APIURL.String, "/")
+	}
+	return strings.TrimSuffix(b.Address, "/")
+}
+
+/*AnnounceBrokernode adds the broker with the ETH address of the announcement to the brokernodes table, or updates
+what it announced if it is already there.  A new broker is health checked once it is approved, either by being in
+BROKERNODE_ALLOWLIST or with ApproveBrokernode, and is listed once it passes a health check.*/
+func AnnounceBrokernode(announcement Brokernode) (Brokernode, error) {
+	announcement.LastSeenAt = nulls.NewTime(time.Now())
+
+	brokernodes := []Brokernode{}
+	err := DB.Where("LOWER(eth_address) = ?", strings.ToLower(announcement.ETHAddress.String)).All(&brokernodes)
+	if err != nil {
+		oyster_utils.LogIfError(err, nil)
+		return announcement, err
+	}
+
+	isAllowlisted := isBrokernodeAllowlisted(announcement.ETHAddress.String)
+
+	if len(brokernodes) == 0 {
+		announcement.Status = BrokernodeUnapproved
+		if isAllowlisted {
+			announcement.Status = BrokernodePending
+		}
+		vErr, err := DB.ValidateAndCreate(&announcement)
+		if err == nil && vErr.HasAny() {
+			err = errors.New(vErr.Error())
+		}
+		oyster_utils.LogIfError(err, nil)
+		return announcement, err
+	}
+
+	brokernode := brokernodes[0]
+	if brokernode.Status == BrokernodeUnapproved {
+		if isAllowlisted {
+			brokernode.Status = BrokernodePending
+		}
+	} else if brokernode.Address != announcement.Address || brokernode.APIURL != announcement.APIURL {
+		// the new address has to pass a health check before it is sold
+		brokernode.Status = BrokernodePending
+		brokernode.FailedHealthChecks = 0
+	} else if brokernode.Status == BrokernodeExpired {
+		brokernode.Status = BrokernodePending
+	}
+	brokernode.Address = announcement.Address
+	brokernode.APIURL = announcement.APIURL
+	brokernode.Capacity = announcement.Capacity
+	brokernode.Version = announcement.Version
+	brokernode.LastSeenAt = announcement.LastSeenAt
+
+	vErr, err := DB.ValidateAndUpdate(&brokernode)
+	if err == nil && vErr.HasAny() {
+		err = errors.New(vErr.Error())
+	}
+	oyster_utils.LogIfError(err, nil)
+	return brokernode, err
+}
+
+/*ApproveBrokernode approves the unapproved broker with ETH address ethAddress, which is listed once it passes a
+health check.*/
+func ApproveBrokernode(ethAddress string) error {
+	brokernode, err := GetBrokernodeByETHAddress(ethAddress)
+	if err != nil {
+		return err
+	}
+	if brokernode.Status != BrokernodeUnapproved {
+		return fmt.Errorf("brokernode %v is already approved", ethAddress)
+	}
+
+	err = DB.RawQuery("UPDATE brokernodes SET status = ? WHERE id = ?", BrokernodePending,
+		brokernode.ID).All(&[]Brokernode{})
+	oyster_utils.LogIfError(err, nil)
+	return err
+}
+
+/*isBrokernodeAllowlisted returns whether ethAddress is in BROKERNODE_ALLOWLIST.*/
+func isBrokernodeAllowlisted(ethAddress string) bool {
+	if ethAddress == "" {
+		return false
+	}
+	for _, allowed := range strings.Split(os.Getenv(BrokernodeAllowlistEnv), ",") {
+		if strings.EqualFold(strings.TrimSpace(allowed), ethAddress) {
+			return true
+		}
+	}
+	return false
+}
+
+/*GetActiveBrokernodes returns the brokers which passed their last health check.*/
+func GetActiveBrokernodes() ([]Brokernode, error) {
+	brokernodes := []Brokernode{}
+	err := DB.Where("status = ?", BrokernodeActive).Order("last_seen_at DESC").All(&brokernodes)
+	oyster_utils.LogIfError(err, nil)
+	return brokernodes, err
+}
+
+/*GetBrokernodesToHealthCheck returns the brokers which were approved and have not expired.*/
+func GetBrokernodesToHealthCheck() ([]Brokernode, error) {
+	brokernodes := []Brokernode{}
+	err := DB.Where("status NOT IN (?, ?)", BrokernodeUnapproved, BrokernodeExpired).All(&brokernodes)
+	oyster_utils.LogIfError(err, nil)
+	return brokernodes, err
+}
+
+/*UpdateHealth records the result of a health check of the broker.  A broker which has not been seen for
+expireAfter expires.*/
+func (b *Brokernode) UpdateHealth(isHealthy bool, expireAfter time.Duration, now time.Time) error {
+	if isHealthy {
+		b.Status = BrokernodeActive
+		b.LastSeenAt = nulls.NewTime(now)
+		b.FailedHealthChecks = 0
+	} else {
+		b.FailedHealthChecks++
+		lastSeenAt := b.CreatedAt
+		if b.LastSeenAt.Valid {
+			lastSeenAt = b.LastSeenAt.Time
+		}
+		if now.Sub(lastSeenAt) >= expireAfter {
+			b.Status = BrokernodeExpired
+		} else if b.Status == BrokernodeActive {
+			b.Status = BrokernodeUnreachable
+		}
+	}
+
+	err := DB.RawQuery("UPDATE brokernodes SET status = ?, last_seen_at = ?, failed_health_checks = ? WHERE id = ?",
+		b.Status, b.LastSeenAt, b.FailedHealthChecks, b.ID).All(&[]Brokernode{})
+	oyster_utils.LogIfError(err, nil)
+	return err
+}
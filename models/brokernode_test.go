@@ -1,5 +1,120 @@
 package models_test
 
+import (
+	"os"
+	"time"
+
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/oysterprotocol/brokernode/models"
+)
+
 func (suite *ModelSuite) Test_Brokernode() {
 	// TODO: Implement this method.
 }
+
+func (suite *ModelSuite) Test_AnnounceBrokernode() {
+	os.Setenv(models.BrokernodeAllowlistEnv, "0x1111111111111111111111111111111111111111, "+
+		"0x5aeda56215b167893e80b4fe645ba6d5bab767de")
+	defer os.Unsetenv(models.BrokernodeAllowlistEnv)
+
+	brokernode, err := models.AnnounceBrokernode(models.Brokernode{
+		Address:    "http://1.2.3.4:3000",
+		ETHAddress: nulls.NewString("0x5aeda56215b167893e80b4fe645ba6d5bab767de"),
+		Capacity:   100,
+	})
+	suite.Nil(err)
+	suite.Equal(models.BrokernodePending, brokernode.Status)
+	suite.True(brokernode.LastSeenAt.Valid)
+
+	suite.Nil(brokernode.UpdateHealth(true, time.Hour, time.Now()))
+
+	// announcing again with the same address keeps the broker active
+	brokernode, err = models.AnnounceBrokernode(models.Brokernode{
+		Address:    "http://1.2.3.4:3000",
+		ETHAddress: nulls.NewString("0x5AEDA56215b167893e80B4fE645BA6d5Bab767DE"),
+		Capacity:   200,
+		Version:    nulls.NewString("1.0.0"),
+	})
+	suite.Nil(err)
+	suite.Equal(models.BrokernodeActive, brokernode.Status)
+	suite.Equal(200, brokernode.Capacity)
+
+	// a new address has to pass a health check first
+	brokernode, err = models.AnnounceBrokernode(models.Brokernode{
+		Address:    "http://5.6.7.8:3000",
+		ETHAddress: nulls.NewString("0x5aeda56215b167893e80b4fe645ba6d5bab767de"),
+	})
+	suite.Nil(err)
+	suite.Equal(models.BrokernodePending, brokernode.Status)
+
+	count, err := suite.DB.Count(&models.Brokernode{})
+	suite.Nil(err)
+	suite.Equal(1, count)
+}
+
+func (suite *ModelSuite) Test_AnnounceBrokernode_Unapproved() {
+	ethAddress := "0x5aeda56215b167893e80b4fe645ba6d5bab767de"
+	brokernode, err := models.AnnounceBrokernode(models.Brokernode{
+		Address:    "http://1.2.3.4:3000",
+		ETHAddress: nulls.NewString(ethAddress),
+	})
+	suite.Nil(err)
+	suite.Equal(models.BrokernodeUnapproved, brokernode.Status)
+
+	// announcing again doesn't approve the broker
+	brokernode, err = models.AnnounceBrokernode(models.Brokernode{
+		Address:    "http://5.6.7.8:3000",
+		ETHAddress: nulls.NewString(ethAddress),
+	})
+	suite.Nil(err)
+	suite.Equal(models.BrokernodeUnapproved, brokernode.Status)
+
+	brokernodes, err := models.GetBrokernodesToHealthCheck()
+	suite.Nil(err)
+	suite.Equal(0, len(brokernodes))
+	isKnown, err := models.IsKnownBrokernode(ethAddress)
+	suite.Nil(err)
+	suite.False(isKnown)
+
+	suite.Nil(models.ApproveBrokernode(ethAddress))
+	suite.NotNil(models.ApproveBrokernode(ethAddress))
+	suite.Nil(suite.DB.Find(&brokernode, brokernode.ID))
+	suite.Equal(models.BrokernodePending, brokernode.Status)
+
+	// requests of the broker are accepted once it passes a health check
+	isKnown, err = models.IsKnownBrokernode(ethAddress)
+	suite.Nil(err)
+	suite.False(isKnown)
+	suite.Nil(brokernode.UpdateHealth(true, time.Hour, time.Now()))
+	isKnown, err = models.IsKnownBrokernode(ethAddress)
+	suite.Nil(err)
+	suite.True(isKnown)
+}
+
+func (suite *ModelSuite) Test_UpdateHealth() {
+	now := time.Now()
+	brokernode := models.Brokernode{
+		Address:    "http://1.2.3.4:3000",
+		LastSeenAt: nulls.NewTime(now.Add(-2 * time.Hour)),
+		Status:     models.BrokernodeActive,
+	}
+	vErr, err := suite.DB.ValidateAndCreate(&brokernode)
+	suite.Nil(err)
+	suite.False(vErr.HasAny())
+	suite.Equal(models.BrokernodeActive, brokernode.Status)
+
+	suite.Nil(brokernode.UpdateHealth(false, 3*time.Hour, now))
+	suite.Equal(models.BrokernodeUnreachable, brokernode.Status)
+	suite.Equal(1, brokernode.FailedHealthChecks)
+
+	suite.Nil(brokernode.UpdateHealth(false, time.Hour, now))
+	suite.Equal(models.BrokernodeExpired, brokernode.Status)
+
+	suite.Nil(suite.DB.Find(&brokernode, brokernode.ID))
+	suite.Equal(models.BrokernodeExpired, brokernode.Status)
+	suite.Equal(2, brokernode.FailedHealthChecks)
+
+	brokernodes, err := models.GetBrokernodesToHealthCheck()
+	suite.Nil(err)
+	suite.Equal(0, len(brokernodes))
+}
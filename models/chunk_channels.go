@@ -2,6 +2,7 @@ package models
 
 import (
 	"encoding/json"
+	"errors"
 	"sync"
 	"time"
 
@@ -130,3 +131,27 @@ func MakeChannels(powProcs int) ([]ChunkChannel, error) {
 
 	return channels, err
 }
+
+/*AddChannel makes one more channel which is ready right away.*/
+func AddChannel() (ChunkChannel, error) {
+	channel := ChunkChannel{
+		ChannelID:       oyster_utils.RandSeq(10, letters),
+		EstReadyTime:    time.Now().Add(-5 * time.Second),
+		ChunksProcessed: 0,
+	}
+
+	vErr, err := DB.ValidateAndSave(&channel)
+	oyster_utils.LogIfValidationError("errors adding a chunk channel", vErr, nil)
+	oyster_utils.LogIfError(err, nil)
+	if err == nil && vErr.HasAny() {
+		err = errors.New("invalid chunk channel")
+	}
+	return channel, err
+}
+
+/*DeleteChannel removes the channel, so that no more chunks are assigned to it.*/
+func DeleteChannel(channelID string) error {
+	err := DB.RawQuery("DELETE FROM chunk_channels WHERE channel_id = ?", channelID).Exec()
+	oyster_utils.LogIfError(err, nil)
+	return err
+}
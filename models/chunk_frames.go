@@ -0,0 +1,110 @@
+package models
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	/*ChunkFrameContentType is the content type of upload requests which send the chunks as frames instead of JSON.*/
+	ChunkFrameContentType = "application/octet-stream"
+	/*ChunkFrameBatchSize is the number of chunks of a framed upload request which are validated and stored at a
+	time.*/
+	ChunkFrameBatchSize = 1000
+	/*MaxChunkFrameHashLength is the max length of the hash in a frame.  A genesis hash is 64 hex characters.*/
+	MaxChunkFrameHashLength = 128
+)
+
+/*ChunkFrameReader reads the chunks of a framed upload request one at a time, so that the request never has to be
+held in memory.  Each frame is the index of the chunk as a big endian uint32, the length of the hash as a uint16,
+the hash, the length of the data as a uint32 and the data.*/
+type ChunkFrameReader struct {
+	reader *bufio.Reader
+}
+
+/*NewChunkFrameReader returns a ChunkFrameReader which reads the frames from r.*/
+func NewChunkFrameReader(r io.Reader) *ChunkFrameReader {
+	return &ChunkFrameReader{reader: bufio.NewReader(r)}
+}
+
+/*Read returns the next chunk.  It returns io.EOF once every frame was read, and io.ErrUnexpectedEOF if the last
+frame is cut off.*/
+func (f *ChunkFrameReader) Read() (ChunkReq, error) {
+	chunk := ChunkReq{}
+
+	var idx uint32
+	if err := binary.Read(f.reader, binary.BigEndian, &idx); err != nil {
+		// io.EOF only when there is not a single byte of the next frame
+		return chunk, err
+	}
+	chunk.Idx = int(idx)
+
+	var hashLength uint16
+	if err := binary.Read(f.reader, binary.BigEndian, &hashLength); err != nil {
+		return chunk, unexpectedEOF(err)
+	}
+	if hashLength > MaxChunkFrameHashLength {
+		return chunk, fmt.Errorf("hash of chunk %v is longer than %v bytes", chunk.Idx, MaxChunkFrameHashLength)
+	}
+	hash := make([]byte, hashLength)
+	if _, err := io.ReadFull(f.reader, hash); err != nil {
+		return chunk, unexpectedEOF(err)
+	}
+	chunk.Hash = string(hash)
+
+	var dataLength uint32
+	if err := binary.Read(f.reader, binary.BigEndian, &dataLength); err != nil {
+		return chunk, unexpectedEOF(err)
+	}
+	if dataLength > MaxChunkDataLength {
+		return chunk, fmt.Errorf("data of chunk %v is longer than %v trytes", chunk.Idx, MaxChunkDataLength)
+	}
+	data := make([]byte, dataLength)
+	if _, err := io.ReadFull(f.reader, data); err != nil {
+		return chunk, unexpectedEOF(err)
+	}
+	chunk.Data = string(data)
+
+	return chunk, nil
+}
+
+/*ReadBatch returns up to batchSize chunks.  Along with the chunks read before the end of the frames, it returns
+io.EOF.*/
+func (f *ChunkFrameReader) ReadBatch(batchSize int) ([]ChunkReq, error) {
+	chunks := []ChunkReq{}
+	for len(chunks) < batchSize {
+		chunk, err := f.Read()
+		if err != nil {
+			return chunks, err
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks, nil
+}
+
+/*WriteChunkFrame writes the chunk to w as one frame.*/
+func WriteChunkFrame(w io.Writer, chunk ChunkReq) error {
+	hashLength := len(chunk.Hash)
+	if hashLength > MaxChunkFrameHashLength {
+		return fmt.Errorf("hash of chunk %v is longer than %v bytes", chunk.Idx, MaxChunkFrameHashLength)
+	}
+
+	frame := make([]byte, 10+hashLength+len(chunk.Data))
+	binary.BigEndian.PutUint32(frame, uint32(chunk.Idx))
+	binary.BigEndian.PutUint16(frame[4:], uint16(hashLength))
+	copy(frame[6:], chunk.Hash)
+	binary.BigEndian.PutUint32(frame[6+hashLength:], uint32(len(chunk.Data)))
+	copy(frame[10+hashLength:], chunk.Data)
+
+	_, err := w.Write(frame)
+	return err
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
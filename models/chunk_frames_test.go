@@ -0,0 +1,49 @@
+package models_test
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/oysterprotocol/brokernode/models"
+)
+
+func (suite *ModelSuite) Test_ChunkFrames() {
+	chunks := []models.ChunkReq{
+		{Idx: 0, Hash: "abcdef11", Data: "ABCDEF"},
+		{Idx: 1, Hash: "abcdef11", Data: ""},
+		{Idx: 70000, Hash: "abcdef11", Data: "GHIJ9"},
+	}
+
+	buf := bytes.Buffer{}
+	for _, chunk := range chunks {
+		suite.Nil(models.WriteChunkFrame(&buf, chunk))
+	}
+
+	reader := models.NewChunkFrameReader(&buf)
+	batch, err := reader.ReadBatch(2)
+	suite.Nil(err)
+	suite.Equal(chunks[:2], batch)
+
+	batch, err = reader.ReadBatch(2)
+	suite.Equal(io.EOF, err)
+	suite.Equal(chunks[2:], batch)
+}
+
+func (suite *ModelSuite) Test_ChunkFrames_Truncated() {
+	buf := bytes.Buffer{}
+	suite.Nil(models.WriteChunkFrame(&buf, models.ChunkReq{Idx: 3, Hash: "abcdef11", Data: "ABCDEF"}))
+
+	reader := models.NewChunkFrameReader(bytes.NewReader(buf.Bytes()[:buf.Len()-2]))
+	_, err := reader.Read()
+	suite.Equal(io.ErrUnexpectedEOF, err)
+}
+
+func (suite *ModelSuite) Test_ChunkFrames_DataTooLong() {
+	// a frame of chunk 0 with an empty hash and 4000 bytes of data
+	frame := []byte{0, 0, 0, 0, 0, 0, 0, 0, 0x0f, 0xa0}
+
+	reader := models.NewChunkFrameReader(bytes.NewReader(frame))
+	_, err := reader.Read()
+	suite.NotNil(err)
+	suite.NotEqual(io.ErrUnexpectedEOF, err)
+}
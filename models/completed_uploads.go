@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
 	"github.com/gobuffalo/uuid"
 	"github.com/gobuffalo/validate"
 	"github.com/gobuffalo/validate/validators"
@@ -26,6 +27,8 @@ type CompletedUpload struct {
 	GasTxHash     string            `json:"gasTxHash" db:"gas_tx_hash"`
 	GasTxNonce    int64             `json:"gasTxNonce" db:"gas_tx_nonce"`
 	Version       uint32            `json:"version" db:"version"`
+	ClaimedBy     nulls.String      `json:"claimedBy" db:"claimed_by"`
+	ClaimedUntil  nulls.Time        `json:"claimedUntil" db:"claimed_until"`
 }
 
 type PRLClaimStatus int
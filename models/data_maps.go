@@ -3,6 +3,7 @@ package models
 import (
 	"encoding/json"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/gobuffalo/pop"
@@ -159,3 +160,78 @@ func insertsIntoDataMapsTable(columnsName string, values string, valueSize int)
 	oyster_utils.LogIfError(err, map[string]interface{}{"MaxRetry": oyster_utils.MAX_NUMBER_OF_SQL_RETRY, "NumOfRecord": valueSize})
 	return err
 }
+
+/*GetDataMapAddresses returns the addresses of the chunks from startIdx to endIdx of the file with the genesis hash,
+from its in-progress or completed data maps, so that the hash chain does not have to be followed.  Returns false if
+the data map of any of the chunks is not stored.*/
+func GetDataMapAddresses(genesisHash string, startIdx int64, endIdx int64) ([]string, bool, error) {
+	if oyster_utils.DataMapStorageMode == oyster_utils.DataMapsInBadger {
+		return getDataMapAddressesFromBadger(genesisHash, startIdx, endIdx)
+	}
+	return getDataMapAddressesFromSQL(genesisHash, startIdx, endIdx)
+}
+
+func getDataMapAddressesFromBadger(genesisHash string, startIdx int64, endIdx int64) ([]string, bool, error) {
+	keys := oyster_utils.GenerateBulkKeys(genesisHash, startIdx, endIdx)
+	hashes := oyster_utils.KVPairs{}
+	for _, prefix := range []string{oyster_utils.InProgressDir, oyster_utils.CompletedDir} {
+		dbID := []string{prefix, genesisHash, oyster_utils.HashDir}
+		// reading a DB creates it, which is not wanted for a file the broker does not have
+		if _, err := os.Stat(oyster_utils.GetUniqueKvStoreDir(dbID)); err != nil {
+			continue
+		}
+		kvs, err := oyster_utils.BatchGetFromUniqueDB(dbID, keys)
+		if err != nil {
+			return nil, false, err
+		}
+		for key, hash := range *kvs {
+			hashes[key] = hash
+		}
+	}
+
+	addresses := make([]string, 0, len(*keys))
+	for _, key := range *keys {
+		hash, ok := hashes[key]
+		if !ok {
+			return nil, false, nil
+		}
+		addresses = append(addresses, oyster_utils.Sha256ToAddress(hash))
+	}
+	return addresses, true, nil
+}
+
+func getDataMapAddressesFromSQL(genesisHash string, startIdx int64, endIdx int64) ([]string, bool, error) {
+	addressByIdx := make(map[int64]string)
+
+	dataMaps := []DataMap{}
+	err := DB.RawQuery("SELECT chunk_idx, address FROM data_maps WHERE genesis_hash = ? AND "+
+		"chunk_idx >= ? AND chunk_idx <= ?", genesisHash, startIdx, endIdx).All(&dataMaps)
+	if err != nil {
+		oyster_utils.LogIfError(err, nil)
+		return nil, false, err
+	}
+	for _, dataMap := range dataMaps {
+		addressByIdx[int64(dataMap.ChunkIdx)] = dataMap.Address
+	}
+
+	completedDataMaps := []CompletedDataMap{}
+	err = DB.RawQuery("SELECT chunk_idx, address FROM completed_data_maps WHERE genesis_hash = ? AND "+
+		"chunk_idx >= ? AND chunk_idx <= ?", genesisHash, startIdx, endIdx).All(&completedDataMaps)
+	if err != nil {
+		oyster_utils.LogIfError(err, nil)
+		return nil, false, err
+	}
+	for _, dataMap := range completedDataMaps {
+		addressByIdx[int64(dataMap.ChunkIdx)] = dataMap.Address
+	}
+
+	addresses := make([]string, 0, endIdx-startIdx+1)
+	for idx := startIdx; idx <= endIdx; idx++ {
+		address, ok := addressByIdx[idx]
+		if !ok {
+			return nil, false, nil
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, true, nil
+}
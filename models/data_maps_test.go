@@ -54,3 +54,29 @@ func (suite *ModelSuite) Test_BuildDataMaps() {
 		suite.NotNil(dMap.MsgID)
 	}
 }
+
+func (suite *ModelSuite) Test_GetDataMapAddresses() {
+	defer oyster_utils.ResetDataMapStorageMode()
+	for _, mode := range []oyster_utils.DataMapsStorageStatus{oyster_utils.DataMapsInSQL, oyster_utils.DataMapsInBadger} {
+		oyster_utils.SetStorageMode(mode)
+
+		genHash := oyster_utils.RandSeq(64, []rune("abcdef0123456789"))
+		suite.Nil(models.BuildDataMapsForSession(genHash, 7))
+
+		expectedAddresses, err := oyster_utils.ComputeChunkAddresses(genHash, 2, 4)
+		suite.Nil(err)
+		addresses, ok, err := models.GetDataMapAddresses(genHash, 2, 5)
+		suite.Nil(err)
+		suite.True(ok)
+		suite.Equal(expectedAddresses, addresses)
+
+		// the data maps end at the last chunk
+		_, ok, err = models.GetDataMapAddresses(genHash, 5, 7)
+		suite.Nil(err)
+		suite.False(ok)
+
+		_, ok, err = models.GetDataMapAddresses(oyster_utils.RandSeq(64, []rune("abcdef0123456789")), 0, 1)
+		suite.Nil(err)
+		suite.False(ok)
+	}
+}
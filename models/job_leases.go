@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+/*JobLease is held by the broker replica which is running a job, so that replicas sharing one database do not
+run the same job at the same time.*/
+type JobLease struct {
+	Name      string    `json:"name" db:"name"`
+	Owner     string    `json:"owner" db:"owner"`
+	ExpiresAt time.Time `json:"expiresAt" db:"expires_at"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+/*AcquireJobLease takes the lease of the job for owner, unless another owner holds a lease which has not expired.
+Taking a lease the owner already holds extends it.*/
+func AcquireJobLease(name string, owner string, duration time.Duration) (bool, error) {
+	// Expiry uses the database clock, so that the replicas do not depend on their own clocks being in sync.
+	err := DB.RawQuery("INSERT INTO job_leases (name, owner, expires_at, created_at, updated_at) "+
+		"VALUES (?, ?, DATE_ADD(NOW(), INTERVAL ? SECOND), NOW(), NOW()) "+
+		"ON DUPLICATE KEY UPDATE "+
+		"owner = IF(expires_at < NOW() OR owner = VALUES(owner), VALUES(owner), owner), "+
+		"expires_at = IF(owner = VALUES(owner), VALUES(expires_at), expires_at), "+
+		"updated_at = NOW()",
+		name, owner, int(duration.Seconds())).Exec()
+	if err != nil {
+		oyster_utils.LogIfError(err, nil)
+		return false, err
+	}
+
+	lease := JobLease{}
+	if err := DB.RawQuery("SELECT * FROM job_leases WHERE name = ?", name).First(&lease); err != nil {
+		oyster_utils.LogIfError(err, nil)
+		return false, err
+	}
+	return lease.Owner == owner, nil
+}
+
+/*ReleaseJobLease gives up the lease of the job, if owner holds it.*/
+func ReleaseJobLease(name string, owner string) error {
+	err := DB.RawQuery("DELETE FROM job_leases WHERE name = ? AND owner = ?", name, owner).Exec()
+	oyster_utils.LogIfError(err, nil)
+	return err
+}
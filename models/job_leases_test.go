@@ -0,0 +1,37 @@
+package models_test
+
+import (
+	"time"
+
+	"github.com/oysterprotocol/brokernode/models"
+)
+
+func (suite *ModelSuite) Test_AcquireJobLease() {
+	acquired, err := models.AcquireJobLease("test_job", "broker_a", time.Minute)
+	suite.Nil(err)
+	suite.True(acquired)
+
+	// Held by broker_a until it expires or is released.
+	acquired, err = models.AcquireJobLease("test_job", "broker_b", time.Minute)
+	suite.Nil(err)
+	suite.False(acquired)
+
+	acquired, err = models.AcquireJobLease("test_job", "broker_a", time.Minute)
+	suite.Nil(err)
+	suite.True(acquired)
+
+	suite.Nil(models.ReleaseJobLease("test_job", "broker_a"))
+
+	acquired, err = models.AcquireJobLease("test_job", "broker_b", time.Minute)
+	suite.Nil(err)
+	suite.True(acquired)
+}
+
+func (suite *ModelSuite) Test_AcquireJobLease_Expired() {
+	suite.Nil(suite.DB.RawQuery("INSERT INTO job_leases (name, owner, expires_at, created_at, updated_at) "+
+		"VALUES (?, ?, DATE_SUB(NOW(), INTERVAL 1 MINUTE), NOW(), NOW())", "test_job", "broker_a").Exec())
+
+	acquired, err := models.AcquireJobLease("test_job", "broker_b", time.Minute)
+	suite.Nil(err)
+	suite.True(acquired)
+}
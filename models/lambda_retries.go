@@ -0,0 +1,119 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/uuid"
+	"github.com/gobuffalo/validate"
+	"github.com/gobuffalo/validate/validators"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+/*LambdaRetry is a batch of chunks which the hooknode lambda failed to attach, waiting for its next attempt.*/
+type LambdaRetry struct {
+	ID uuid.UUID `json:"id" db:"id"`
+	/*Payload is the batch of chunks in the format it is sent to the lambda.*/
+	Payload       string            `json:"payload" db:"payload"`
+	NumChunks     int               `json:"numChunks" db:"num_chunks"`
+	Attempts      int               `json:"attempts" db:"attempts"`
+	Status        LambdaRetryStatus `json:"status" db:"status"`
+	LastError     string            `json:"lastError" db:"last_error"`
+	NextAttemptAt time.Time         `json:"nextAttemptAt" db:"next_attempt_at"`
+	CreatedAt     time.Time         `json:"createdAt" db:"created_at"`
+	UpdatedAt     time.Time         `json:"updatedAt" db:"updated_at"`
+}
+
+/*LambdaRetryStatus is the state of a LambdaRetry.*/
+type LambdaRetryStatus int
+
+const (
+	/*LambdaRetryPending is waiting for its next attempt.*/
+	LambdaRetryPending LambdaRetryStatus = iota + 1
+	/*LambdaRetryDeadLetter has used all of its attempts and is not retried anymore.*/
+	LambdaRetryDeadLetter
+)
+
+// String is not required by pop and may be deleted
+func (l LambdaRetry) String() string {
+	jl, _ := json.Marshal(l)
+	return string(jl)
+}
+
+// Validate gets run every time you call a "pop.Validate*" (pop.ValidateAndSave, pop.ValidateAndCreate, pop.ValidateAndUpdate) method.
+// This method is not required and may be deleted.
+func (l *LambdaRetry) Validate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.Validate(
+		&validators.StringIsPresent{Field: l.Payload, Name: "Payload"},
+	), nil
+}
+
+/*CreateLambdaRetry queues a batch of chunks for its first retry at nextAttemptAt.*/
+func CreateLambdaRetry(payload string, numChunks int, lastError string, nextAttemptAt time.Time) (LambdaRetry, error) {
+	retry := LambdaRetry{
+		Payload:       payload,
+		NumChunks:     numChunks,
+		Attempts:      1,
+		Status:        LambdaRetryPending,
+		LastError:     lastError,
+		NextAttemptAt: nextAttemptAt,
+	}
+
+	vErr, err := DB.ValidateAndCreate(&retry)
+	oyster_utils.LogIfValidationError("errors creating a lambda retry", vErr, nil)
+	oyster_utils.LogIfError(err, nil)
+	if err == nil && vErr.HasAny() {
+		err = vErr
+	}
+	return retry, err
+}
+
+/*GetDueLambdaRetries returns up to limit pending retries whose next attempt is due, the oldest first.*/
+func GetDueLambdaRetries(limit int) ([]LambdaRetry, error) {
+	retries := []LambdaRetry{}
+	err := DB.RawQuery("SELECT * FROM lambda_retries WHERE status = ? AND next_attempt_at <= ? "+
+		"ORDER BY next_attempt_at ASC LIMIT ?", LambdaRetryPending, time.Now(), limit).All(&retries)
+	oyster_utils.LogIfError(err, nil)
+	return retries, err
+}
+
+/*GetLambdaRetryCounts returns the number of retries in each status.*/
+func GetLambdaRetryCounts() (map[LambdaRetryStatus]int, error) {
+	counts := make(map[LambdaRetryStatus]int)
+	for _, status := range []LambdaRetryStatus{LambdaRetryPending, LambdaRetryDeadLetter} {
+		count, err := DB.Where("status = ?", status).Count(&LambdaRetry{})
+		if err != nil {
+			oyster_utils.LogIfError(err, nil)
+			return counts, err
+		}
+		counts[status] = count
+	}
+	return counts, nil
+}
+
+/*RecordFailedAttempt counts the failed attempt.  The retry moves to the dead letter state once it used
+maxAttempts, otherwise its next attempt is at nextAttemptAt.*/
+func (l *LambdaRetry) RecordFailedAttempt(lastError string, maxAttempts int, nextAttemptAt time.Time) error {
+	l.Attempts++
+	l.LastError = lastError
+	l.NextAttemptAt = nextAttemptAt
+	if l.Attempts >= maxAttempts {
+		l.Status = LambdaRetryDeadLetter
+	}
+
+	vErr, err := DB.ValidateAndUpdate(l)
+	oyster_utils.LogIfValidationError("errors updating a lambda retry", vErr, nil)
+	oyster_utils.LogIfError(err, nil)
+	if err == nil && vErr.HasAny() {
+		err = vErr
+	}
+	return err
+}
+
+/*DeleteLambdaRetry removes a retry whose chunks have been attached.*/
+func DeleteLambdaRetry(retry LambdaRetry) error {
+	err := DB.Destroy(&retry)
+	oyster_utils.LogIfError(err, nil)
+	return err
+}
@@ -0,0 +1,53 @@
+package models_test
+
+import (
+	"time"
+
+	"github.com/oysterprotocol/brokernode/models"
+)
+
+func (suite *ModelSuite) Test_GetDueLambdaRetries() {
+	_, err := models.CreateLambdaRetry("[]", 1, "timeout", time.Now().Add(-time.Minute))
+	suite.Nil(err)
+	_, err = models.CreateLambdaRetry("[]", 2, "timeout", time.Now().Add(time.Hour))
+	suite.Nil(err)
+
+	retries, err := models.GetDueLambdaRetries(10)
+	suite.Nil(err)
+	suite.Equal(1, len(retries))
+	suite.Equal(1, retries[0].NumChunks)
+	suite.Equal(1, retries[0].Attempts)
+	suite.Equal(models.LambdaRetryPending, retries[0].Status)
+}
+
+func (suite *ModelSuite) Test_RecordFailedAttempt() {
+	retry, err := models.CreateLambdaRetry("[]", 1, "timeout", time.Now().Add(-time.Minute))
+	suite.Nil(err)
+
+	suite.Nil(retry.RecordFailedAttempt("timeout again", 3, time.Now().Add(time.Hour)))
+	suite.Equal(2, retry.Attempts)
+	suite.Equal(models.LambdaRetryPending, retry.Status)
+
+	retries, err := models.GetDueLambdaRetries(10)
+	suite.Nil(err)
+	suite.Equal(0, len(retries))
+
+	suite.Nil(retry.RecordFailedAttempt("timeout again", 3, time.Now()))
+	suite.Equal(models.LambdaRetryDeadLetter, retry.Status)
+
+	counts, err := models.GetLambdaRetryCounts()
+	suite.Nil(err)
+	suite.Equal(0, counts[models.LambdaRetryPending])
+	suite.Equal(1, counts[models.LambdaRetryDeadLetter])
+}
+
+func (suite *ModelSuite) Test_DeleteLambdaRetry() {
+	retry, err := models.CreateLambdaRetry("[]", 1, "timeout", time.Now().Add(-time.Minute))
+	suite.Nil(err)
+
+	suite.Nil(models.DeleteLambdaRetry(retry))
+
+	retries, err := models.GetDueLambdaRetries(10)
+	suite.Nil(err)
+	suite.Equal(0, len(retries))
+}
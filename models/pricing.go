@@ -0,0 +1,65 @@
+package models
+
+import (
+	"github.com/oysterprotocol/brokernode/utils"
+	"github.com/shopspring/decimal"
+)
+
+/*Quote is what storing a file costs, in PRL.  The treasure cost is buried in treasures for the webnodes and the
+storage cost pays the brokers.  A markup or minimum fee only raises the storage cost.*/
+type Quote struct {
+	NumChunks    int             `json:"numChunks"`
+	NumSectors   int             `json:"numSectors"`
+	StoragePeg   decimal.Decimal `json:"storagePeg"`
+	StorageCost  decimal.Decimal `json:"storageCost"`
+	TreasureCost decimal.Decimal `json:"treasureCost"`
+	TotalCost    decimal.Decimal `json:"totalCost"`
+}
+
+/*GetQuote returns what storing a file of fileSizeBytes for storageLengthInYears costs.  The price of the storage
+peg is split evenly between the treasures and the brokers.  The share of the brokers is raised by
+PRICE_MARKUP_PERCENT, and is at least PRICE_MIN_FEE PRL.*/
+func GetQuote(fileSizeBytes uint64, storageLengthInYears int) Quote {
+
+	// convert all variables to decimal format
+	storagePeg := GetStoragePeg()
+	fileSizeInBytes := decimal.NewFromFloat(float64(fileSizeBytes))
+	storageLength := decimal.NewFromFloat(float64(storageLengthInYears))
+
+	// calculate total cost
+	fileSizeInKB := fileSizeInBytes.Div(decimal.NewFromFloat(float64(oyster_utils.FileChunkSizeInByte)))
+	numChunks := fileSizeInKB.Add(decimal.NewFromFloat(float64(1))).Ceil()
+	numSectors := numChunks.Div(decimal.NewFromFloat(float64(oyster_utils.FileSectorInChunkSize))).Ceil()
+	costPerYear := numSectors.Div(storagePeg)
+	pegCost := costPerYear.Mul(storageLength)
+
+	treasureCost := pegCost.Div(decimal.NewFromFloat(float64(2)))
+	storageCost := pegCost.Sub(treasureCost)
+
+	if markupPercent := oyster_utils.GetEnvDecimal("PRICE_MARKUP_PERCENT"); markupPercent.GreaterThan(decimal.Zero) {
+		storageCost = storageCost.Mul(decimal.NewFromFloat(float64(100)).Add(markupPercent)).
+			Div(decimal.NewFromFloat(float64(100)))
+	}
+	if minFee := oyster_utils.GetEnvDecimal("PRICE_MIN_FEE"); storageCost.LessThan(minFee) {
+		storageCost = minFee
+	}
+
+	return Quote{
+		NumChunks:    int(numChunks.IntPart()),
+		NumSectors:   int(numSectors.IntPart()),
+		StoragePeg:   storagePeg,
+		StorageCost:  storageCost,
+		TreasureCost: treasureCost,
+		TotalCost:    storageCost.Add(treasureCost),
+	}
+}
+
+/*GetStoragePeg returns how much storage in GB that one PRL pays for, for a year.  STORAGE_PEG overrides
+StoragePeg.*/
+func GetStoragePeg() decimal.Decimal {
+	// TODO: query the smart contract for the storage peg once it has a getter for one
+	if storagePeg := oyster_utils.GetEnvDecimal("STORAGE_PEG"); storagePeg.GreaterThan(decimal.Zero) {
+		return storagePeg
+	}
+	return StoragePeg
+}
@@ -0,0 +1,45 @@
+package models_test
+
+import (
+	"os"
+
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/shopspring/decimal"
+)
+
+func (suite *ModelSuite) Test_GetQuote() {
+	quote := models.GetQuote(uint64(123), 2)
+
+	suite.Equal(2, quote.NumChunks)
+	suite.Equal(1, quote.NumSectors)
+	suite.Equal("64", quote.StoragePeg.String())
+	suite.Equal("0.03125", quote.TotalCost.String())
+	suite.Equal("0.015625", quote.TreasureCost.String())
+	suite.Equal("0.015625", quote.StorageCost.String())
+}
+
+func (suite *ModelSuite) Test_GetQuote_Config() {
+	defer os.Unsetenv("STORAGE_PEG")
+	defer os.Unsetenv("PRICE_MARKUP_PERCENT")
+	defer os.Unsetenv("PRICE_MIN_FEE")
+
+	os.Setenv("STORAGE_PEG", "32")
+	os.Setenv("PRICE_MARKUP_PERCENT", "10")
+	quote := models.GetQuote(uint64(123), 2)
+	suite.Equal("32", quote.StoragePeg.String())
+	// the markup only applies to the share of the brokers
+	suite.Equal("0.03125", quote.TreasureCost.String())
+	suite.Equal("0.034375", quote.StorageCost.String())
+	suite.Equal("0.065625", quote.TotalCost.String())
+
+	os.Setenv("PRICE_MIN_FEE", "1")
+	quote = models.GetQuote(uint64(123), 2)
+	suite.Equal("0.03125", quote.TreasureCost.String())
+	suite.Equal("1", quote.StorageCost.String())
+	suite.Equal("1.03125", quote.TotalCost.String())
+
+	// an invalid peg falls back to StoragePeg
+	os.Setenv("STORAGE_PEG", "abc")
+	suite.True(models.StoragePeg.Equal(models.GetStoragePeg()))
+	suite.True(decimal.NewFromFloat(float64(64)).Equal(models.GetStoragePeg()))
+}
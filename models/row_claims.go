@@ -0,0 +1,89 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+/*RowClaimDuration is how long a broker replica keeps the rows it claimed.  The jobs move claimed rows to a
+pending status well before the claim expires, so other replicas do not pick them up again.*/
+const RowClaimDuration = 10 * time.Minute
+
+/*ClaimTreasures claims the treasures for owner and returns the ones owner holds a claim on.*/
+func ClaimTreasures(treasures []Treasure, owner string) ([]Treasure, error) {
+	claimed := []Treasure{}
+	if len(treasures) == 0 {
+		return claimed, nil
+	}
+
+	var ids []string
+	for _, treasure := range treasures {
+		ids = append(ids, treasure.ID.String())
+	}
+	if err := claimRows("treasures", ids, owner, RowClaimDuration); err != nil {
+		return claimed, err
+	}
+
+	query, args := getClaimedRowsQueryArgs(ids, owner)
+	err := DB.Where(query, args...).All(&claimed)
+	oyster_utils.LogIfError(err, nil)
+	return claimed, err
+}
+
+/*ClaimCompletedUploads claims the completed uploads for owner and returns the ones owner holds a claim on.*/
+func ClaimCompletedUploads(uploads []CompletedUpload, owner string) ([]CompletedUpload, error) {
+	claimed := []CompletedUpload{}
+	if len(uploads) == 0 {
+		return claimed, nil
+	}
+
+	var ids []string
+	for _, upload := range uploads {
+		ids = append(ids, upload.ID.String())
+	}
+	if err := claimRows("completed_uploads", ids, owner, RowClaimDuration); err != nil {
+		return claimed, err
+	}
+
+	query, args := getClaimedRowsQueryArgs(ids, owner)
+	err := DB.Where(query, args...).All(&claimed)
+	oyster_utils.LogIfError(err, nil)
+	return claimed, err
+}
+
+/*claimRows claims the rows of the table with the ids for owner until the claim expires, unless another owner
+holds an unexpired claim on them.  Callers then only process the rows which are claimed by owner.*/
+func claimRows(tableName string, ids []string, owner string, duration time.Duration) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	args := []interface{}{owner, int(duration.Seconds())}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	args = append(args, owner)
+
+	err := DB.RawQuery("UPDATE "+tableName+" SET claimed_by = ?, claimed_until = DATE_ADD(NOW(), INTERVAL ? SECOND) "+
+		"WHERE id IN ("+getPlaceholders(len(ids))+") "+
+		"AND (claimed_by IS NULL OR claimed_until IS NULL OR claimed_until < NOW() OR claimed_by = ?)",
+		args...).Exec()
+	oyster_utils.LogIfError(err, nil)
+	return err
+}
+
+/*getClaimedRowsQueryArgs returns the WHERE clause and its args to select the rows with the ids claimed by owner.*/
+func getClaimedRowsQueryArgs(ids []string, owner string) (string, []interface{}) {
+	var args []interface{}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	args = append(args, owner)
+	return "id IN (" + getPlaceholders(len(ids)) + ") AND claimed_by = ?", args
+}
+
+func getPlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,48 @@
+package models_test
+
+import (
+	"github.com/oysterprotocol/brokernode/models"
+)
+
+func (suite *ModelSuite) Test_ClaimTreasures() {
+	generateTreasuresToBuryOfEachStatus(suite, 2)
+
+	waitingForPRL, err := models.GetTreasuresToBuryByPRLStatus([]models.PRLStatus{models.PRLWaiting})
+	suite.Nil(err)
+	suite.Equal(2, len(waitingForPRL))
+
+	claimed, err := models.ClaimTreasures(waitingForPRL[0:1], "broker_a")
+	suite.Nil(err)
+	suite.Equal(1, len(claimed))
+	suite.Equal("broker_a", claimed[0].ClaimedBy.String)
+
+	// broker_b only gets the treasure broker_a has not claimed.
+	claimed, err = models.ClaimTreasures(waitingForPRL, "broker_b")
+	suite.Nil(err)
+	suite.Equal(1, len(claimed))
+	suite.Equal(waitingForPRL[1].ID, claimed[0].ID)
+
+	// broker_a can renew its own claim.
+	claimed, err = models.ClaimTreasures(waitingForPRL[0:1], "broker_a")
+	suite.Nil(err)
+	suite.Equal(1, len(claimed))
+}
+
+func (suite *ModelSuite) Test_ClaimCompletedUploads() {
+	upload := models.CompletedUpload{
+		GenesisHash:   "abcdef",
+		ETHAddr:       "0x5aeda56215b167893e80b4fe645ba6d5bab767de",
+		ETHPrivateKey: "abcdef",
+	}
+	vErr, err := suite.DB.ValidateAndCreate(&upload)
+	suite.Nil(err)
+	suite.False(vErr.HasAny())
+
+	claimed, err := models.ClaimCompletedUploads([]models.CompletedUpload{upload}, "broker_a")
+	suite.Nil(err)
+	suite.Equal(1, len(claimed))
+
+	claimed, err = models.ClaimCompletedUploads([]models.CompletedUpload{upload}, "broker_b")
+	suite.Nil(err)
+	suite.Equal(0, len(claimed))
+}
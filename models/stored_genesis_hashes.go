@@ -164,3 +164,23 @@ func SetToTreasureBuriedByGenesisHash(genesisHash string) error {
 		TreasureBuried, genesisHash).All(&[]StoredGenesisHash{})
 	return err
 }
+
+/*GetNumChunksOfGenesisHash returns the number of chunks of the file with the genesis hash, from its upload session
+or from stored_genesis_hashes.  It returns 0 if the broker does not know the file.*/
+func GetNumChunksOfGenesisHash(genesisHash string) (int, error) {
+	sessions := []UploadSession{}
+	err := DB.RawQuery("SELECT * FROM upload_sessions WHERE genesis_hash = ?", genesisHash).All(&sessions)
+	if err != nil {
+		return 0, err
+	}
+	if len(sessions) > 0 {
+		return sessions[0].NumChunks, nil
+	}
+
+	match := []StoredGenesisHash{}
+	err = DB.RawQuery("SELECT * FROM stored_genesis_hashes WHERE genesis_hash = ?", genesisHash).All(&match)
+	if err != nil || len(match) == 0 {
+		return 0, err
+	}
+	return match[0].NumChunks, nil
+}
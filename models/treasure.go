@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
 	"github.com/gobuffalo/uuid"
 	"github.com/gobuffalo/validate"
 	"github.com/oysterprotocol/brokernode/utils"
@@ -44,6 +45,9 @@ type Treasure struct {
 	SignedStatus    SignedStatus `json:"signedStatus" db:"signed_status"`
 	EncryptionIndex int64        `json:"encryptionIndex" db:"encryption_index"`
 	Idx             int64        `json:"Idx" db:"idx"`
+
+	ClaimedBy    nulls.String `json:"claimedBy" db:"claimed_by"`
+	ClaimedUntil nulls.Time   `json:"claimedUntil" db:"claimed_until"`
 }
 
 const (
@@ -80,6 +84,9 @@ const (
 	/*TreasureSignedAndAttachmentVerified is when the treasure has been attached and we have
 	verified it is on the tangle*/
 	TreasureSignedAndAttachmentVerified
+	/*TreasureAttachPending is when the treasure has been queued to be attached, e.g. by the lambdas.  It is
+	verified like an attached treasure.*/
+	TreasureAttachPending
 
 	/*TreasureSignError is when there was some error signing the treasure*/
 	TreasureSignError = -1
@@ -116,6 +123,7 @@ func init() {
 	SignedStatusMap[TreasureSigned] = "TreasureSigned"
 	SignedStatusMap[TreasureSignedAndAttached] = "TreasureSignedAndAttached"
 	SignedStatusMap[TreasureSignedAndAttachmentVerified] = "TreasureSignedAndAttachmentVerified"
+	SignedStatusMap[TreasureAttachPending] = "TreasureAttachPending"
 	SignedStatusMap[TreasureSignError] = "TreasureSignError"
 	SignedStatusMap[TreasureAttachError] = "TreasureAttachError"
 }
@@ -241,6 +249,55 @@ func GetTreasuresToBuryBySignedStatus(signedStatuses []SignedStatus) ([]Treasure
 	return treasureRowsToReturn, nil
 }
 
+/*GetTreasuresBySignedStatusAndUpdateTime gets the treasures that matched the signed statuses passed in and have
+not been updated since thresholdTime*/
+func GetTreasuresBySignedStatusAndUpdateTime(signedStatuses []SignedStatus, thresholdTime time.Time) ([]Treasure, error) {
+	treasureRowsToReturn := make([]Treasure, 0)
+	for _, status := range signedStatuses {
+		treasures := []Treasure{}
+		err := DB.RawQuery("SELECT * FROM treasures WHERE signed_status = ? AND updated_at <= ? LIMIT ?",
+			status,
+			thresholdTime,
+			maxNumSimultaneousTreasureTxs).All(&treasures)
+		if err != nil {
+			oyster_utils.LogIfError(err, nil)
+			return treasures, err
+		}
+		treasureRowsToReturn = append(treasureRowsToReturn, treasures...)
+	}
+	return treasureRowsToReturn, nil
+}
+
+/*GetAllTreasuresBySignedStatus gets every treasure with the signed status, for reporting*/
+func GetAllTreasuresBySignedStatus(signedStatus SignedStatus) ([]Treasure, error) {
+	treasures := []Treasure{}
+	err := DB.Where("signed_status = ?", signedStatus).Order("updated_at asc").All(&treasures)
+	oyster_utils.LogIfError(err, nil)
+	return treasures, err
+}
+
+/*GetTreasureCountsBySignedStatus returns the number of treasures of each signed status, keyed by the name of
+the status*/
+func GetTreasureCountsBySignedStatus() (map[string]int, error) {
+	type signedStatusCount struct {
+		SignedStatus SignedStatus `db:"signed_status"`
+		Count        int          `db:"count"`
+	}
+
+	counts := []signedStatusCount{}
+	err := DB.RawQuery("SELECT signed_status, COUNT(*) AS count FROM treasures GROUP BY signed_status").All(&counts)
+	if err != nil {
+		oyster_utils.LogIfError(err, nil)
+		return nil, err
+	}
+
+	countsByName := make(map[string]int)
+	for _, count := range counts {
+		countsByName[SignedStatusMap[count.SignedStatus]] = count.Count
+	}
+	return countsByName, nil
+}
+
 func GetAllTreasuresToBury() ([]Treasure, error) {
 	allTreasures := []Treasure{}
 	err := DB.RawQuery("SELECT * FROM treasures").All(&allTreasures)
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+/*UploadBatch records which chunks of a v3 chunk batch are stored in the blob store, so that the manifest of a
+session can be built without reading the batches.*/
+type UploadBatch struct {
+	GenesisHash string    `json:"genesisHash" db:"genesis_hash"`
+	BatchIdx    int       `json:"batchIdx" db:"batch_idx"`
+	NumReceived int       `json:"numReceived" db:"num_received"`
+	Received    string    `json:"received" db:"received"`
+	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt   time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+/*SetUploadBatchReceived records the sorted indexes of the chunks stored in the batch.  The chunks of a batch are
+only ever merged, so a record with fewer indexes, e.g. from a request which was overtaken by another broker
+replica, does not replace a record with more.*/
+func SetUploadBatchReceived(genesisHash string, batchIdx int, indexes []int) error {
+	received, err := json.Marshal(oyster_utils.IndexesToRanges(indexes))
+	if err != nil {
+		return err
+	}
+
+	// received is updated first, so that it compares against the num_received which is stored.
+	err = DB.RawQuery("INSERT INTO upload_batches (genesis_hash, batch_idx, num_received, received, created_at, "+
+		"updated_at) VALUES (?, ?, ?, ?, NOW(), NOW()) "+
+		"ON DUPLICATE KEY UPDATE "+
+		"received = IF(VALUES(num_received) > num_received, VALUES(received), received), "+
+		"num_received = GREATEST(VALUES(num_received), num_received), "+
+		"updated_at = NOW()",
+		genesisHash, batchIdx, len(indexes), string(received)).Exec()
+	oyster_utils.LogIfError(err, nil)
+	return err
+}
+
+/*GetUploadBatchReceivedIndexes returns the indexes of the chunks recorded for all the batches of the session.*/
+func GetUploadBatchReceivedIndexes(genesisHash string) ([]int, error) {
+	batches := []UploadBatch{}
+	if err := DB.RawQuery("SELECT * FROM upload_batches WHERE genesis_hash = ? ORDER BY batch_idx",
+		genesisHash).All(&batches); err != nil {
+		oyster_utils.LogIfError(err, nil)
+		return nil, err
+	}
+
+	var indexes []int
+	for _, batch := range batches {
+		var ranges []oyster_utils.IndexRange
+		if err := json.Unmarshal([]byte(batch.Received), &ranges); err != nil {
+			oyster_utils.LogIfError(err, nil)
+			return nil, err
+		}
+		for _, r := range ranges {
+			for idx := r.Start; idx <= r.End; idx++ {
+				indexes = append(indexes, idx)
+			}
+		}
+	}
+	return indexes, nil
+}
+
+/*DeleteUploadBatch removes the record of the batch, once its chunks have been moved into the chunk storage.*/
+func DeleteUploadBatch(genesisHash string, batchIdx int) error {
+	err := DB.RawQuery("DELETE FROM upload_batches WHERE genesis_hash = ? AND batch_idx = ?",
+		genesisHash, batchIdx).Exec()
+	oyster_utils.LogIfError(err, nil)
+	return err
+}
@@ -0,0 +1,28 @@
+package models_test
+
+import (
+	"github.com/oysterprotocol/brokernode/models"
+)
+
+func (suite *ModelSuite) Test_SetUploadBatchReceived() {
+	suite.Nil(models.SetUploadBatchReceived("abcdef", 0, []int{3, 4}))
+	suite.Nil(models.SetUploadBatchReceived("abcdef", 1, []int{25, 26, 27}))
+
+	indexes, err := models.GetUploadBatchReceivedIndexes("abcdef")
+	suite.Nil(err)
+	suite.Equal([]int{3, 4, 25, 26, 27}, indexes)
+
+	// the batch was merged by another request in between, so the record with fewer chunks is not set
+	suite.Nil(models.SetUploadBatchReceived("abcdef", 0, []int{2, 3, 4, 5}))
+	suite.Nil(models.SetUploadBatchReceived("abcdef", 0, []int{3, 4, 5}))
+
+	indexes, err = models.GetUploadBatchReceivedIndexes("abcdef")
+	suite.Nil(err)
+	suite.Equal([]int{2, 3, 4, 5, 25, 26, 27}, indexes)
+
+	suite.Nil(models.DeleteUploadBatch("abcdef", 0))
+
+	indexes, err = models.GetUploadBatchReceivedIndexes("abcdef")
+	suite.Nil(err)
+	suite.Equal([]int{25, 26, 27}, indexes)
+}
@@ -1,8 +1,10 @@
 package models
 
 import (
+	cryptorand "crypto/rand"
 	"crypto/sha256"
 	"crypto/sha512"
+	"crypto/subtle"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -21,6 +23,7 @@ import (
 	"github.com/gobuffalo/uuid"
 	"github.com/gobuffalo/validate"
 	"github.com/gobuffalo/validate/validators"
+	"github.com/iotaledger/iota.go/trinary"
 	"github.com/oysterprotocol/brokernode/utils"
 	"github.com/shopspring/decimal"
 )
@@ -29,11 +32,17 @@ import (
 type ChunkReq struct {
 	Idx  int    `json:"idx"`
 	Data string `json:"data"`
-	Hash string `json:"hash"` // This is GenesisHash.
+	Hash string `json:"hash"` // This is GenesisHash, or the hash of the chunk in the hash chain.
 }
 
 type ChunkReqs []ChunkReq
 
+/*ChunkReqError is the reason a chunk of an upload request was rejected.*/
+type ChunkReqError struct {
+	Idx   int    `json:"idx"`
+	Error string `json:"error"`
+}
+
 type Invoice struct {
 	Cost       decimal.Decimal `json:"cost"`
 	EthAddress nulls.String    `json:"ethAddress"`
@@ -60,6 +69,8 @@ type UploadSession struct {
 	ETHAddrBeta    nulls.String    `json:"ethAddrBeta" db:"eth_addr_beta"`
 	ETHPrivateKey  string          `db:"eth_private_key"`
 	TotalCost      decimal.Decimal `json:"totalCost" db:"total_cost"`
+	// TreasureCost is the part of TotalCost buried in the treasures of the file.
+	TreasureCost   decimal.Decimal `json:"treasureCost" db:"treasure_cost"`
 	PaymentStatus  int             `json:"paymentStatus" db:"payment_status"`
 	TreasureStatus int             `json:"treasureStatus" db:"treasure_status"`
 
@@ -74,6 +85,43 @@ type UploadSession struct {
 
 	StorageMethod int          `json:"storage_method" db:"storage_method"`
 	S3BucketName  nulls.String `json:"s3_bucket_name" db:"s3_bucket_name"`
+
+	// The beta session of an alpha session, which is told when the alpha session is canceled.
+	BetaIP        nulls.String `json:"betaIp" db:"beta_ip"`
+	BetaSessionID nulls.String `json:"betaSessionId" db:"beta_session_id"`
+
+	// The other broker of the session, and how far it got the last time it was asked.
+	PeerAddress         nulls.String `json:"peerAddress" db:"peer_address"`
+	PeerNextIdxToAttach nulls.Int64  `json:"peerNextIdxToAttach" db:"peer_next_idx_to_attach"`
+	PeerProgressAt      nulls.Time   `json:"peerProgressAt" db:"peer_progress_at"`
+	PeerStatus          int          `json:"peerStatus" db:"peer_status"`
+
+	// In N-broker mode, the range of chunks this broker attaches without checking the tangle first, and on the
+	// alpha session the other brokers of the upload.
+	RangeStartIdx nulls.Int64  `json:"rangeStartIdx" db:"range_start_idx"`
+	RangeEndIdx   nulls.Int64  `json:"rangeEndIdx" db:"range_end_idx"`
+	Peers         nulls.String `json:"peers" db:"peers"`
+
+	// The hash of the token the client who created an alpha session cancels it with.
+	CancelTokenHash nulls.String `json:"-" db:"cancel_token_hash"`
+}
+
+/*SessionPeer is one of the other brokers of an N-broker upload, as known to the alpha broker.*/
+type SessionPeer struct {
+	BrokerIP  string                  `json:"brokerIp"`
+	SessionID string                  `json:"sessionId"`
+	ETHAddr   string                  `json:"ethAddr"`
+	Range     oyster_utils.IndexRange `json:"range"`
+}
+
+/*SessionProgress is how far a broker got attaching a session, as told to the other broker of the session.*/
+type SessionProgress struct {
+	GenesisHash     string `json:"genesisHash"`
+	Type            int    `json:"type"`
+	NumChunks       int    `json:"numChunks"`
+	NextIdxToAttach int64  `json:"nextIdxToAttach"`
+	NextIdxToVerify int64  `json:"nextIdxToVerify"`
+	Finished        bool   `json:"finished"`
 }
 
 const (
@@ -96,6 +144,16 @@ const (
 	SessionTypeBeta
 )
 
+const (
+	/*PeerActive means the other broker of the session is still attaching its side of the file*/
+	PeerActive int = iota + 1
+	/*PeerFinished means the other broker of the session has attached its side of the file*/
+	PeerFinished
+	/*PeerTakenOver means the other broker of the session stalled, so this broker attaches the chunks the other
+	broker did not attach without checking the tangle for them first*/
+	PeerTakenOver
+)
+
 const (
 	PaymentStatusInvoiced int = iota + 1
 	PaymentStatusPending
@@ -131,6 +189,11 @@ const (
 	/*CompletedDataMapsTimeToLive will cause completed_data_maps
 	message data to be garbage collected after 3 weeks.*/
 	CompletedDataMapsTimeToLive = 21 * 24 * time.Hour
+	/*ChunkBatchSize is the max number of chunks in each batch object that a v3 upload stores in the blob store.
+	The batch holding chunk idx is stored under the key {genesisHash}/{idx / ChunkBatchSize}.*/
+	ChunkBatchSize = 25
+	/*MaxChunkDataLength is the max number of trytes of chunk data, which is the size of a transaction's message*/
+	MaxChunkDataLength = 2187
 )
 
 const (
@@ -147,7 +210,7 @@ var (
 	TreasurePayloadLength = len(TreasurePrefix) + 96
 	/*TreasureChunkPadding - the length of padding to add after the payload*/
 	TreasureChunkPadding = int(FileBytesChunkSize) - TreasurePayloadLength
-	/*StoragePeg is how much storage in GB that one PRL will pay for, for a year.
+	/*StoragePeg is how much storage in GB that one PRL will pay for, for a year, unless STORAGE_PEG is set.
 	Long-term we will query the smart contract for this value*/
 	StoragePeg = decimal.NewFromFloat(float64(64))
 )
@@ -280,6 +343,10 @@ func (u *UploadSession) BeforeCreate(tx *pop.Connection) error {
 		u.StorageMethod = StorageMethodBadger
 	}
 
+	if u.PeerStatus == 0 {
+		u.PeerStatus = PeerActive
+	}
+
 	switch oyster_utils.BrokerMode {
 	case oyster_utils.ProdMode:
 		// Defaults to paymentStatusPending
@@ -454,8 +521,8 @@ func (u *UploadSession) StartUploadSession() (vErr *validate.Errors, err error)
 		u.NextIdxToAttach = 0
 		u.NextIdxToVerify = 0
 	case SessionTypeBeta:
-		u.NextIdxToAttach = int64(u.NumChunks - 1)
-		u.NextIdxToVerify = int64(u.NumChunks - 1)
+		u.NextIdxToAttach = u.getFirstIdxToAttach()
+		u.NextIdxToVerify = u.getFirstIdxToAttach()
 	}
 	DB.ValidateAndUpdate(u)
 
@@ -497,18 +564,9 @@ func (u *UploadSession) GetInvoice() Invoice {
 }
 
 func (u *UploadSession) calculatePayment() {
-
-	// convert all variables to decimal format
-	storagePeg := GetStoragePeg()
-	fileSizeInBytes := decimal.NewFromFloat(float64(u.FileSizeBytes))
-	storageLength := decimal.NewFromFloat(float64(u.StorageLengthInYears))
-
-	// calculate total cost
-	fileSizeInKB := fileSizeInBytes.Div(decimal.NewFromFloat(float64(oyster_utils.FileChunkSizeInByte)))
-	numChunks := fileSizeInKB.Add(decimal.NewFromFloat(float64(1))).Ceil()
-	numSectors := numChunks.Div(decimal.NewFromFloat(float64(oyster_utils.FileSectorInChunkSize))).Ceil()
-	costPerYear := numSectors.Div(storagePeg)
-	u.TotalCost = costPerYear.Mul(storageLength)
+	quote := GetQuote(u.FileSizeBytes, u.StorageLengthInYears)
+	u.TotalCost = quote.TotalCost
+	u.TreasureCost = quote.TreasureCost
 }
 
 func (u *UploadSession) GetTreasureMap() ([]TreasureMap, error) {
@@ -523,6 +581,29 @@ func (u *UploadSession) GetTreasureMap() ([]TreasureMap, error) {
 	return treasureIndex, err
 }
 
+/*GetPeers returns the other brokers of an N-broker upload.*/
+func (u *UploadSession) GetPeers() ([]SessionPeer, error) {
+	var err error
+	peers := []SessionPeer{}
+	if u.Peers.Valid {
+		err = json.Unmarshal([]byte(u.Peers.String), &peers)
+		oyster_utils.LogIfError(err, nil)
+	}
+
+	return peers, err
+}
+
+/*SetPeers sets the other brokers of an N-broker upload.  The session is not saved.*/
+func (u *UploadSession) SetPeers(peers []SessionPeer) error {
+	peersString, err := json.Marshal(peers)
+	if err != nil {
+		oyster_utils.LogIfError(err, nil)
+		return err
+	}
+	u.Peers = nulls.NewString(string(peersString))
+	return nil
+}
+
 func (u *UploadSession) SetTreasureMap(treasureIndexMap []TreasureMap) error {
 	treasureString, err := json.Marshal(treasureIndexMap)
 	if err != nil {
@@ -599,12 +680,14 @@ func (u *UploadSession) GetPRLsPerTreasure() (*big.Float, error) {
 		return big.NewFloat(0), err
 	}
 
-	prlTotal := u.TotalCost.Rat()
-	numerator := prlTotal.Num()
-	denominator := prlTotal.Denom()
-
-	prlTotalFloat := new(big.Float).Quo(new(big.Float).SetInt(numerator), new(big.Float).SetInt(denominator))
-	prlTotalToBuryFloat := new(big.Float).Quo(prlTotalFloat, new(big.Float).SetInt(big.NewInt(int64(2))))
+	// sessions created before the treasure cost was stored bury half the total cost
+	prlTotalToBury := u.TreasureCost
+	if !prlTotalToBury.GreaterThan(decimal.Zero) {
+		prlTotalToBury = u.TotalCost.Div(decimal.NewFromFloat(float64(2)))
+	}
+	prlTotalToBuryRat := prlTotalToBury.Rat()
+	prlTotalToBuryFloat := new(big.Float).Quo(new(big.Float).SetInt(prlTotalToBuryRat.Num()),
+		new(big.Float).SetInt(prlTotalToBuryRat.Denom()))
 
 	totalChunks := oyster_utils.GetTotalFileChunkIncludingBuriedPearlsUsingNumChunks(u.NumChunks)
 	totalSectors := float64(math.Ceil(float64(totalChunks) / float64(oyster_utils.FileSectorInChunkSize)))
@@ -620,10 +703,6 @@ func (u *UploadSession) GetPRLsPerTreasure() (*big.Float, error) {
 	return prlPerSector, nil
 }
 
-func GetStoragePeg() decimal.Decimal {
-	return StoragePeg // TODO: write code to query smart contract to get real storage peg
-}
-
 func (u *UploadSession) GetPaymentStatus() string {
 	switch u.PaymentStatus {
 	case PaymentStatusInvoiced:
@@ -637,6 +716,57 @@ func (u *UploadSession) GetPaymentStatus() string {
 	}
 }
 
+/*GetProgressPercentage converts one of the session's chunk pointers (NextIdxToAttach or NextIdxToVerify)
+into the percentage of the file that has been processed.  Alpha sessions work upwards from index 0,
+beta sessions work downwards from the last index of their range.*/
+func (u *UploadSession) GetProgressPercentage(nextIdx int64) float64 {
+	if u.NumChunks <= 0 {
+		return 0
+	}
+
+	chunksDone := nextIdx
+	numChunksToDo := int64(u.NumChunks)
+	if u.Type == SessionTypeBeta {
+		chunksDone = u.getFirstIdxToAttach() - nextIdx
+		numChunksToDo = u.getFirstIdxToAttach() - u.GetStopIdx()
+	}
+	percentage := float64(chunksDone) * 100 / float64(numChunksToDo)
+	return math.Max(0, math.Min(100, percentage))
+}
+
+/*getFirstIdxToAttach returns the index the session starts attaching from.  A beta session of an N-broker upload
+starts from the end of its range, since the brokers after it attach the chunks above its range.*/
+func (u *UploadSession) getFirstIdxToAttach() int64 {
+	if u.Type != SessionTypeBeta {
+		return 0
+	}
+	if u.RangeEndIdx.Valid {
+		return u.RangeEndIdx.Int64
+	}
+	return int64(u.NumChunks - 1)
+}
+
+/*GetStopIdx returns the index the chunk pointers of the session reach once it has attached all of its chunks.  A beta
+session of an N-broker upload stops at the start of its range, since the brokers before it attach the chunks below
+its range.  If it took over from the alpha broker, it attaches those chunks as well.*/
+func (u *UploadSession) GetStopIdx() int64 {
+	if u.Type != SessionTypeBeta {
+		return int64(u.NumChunks)
+	}
+	if u.RangeStartIdx.Valid && u.PeerStatus != PeerTakenOver {
+		return u.RangeStartIdx.Int64 - 1
+	}
+	return -1
+}
+
+/*GetNumChunksToAttach returns how many chunks of the session have not been sent to the tangle yet.*/
+func (u *UploadSession) GetNumChunksToAttach() int {
+	if u.Type == SessionTypeBeta {
+		return int(math.Max(0, float64(u.NextIdxToAttach-u.GetStopIdx())))
+	}
+	return int(math.Max(0, float64(int64(u.NumChunks)-u.NextIdxToAttach)))
+}
+
 func (u *UploadSession) EncryptSessionEthKey() (string, error) {
 	var err error
 
@@ -827,6 +957,235 @@ func checkIfAllMessagesAreReadyInSQL(treasureIndexes []int, u *UploadSession) bo
 	return allMessagesFound
 }
 
+/*GetNumChunksFromClient returns the number of chunks the client will upload, which excludes the treasure chunks
+that StartUploadSession added to NumChunks.*/
+func (u *UploadSession) GetNumChunksFromClient() int {
+	if u.StorageMethod == StorageMethodS3 || oyster_utils.BrokerMode == oyster_utils.TestModeNoTreasure {
+		return u.NumChunks
+	}
+	return oyster_utils.GetNumChunksExcludingBuriedPearls(u.NumChunks)
+}
+
+/*GetReceivedChunkIndexes returns, in ascending order, the indexes (as numbered by the client) of the chunks whose
+data has already been stored for this session.  Treasure chunks are not included.*/
+func (u *UploadSession) GetReceivedChunkIndexes() ([]int, error) {
+	treasureIndexes, err := u.GetTreasureIndexes()
+	if err != nil {
+		return nil, err
+	}
+
+	var storedIndexes map[int64]bool
+	if oyster_utils.DataMapStorageMode == oyster_utils.DataMapsInBadger {
+		storedIndexes, err = getStoredChunkIndexesInBadger(u)
+	} else {
+		storedIndexes, err = getStoredChunkIndexesInSQL(u)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	receivedIndexes := []int{}
+	for i := 0; i < u.GetNumChunksFromClient(); i++ {
+		storedIdx := i
+		if oyster_utils.BrokerMode != oyster_utils.TestModeNoTreasure {
+			storedIdx = oyster_utils.TransformIndexWithBuriedIndexes(i, treasureIndexes)
+		}
+		if storedIndexes[int64(storedIdx)] {
+			receivedIndexes = append(receivedIndexes, i)
+		}
+	}
+	return receivedIndexes, nil
+}
+
+func getStoredChunkIndexesInBadger(u *UploadSession) (map[int64]bool, error) {
+	storedIndexes := make(map[int64]bool)
+
+	keys, err := oyster_utils.GetAllKeysFromUniqueDB([]string{oyster_utils.InProgressDir, u.GenesisHash,
+		oyster_utils.MessageDir})
+	if err != nil {
+		return storedIndexes, err
+	}
+
+	for _, key := range keys {
+		storedIndexes[oyster_utils.GetChunkIdxFromKey(key)] = true
+	}
+	return storedIndexes, nil
+}
+
+func getStoredChunkIndexesInSQL(u *UploadSession) (map[int64]bool, error) {
+	storedIndexes := make(map[int64]bool)
+
+	dataMaps := []DataMap{}
+	err := DB.RawQuery("SELECT * FROM data_maps WHERE genesis_hash = ?", u.GenesisHash).All(&dataMaps)
+	if err != nil {
+		oyster_utils.LogIfError(err, nil)
+		return storedIndexes, err
+	}
+
+	var keys oyster_utils.KVKeys
+	msgIDToChunkIdx := make(map[string]int)
+	for _, dataMap := range dataMaps {
+		keys = append(keys, dataMap.MsgID)
+		msgIDToChunkIdx[dataMap.MsgID] = dataMap.ChunkIdx
+	}
+
+	values, err := oyster_utils.BatchGet(&keys)
+	if err != nil {
+		return storedIndexes, err
+	}
+	for key := range *values {
+		storedIndexes[int64(msgIDToChunkIdx[key])] = true
+	}
+	return storedIndexes, nil
+}
+
+/*ValidateChunkReqs checks the chunks of an upload request before they are stored.  A chunk is rejected if its
+index is not one of the session's chunks, if its hash is neither the session's genesis hash nor the hash of its
+index in the hash chain derived from the genesis hash, or if that hash is not built yet, if its data is not trytes that fit in a transaction, or if
+its data conflicts with another chunk of the request or with the data already stored for that index.  Returns one
+ChunkReqError per rejected chunk.*/
+func (u *UploadSession) ValidateChunkReqs(chunks []ChunkReq) []ChunkReqError {
+	chunkErrors := []ChunkReqError{}
+
+	treasureIndexes, err := u.GetTreasureIndexes()
+	if err != nil {
+		return append(chunkErrors, ChunkReqError{Idx: -1, Error: "Unable to read the treasure indexes of the session"})
+	}
+
+	numChunks := u.GetNumChunksFromClient()
+	chainHashes, err := u.getChainHashesOfChunks(chunks, numChunks, treasureIndexes)
+	if err != nil {
+		return append(chunkErrors, ChunkReqError{Idx: -1, Error: "Unable to read the hash chain of the session"})
+	}
+	dataByIdx := make(map[int]string)
+	var keys oyster_utils.KVKeys
+	for _, chunk := range chunks {
+		if chunk.Idx < 0 || chunk.Idx >= numChunks {
+			chunkErrors = append(chunkErrors, ChunkReqError{Idx: chunk.Idx,
+				Error: fmt.Sprintf("Index is out of the range [0, %v)", numChunks)})
+			continue
+		}
+		if chainHash, ok := chainHashes[chunk.Idx]; chunk.Hash != u.GenesisHash && !ok {
+			chunkErrors = append(chunkErrors, ChunkReqError{Idx: chunk.Idx,
+				Error: "The hash chain of the session is not built yet, send the genesis hash or retry later"})
+			continue
+		} else if chunk.Hash != u.GenesisHash && !strings.EqualFold(chunk.Hash, chainHash) {
+			chunkErrors = append(chunkErrors, ChunkReqError{Idx: chunk.Idx,
+				Error: "Hash does not match the hash chain of the session"})
+			continue
+		}
+		if _, err := trinary.NewTrytes(chunk.Data); err != nil || len(chunk.Data) > MaxChunkDataLength {
+			chunkErrors = append(chunkErrors, ChunkReqError{Idx: chunk.Idx,
+				Error: fmt.Sprintf("Data must be at most %v valid trytes", MaxChunkDataLength)})
+			continue
+		}
+		if data, ok := dataByIdx[chunk.Idx]; ok {
+			if data != chunk.Data {
+				chunkErrors = append(chunkErrors, ChunkReqError{Idx: chunk.Idx,
+					Error: "Duplicate index with conflicting data"})
+			}
+			continue
+		}
+		dataByIdx[chunk.Idx] = chunk.Data
+		keys = append(keys, getChunkMessageKey(u.GenesisHash, chunk.Idx, treasureIndexes))
+	}
+
+	if len(keys) == 0 {
+		return chunkErrors
+	}
+
+	var storedData *oyster_utils.KVPairs
+	if oyster_utils.DataMapStorageMode == oyster_utils.DataMapsInBadger {
+		storedData, err = oyster_utils.BatchGetFromUniqueDB([]string{oyster_utils.InProgressDir, u.GenesisHash,
+			oyster_utils.MessageDir}, &keys)
+	} else {
+		storedData, err = oyster_utils.BatchGet(&keys)
+	}
+	if err != nil {
+		// Not able to compare with the stored data, the chunks will be overwritten.
+		return chunkErrors
+	}
+
+	for idx, data := range dataByIdx {
+		storedValue, ok := (*storedData)[getChunkMessageKey(u.GenesisHash, idx, treasureIndexes)]
+		if ok && storedValue != data {
+			chunkErrors = append(chunkErrors, ChunkReqError{Idx: idx,
+				Error: "Conflicts with the data already uploaded for this index"})
+		}
+	}
+	return chunkErrors
+}
+
+/*getChainHashesOfChunks returns the hash in the hash chain of each chunk which is not sent with the genesis hash,
+by index.  The hashes are read from the data maps built by BuildDataMapsForSession, a chunk whose hash is not built
+yet is left out.*/
+func (u *UploadSession) getChainHashesOfChunks(chunks []ChunkReq, numChunks int,
+	treasureIndexes []int) (map[int]string, error) {
+	chainHashes := make(map[int]string)
+
+	chainIdxs := make(map[int]int)
+	for _, chunk := range chunks {
+		if chunk.Hash == u.GenesisHash || chunk.Idx < 0 || chunk.Idx >= numChunks {
+			continue
+		}
+		chainIdx := chunk.Idx
+		if oyster_utils.BrokerMode != oyster_utils.TestModeNoTreasure {
+			chainIdx = oyster_utils.TransformIndexWithBuriedIndexes(chunk.Idx, treasureIndexes)
+		}
+		chainIdxs[chainIdx] = chunk.Idx
+	}
+	if len(chainIdxs) == 0 {
+		return chainHashes, nil
+	}
+
+	if oyster_utils.DataMapStorageMode == oyster_utils.DataMapsInBadger {
+		var keys oyster_utils.KVKeys
+		for chainIdx := range chainIdxs {
+			keys = append(keys, oyster_utils.GetBadgerKey([]string{u.GenesisHash, strconv.Itoa(chainIdx)}))
+		}
+		hashes, err := oyster_utils.BatchGetFromUniqueDB([]string{oyster_utils.InProgressDir, u.GenesisHash,
+			oyster_utils.HashDir}, &keys)
+		if err != nil {
+			return chainHashes, err
+		}
+		for chainIdx, idx := range chainIdxs {
+			if hash, ok := (*hashes)[oyster_utils.GetBadgerKey([]string{u.GenesisHash, strconv.Itoa(chainIdx)})]; ok {
+				chainHashes[idx] = hash
+			}
+		}
+		return chainHashes, nil
+	}
+
+	args := []interface{}{u.GenesisHash}
+	var placeholders []string
+	for chainIdx := range chainIdxs {
+		args = append(args, chainIdx)
+		placeholders = append(placeholders, "?")
+	}
+	dataMaps := []DataMap{}
+	err := DB.RawQuery("SELECT * FROM data_maps WHERE genesis_hash = ? AND chunk_idx IN ("+
+		strings.Join(placeholders, ", ")+")", args...).All(&dataMaps)
+	if err != nil {
+		oyster_utils.LogIfError(err, nil)
+		return chainHashes, err
+	}
+	for _, dataMap := range dataMaps {
+		if idx, ok := chainIdxs[dataMap.ChunkIdx]; ok {
+			chainHashes[idx] = dataMap.Hash
+		}
+	}
+	return chainHashes, nil
+}
+
+/*getChunkMessageKey returns the key the message of the client's chunk idx is stored under.  It matches the keys
+created by ProcessAndStoreChunkData.*/
+func getChunkMessageKey(genesisHash string, idx int, treasureIndexes []int) string {
+	if oyster_utils.BrokerMode != oyster_utils.TestModeNoTreasure {
+		idx = oyster_utils.TransformIndexWithBuriedIndexes(idx, treasureIndexes)
+	}
+	return oyster_utils.GetBadgerKey([]string{genesisHash, strconv.Itoa(idx)})
+}
+
 /*GetUnassignedChunksBySession returns the chunk data for chunks that need attaching for a particular session*/
 func (u *UploadSession) GetUnassignedChunksBySession(offset int) (chunkData []oyster_utils.ChunkData, err error) {
 	var stopChunkIdx int64
@@ -838,8 +1197,8 @@ func (u *UploadSession) GetUnassignedChunksBySession(offset int) (chunkData []oy
 		}
 	} else {
 		stopChunkIdx = u.NextIdxToAttach - int64(offset)
-		if stopChunkIdx < 0 {
-			stopChunkIdx = int64(0)
+		if stopChunkIdx <= u.GetStopIdx() {
+			stopChunkIdx = u.GetStopIdx() + 1
 		}
 	}
 
@@ -1308,6 +1667,22 @@ func GetSessionsWithIncompleteData() ([]UploadSession, error) {
 	return sessions, nil
 }
 
+/*GetSessionsWithDataInBlobStore gets all the v3 sessions whose chunk batches have not all been
+moved from the blob store into the chunk storage yet.*/
+func GetSessionsWithDataInBlobStore() ([]UploadSession, error) {
+	sessions := []UploadSession{}
+
+	err := DB.RawQuery("SELECT * FROM upload_sessions WHERE storage_method = ? AND all_data_ready = ?",
+		StorageMethodS3, AllDataNotReady).All(&sessions)
+
+	if err != nil {
+		oyster_utils.LogIfError(err, nil)
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
 /*GetSessionsByOldestUpdate gets all the sessions eligible for chunk attachment, from oldest update time to newest.*/
 func GetSessionsByOldestUpdate() ([]UploadSession, error) {
 	sessionsByAge := []UploadSession{}
@@ -1332,7 +1707,7 @@ func GetReadySessions() ([]UploadSession, error) {
 	sessions, err := GetSessionsByOldestUpdate()
 
 	for _, session := range sessions {
-		if session.Type == SessionTypeBeta && session.NextIdxToAttach != -1 {
+		if session.Type == SessionTypeBeta && session.NextIdxToAttach != session.GetStopIdx() {
 			readySessions = append(readySessions, session)
 		} else if session.Type == SessionTypeAlpha && session.NextIdxToAttach < int64(session.NumChunks) {
 			readySessions = append(readySessions, session)
@@ -1361,7 +1736,7 @@ func GetVerifiableSessions(thresholdTime time.Time) ([]UploadSession, error) {
 
 	for _, session := range sessions {
 		if session.Type == SessionTypeBeta &&
-			session.NextIdxToAttach == -1 &&
+			session.NextIdxToAttach == session.GetStopIdx() &&
 			session.NextIdxToVerify != session.NextIdxToAttach {
 			verifiableSessions = append(verifiableSessions, session)
 		} else if session.Type == SessionTypeAlpha &&
@@ -1374,6 +1749,49 @@ func GetVerifiableSessions(thresholdTime time.Time) ([]UploadSession, error) {
 	return verifiableSessions, err
 }
 
+/*GetSessionsToReconcile gets the ready sessions whose other broker is still expected to attach its side of the
+file.*/
+func GetSessionsToReconcile() ([]UploadSession, error) {
+	sessionsToReconcile := []UploadSession{}
+
+	sessions, err := GetReadySessions()
+	for _, session := range sessions {
+		if session.PeerAddress.Valid && session.PeerStatus == PeerActive {
+			sessionsToReconcile = append(sessionsToReconcile, session)
+		}
+	}
+
+	return sessionsToReconcile, err
+}
+
+/*GetProgress returns how far this broker got attaching the session.  The session is finished once all of its chunks
+are verified, the same as in GetCompletedSessions.*/
+func (u *UploadSession) GetProgress() SessionProgress {
+	finished := u.NextIdxToVerify >= int64(u.NumChunks)
+	if u.Type == SessionTypeBeta {
+		finished = u.NextIdxToVerify == u.GetStopIdx()
+	}
+
+	return SessionProgress{
+		GenesisHash:     u.GenesisHash,
+		Type:            u.Type,
+		NumChunks:       u.NumChunks,
+		NextIdxToAttach: u.NextIdxToAttach,
+		NextIdxToVerify: u.NextIdxToVerify,
+		Finished:        finished,
+	}
+}
+
+/*UpdatePeerProgress saves the peer columns of the session.  Only those columns are written, since the attachment
+jobs update the indexes of the session at the same time.*/
+func (u *UploadSession) UpdatePeerProgress() error {
+	err := DB.RawQuery("UPDATE upload_sessions SET peer_next_idx_to_attach = ?, peer_progress_at = ?, "+
+		"peer_status = ? WHERE id = ?",
+		u.PeerNextIdxToAttach, u.PeerProgressAt, u.PeerStatus, u.ID).All(&[]UploadSession{})
+	oyster_utils.LogIfError(err, nil)
+	return err
+}
+
 /*GetCompletedSessions gets all the sessions whose index values suggest that they are completed.*/
 func GetCompletedSessions() ([]UploadSession, error) {
 	completedSessions := []UploadSession{}
@@ -1385,11 +1803,7 @@ func GetCompletedSessions() ([]UploadSession, error) {
 	}
 
 	for _, session := range sessions {
-		stop := session.NumChunks
-		if session.Type == SessionTypeBeta {
-			stop = -1
-		}
-		if session.NextIdxToVerify == int64(stop) {
+		if session.NextIdxToVerify == session.GetStopIdx() {
 			completedSessions = append(completedSessions, session)
 		}
 	}
@@ -1424,6 +1838,106 @@ func SetBrokerTransactionToPaid(session UploadSession) error {
 	return err
 }
 
+/*NewCancelToken returns a new random token which cancels the session, and keeps only its hash.  The session has
+to be saved afterwards.*/
+func (u *UploadSession) NewCancelToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := cryptorand.Read(token); err != nil {
+		return "", err
+	}
+	tokenHex := hex.EncodeToString(token)
+	u.CancelTokenHash = nulls.NewString(hashCancelToken(tokenHex))
+	return tokenHex, nil
+}
+
+/*IsCancelToken returns whether token is the one which cancels the session.*/
+func (u *UploadSession) IsCancelToken(token string) bool {
+	if !u.CancelTokenHash.Valid || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashCancelToken(token)), []byte(u.CancelTokenHash.String)) == 1
+}
+
+func hashCancelToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+/*DeleteUploadSession deletes an unpaid session along with its chunk data, treasures and pending broker transaction.
+In badger mode the files of its chunk data are removed.  Chunk batches still in the blob store are not deleted, only
+the records of their received chunks.*/
+func DeleteUploadSession(session UploadSession) error {
+	var err error
+	if oyster_utils.DataMapStorageMode == oyster_utils.DataMapsInBadger {
+		err = deleteDataMapsFromBadger(session)
+	} else {
+		err = deleteDataMapsFromSQL(session)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = DB.Transaction(func(tx *pop.Connection) error {
+		if err := tx.RawQuery("DELETE FROM treasures WHERE genesis_hash = ?",
+			session.GenesisHash).All(&[]Treasure{}); err != nil {
+			return err
+		}
+		if err := tx.RawQuery("DELETE FROM broker_broker_transactions WHERE genesis_hash = ? AND payment_status = ?",
+			session.GenesisHash, BrokerTxAlphaPaymentPending).All(&[]BrokerBrokerTransaction{}); err != nil {
+			return err
+		}
+		if err := tx.RawQuery("DELETE FROM upload_batches WHERE genesis_hash = ?", session.GenesisHash).Exec(); err != nil {
+			return err
+		}
+		return tx.RawQuery("DELETE FROM upload_sessions WHERE id = ?", session.ID).All(&[]UploadSession{})
+	})
+	oyster_utils.LogIfError(err, nil)
+	return err
+}
+
+/*deleteDataMapsFromBadger removes the message and hash DBs of the session, along with their files.*/
+func deleteDataMapsFromBadger(session UploadSession) error {
+	for _, dir := range []string{oyster_utils.MessageDir, oyster_utils.HashDir} {
+		dbID := []string{oyster_utils.InProgressDir, session.GenesisHash, dir}
+		dbName := oyster_utils.GetBadgerDBName(dbID)
+
+		// a DB is only removed while it is open, e.g. after a restart it has to be opened first
+		if db := oyster_utils.GetOrInitUniqueBadgerDB(dbID); db == nil {
+			err := errors.New("error opening " + dbName + " in DeleteUploadSession")
+			oyster_utils.LogIfError(err, nil)
+			return err
+		}
+		if err := oyster_utils.RemoveAllUniqueKvStoreData(dbName); err != nil {
+			oyster_utils.LogIfError(errors.New(err.Error()+" deleting data from "+dbName+" in DeleteUploadSession"),
+				nil)
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteDataMapsFromSQL(session UploadSession) error {
+	dataMaps := []DataMap{}
+	err := DB.Transaction(func(tx *pop.Connection) error {
+		err := tx.RawQuery("DELETE FROM data_maps WHERE genesis_hash = ?", session.GenesisHash).All(&dataMaps)
+		return err
+	})
+	if err == nil {
+		var keys oyster_utils.KVKeys
+		for _, dm := range dataMaps {
+			keys = append(keys, dm.MsgID)
+		}
+		err := oyster_utils.BatchDelete(&keys)
+		if err != nil {
+			oyster_utils.LogIfError(err, nil)
+			return err
+		}
+	} else {
+		oyster_utils.LogIfError(errors.New(err.Error()+" in transaction in DeleteUploadSession"), nil)
+	}
+	return err
+}
+
 /*CreateTreasurePayload makes a payload for a treasure chunk by encrypting an ethereum private key using a sidechain
 hash as the key.*/
 func CreateTreasurePayload(ethereumSeed string, sha256Hash string, maxSideChainLength int) (string, error) {
@@ -1483,7 +1997,7 @@ func GetChunkForWebnodePoW() (oyster_utils.ChunkData, error) {
 				break
 			}
 		} else {
-			if sessions[i].NextIdxToAttach != int64(0) {
+			if sessions[i].NextIdxToAttach != sessions[i].GetStopIdx()+1 {
 				chunkData = GetSingleChunkData(oyster_utils.InProgressDir,
 					sessions[i].GenesisHash,
 					sessions[i].NextIdxToAttach)
@@ -1500,12 +2014,11 @@ func GetChunkForWebnodePoW() (oyster_utils.ChunkData, error) {
 }
 
 /*ProcessAndStoreChunkData receives the genesis hash, chunk idx, and message from the client
-and adds it to the badger database*/
-func ProcessAndStoreChunkData(chunks []ChunkReq, genesisHash string, treasureIdxMap []int, ttl time.Duration) {
+and adds it to the badger database.  Returns an error if the chunks were not stored.*/
+func ProcessAndStoreChunkData(chunks []ChunkReq, genesisHash string, treasureIdxMap []int, ttl time.Duration) error {
 
 	if oyster_utils.DataMapStorageMode == oyster_utils.DataMapsInSQL {
-		ProcessAndStoreChunkDataInSQL(chunks, genesisHash, treasureIdxMap)
-		return
+		return ProcessAndStoreChunkDataInSQL(chunks, genesisHash, treasureIdxMap)
 	}
 
 	// the keys in this chunks map have already transformed indexes
@@ -1515,7 +2028,9 @@ func ProcessAndStoreChunkData(chunks []ChunkReq, genesisHash string, treasureIdx
 
 	db := oyster_utils.GetOrInitUniqueBadgerDB(dbID)
 	if db == nil {
-		return
+		err := errors.New("error creating unique badger DB for messages")
+		oyster_utils.LogIfError(err, nil)
+		return err
 	}
 
 	batchSetKvMap := oyster_utils.KVPairs{} // Store chunk.Data into KVStore
@@ -1525,9 +2040,7 @@ func ProcessAndStoreChunkData(chunks []ChunkReq, genesisHash string, treasureIdx
 
 	err := oyster_utils.BatchSetToUniqueDB(dbID, &batchSetKvMap, ttl)
 	oyster_utils.LogIfError(err, nil)
-	if err != nil {
-		panic(err)
-	}
+	return err
 }
 
 // convertToBadgerKeyedMapForChunks converts chunkReq into maps where the key is the badger msg_id.
@@ -1550,7 +2063,7 @@ func convertToBadgerKeyedMapForChunks(chunks []ChunkReq, genesisHash string, tre
 }
 
 /*ProcessAndStoreChunkDataInSQL receives chunk data from the client and stores the data in data_maps rows.*/
-func ProcessAndStoreChunkDataInSQL(chunks []ChunkReq, genesisHash string, treasureIdxMap []int) {
+func ProcessAndStoreChunkDataInSQL(chunks []ChunkReq, genesisHash string, treasureIdxMap []int) error {
 	// the keys in this chunks map have already transformed indexes
 	chunksMap := convertToBadgerKeyedMapForChunks(chunks, genesisHash, treasureIdxMap)
 
@@ -1560,7 +2073,9 @@ func ProcessAndStoreChunkDataInSQL(chunks []ChunkReq, genesisHash string, treasu
 		batchSetKvMap[key] = chunk.Data
 	}
 
-	oyster_utils.BatchSet(&batchSetKvMap, DataMapsTimeToLive)
+	err := oyster_utils.BatchSet(&batchSetKvMap, DataMapsTimeToLive)
+	oyster_utils.LogIfError(err, nil)
+	return err
 }
 
 /*GetSingleChunkData gets data about a single chunk.*/
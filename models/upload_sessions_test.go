@@ -6,8 +6,10 @@ import (
 	"encoding/hex"
 	"fmt"
 	"math/big"
+	"os"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gobuffalo/pop/nulls"
@@ -472,6 +474,220 @@ func (suite *ModelSuite) Test_WaitForAllChunks() {
 	suite.Nil(err)
 }
 
+func (suite *ModelSuite) Test_GetReceivedChunkIndexes() {
+	u := models.UploadSession{
+		Type:          models.SessionTypeAlpha,
+		GenesisHash:   oyster_utils.RandSeq(6, []rune("abcdef0123456789")),
+		NumChunks:     10,
+		FileSizeBytes: 9000,
+	}
+
+	vErr, err := u.StartUploadSession()
+	suite.Nil(err)
+	suite.False(vErr.HasAny())
+	suite.Equal(11, u.NumChunks)
+	suite.Equal(10, u.GetNumChunksFromClient())
+
+	mergedIndexes := []int{5}
+	u.MakeTreasureIdxMap(mergedIndexes, []string{"0000000001"})
+
+	chunkReqs := GenerateChunkRequests(10, u.GenesisHash)
+	chunkReqs = append(chunkReqs[:3], chunkReqs[5:]...)
+	models.ProcessAndStoreChunkData(chunkReqs, u.GenesisHash, mergedIndexes, oyster_utils.TestValueTimeToLive)
+
+	receivedIndexes, err := u.GetReceivedChunkIndexes()
+	suite.Nil(err)
+	suite.Equal([]int{0, 1, 2, 5, 6, 7, 8, 9}, receivedIndexes)
+}
+
+func (suite *ModelSuite) Test_GetProgressPercentage() {
+	alpha := models.UploadSession{Type: models.SessionTypeAlpha, NumChunks: 200}
+	suite.Equal(float64(0), alpha.GetProgressPercentage(0))
+	suite.Equal(float64(50), alpha.GetProgressPercentage(100))
+	suite.Equal(float64(100), alpha.GetProgressPercentage(200))
+
+	beta := models.UploadSession{Type: models.SessionTypeBeta, NumChunks: 200}
+	suite.Equal(float64(0), beta.GetProgressPercentage(199))
+	suite.Equal(float64(50), beta.GetProgressPercentage(99))
+	suite.Equal(float64(100), beta.GetProgressPercentage(-1))
+
+	// a beta session of an N-broker upload works through its range only
+	beta.RangeStartIdx = nulls.NewInt64(100)
+	beta.RangeEndIdx = nulls.NewInt64(149)
+	suite.Equal(float64(0), beta.GetProgressPercentage(149))
+	suite.Equal(float64(50), beta.GetProgressPercentage(124))
+	suite.Equal(float64(100), beta.GetProgressPercentage(99))
+}
+
+func (suite *ModelSuite) Test_GetStopIdx() {
+	alpha := models.UploadSession{Type: models.SessionTypeAlpha, NumChunks: 200}
+	suite.Equal(int64(200), alpha.GetStopIdx())
+
+	beta := models.UploadSession{Type: models.SessionTypeBeta, NumChunks: 200}
+	suite.Equal(int64(-1), beta.GetStopIdx())
+
+	beta.RangeStartIdx = nulls.NewInt64(100)
+	beta.RangeEndIdx = nulls.NewInt64(149)
+	beta.NextIdxToAttach = 105
+	suite.Equal(int64(99), beta.GetStopIdx())
+	suite.Equal(6, beta.GetNumChunksToAttach())
+
+	// after taking over from the alpha broker, the beta broker attaches the chunks below its range as well
+	beta.PeerStatus = models.PeerTakenOver
+	suite.Equal(int64(-1), beta.GetStopIdx())
+}
+
+func (suite *ModelSuite) Test_GetUnassignedChunksBySession_BetaRange() {
+	uploadSession := models.UploadSession{
+		GenesisHash:   oyster_utils.RandSeq(6, []rune("abcdef0123456789")),
+		NumChunks:     30,
+		FileSizeBytes: 3000,
+		Type:          models.SessionTypeBeta,
+		RangeStartIdx: nulls.NewInt64(10),
+		RangeEndIdx:   nulls.NewInt64(19),
+	}
+	SessionSetUpForTest(&uploadSession, []int{}, uploadSession.NumChunks)
+	uploadSession.NextIdxToAttach = 12
+
+	chunks, err := uploadSession.GetUnassignedChunksBySession(10)
+	suite.Nil(err)
+	suite.Equal(3, len(chunks))
+	for _, chunk := range chunks {
+		suite.True(chunk.Idx >= 10 && chunk.Idx <= 12)
+	}
+}
+
+func (suite *ModelSuite) Test_GetProgress() {
+	// attached but not verified yet
+	alpha := models.UploadSession{Type: models.SessionTypeAlpha, NumChunks: 200, NextIdxToAttach: 200,
+		NextIdxToVerify: 150}
+	suite.False(alpha.GetProgress().Finished)
+	alpha.NextIdxToVerify = 200
+	suite.True(alpha.GetProgress().Finished)
+
+	beta := models.UploadSession{Type: models.SessionTypeBeta, NumChunks: 200, NextIdxToAttach: -1,
+		NextIdxToVerify: 49}
+	suite.False(beta.GetProgress().Finished)
+	beta.NextIdxToVerify = -1
+	suite.True(beta.GetProgress().Finished)
+}
+
+func (suite *ModelSuite) Test_SetPeers() {
+	u := models.UploadSession{Type: models.SessionTypeAlpha, NumChunks: 200}
+	suite.Nil(u.SetPeers([]models.SessionPeer{
+		{BrokerIP: "http://1.1.1.1", SessionID: "peer1", ETHAddr: "0x1", Range: oyster_utils.IndexRange{Start: 100, End: 149}},
+		{BrokerIP: "http://2.2.2.2", SessionID: "peer2", ETHAddr: "0x2", Range: oyster_utils.IndexRange{Start: 150, End: 199}},
+	}))
+
+	peers, err := u.GetPeers()
+	suite.Nil(err)
+	suite.Equal(2, len(peers))
+	suite.Equal("peer2", peers[1].SessionID)
+	suite.Equal(oyster_utils.IndexRange{Start: 150, End: 199}, peers[1].Range)
+}
+
+func (suite *ModelSuite) Test_GetNumChunksToAttach() {
+	alpha := models.UploadSession{Type: models.SessionTypeAlpha, NumChunks: 200, NextIdxToAttach: 50}
+	suite.Equal(150, alpha.GetNumChunksToAttach())
+	alpha.NextIdxToAttach = 200
+	suite.Equal(0, alpha.GetNumChunksToAttach())
+
+	beta := models.UploadSession{Type: models.SessionTypeBeta, NumChunks: 200, NextIdxToAttach: 199}
+	suite.Equal(200, beta.GetNumChunksToAttach())
+	beta.NextIdxToAttach = -1
+	suite.Equal(0, beta.GetNumChunksToAttach())
+}
+
+func (suite *ModelSuite) Test_ValidateChunkReqs_ValidChunks() {
+	u := models.UploadSession{
+		GenesisHash:   oyster_utils.RandSeq(6, []rune("abcdef0123456789")),
+		NumChunks:     10,
+		StorageMethod: models.StorageMethodS3,
+	}
+	suite.Nil(suite.DB.Save(&u))
+
+	chunkReqs := GenerateChunkRequests(10, u.GenesisHash)
+	chunkReqs = append(chunkReqs, chunkReqs[3]) // Same data twice is fine.
+
+	suite.Equal(0, len(u.ValidateChunkReqs(chunkReqs)))
+}
+
+func (suite *ModelSuite) Test_ValidateChunkReqs_InvalidChunks() {
+	u := models.UploadSession{
+		GenesisHash:   oyster_utils.RandSeq(6, []rune("abcdef0123456789")),
+		NumChunks:     10,
+		StorageMethod: models.StorageMethodS3,
+	}
+	suite.Nil(suite.DB.Save(&u))
+
+	chunkReqs := []models.ChunkReq{
+		{Idx: 0, Hash: u.GenesisHash, Data: "ABC"},
+		{Idx: 10, Hash: u.GenesisHash, Data: "ABC"},
+		{Idx: 1, Hash: "otherhash", Data: "ABC"},
+		{Idx: 2, Hash: u.GenesisHash, Data: "abc"},
+		{Idx: 3, Hash: u.GenesisHash, Data: strings.Repeat("A", models.MaxChunkDataLength+1)},
+		{Idx: 0, Hash: u.GenesisHash, Data: "ABD"},
+	}
+
+	chunkErrors := u.ValidateChunkReqs(chunkReqs)
+
+	var invalidIndexes []int
+	for _, chunkError := range chunkErrors {
+		invalidIndexes = append(invalidIndexes, chunkError.Idx)
+	}
+	suite.Equal([]int{10, 1, 2, 3, 0}, invalidIndexes)
+}
+
+func (suite *ModelSuite) Test_ValidateChunkReqs_HashChain() {
+	u := models.UploadSession{
+		GenesisHash:   oyster_utils.RandSeq(6, []rune("abcdef0123456789")),
+		NumChunks:     10,
+		StorageMethod: models.StorageMethodS3,
+	}
+	suite.Nil(suite.DB.Save(&u))
+
+	chunkReqs := GenerateChunkRequests(10, u.GenesisHash)
+	currHash := u.GenesisHash
+	for i := range chunkReqs {
+		chunkReqs[i].Hash = currHash
+		currHash = oyster_utils.HashHex(currHash, sha256.New())
+	}
+
+	// the hashes are read from the data maps, which are not built yet
+	chunkErrors := u.ValidateChunkReqs(chunkReqs[1:2])
+	suite.Equal(1, len(chunkErrors))
+	suite.Equal(1, chunkErrors[0].Idx)
+
+	suite.Nil(models.BuildDataMapsForSession(u.GenesisHash, u.NumChunks))
+	suite.Equal(0, len(u.ValidateChunkReqs(chunkReqs)))
+
+	chunkReqs[5].Hash = chunkReqs[6].Hash
+	chunkErrors = u.ValidateChunkReqs(chunkReqs)
+
+	suite.Equal(1, len(chunkErrors))
+	suite.Equal(5, chunkErrors[0].Idx)
+}
+
+func (suite *ModelSuite) Test_ValidateChunkReqs_ConflictWithStoredData() {
+	u := models.UploadSession{
+		GenesisHash:   oyster_utils.RandSeq(6, []rune("abcdef0123456789")),
+		NumChunks:     10,
+		StorageMethod: models.StorageMethodS3,
+	}
+	suite.Nil(suite.DB.Save(&u))
+
+	chunkReqs := GenerateChunkRequests(10, u.GenesisHash)
+	models.ProcessAndStoreChunkData(chunkReqs, u.GenesisHash, []int{}, oyster_utils.TestValueTimeToLive)
+
+	suite.Equal(0, len(u.ValidateChunkReqs(chunkReqs)))
+
+	chunkReqs[4].Data = chunkReqs[4].Data + "A"
+	chunkErrors := u.ValidateChunkReqs(chunkReqs)
+
+	suite.Equal(1, len(chunkErrors))
+	suite.Equal(4, chunkErrors[0].Idx)
+}
+
 func (suite *ModelSuite) Test_CalculatePayment_Less_Than_1_GB() {
 
 	currentStoragePeg := models.StoragePeg
@@ -617,6 +833,8 @@ func (suite *ModelSuite) Test_GetPRLsPerTreasure() {
 	u.MakeTreasureIdxMap(mergedIndexes, privateKeys)
 	u.NumChunks = 2500000
 	u.TotalCost = decimal.NewFromFloat(float64(totalCost))
+	// a session without a treasure cost buries half its total cost
+	u.TreasureCost = decimal.Zero
 	suite.DB.ValidateAndUpdate(&u)
 
 	prlsPerTreasure, err := u.GetPRLsPerTreasure()
@@ -628,6 +846,12 @@ func (suite *ModelSuite) Test_GetPRLsPerTreasure() {
 	// multiplying numSectors x2, since brokers get to keep half the PRL
 
 	suite.Equal(expectedPRLsPerTreasure, prlsPerTreasure)
+
+	// the markup of the brokers is not buried
+	u.TreasureCost = decimal.NewFromFloat(float64(3))
+	prlsPerTreasure, err = u.GetPRLsPerTreasure()
+	suite.Nil(err)
+	suite.Equal(0, big.NewFloat(1).Cmp(prlsPerTreasure))
 }
 
 func (suite *ModelSuite) Test_PaymentStatus() {
@@ -2566,3 +2790,75 @@ func (suite *ModelSuite) Test_GetTreasureAddress() {
 	// chunk before the treasure chunk, converted to an address
 	suite.Equal(expectedTreasureAddress, treasureAddress)
 }
+
+func (suite *ModelSuite) Test_DeleteUploadSession() {
+	oyster_utils.SetStorageMode(oyster_utils.DataMapsInSQL)
+	defer oyster_utils.ResetDataMapStorageMode()
+
+	genHash := oyster_utils.RandSeq(6, []rune("abcdef0123456789"))
+	session := models.UploadSession{
+		GenesisHash:   genHash,
+		NumChunks:     5,
+		FileSizeBytes: 8000,
+		Type:          models.SessionTypeAlpha,
+		PaymentStatus: models.PaymentStatusInvoiced,
+	}
+	vErr, err := session.StartUploadSession()
+	suite.Nil(err)
+	suite.False(vErr.HasAny())
+
+	suite.Nil(suite.DB.Save(&models.Treasure{GenesisHash: genHash}))
+	suite.Nil(suite.DB.Save(&models.BrokerBrokerTransaction{
+		GenesisHash:   genHash,
+		PaymentStatus: models.BrokerTxAlphaPaymentPending,
+	}))
+
+	suite.Nil(models.DeleteUploadSession(session))
+
+	count, err := suite.DB.Where("id = ?", session.ID).Count(&models.UploadSession{})
+	suite.Nil(err)
+	suite.Equal(0, count)
+	count, err = suite.DB.Where("genesis_hash = ?", genHash).Count(&models.DataMap{})
+	suite.Nil(err)
+	suite.Equal(0, count)
+	count, err = suite.DB.Where("genesis_hash = ?", genHash).Count(&models.Treasure{})
+	suite.Nil(err)
+	suite.Equal(0, count)
+	count, err = suite.DB.Where("genesis_hash = ?", genHash).Count(&models.BrokerBrokerTransaction{})
+	suite.Nil(err)
+	suite.Equal(0, count)
+}
+
+func (suite *ModelSuite) Test_DeleteUploadSession_Badger() {
+	oyster_utils.SetStorageMode(oyster_utils.DataMapsInBadger)
+	defer oyster_utils.ResetDataMapStorageMode()
+
+	genHash := oyster_utils.RandSeq(6, []rune("abcdef0123456789"))
+	session := models.UploadSession{
+		GenesisHash:   genHash,
+		NumChunks:     5,
+		FileSizeBytes: 8000,
+		Type:          models.SessionTypeAlpha,
+		PaymentStatus: models.PaymentStatusInvoiced,
+	}
+	vErr, err := session.StartUploadSession()
+	suite.Nil(err)
+	suite.False(vErr.HasAny())
+	suite.Nil(models.ProcessAndStoreChunkData(GenerateChunkRequests(5, genHash), genHash, []int{},
+		oyster_utils.TestValueTimeToLive))
+
+	messageDBID := []string{oyster_utils.InProgressDir, genHash, oyster_utils.MessageDir}
+	hashDBID := []string{oyster_utils.InProgressDir, genHash, oyster_utils.HashDir}
+	// a closed DB is removed as well
+	suite.Nil(oyster_utils.CloseUniqueKvStore(oyster_utils.GetBadgerDBName(hashDBID)))
+
+	suite.Nil(models.DeleteUploadSession(session))
+
+	for _, dbID := range [][]string{messageDBID, hashDBID} {
+		_, err := os.Stat(oyster_utils.GetUniqueKvStoreDir(dbID))
+		suite.True(os.IsNotExist(err))
+	}
+	count, err := suite.DB.Where("id = ?", session.ID).Count(&models.UploadSession{})
+	suite.Nil(err)
+	suite.Equal(0, count)
+}
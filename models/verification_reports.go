@@ -0,0 +1,146 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gobuffalo/pop"
+	"github.com/gobuffalo/pop/nulls"
+	"github.com/gobuffalo/uuid"
+	"github.com/gobuffalo/validate"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+/*VerificationReport adds up the results of verifying the chunks of an upload against the tangle.  It is kept
+after the upload session is purged, so that it can be shown to the customer.*/
+type VerificationReport struct {
+	ID          uuid.UUID `json:"id" db:"id"`
+	GenesisHash string    `json:"genesisHash" db:"genesis_hash"`
+	/*NumChunks is the number of chunks from FirstChunkIdx to LastChunkIdx.  A broker of an upload split across
+	several brokers only verifies its own range of the chunks.*/
+	NumChunks     int   `json:"numChunks" db:"num_chunks"`
+	FirstChunkIdx int64 `json:"firstChunkIdx" db:"first_chunk_idx"`
+	LastChunkIdx  int64 `json:"lastChunkIdx" db:"last_chunk_idx"`
+	/*ChunksMatching is the number of chunks found on the tangle with the data we have stored.*/
+	ChunksMatching int `json:"chunksMatching" db:"chunks_matching"`
+	/*ChunksNotAttached is the number of times a chunk was not found on the tangle.*/
+	ChunksNotAttached int `json:"chunksNotAttached" db:"chunks_not_attached"`
+	/*ChunksMismatched is the number of times a chunk was found on the tangle with other data.*/
+	ChunksMismatched int `json:"chunksMismatched" db:"chunks_mismatched"`
+	/*ReattachCount is the number of chunks which were sent to the tangle again after failing verification.*/
+	ReattachCount int `json:"reattachCount" db:"reattach_count"`
+	/*ChunksUnrecoverable is the number of chunks which were missing from the tangle when we no longer had their
+	data to attach them again.*/
+	ChunksUnrecoverable int        `json:"chunksUnrecoverable" db:"chunks_unrecoverable"`
+	LastVerifiedAt      time.Time  `json:"lastVerifiedAt" db:"last_verified_at"`
+	CompletedAt         nulls.Time `json:"completedAt" db:"completed_at"`
+	/*StorageExpiresAt is the end of the storage term the customer paid for.*/
+	StorageExpiresAt nulls.Time `json:"storageExpiresAt" db:"storage_expires_at"`
+	/*LastReverifiedAt is the last time the chunks were verified again after the upload was completed.*/
+	LastReverifiedAt nulls.Time `json:"lastReverifiedAt" db:"last_reverified_at"`
+	CreatedAt        time.Time  `json:"createdAt" db:"created_at"`
+	UpdatedAt        time.Time  `json:"updatedAt" db:"updated_at"`
+}
+
+/*VerificationResult is the outcome of verifying one batch of chunks.*/
+type VerificationResult struct {
+	ChunksMatching    int
+	ChunksNotAttached int
+	ChunksMismatched  int
+	ReattachCount     int
+}
+
+// String is not required by pop and may be deleted
+func (v VerificationReport) String() string {
+	jv, _ := json.Marshal(v)
+	return string(jv)
+}
+
+// Validate gets run every time you call a "pop.Validate*" (pop.ValidateAndSave, pop.ValidateAndCreate, pop.ValidateAndUpdate) method.
+// This method is not required and may be deleted.
+func (v *VerificationReport) Validate(tx *pop.Connection) (*validate.Errors, error) {
+	return validate.NewErrors(), nil
+}
+
+/*IsComplete returns whether every chunk of the upload has been verified on the tangle.*/
+func (v *VerificationReport) IsComplete() bool {
+	return v.CompletedAt.Valid
+}
+
+/*RecordVerificationResult adds the result of verifying the batch of chunks from firstChunkIdx to lastChunkIdx to
+the report of the genesis hash, creating the report if there is none yet.*/
+func RecordVerificationResult(genesisHash string, firstChunkIdx int64, lastChunkIdx int64,
+	result VerificationResult) error {
+	id, err := uuid.NewV4()
+	if err != nil {
+		oyster_utils.LogIfError(err, nil)
+		return err
+	}
+
+	// The assignments are applied in order, so num_chunks is set before the range is widened.
+	err = DB.RawQuery("INSERT INTO verification_reports (id, genesis_hash, num_chunks, first_chunk_idx, "+
+		"last_chunk_idx, chunks_matching, chunks_not_attached, chunks_mismatched, reattach_count, last_verified_at, "+
+		"created_at, updated_at) "+
+		"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW(), NOW()) "+
+		"ON DUPLICATE KEY UPDATE "+
+		"num_chunks = GREATEST(last_chunk_idx, VALUES(last_chunk_idx)) - "+
+		"LEAST(first_chunk_idx, VALUES(first_chunk_idx)) + 1, "+
+		"first_chunk_idx = LEAST(first_chunk_idx, VALUES(first_chunk_idx)), "+
+		"last_chunk_idx = GREATEST(last_chunk_idx, VALUES(last_chunk_idx)), "+
+		"chunks_matching = chunks_matching + VALUES(chunks_matching), "+
+		"chunks_not_attached = chunks_not_attached + VALUES(chunks_not_attached), "+
+		"chunks_mismatched = chunks_mismatched + VALUES(chunks_mismatched), "+
+		"reattach_count = reattach_count + VALUES(reattach_count), "+
+		"last_verified_at = NOW(), updated_at = NOW()",
+		id, genesisHash, lastChunkIdx-firstChunkIdx+1, firstChunkIdx, lastChunkIdx, result.ChunksMatching,
+		result.ChunksNotAttached, result.ChunksMismatched, result.ReattachCount).Exec()
+	oyster_utils.LogIfError(err, nil)
+	return err
+}
+
+/*CompleteVerificationReport marks the report of the genesis hash as complete in tx, once the upload session is
+done.  The chunks are verified again from time to time until storageExpiresAt.*/
+func CompleteVerificationReport(tx *pop.Connection, genesisHash string, storageExpiresAt time.Time) error {
+	err := tx.RawQuery("UPDATE verification_reports SET completed_at = NOW(), storage_expires_at = ?, "+
+		"updated_at = NOW() WHERE genesis_hash = ? AND completed_at IS NULL", storageExpiresAt, genesisHash).Exec()
+	oyster_utils.LogIfError(err, nil)
+	return err
+}
+
+/*GetReportsToReverify returns a random sample of up to limit completed uploads which are still within their
+storage term and were not verified again since reverifiedBefore.*/
+func GetReportsToReverify(reverifiedBefore time.Time, limit int) ([]VerificationReport, error) {
+	reports := []VerificationReport{}
+	err := DB.RawQuery("SELECT * FROM verification_reports WHERE completed_at IS NOT NULL AND "+
+		"storage_expires_at > ? AND (last_reverified_at IS NULL OR last_reverified_at < ?) "+
+		"ORDER BY RAND() LIMIT ?", time.Now(), reverifiedBefore, limit).All(&reports)
+	oyster_utils.LogIfError(err, nil)
+	return reports, err
+}
+
+/*RecordReverificationResult adds the result of verifying a completed upload again to its report.*/
+func RecordReverificationResult(genesisHash string, result VerificationResult, chunksUnrecoverable int) error {
+	err := DB.RawQuery("UPDATE verification_reports SET "+
+		"chunks_not_attached = chunks_not_attached + ?, "+
+		"chunks_mismatched = chunks_mismatched + ?, "+
+		"reattach_count = reattach_count + ?, "+
+		"chunks_unrecoverable = chunks_unrecoverable + ?, "+
+		"last_reverified_at = NOW(), updated_at = NOW() WHERE genesis_hash = ?",
+		result.ChunksNotAttached, result.ChunksMismatched, result.ReattachCount, chunksUnrecoverable,
+		genesisHash).Exec()
+	oyster_utils.LogIfError(err, nil)
+	return err
+}
+
+/*GetVerificationReport returns the report of the genesis hash, or nil if none of its chunks were verified yet.*/
+func GetVerificationReport(genesisHash string) (*VerificationReport, error) {
+	reports := []VerificationReport{}
+	if err := DB.Where("genesis_hash = ?", genesisHash).All(&reports); err != nil {
+		oyster_utils.LogIfError(err, nil)
+		return nil, err
+	}
+	if len(reports) == 0 {
+		return nil, nil
+	}
+	return &reports[0], nil
+}
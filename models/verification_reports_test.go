@@ -0,0 +1,92 @@
+package models_test
+
+import (
+	"time"
+
+	"github.com/oysterprotocol/brokernode/models"
+)
+
+func (suite *ModelSuite) Test_RecordVerificationResult() {
+	genesisHash := "abcdef11"
+
+	suite.Nil(models.RecordVerificationResult(genesisHash, 0, 9, models.VerificationResult{
+		ChunksMatching:    6,
+		ChunksNotAttached: 3,
+		ChunksMismatched:  1,
+		ReattachCount:     4,
+	}))
+	suite.Nil(models.RecordVerificationResult(genesisHash, 0, 9, models.VerificationResult{
+		ChunksMatching: 4,
+	}))
+
+	report, err := models.GetVerificationReport(genesisHash)
+	suite.Nil(err)
+	suite.NotNil(report)
+	suite.Equal(10, report.NumChunks)
+	suite.Equal(10, report.ChunksMatching)
+	suite.Equal(3, report.ChunksNotAttached)
+	suite.Equal(1, report.ChunksMismatched)
+	suite.Equal(4, report.ReattachCount)
+	suite.False(report.IsComplete())
+
+	suite.Nil(models.CompleteVerificationReport(models.DB, genesisHash, time.Now().AddDate(1, 0, 0)))
+
+	report, err = models.GetVerificationReport(genesisHash)
+	suite.Nil(err)
+	suite.True(report.IsComplete())
+}
+
+func (suite *ModelSuite) Test_RecordVerificationResult_ChunkRange() {
+	genesisHash := "abcdef66"
+
+	// a beta broker verifies its half of the chunks, from the end down
+	suite.Nil(models.RecordVerificationResult(genesisHash, 15, 19, models.VerificationResult{ChunksMatching: 5}))
+	suite.Nil(models.RecordVerificationResult(genesisHash, 10, 14, models.VerificationResult{ChunksMatching: 5}))
+
+	report, err := models.GetVerificationReport(genesisHash)
+	suite.Nil(err)
+	suite.Equal(10, report.NumChunks)
+	suite.Equal(int64(10), report.FirstChunkIdx)
+	suite.Equal(int64(19), report.LastChunkIdx)
+	suite.Equal(10, report.ChunksMatching)
+}
+
+func (suite *ModelSuite) Test_GetVerificationReport_NotFound() {
+	report, err := models.GetVerificationReport("abcdef22")
+	suite.Nil(err)
+	suite.Nil(report)
+}
+
+func (suite *ModelSuite) Test_GetReportsToReverify() {
+	suite.Nil(models.RecordVerificationResult("abcdef33", 0, 9, models.VerificationResult{ChunksMatching: 10}))
+	suite.Nil(models.RecordVerificationResult("abcdef44", 0, 9, models.VerificationResult{ChunksMatching: 10}))
+	suite.Nil(models.RecordVerificationResult("abcdef55", 0, 9, models.VerificationResult{ChunksMatching: 10}))
+
+	// abcdef33 is still uploading and the storage of abcdef55 has expired
+	suite.Nil(models.CompleteVerificationReport(models.DB, "abcdef44", time.Now().AddDate(1, 0, 0)))
+	suite.Nil(models.CompleteVerificationReport(models.DB, "abcdef55", time.Now().Add(-time.Hour)))
+
+	reports, err := models.GetReportsToReverify(time.Now(), 10)
+	suite.Nil(err)
+	suite.Equal(1, len(reports))
+	suite.Equal("abcdef44", reports[0].GenesisHash)
+
+	suite.Nil(models.RecordReverificationResult("abcdef44", models.VerificationResult{
+		ChunksNotAttached: 2,
+		ChunksMismatched:  1,
+		ReattachCount:     2,
+	}, 3))
+
+	reports, err = models.GetReportsToReverify(time.Now().Add(-time.Hour), 10)
+	suite.Nil(err)
+	suite.Equal(0, len(reports))
+
+	report, err := models.GetVerificationReport("abcdef44")
+	suite.Nil(err)
+	suite.Equal(10, report.ChunksMatching)
+	suite.Equal(2, report.ChunksNotAttached)
+	suite.Equal(1, report.ChunksMismatched)
+	suite.Equal(2, report.ReattachCount)
+	suite.Equal(3, report.ChunksUnrecoverable)
+	suite.True(report.LastReverifiedAt.Valid)
+}
@@ -0,0 +1,108 @@
+package blobstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	/*StoreTypeS3 stores the objects in AWS S3.*/
+	StoreTypeS3 = "s3"
+	/*StoreTypeLocal stores the objects as files under BLOB_STORE_DIR.*/
+	StoreTypeLocal = "local"
+	/*StoreTypeMemory keeps the objects in memory.  Objects are lost when the broker restarts.*/
+	StoreTypeMemory = "memory"
+
+	defaultLocalStoreDir = "/var/lib/brokernode/blobstore"
+)
+
+/*BlobStore stores string objects in buckets.  An object key may contain "/", which lets callers group
+objects under a common prefix.*/
+type BlobStore interface {
+	CreateBucket(bucketName string) error
+	/*DeleteBucket deletes the bucket.  The bucket must be empty.*/
+	DeleteBucket(bucketName string) error
+	GetObject(bucketName string, objectKey string) (string, error)
+	SetObject(bucketName string, objectKey string, data string) error
+	DeleteObject(bucketName string, objectKey string) error
+	/*ListObjectKeys returns, in ascending order, the keys of all the objects whose key starts with objectKeyPrefix.*/
+	ListObjectKeys(bucketName string, objectKeyPrefix string) ([]string, error)
+	/*DeleteObjectKeys deletes all the objects whose key starts with objectKeyPrefix.*/
+	DeleteObjectKeys(bucketName string, objectKeyPrefix string) error
+	/*GetObjectVersion returns the object and its version, which changes when the object is set to other data.*/
+	GetObjectVersion(bucketName string, objectKey string) (string, string, error)
+	/*DeleteObjectVersion deletes the object only if it is still at version.  Returns ErrObjectChanged if it was set
+	to other data since.*/
+	DeleteObjectVersion(bucketName string, objectKey string, version string) error
+	/*SetObjectVersion sets the object only if it is still at version, or if version is "" only if it does not
+	exist.  Returns ErrObjectChanged otherwise.*/
+	SetObjectVersion(bucketName string, objectKey string, data string, version string) error
+}
+
+/*ErrObjectChanged means an object was set again since its version was read.*/
+var ErrObjectChanged = errors.New("object was changed since it was read")
+
+/*Store is the BlobStore selected by the BLOB_STORE env var.*/
+var Store BlobStore
+
+/*DefaultBucketName is the bucket the v3 upload data is stored in.*/
+var DefaultBucketName string
+
+func init() {
+	var err error
+	Store, err = NewBlobStore(getStoreType())
+	// Fail the process rather than start with a store that loses the uploads.
+	if err != nil {
+		panic(err.Error())
+	}
+	DefaultBucketName = os.Getenv("AWS_BUCKET_NAME")
+}
+
+/*NewBlobStore returns a new BlobStore of the given storeType.  Returns an error for an unknown type, or for S3
+without AWS credentials.*/
+func NewBlobStore(storeType string) (BlobStore, error) {
+	switch storeType {
+	case StoreTypeS3:
+		if !hasAwsCredentials() {
+			return nil, errors.New("BLOB_STORE is s3, but AWS_ACCESS_KEY_ID or AWS_SECRET_ACCESS_KEY is not set")
+		}
+		return NewS3Store(), nil
+	case StoreTypeLocal:
+		dir := os.Getenv("BLOB_STORE_DIR")
+		if dir == "" {
+			dir = defaultLocalStoreDir
+		}
+		return NewLocalStore(dir), nil
+	case StoreTypeMemory:
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown BLOB_STORE %q, must be one of %v, %v or %v", storeType, StoreTypeS3,
+			StoreTypeLocal, StoreTypeMemory)
+	}
+}
+
+/*getStoreType reads BLOB_STORE.  If it is not set, S3 is used, except in unit tests, which use the in-memory
+store.*/
+func getStoreType() string {
+	if v := strings.ToLower(os.Getenv("BLOB_STORE")); v != "" {
+		return v
+	}
+	if os.Getenv("GO_ENV") == "test" {
+		return StoreTypeMemory
+	}
+	return StoreTypeS3
+}
+
+func hasAwsCredentials() bool {
+	return len(os.Getenv("AWS_ACCESS_KEY_ID")) > 0 && len(os.Getenv("AWS_SECRET_ACCESS_KEY")) > 0
+}
+
+/*getDataVersion is the version of an object in the stores which do not keep versions themselves.*/
+func getDataVersion(data string) string {
+	hash := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(hash[:])
+}
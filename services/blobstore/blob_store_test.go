@@ -0,0 +1,124 @@
+package blobstore_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/oysterprotocol/brokernode/services/blobstore"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+func Test_MemoryStore(t *testing.T) {
+	runBlobStoreTests(t, blobstore.NewMemoryStore())
+}
+
+func Test_LocalStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blobstore")
+	oyster_utils.AssertNoError(err, t, "")
+	defer os.RemoveAll(dir)
+
+	runBlobStoreTests(t, blobstore.NewLocalStore(dir))
+}
+
+func Test_LocalStore_InvalidObjectKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blobstore")
+	oyster_utils.AssertNoError(err, t, "")
+	defer os.RemoveAll(dir)
+
+	store := blobstore.NewLocalStore(dir)
+
+	oyster_utils.AssertError(store.SetObject("bucket", "../escape", "data"), t, "Must not write outside of bucket")
+}
+
+func Test_NewBlobStore_Memory(t *testing.T) {
+	store, err := blobstore.NewBlobStore(blobstore.StoreTypeMemory)
+	oyster_utils.AssertNoError(err, t, "")
+
+	oyster_utils.AssertNoError(store.SetObject("bucket", "key", "data"), t, "")
+	data, err := store.GetObject("bucket", "key")
+	oyster_utils.AssertNoError(err, t, "")
+	oyster_utils.AssertStringEqual(data, "data", t)
+}
+
+func Test_NewBlobStore_UnknownType(t *testing.T) {
+	_, err := blobstore.NewBlobStore("memroy")
+	oyster_utils.AssertError(err, t, "Unknown store types must not fall back to memory")
+}
+
+func Test_NewBlobStore_S3WithoutCredentials(t *testing.T) {
+	defer os.Setenv("AWS_ACCESS_KEY_ID", os.Getenv("AWS_ACCESS_KEY_ID"))
+	os.Setenv("AWS_ACCESS_KEY_ID", "")
+
+	_, err := blobstore.NewBlobStore(blobstore.StoreTypeS3)
+	oyster_utils.AssertError(err, t, "S3 needs AWS credentials")
+}
+
+func runBlobStoreTests(t *testing.T, store blobstore.BlobStore) {
+	bucket := "bucket"
+	oyster_utils.AssertNoError(store.CreateBucket(bucket), t, "CreateBucket")
+
+	_, err := store.GetObject(bucket, "o/1")
+	oyster_utils.AssertError(err, t, "Object does not exist yet")
+
+	objectKeys := []string{"o/1", "o/2", "o/3", "p/1"}
+	for _, k := range objectKeys {
+		oyster_utils.AssertNoError(store.SetObject(bucket, k, "data"+k), t, "SetObject")
+	}
+
+	data, err := store.GetObject(bucket, "o/2")
+	oyster_utils.AssertNoError(err, t, "GetObject")
+	oyster_utils.AssertStringEqual(data, "datao/2", t)
+
+	keys, err := store.ListObjectKeys(bucket, "o/")
+	oyster_utils.AssertNoError(err, t, "ListObjectKeys")
+	compareStrings(t, keys, []string{"o/1", "o/2", "o/3"})
+
+	oyster_utils.AssertNoError(store.DeleteObject(bucket, "o/1"), t, "DeleteObject")
+	keys, _ = store.ListObjectKeys(bucket, "o/")
+	compareStrings(t, keys, []string{"o/2", "o/3"})
+
+	oyster_utils.AssertError(store.DeleteBucket(bucket), t, "Bucket is not empty")
+
+	oyster_utils.AssertNoError(store.DeleteObjectKeys(bucket, "o/"), t, "DeleteObjectKeys")
+	keys, _ = store.ListObjectKeys(bucket, "")
+	compareStrings(t, keys, []string{"p/1"})
+
+	// an object set again after its version was read is not deleted
+	_, version, err := store.GetObjectVersion(bucket, "p/1")
+	oyster_utils.AssertNoError(err, t, "GetObjectVersion")
+	oyster_utils.AssertNoError(store.SetObject(bucket, "p/1", "newdata"), t, "SetObject")
+	oyster_utils.AssertTrue(store.DeleteObjectVersion(bucket, "p/1", version) == blobstore.ErrObjectChanged, t,
+		"DeleteObjectVersion of a changed object")
+	data, version, err = store.GetObjectVersion(bucket, "p/1")
+	oyster_utils.AssertNoError(err, t, "GetObjectVersion")
+	oyster_utils.AssertStringEqual(data, "newdata", t)
+
+	oyster_utils.AssertNoError(store.DeleteObjectVersion(bucket, "p/1", version), t, "DeleteObjectVersion")
+
+	// an object is only set if it is still at the version read, or only created if it does not exist
+	oyster_utils.AssertNoError(store.SetObjectVersion(bucket, "p/2", "data", ""), t, "SetObjectVersion")
+	oyster_utils.AssertTrue(store.SetObjectVersion(bucket, "p/2", "otherdata", "") == blobstore.ErrObjectChanged, t,
+		"SetObjectVersion of an object which exists")
+	_, version, err = store.GetObjectVersion(bucket, "p/2")
+	oyster_utils.AssertNoError(err, t, "GetObjectVersion")
+	oyster_utils.AssertNoError(store.SetObject(bucket, "p/2", "newdata"), t, "SetObject")
+	oyster_utils.AssertTrue(store.SetObjectVersion(bucket, "p/2", "otherdata", version) == blobstore.ErrObjectChanged,
+		t, "SetObjectVersion of a changed object")
+	_, version, err = store.GetObjectVersion(bucket, "p/2")
+	oyster_utils.AssertNoError(err, t, "GetObjectVersion")
+	oyster_utils.AssertNoError(store.SetObjectVersion(bucket, "p/2", "mergeddata", version), t, "SetObjectVersion")
+	data, err = store.GetObject(bucket, "p/2")
+	oyster_utils.AssertNoError(err, t, "GetObject")
+	oyster_utils.AssertStringEqual(data, "mergeddata", t)
+
+	oyster_utils.AssertNoError(store.DeleteObject(bucket, "p/2"), t, "DeleteObject")
+	oyster_utils.AssertNoError(store.DeleteBucket(bucket), t, "DeleteBucket")
+}
+
+func compareStrings(t *testing.T, a []string, b []string) {
+	oyster_utils.AssertTrue(len(a) == len(b), t, "a and b must have the same len")
+	for i := 0; i < len(a) && i < len(b); i++ {
+		oyster_utils.AssertStringEqual(a[i], b[i], t)
+	}
+}
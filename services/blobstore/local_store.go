@@ -0,0 +1,197 @@
+package blobstore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+/*localStore keeps each bucket as a directory under rootDir and each object as a file in it.  Object keys
+containing "/" are stored in sub directories.*/
+type localStore struct {
+	rootDir string
+	// mutex makes checking the version of an object and deleting or setting it atomic
+	mutex sync.Mutex
+}
+
+/*NewLocalStore returns a BlobStore that stores the objects under rootDir on the local filesystem.*/
+func NewLocalStore(rootDir string) BlobStore {
+	return &localStore{rootDir: rootDir}
+}
+
+func (l *localStore) CreateBucket(bucketName string) error {
+	err := os.MkdirAll(l.bucketPath(bucketName), 0700)
+	oyster_utils.LogIfError(err, nil)
+	return err
+}
+
+func (l *localStore) DeleteBucket(bucketName string) error {
+	err := os.Remove(l.bucketPath(bucketName))
+	oyster_utils.LogIfError(err, nil)
+	return err
+}
+
+func (l *localStore) GetObject(bucketName string, objectKey string) (string, error) {
+	path, err := l.objectPath(bucketName, objectKey)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+/*SetObject stores the object, creating the bucket if it does not exist yet.*/
+func (l *localStore) SetObject(bucketName string, objectKey string, data string) error {
+	path, err := l.objectPath(bucketName, objectKey)
+	if err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return writeObjectFile(path, data)
+}
+
+func (l *localStore) DeleteObject(bucketName string, objectKey string) error {
+	path, err := l.objectPath(bucketName, objectKey)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		oyster_utils.LogIfError(err, nil)
+		return err
+	}
+
+	// Clean up the sub directories left empty, so that an emptied bucket can be deleted.
+	bucketPath := l.bucketPath(bucketName)
+	for dir := filepath.Dir(path); dir != bucketPath; dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (l *localStore) GetObjectVersion(bucketName string, objectKey string) (string, string, error) {
+	data, err := l.GetObject(bucketName, objectKey)
+	if err != nil {
+		return "", "", err
+	}
+	return data, getDataVersion(data), nil
+}
+
+func (l *localStore) DeleteObjectVersion(bucketName string, objectKey string, version string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	data, err := l.GetObject(bucketName, objectKey)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if getDataVersion(data) != version {
+		return ErrObjectChanged
+	}
+	return l.DeleteObject(bucketName, objectKey)
+}
+
+func (l *localStore) SetObjectVersion(bucketName string, objectKey string, data string, version string) error {
+	path, err := l.objectPath(bucketName, objectKey)
+	if err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	current, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	exists := err == nil
+	if version == "" && exists || version != "" && (!exists || getDataVersion(string(current)) != version) {
+		return ErrObjectChanged
+	}
+	return writeObjectFile(path, data)
+}
+
+func (l *localStore) ListObjectKeys(bucketName string, objectKeyPrefix string) ([]string, error) {
+	var keys []string
+
+	bucketPath := l.bucketPath(bucketName)
+	// filepath.Walk visits the files in lexical order, so the keys are already sorted.
+	err := filepath.Walk(bucketPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(bucketPath, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(relPath)
+		if strings.HasPrefix(key, objectKeyPrefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	oyster_utils.LogIfError(err, nil)
+	return keys, err
+}
+
+func (l *localStore) DeleteObjectKeys(bucketName string, objectKeyPrefix string) error {
+	keys, err := l.ListObjectKeys(bucketName, objectKeyPrefix)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := l.DeleteObject(bucketName, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *localStore) bucketPath(bucketName string) string {
+	return filepath.Join(l.rootDir, filepath.Base(bucketName))
+}
+
+func (l *localStore) objectPath(bucketName string, objectKey string) (string, error) {
+	bucketPath := l.bucketPath(bucketName)
+	path := filepath.Join(bucketPath, filepath.FromSlash(objectKey))
+	if !strings.HasPrefix(path, bucketPath+string(filepath.Separator)) {
+		return "", fmt.Errorf("Invalid object key %v", objectKey)
+	}
+	return path, nil
+}
+
+/*writeObjectFile writes the object to the file at path, creating its directory if needed.*/
+func writeObjectFile(path string, data string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		oyster_utils.LogIfError(err, nil)
+		return err
+	}
+	err := ioutil.WriteFile(path, []byte(data), 0600)
+	oyster_utils.LogIfError(err, nil)
+	return err
+}
@@ -0,0 +1,137 @@
+package blobstore
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type memoryStore struct {
+	mutex   sync.RWMutex
+	buckets map[string]map[string]string
+}
+
+/*NewMemoryStore returns a BlobStore that keeps all the objects in memory.*/
+func NewMemoryStore() BlobStore {
+	return &memoryStore{
+		buckets: make(map[string]map[string]string),
+	}
+}
+
+func (m *memoryStore) CreateBucket(bucketName string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.buckets[bucketName]; !ok {
+		m.buckets[bucketName] = make(map[string]string)
+	}
+	return nil
+}
+
+func (m *memoryStore) DeleteBucket(bucketName string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if len(m.buckets[bucketName]) > 0 {
+		return fmt.Errorf("Bucket %v is not empty", bucketName)
+	}
+	delete(m.buckets, bucketName)
+	return nil
+}
+
+func (m *memoryStore) GetObject(bucketName string, objectKey string) (string, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	data, ok := m.buckets[bucketName][objectKey]
+	if !ok {
+		return "", fmt.Errorf("Object %v does not exist in bucket %v", objectKey, bucketName)
+	}
+	return data, nil
+}
+
+/*SetObject stores the object, creating the bucket if it does not exist yet.*/
+func (m *memoryStore) SetObject(bucketName string, objectKey string, data string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.buckets[bucketName]; !ok {
+		m.buckets[bucketName] = make(map[string]string)
+	}
+	m.buckets[bucketName][objectKey] = data
+	return nil
+}
+
+func (m *memoryStore) DeleteObject(bucketName string, objectKey string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.buckets[bucketName], objectKey)
+	return nil
+}
+
+func (m *memoryStore) ListObjectKeys(bucketName string, objectKeyPrefix string) ([]string, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var keys []string
+	for key := range m.buckets[bucketName] {
+		if strings.HasPrefix(key, objectKeyPrefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (m *memoryStore) DeleteObjectKeys(bucketName string, objectKeyPrefix string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for key := range m.buckets[bucketName] {
+		if strings.HasPrefix(key, objectKeyPrefix) {
+			delete(m.buckets[bucketName], key)
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) GetObjectVersion(bucketName string, objectKey string) (string, string, error) {
+	data, err := m.GetObject(bucketName, objectKey)
+	if err != nil {
+		return "", "", err
+	}
+	return data, getDataVersion(data), nil
+}
+
+func (m *memoryStore) DeleteObjectVersion(bucketName string, objectKey string, version string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	data, ok := m.buckets[bucketName][objectKey]
+	if !ok {
+		return nil
+	}
+	if getDataVersion(data) != version {
+		return ErrObjectChanged
+	}
+	delete(m.buckets[bucketName], objectKey)
+	return nil
+}
+
+func (m *memoryStore) SetObjectVersion(bucketName string, objectKey string, data string, version string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	current, ok := m.buckets[bucketName][objectKey]
+	if version == "" && ok || version != "" && (!ok || getDataVersion(current) != version) {
+		return ErrObjectChanged
+	}
+
+	if _, ok := m.buckets[bucketName]; !ok {
+		m.buckets[bucketName] = make(map[string]string)
+	}
+	m.buckets[bucketName][objectKey] = data
+	return nil
+}
@@ -0,0 +1,240 @@
+package blobstore
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+/*awsPagingSize is the max paging size per request.*/
+var awsPagingSize int64 = 1000
+
+const (
+	s3VersionIDPrefix = "version:"
+	s3ETagPrefix      = "etag:"
+)
+
+type s3Store struct {
+	s3 *s3.S3
+}
+
+/*NewS3Store returns a BlobStore backed by AWS S3.  Credentials and region are read by the AWS SDK from the env.*/
+func NewS3Store() BlobStore {
+	return &s3Store{
+		s3: s3.New(session.Must(session.NewSession())),
+	}
+}
+
+func (svc *s3Store) CreateBucket(bucketName string) error {
+	_, err := svc.s3.CreateBucket(&s3.CreateBucketInput{
+		Bucket: aws.String(bucketName),
+	})
+	oyster_utils.LogIfError(err, nil)
+	return err
+}
+
+func (svc *s3Store) DeleteBucket(bucketName string) error {
+	_, err := svc.s3.DeleteBucket(&s3.DeleteBucketInput{
+		Bucket: aws.String(bucketName),
+	})
+	oyster_utils.LogIfError(err, nil)
+	return err
+}
+
+func (svc *s3Store) GetObject(bucketName string, objectKey string) (string, error) {
+	output, err := svc.s3.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectKey),
+	})
+	oyster_utils.LogIfError(err, nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(output.Body)
+	return buf.String(), nil
+}
+
+func (svc *s3Store) SetObject(bucketName string, objectKey string, data string) error {
+	_, err := svc.s3.PutObject(&s3.PutObjectInput{
+		Body:   aws.ReadSeekCloser(strings.NewReader(data)),
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectKey),
+	})
+	oyster_utils.LogIfError(err, nil)
+	return err
+}
+
+func (svc *s3Store) DeleteObject(bucketName string, objectKey string) error {
+	_, err := svc.s3.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectKey),
+	})
+	oyster_utils.LogIfError(err, nil)
+	return err
+}
+
+/*GetObjectVersion returns the version id of the object in a versioned bucket, and its ETag otherwise.*/
+func (svc *s3Store) GetObjectVersion(bucketName string, objectKey string) (string, string, error) {
+	output, err := svc.s3.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectKey),
+	})
+	oyster_utils.LogIfError(err, nil)
+	if err != nil {
+		return "", "", err
+	}
+
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(output.Body)
+	output.Body.Close()
+
+	if versionID := aws.StringValue(output.VersionId); versionID != "" && versionID != "null" {
+		return buf.String(), s3VersionIDPrefix + versionID, nil
+	}
+	return buf.String(), s3ETagPrefix + aws.StringValue(output.ETag), nil
+}
+
+/*DeleteObjectVersion deletes only the version of the object in a versioned bucket, so an object set again since
+is kept.  Without versioning, the object is only deleted if its ETag still matches, which leaves a short window in
+which an object set again can be deleted.*/
+func (svc *s3Store) DeleteObjectVersion(bucketName string, objectKey string, version string) error {
+	input := &s3.DeleteObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectKey),
+	}
+
+	if strings.HasPrefix(version, s3VersionIDPrefix) {
+		input.VersionId = aws.String(strings.TrimPrefix(version, s3VersionIDPrefix))
+	} else {
+		_, err := svc.s3.HeadObject(&s3.HeadObjectInput{
+			Bucket:  aws.String(bucketName),
+			Key:     aws.String(objectKey),
+			IfMatch: aws.String(strings.TrimPrefix(version, s3ETagPrefix)),
+		})
+		if aerr, ok := err.(awserr.RequestFailure); ok && aerr.StatusCode() == 412 {
+			return ErrObjectChanged
+		}
+		if err != nil {
+			oyster_utils.LogIfError(err, nil)
+			return err
+		}
+	}
+
+	_, err := svc.s3.DeleteObject(input)
+	oyster_utils.LogIfError(err, nil)
+	return err
+}
+
+/*SetObjectVersion puts the object with an If-Match on the ETag of version, or an If-None-Match if the object must not
+exist, so that S3 rejects the put if the object was set since.  A put can only match an ETag, so the ETag of a version
+id is looked up first.*/
+func (svc *s3Store) SetObjectVersion(bucketName string, objectKey string, data string, version string) error {
+	etag := strings.TrimPrefix(version, s3ETagPrefix)
+	if strings.HasPrefix(version, s3VersionIDPrefix) {
+		output, err := svc.s3.HeadObject(&s3.HeadObjectInput{
+			Bucket:    aws.String(bucketName),
+			Key:       aws.String(objectKey),
+			VersionId: aws.String(strings.TrimPrefix(version, s3VersionIDPrefix)),
+		})
+		if isObjectChangedError(err) {
+			return ErrObjectChanged
+		}
+		if err != nil {
+			oyster_utils.LogIfError(err, nil)
+			return err
+		}
+		etag = aws.StringValue(output.ETag)
+	}
+
+	req, _ := svc.s3.PutObjectRequest(&s3.PutObjectInput{
+		Body:   aws.ReadSeekCloser(strings.NewReader(data)),
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectKey),
+	})
+	// The conditional headers are set on the request before it is signed and sent.
+	if version == "" {
+		req.HTTPRequest.Header.Set("If-None-Match", "*")
+	} else {
+		req.HTTPRequest.Header.Set("If-Match", etag)
+	}
+	err := req.Send()
+	if isObjectChangedError(err) {
+		return ErrObjectChanged
+	}
+	oyster_utils.LogIfError(err, nil)
+	return err
+}
+
+/*isObjectChangedError returns whether S3 failed a conditional request because the object was set or deleted since,
+or is being set by a concurrent conditional request.*/
+func isObjectChangedError(err error) bool {
+	if aerr, ok := err.(awserr.RequestFailure); ok {
+		switch aerr.StatusCode() {
+		case 404, 409, 412:
+			return true
+		}
+	}
+	return false
+}
+
+func (svc *s3Store) ListObjectKeys(bucketName string, objectKeyPrefix string) ([]string, error) {
+	var keys []string
+	err := svc.listObjectPages(bucketName, objectKeyPrefix, func(objKeys []string) bool {
+		keys = append(keys, objKeys...)
+		return true
+	})
+	return keys, err
+}
+
+func (svc *s3Store) DeleteObjectKeys(bucketName string, objectKeyPrefix string) error {
+	var deleteErr error
+	err := svc.listObjectPages(bucketName, objectKeyPrefix, func(objKeys []string) bool {
+		if len(objKeys) == 0 {
+			return true
+		}
+
+		var objIdentifier []*s3.ObjectIdentifier
+		for _, objKey := range objKeys {
+			objIdentifier = append(objIdentifier, &s3.ObjectIdentifier{Key: aws.String(objKey)})
+		}
+		_, deleteErr = svc.s3.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: aws.String(bucketName),
+			Delete: &s3.Delete{
+				Objects: objIdentifier,
+			},
+		})
+		oyster_utils.LogIfError(deleteErr, nil)
+		return deleteErr == nil
+	})
+
+	if deleteErr != nil {
+		return deleteErr
+	}
+	return err
+}
+
+func (svc *s3Store) listObjectPages(bucketName string, objectKeyPrefix string, fn func([]string) bool) error {
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(bucketName),
+		Prefix:  aws.String(objectKeyPrefix),
+		MaxKeys: aws.Int64(awsPagingSize),
+	}
+
+	err := svc.s3.ListObjectsV2Pages(input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		var keys []string
+		for _, c := range page.Contents {
+			keys = append(keys, aws.StringValue(c.Key))
+		}
+		return fn(keys)
+	})
+	oyster_utils.LogIfError(err, nil)
+	return err
+}
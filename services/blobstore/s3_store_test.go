@@ -0,0 +1,41 @@
+package blobstore
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+func Test_S3Store_Paging(t *testing.T) {
+	if !hasAwsCredentials() {
+		return
+	}
+
+	awsPagingSize = 2
+	defer func() { awsPagingSize = 1000 }()
+
+	store := NewS3Store()
+	bucket := fmt.Sprintf("unknown-%v", time.Now().Format("2006-01-02t15.04.05z07.00"))
+	oyster_utils.AssertNoError(store.CreateBucket(bucket), t, "CreateBucket")
+
+	objectKeys := []string{"o/1", "o/2", "o/3", "o/4", "o/5"}
+	for _, k := range objectKeys {
+		oyster_utils.AssertNoError(store.SetObject(bucket, k, "data"), t, "SetObject")
+	}
+
+	keys, err := store.ListObjectKeys(bucket, "o/")
+	oyster_utils.AssertNoError(err, t, "ListObjectKeys")
+	oyster_utils.AssertTrue(len(keys) == len(objectKeys), t, "all the pages must be listed")
+	for i := range keys {
+		oyster_utils.AssertStringEqual(keys[i], objectKeys[i], t)
+	}
+
+	oyster_utils.AssertNoError(store.DeleteObjectKeys(bucket, "o/"), t, "DeleteObjectKeys")
+	keys, err = store.ListObjectKeys(bucket, "o/")
+	oyster_utils.AssertNoError(err, t, "ListObjectKeys")
+	oyster_utils.AssertTrue(len(keys) == 0, t, "all the pages must be deleted")
+
+	oyster_utils.AssertNoError(store.DeleteBucket(bucket), t, "DeleteBucket")
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gobuffalo/uuid"
+	"github.com/oysterprotocol/brokernode/utils"
+	"github.com/oysterprotocol/brokernode/utils/eth_gateway"
+)
+
+const (
+	/*BrokerAddressHeader is the ETH address of the broker which signed the request.*/
+	BrokerAddressHeader = "X-Broker-Address"
+	/*BrokerTimestampHeader is the unix time at which the request was signed.*/
+	BrokerTimestampHeader = "X-Broker-Timestamp"
+	/*BrokerNonceHeader makes each signed request unique, so that it can't be replayed.*/
+	BrokerNonceHeader = "X-Broker-Nonce"
+	/*BrokerSignatureHeader is the hex signature of the request by the main wallet key of the broker.*/
+	BrokerSignatureHeader = "X-Broker-Signature"
+)
+
+var brokerClient = &http.Client{Timeout: 30 * time.Second}
+
+/*SignBrokerRequest signs a request to another broker with the main wallet key of this broker.  body must be the
+body of the request.*/
+func SignBrokerRequest(req *http.Request, body []byte) error {
+	key := eth_gateway.MainWalletPrivateKey
+	if key == nil {
+		return errors.New("no main wallet key to sign the broker request with")
+	}
+
+	nonce, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	signature, err := crypto.Sign(GetBrokerRequestHash(req.Method, req.URL.Path, timestamp, nonce.String(), body), key)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set(BrokerAddressHeader, crypto.PubkeyToAddress(key.PublicKey).Hex())
+	req.Header.Set(BrokerTimestampHeader, timestamp)
+	req.Header.Set(BrokerNonceHeader, nonce.String())
+	req.Header.Set(BrokerSignatureHeader, hex.EncodeToString(signature))
+	return nil
+}
+
+/*GetBrokerRequestHash returns the hash of the parts of a request which are signed.*/
+func GetBrokerRequestHash(method string, path string, timestamp string, nonce string, body []byte) []byte {
+	bodyHash := sha256.Sum256(body)
+	return crypto.Keccak256([]byte(strings.Join([]string{method, path, timestamp, nonce,
+		hex.EncodeToString(bodyHash[:])}, "\n")))
+}
+
+/*SendBrokerRequest sends req as JSON to another broker, signed by this broker.  A nil req sends no body.  The
+caller must close the body of the response.*/
+func SendBrokerRequest(method string, url string, req interface{}) (*http.Response, error) {
+	var body []byte
+	if req != nil {
+		var err error
+		if body, err = json.Marshal(req); err != nil {
+			return nil, err
+		}
+	}
+
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	httpReq, err := http.NewRequest(method, url, bodyReader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if err := SignBrokerRequest(httpReq, body); err != nil {
+		return nil, err
+	}
+
+	return brokerClient.Do(httpReq)
+}
+
+/*SendSignedBrokerRequest sends req as JSON to another broker, signed by this broker, and parses the response into
+resp.*/
+func SendSignedBrokerRequest(method string, url string, req interface{}, resp interface{}) error {
+	httpRes, err := SendBrokerRequest(method, url, req)
+	if err != nil {
+		oyster_utils.LogIfError(err, nil)
+		return err
+	}
+	if httpRes.StatusCode != http.StatusOK {
+		httpRes.Body.Close()
+		return fmt.Errorf("Unable to communicate with broker %v: request failed with status %v", url,
+			httpRes.StatusCode)
+	}
+
+	if err := oyster_utils.ParseResBody(httpRes, resp); err != nil {
+		err = fmt.Errorf("Unable to communicate with broker %v: %v", url, err)
+		oyster_utils.LogIfError(err, nil)
+		return err
+	}
+	return nil
+}
@@ -5,13 +5,11 @@ import (
 	"github.com/pkg/errors"
 	"math"
 	"os"
-	"runtime"
 	"strings"
 	"sync"
 	"time"
 
 	giota "github.com/iotaledger/iota.go/api"
-	"github.com/iotaledger/iota.go/bundle"
 	"github.com/iotaledger/iota.go/consts"
 	"github.com/iotaledger/iota.go/pow"
 	"github.com/iotaledger/iota.go/transaction"
@@ -37,11 +35,12 @@ type PowChannel struct {
 	ChannelID     string
 	ChunkTrackers *[]ChunkTracker
 	Channel       chan PowJob
+	// done is closed when the channel is removed from the pool.
+	done chan struct{}
 }
 
 type IotaService struct {
 	SendChunksToChannel
-	SendChunksToLambda
 	VerifyChunkMessagesMatchRecord
 	VerifyChunksMatchRecord
 	ChunksMatch
@@ -71,10 +70,6 @@ type VerifyChunksMatchRecord func([]oyster_utils.ChunkData, bool) (filteredChunk
 This type used for mocking.*/
 type ChunksMatch func(transaction.Transaction, oyster_utils.ChunkData, bool) bool
 
-/*SendChunksToLambda defines the type for a function which will send the chunkds to AWS Lambda.
-This type used for mocking.*/
-type SendChunksToLambda func(chunks *[]oyster_utils.ChunkData)
-
 /*VerifyTreasure defines the type for a function which will verify webnode treasure claims.
 This type used for mocking.*/
 type VerifyTreasure func([]string) (verify bool, err error)
@@ -105,7 +100,7 @@ const (
 )
 
 var (
-	// PowProcs is number of concurrent processes (default is NumCPU()-1)
+	// PowProcs is number of concurrent processes, which is the size of the PoW pool
 	PowProcs    int
 	IotaWrapper IotaService
 	//This mutex was added by us.
@@ -117,7 +112,6 @@ var (
 	powName          string
 	Channel          = map[string]PowChannel{}
 	wg               sync.WaitGroup
-	api              *giota.API
 	PoWFrequency     ProcessingFrequency
 	minPoWFrequency  = 1
 	OysterTag, _     = trinary.NewTrytes(oysterTagStr)
@@ -135,27 +129,24 @@ func init() {
 		oyster_utils.LogIfError(fmt.Errorf(".env file : %v", err), nil)
 	}
 
-	host_ip := os.Getenv("HOST_IP")
-	if host_ip == "" {
-		panic("Invalid IRI host: Check the .env file for HOST_IP")
+	iriURIs := getIriURIs()
+	if len(iriURIs) == 0 {
+		panic("Invalid IRI host: Check the .env file for HOST_IP or IRI_HOSTS")
 	}
 
 	powName, bestPow = pow.GetFastestProofOfWorkImpl()
 
-	provider := "http://" + host_ip + ":14265"
-	// create a new API instance
-	api, err = giota.ComposeAPI(giota.HTTPClientSettings{
-		URI:                  provider,
-		LocalProofOfWorkFunc: bestPow,
-	})
+	// create the API instances of the IRI nodes
+	IriNodes, err = NewIriNodePool(iriURIs, os.Getenv("IRI_SELECTION"), int64(oyster_utils.GetEnvInt("IRI_MAX_MILESTONE_LAG", 2)))
 	if err != nil {
 		panic(err)
 	}
 
 	seed = "OYSTERPRLOYSTERPRLOYSTERPRLOYSTERPRLOYSTERPRLOYSTERPRLOYSTERPRLOYSTERPRLOYSTERPRL"
 
+	Pow = NewPowProvider(getPowProviderType())
+
 	IotaWrapper = IotaService{
-		SendChunksToLambda:             sendChunksToLambda,
 		SendChunksToChannel:            sendChunksToChannel,
 		VerifyChunkMessagesMatchRecord: verifyChunkMessagesMatchRecord,
 		VerifyChunksMatchRecord:        verifyChunksMatchRecord,
@@ -166,62 +157,65 @@ func init() {
 		DoPoW: doPoW,
 	}
 
-	PowProcs = runtime.NumCPU()
-	if PowProcs != 1 {
-		PowProcs--
-	}
+	// the pool starts with the whole CPU budget and is resized to the backlog later on
+	powPoolConfig := GetPowPoolConfig()
 
 	channels := []models.ChunkChannel{}
 
 	wg.Add(1)
 	go func(channels *[]models.ChunkChannel, err *error) {
 		defer wg.Done()
-		*channels, *err = models.MakeChannels(PowProcs)
+		*channels, *err = models.MakeChannels(powPoolConfig.MaxChannels)
 	}(&channels, &err)
 
 	wg.Wait()
 
 	for _, channel := range channels {
-
-		chunkTracker := make([]ChunkTracker, 0)
-
-		Channel[channel.ChannelID] = PowChannel{
-			ChannelID:     channel.ChannelID,
-			Channel:       make(chan PowJob),
-			ChunkTrackers: &chunkTracker,
-		}
-
-		// start the worker
-		go PowWorker(Channel[channel.ChannelID].Channel, channel.ChannelID, err)
-
-		// Start lambda worker pool.
-		for i := 0; i < awsgateway.MaxConcurrency; i++ {
-			go lambdaWorker(provider, lambdaChan)
-		}
+		addPowChannel(channel.ChannelID)
 	}
 
 	PoWFrequency.Frequency = 2
+
+	if !oyster_utils.IsInUnitTest() {
+		go runPowPoolAdjuster(powPoolConfig)
+	}
 }
 
-func PowWorker(jobQueue <-chan PowJob, channelID string, err error) {
-	for powJobRequest := range jobQueue {
+func PowWorker(jobQueue <-chan PowJob, done <-chan struct{}, channelID string, err error) {
+	for {
+		var powJobRequest PowJob
+		select {
+		case powJobRequest = <-jobQueue:
+		case <-done:
+			fmt.Println("PowWorker: Removed from the pool")
+			return
+		}
+
 		// this is where we would call methods to deal with each job request
-		fmt.Println("PowWorker: Starting")
+		fmt.Println("PowWorker: Starting with " + Pow.Name())
 
 		startTime := time.Now()
 
-		err = doPoW(powJobRequest.Chunks)
+		err = Pow.AttachChunks(powJobRequest.Chunks)
 
-		if err == nil {
-			channelToChange := Channel[channelID]
+		if err == nil || err == ErrAttachPending {
+			channelToChange := PowChannel{ChannelID: channelID}
+			if powChannel, ok := getPowChannel(channelID); ok {
+				channelToChange = powChannel
+			}
 
 			channelInDB := models.ChunkChannel{}
-			models.DB.RawQuery("SELECT * FROM chunk_channels WHERE channel_id = ?", channelID).First(&channelInDB)
-			channelInDB.ChunksProcessed += len(powJobRequest.Chunks)
-			models.DB.ValidateAndSave(&channelInDB)
+			// the channel is no longer in the db if it was removed from the pool during this job
+			if models.DB.RawQuery("SELECT * FROM chunk_channels WHERE channel_id = ?", channelID).First(&channelInDB) == nil {
+				channelInDB.ChunksProcessed += len(powJobRequest.Chunks)
+				models.DB.ValidateAndSave(&channelInDB)
+			}
 
 			fmt.Println("PowWorker: Leaving")
-			TrackProcessingTime(startTime, len(powJobRequest.Chunks), &channelToChange)
+			// queued chunks took no time to attach yet, so they would skew the processing frequency
+			if err == nil {
+				TrackProcessingTime(startTime, len(powJobRequest.Chunks), &channelToChange)
+			}
 		} else {
 			fmt.Println("PowWorker: FAILED")
 			oyster_utils.LogIfError(err, nil)
@@ -229,54 +223,26 @@ func PowWorker(jobQueue <-chan PowJob, channelID string, err error) {
 	}
 }
 
+/*doPoW attaches the chunks with the selected PowProvider.  It returns ErrAttachPending if they were only queued.*/
 func doPoW(chunks []oyster_utils.ChunkData) error {
-	transfersArray := make([]bundle.Transfer, len(chunks))
-
-	for i, chunk := range chunks {
-		address, err := trinary.NewTrytes(chunk.Address)
-		if err != nil {
-			oyster_utils.LogIfError(err, nil)
-			panic(err)
-		}
-		transfersArray[i].Address = address
-		transfersArray[i].Value = uint64(0)
-		transfersArray[i].Message, err = trinary.NewTrytes(chunk.Message)
-		if err != nil {
-			oyster_utils.LogIfError(err, nil)
-			panic(err)
-		}
-		transfersArray[i].Tag = OysterTag
-	}
-
-	bdl, err := api.PrepareTransfers(seed, transfersArray, giota.PrepareTransfersOptions{})
-
-	oyster_utils.LogIfError(err, nil)
-
-	transactions, err := transaction.AsTransactionObjects(bdl, nil)
-	oyster_utils.LogIfError(err, nil)
-
-	transactionsToApprove, err := getTransactionsToApprove()
-	oyster_utils.LogIfError(err, nil)
-
-	if err == nil {
-		err = doPowAndBroadcast(
-			transactionsToApprove.BranchTransaction,
-			transactionsToApprove.TrunkTransaction,
-			minDepth,
-			transactions,
-			minWeightMag,
-			bestPow,
-			[]string{""})
-	}
-
-	return err
+	return Pow.AttachChunks(chunks)
 }
 
 func getTransactionsToApprove() (*giota.TransactionsToApprove, error) {
-	return api.GetTransactionsToApprove(uint64(minDepth), "")
+	node := IriNodes.GetNode()
+	transactionsToApprove, err := node.api.GetTransactionsToApprove(uint64(minDepth), "")
+	IriNodes.ReportError(node, err)
+	return transactionsToApprove, err
 }
 
 func TrackProcessingTime(startTime time.Time, numChunks int, channel *PowChannel) {
+	trackerMutex.Lock()
+	defer trackerMutex.Unlock()
+
+	if channel.ChunkTrackers == nil {
+		chunkTracker := make([]ChunkTracker, 0)
+		channel.ChunkTrackers = &chunkTracker
+	}
 
 	*(channel.ChunkTrackers) = append(*(channel.ChunkTrackers), ChunkTracker{
 		ChunkCount:  numChunks,
@@ -304,6 +270,9 @@ func TrackProcessingTime(startTime time.Time, numChunks int, channel *PowChannel
 }
 
 func GetProcessingFrequency() float64 {
+	trackerMutex.Lock()
+	defer trackerMutex.Unlock()
+
 	return PoWFrequency.Frequency
 }
 
@@ -321,13 +290,16 @@ func findTransactions(addresses []trinary.Hash) (map[trinary.Hash][]transaction.
 		req := giota.FindTransactionsQuery{
 			Addresses: addresses[lower:upper],
 		}
-		transactionsHashes, err := api.FindTransactions(req)
+		node := IriNodes.GetNode()
+		transactionsHashes, err := node.api.FindTransactions(req)
 		if err != nil {
+			IriNodes.ReportError(node, err)
 			oyster_utils.LogIfError(err, nil)
 			return nil, err
 		}
-		transactionTrytes, err := api.GetTrytes(transactionsHashes...)
+		transactionTrytes, err := node.api.GetTrytes(transactionsHashes...)
 		if err != nil {
+			IriNodes.ReportError(node, err)
 			oyster_utils.LogIfError(err, nil)
 			return nil, err
 		}
@@ -391,16 +363,18 @@ func doPowAndBroadcast(branch trinary.Trytes, trunk trinary.Trytes, depth int64,
 	go func(transactions []transaction.Transaction, broadcastProperties analytics.Properties) {
 		trytes := transaction.MustTransactionsToTrytes(transactions)
 
-		_, err = api.BroadcastTransactions(trytes...)
+		node := IriNodes.GetNode()
+		_, err = node.api.BroadcastTransactions(trytes...)
 
 		if err != nil {
+			IriNodes.ReportError(node, err)
 
 			// Async log
 			oyster_utils.LogToSegment("iota_wrappers: broadcast_FAIL", broadcastProperties)
 			oyster_utils.LogIfError(err, nil)
 		} else {
 
-			_, err = api.StoreTransactions(trytes...)
+			_, err = node.api.StoreTransactions(trytes...)
 			fmt.Println("BROADCAST SUCCESS")
 
 			// Async log
@@ -411,25 +385,44 @@ func doPowAndBroadcast(branch trinary.Trytes, trunk trinary.Trytes, depth int64,
 	return nil
 }
 
-func sendChunksToLambda(chunks *[]oyster_utils.ChunkData) {
-
-	go batchPowOnLambda(chunks)
-}
-
 func sendChunksToChannel(chunks []oyster_utils.ChunkData, channel *models.ChunkChannel) {
 
-	channel.EstReadyTime = SetEstimatedReadyTime(Channel[channel.ChannelID], len(chunks))
-	models.DB.ValidateAndSave(channel)
-
 	powJob := PowJob{
 		Chunks:         chunks,
 		BroadcastNodes: make([]string, 1),
 	}
 
-	Channel[channel.ChannelID].Channel <- powJob
+	for {
+		powChannel, ok := getPowChannel(channel.ChannelID)
+		if !ok {
+			// The channel was removed from the pool after it was assigned these chunks, use another one.
+			channels := getPowChannels()
+			if len(channels) == 0 {
+				oyster_utils.LogIfError(errors.New("no PoW channel left for the chunks of channel "+
+					channel.ChannelID), nil)
+				return
+			}
+			powChannel = channels[0]
+			if err := models.DB.Where("channel_id = ?", powChannel.ChannelID).First(channel); err != nil {
+				oyster_utils.LogIfError(err, nil)
+				continue
+			}
+		}
+
+		channel.EstReadyTime = SetEstimatedReadyTime(powChannel, len(chunks))
+		models.DB.ValidateAndSave(channel)
+
+		select {
+		case powChannel.Channel <- powJob:
+			return
+		case <-powChannel.done:
+		}
+	}
 }
 
 func SetEstimatedReadyTime(channel PowChannel, numChunks int) time.Time {
+	trackerMutex.Lock()
+	defer trackerMutex.Unlock()
 
 	if channel.Channel == nil {
 		delay := time.Duration(PoWFrequency.Frequency) * time.Second
@@ -439,7 +432,7 @@ func SetEstimatedReadyTime(channel PowChannel, numChunks int) time.Time {
 	var totalTime time.Duration = 0
 	chunksCount := 0
 
-	if len(*(channel.ChunkTrackers)) != 0 {
+	if channel.ChunkTrackers != nil && len(*(channel.ChunkTrackers)) != 0 {
 
 		for _, timeRecord := range *(channel.ChunkTrackers) {
 			totalTime += timeRecord.ElapsedTime
@@ -490,9 +483,11 @@ func verifyChunksMatchRecord(chunks []oyster_utils.ChunkData, checkTrunkAndBranc
 		Addresses: addresses,
 	}
 
-	responseHashes, err := api.FindTransactions(request)
+	node := IriNodes.GetNode()
+	responseHashes, err := node.api.FindTransactions(request)
 
 	if err != nil {
+		IriNodes.ReportError(node, err)
 		oyster_utils.LogIfError(err, nil)
 		return filteredChunks, err
 	}
@@ -535,8 +530,10 @@ func filterChunks(hashes []trinary.Trytes, chunks []oyster_utils.ChunkData, chec
 			break
 		}
 
-		trytesArray, err := api.GetTrytes(hashes[i:end]...)
+		node := IriNodes.GetNode()
+		trytesArray, err := node.api.GetTrytes(hashes[i:end]...)
 		if err != nil {
+			IriNodes.ReportError(node, err)
 			oyster_utils.LogIfError(err, nil)
 			continue
 		}
@@ -662,7 +659,7 @@ func verifyTreasure(addr []string) (bool, error) {
 	return true, nil
 }
 
-func lambdaWorker(provider string, lChan <-chan []*awsgateway.HooknodeChunk) {
+func lambdaWorker(lChan <-chan []*awsgateway.HooknodeChunk) {
 	for chkBatch := range lChan {
 		if len(chkBatch) <= 0 {
 			continue
@@ -671,15 +668,18 @@ func lambdaWorker(provider string, lChan <-chan []*awsgateway.HooknodeChunk) {
 		fmt.Printf("Lambda Worker Processing!!! \t %d chunks\n", len(chkBatch))
 
 		req := awsgateway.HooknodeReq{
-			Provider: provider,
+			Provider: IriNodes.GetNode().URI,
 			Chunks:   chkBatch,
 		}
 
-		err := awsgateway.InvokeHooknode(&req)
+		err := InvokeHooknodeFunc(&req)
+		recordLambdaResult(err)
 		oyster_utils.LogIfError(err, nil)
 
 		if err != nil {
 			fmt.Println(err)
+			// keep the batch, so that it is attached later instead of waiting for verification to catch it
+			enqueueLambdaRetry(chkBatch, err)
 		}
 		fmt.Println("DONE PROCESSING!!!!!")
 
@@ -687,7 +687,7 @@ func lambdaWorker(provider string, lChan <-chan []*awsgateway.HooknodeChunk) {
 	}
 }
 
-func batchPowOnLambda(chunks *[]oyster_utils.ChunkData) {
+func batchPowOnLambda(chunks *[]oyster_utils.ChunkData) error {
 	// Batch chunks by limit
 	numBatches := (len(*chunks) / awsgateway.MaxChunksLen) + 1
 	for i := 0; i < numBatches; i++ {
@@ -715,7 +715,7 @@ func batchPowOnLambda(chunks *[]oyster_utils.ChunkData) {
 			msg, err := trinary.NewTrytes(chk.Message)
 			if err != nil {
 				oyster_utils.LogIfError(err, nil)
-				panic(err)
+				return err
 			}
 			lamChk.Message = msg
 
@@ -725,4 +725,5 @@ func batchPowOnLambda(chunks *[]oyster_utils.ChunkData) {
 		// Push chunkBatch to chan
 		lambdaChan <- chunkBatch
 	}
+	return nil
 }
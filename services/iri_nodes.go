@@ -0,0 +1,261 @@
+package services
+
+import (
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	giota "github.com/iotaledger/iota.go/api"
+	"github.com/oysterprotocol/brokernode/utils"
+	"github.com/pkg/errors"
+)
+
+const (
+	/*IriSelectionRoundRobin uses the healthy IRI nodes in turn.*/
+	IriSelectionRoundRobin = "round_robin"
+	/*IriSelectionLatency uses the healthy IRI node which answered its last health check the fastest.*/
+	IriSelectionLatency = "latency"
+)
+
+/*IriNode is one of the IRI nodes the broker talks to.*/
+type IriNode struct {
+	URI string
+	/*api does the proof of work locally, remoteAPI lets the IRI node do it with attachToTangle.*/
+	api       *giota.API
+	remoteAPI *giota.API
+}
+
+/*IriNodeStatus is the result of the last health check of an IRI node.*/
+type IriNodeStatus struct {
+	URI                                string        `json:"uri"`
+	Healthy                            bool          `json:"healthy"`
+	Latency                            time.Duration `json:"latency"`
+	LatestMilestoneIndex               int64         `json:"latestMilestoneIndex"`
+	LatestSolidSubtangleMilestoneIndex int64         `json:"latestSolidSubtangleMilestoneIndex"`
+	LastCheck                          time.Time     `json:"lastCheck"`
+	LastError                          string        `json:"lastError,omitempty"`
+}
+
+/*IriNodePool picks the IRI node for each request to the tangle, leaving out the nodes which failed their health
+check.*/
+type IriNodePool struct {
+	mutex     sync.Mutex
+	nodes     []IriNode
+	statuses  map[string]IriNodeStatus
+	selection string
+	next      int
+	/*MaxMilestoneLag is how many milestones a node may be behind before it is ejected.*/
+	MaxMilestoneLag int64
+}
+
+/*IriNodes are the IRI nodes from IRI_HOSTS, or the one at HOST_IP.*/
+var IriNodes *IriNodePool
+
+var startIriHealthChecksOnce sync.Once
+
+/*NewIriNodePool returns a pool of the IRI nodes at uris.  Every node counts as healthy until it is checked.*/
+func NewIriNodePool(uris []string, selection string, maxMilestoneLag int64) (*IriNodePool, error) {
+	if len(uris) == 0 {
+		return nil, errors.New("no IRI nodes configured")
+	}
+
+	pool := &IriNodePool{
+		statuses:        make(map[string]IriNodeStatus),
+		selection:       selection,
+		MaxMilestoneLag: maxMilestoneLag,
+	}
+	for _, uri := range uris {
+		api, err := giota.ComposeAPI(giota.HTTPClientSettings{
+			URI:                  uri,
+			LocalProofOfWorkFunc: bestPow,
+		})
+		if err != nil {
+			return nil, err
+		}
+		// without a local proof of work function, attachToTangle is done by the IRI node
+		remoteAPI, err := giota.ComposeAPI(giota.HTTPClientSettings{
+			URI: uri,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		pool.nodes = append(pool.nodes, IriNode{URI: uri, api: api, remoteAPI: remoteAPI})
+		pool.statuses[uri] = IriNodeStatus{URI: uri, Healthy: true}
+	}
+	return pool, nil
+}
+
+/*GetNode returns the IRI node to send the next request to.  If every node is unhealthy, they are all used, since
+an unhealthy node is better than none.*/
+func (p *IriNodePool) GetNode() IriNode {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	candidates := []IriNode{}
+	for _, node := range p.nodes {
+		if p.statuses[node.URI].Healthy {
+			candidates = append(candidates, node)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = p.nodes
+	}
+
+	if p.selection == IriSelectionLatency {
+		best := candidates[0]
+		for _, node := range candidates[1:] {
+			if p.statuses[node.URI].Latency < p.statuses[best.URI].Latency {
+				best = node
+			}
+		}
+		return best
+	}
+
+	p.next = (p.next + 1) % len(candidates)
+	return candidates[p.next]
+}
+
+/*ReportError ejects the node after a request which failed to reach it, until its next health check passes.
+Errors the node answered with, such as an invalid request, do not eject it.*/
+func (p *IriNodePool) ReportError(node IriNode, err error) {
+	if err == nil || !isTransportError(err) {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	status := p.statuses[node.URI]
+	status.Healthy = false
+	status.LastError = err.Error()
+	p.statuses[node.URI] = status
+}
+
+/*CheckHealth asks every node for its node info.  Nodes which do not answer, are not synced with their latest
+milestone or are more than MaxMilestoneLag milestones behind the best node are ejected.*/
+func (p *IriNodePool) CheckHealth() {
+	statuses := make([]IriNodeStatus, len(p.nodes))
+
+	var wg sync.WaitGroup
+	for i, node := range p.nodes {
+		wg.Add(1)
+		go func(i int, node IriNode) {
+			defer wg.Done()
+			statuses[i] = checkIriNode(node)
+		}(i, node)
+	}
+	wg.Wait()
+
+	p.updateStatuses(statuses)
+}
+
+/*GetStatuses returns the status of every node.*/
+func (p *IriNodePool) GetStatuses() []IriNodeStatus {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	statuses := make([]IriNodeStatus, 0, len(p.nodes))
+	for _, node := range p.nodes {
+		statuses = append(statuses, p.statuses[node.URI])
+	}
+	return statuses
+}
+
+func (p *IriNodePool) updateStatuses(statuses []IriNodeStatus) {
+	bestMilestoneIndex := int64(0)
+	for _, status := range statuses {
+		if status.LastError == "" && status.LatestMilestoneIndex > bestMilestoneIndex {
+			bestMilestoneIndex = status.LatestMilestoneIndex
+		}
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, status := range statuses {
+		if status.LastError == "" {
+			switch {
+			case status.LatestMilestoneIndex-status.LatestSolidSubtangleMilestoneIndex > p.MaxMilestoneLag:
+				status.LastError = "node is not synced"
+			case bestMilestoneIndex-status.LatestSolidSubtangleMilestoneIndex > p.MaxMilestoneLag:
+				status.LastError = "node is behind the other nodes"
+			}
+		}
+		status.Healthy = status.LastError == ""
+		if !status.Healthy && p.statuses[status.URI].Healthy {
+			oyster_utils.LogIfError(errors.New("ejected IRI node "+status.URI+": "+status.LastError), nil)
+		}
+		p.statuses[status.URI] = status
+	}
+}
+
+func checkIriNode(node IriNode) IriNodeStatus {
+	status := IriNodeStatus{URI: node.URI, LastCheck: time.Now()}
+
+	nodeInfo, err := node.api.GetNodeInfo()
+	status.Latency = time.Since(status.LastCheck)
+	if err != nil {
+		status.LastError = err.Error()
+		return status
+	}
+
+	status.LatestMilestoneIndex = nodeInfo.LatestMilestoneIndex
+	status.LatestSolidSubtangleMilestoneIndex = nodeInfo.LatestSolidSubtangleMilestoneIndex
+	return status
+}
+
+/*isTransportError returns whether the request failed because the node could not be reached or did not answer.*/
+func isTransportError(err error) bool {
+	switch cause := errors.Cause(err).(type) {
+	case *url.Error, net.Error:
+		return true
+	default:
+		return cause == io.EOF || cause == io.ErrUnexpectedEOF
+	}
+}
+
+/*StartIriHealthChecks checks the health of IriNodes every IRI_HEALTH_CHECK_INTERVAL in the background.  Calling it
+again does nothing.*/
+func StartIriHealthChecks() {
+	startIriHealthChecksOnce.Do(func() {
+		go runIriHealthChecks(IriNodes, oyster_utils.GetEnvDuration("IRI_HEALTH_CHECK_INTERVAL", 30*time.Second))
+	})
+}
+
+func runIriHealthChecks(pool *IriNodePool, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	pool.CheckHealth()
+	for range time.Tick(interval) {
+		pool.CheckHealth()
+	}
+}
+
+/*getIriURIs reads IRI_HOSTS, a comma separated list of hosts or URIs of IRI nodes.  If it is not set, the node
+at HOST_IP is used.*/
+func getIriURIs() []string {
+	hosts := os.Getenv("IRI_HOSTS")
+	if hosts == "" {
+		hosts = os.Getenv("HOST_IP")
+	}
+
+	uris := []string{}
+	for _, host := range strings.Split(hosts, ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		if !strings.Contains(host, "://") {
+			host = "http://" + host + ":14265"
+		}
+		uris = append(uris, host)
+	}
+	return uris
+}
@@ -0,0 +1,58 @@
+package services_test
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+func Test_IriNodePool_RoundRobin(t *testing.T) {
+	pool, err := services.NewIriNodePool([]string{"http://node-a:14265", "http://node-b:14265"},
+		services.IriSelectionRoundRobin, 2)
+	oyster_utils.AssertNoError(err, t, "")
+
+	first := pool.GetNode()
+	second := pool.GetNode()
+	oyster_utils.AssertTrue(first.URI != second.URI, t, "Expected the nodes to be used in turn")
+	oyster_utils.AssertStringEqual(pool.GetNode().URI, first.URI, t)
+}
+
+func Test_IriNodePool_ReportError(t *testing.T) {
+	pool, err := services.NewIriNodePool([]string{"http://node-a:14265", "http://node-b:14265"},
+		services.IriSelectionRoundRobin, 2)
+	oyster_utils.AssertNoError(err, t, "")
+
+	pool.ReportError(services.IriNode{URI: "http://node-a:14265"}, getTransportErrorForTest("http://node-a:14265"))
+
+	// node-a is ejected, so every request goes to node-b.
+	for i := 0; i < 3; i++ {
+		oyster_utils.AssertStringEqual(pool.GetNode().URI, "http://node-b:14265", t)
+	}
+	oyster_utils.AssertTrue(!pool.GetStatuses()[0].Healthy, t, "Expected node-a to be unhealthy")
+
+	// With every node ejected, the nodes are still used.
+	pool.ReportError(pool.GetNode(), getTransportErrorForTest("http://node-b:14265"))
+	oyster_utils.AssertTrue(pool.GetNode().URI != "", t, "Expected a node even if all are unhealthy")
+}
+
+func Test_IriNodePool_ReportError_NodeAnswered(t *testing.T) {
+	pool, err := services.NewIriNodePool([]string{"http://node-a:14265", "http://node-b:14265"},
+		services.IriSelectionRoundRobin, 2)
+	oyster_utils.AssertNoError(err, t, "")
+
+	// the node answered, so the request was at fault rather than the node
+	pool.ReportError(services.IriNode{URI: "http://node-a:14265"}, errors.New("invalid trytes"))
+	oyster_utils.AssertTrue(pool.GetStatuses()[0].Healthy, t, "Expected node-a to stay healthy")
+}
+
+func Test_NewIriNodePool_NoNodes(t *testing.T) {
+	_, err := services.NewIriNodePool([]string{}, services.IriSelectionRoundRobin, 2)
+	oyster_utils.AssertError(err, t, "Expected an error without IRI nodes")
+}
+
+func getTransportErrorForTest(uri string) error {
+	return &url.Error{Op: "Post", URL: uri, Err: errors.New("connection refused")}
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services/awsgateway"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+const (
+	/*MaxLambdaRetryDelay is the longest a failed batch waits for its next attempt.*/
+	MaxLambdaRetryDelay = 30 * time.Minute
+	/*LambdaRetryBatchSize is the max number of retries processed in one run.*/
+	LambdaRetryBatchSize = 100
+)
+
+/*InvokeHooknode defines the type for a function which sends a batch of chunks to the hooknode lambda.  This type
+used for mocking.*/
+type InvokeHooknode func(req *awsgateway.HooknodeReq) error
+
+var (
+	/*InvokeHooknodeFunc is replaced in tests so that no lambda is invoked.*/
+	InvokeHooknodeFunc InvokeHooknode = awsgateway.InvokeHooknode
+	/*LambdaFallbackPow attaches the chunks while the lambda is in fallback.  It defaults to local PoW.*/
+	LambdaFallbackPow PowProvider
+	/*LambdaClock tells when the fallback of the lambda is over.  It is replaced in tests.*/
+	LambdaClock = time.Now
+
+	lambdaHealth = lambdaHealthState{}
+)
+
+/*lambdaHealthState tracks the consecutive failures of the lambda.  Once there are LAMBDA_FALLBACK_THRESHOLD of
+them, chunks are attached with local PoW for LAMBDA_FALLBACK_DURATION before the lambda is tried again.*/
+type lambdaHealthState struct {
+	mutex               sync.Mutex
+	consecutiveFailures int
+	fallbackUntil       time.Time
+}
+
+/*LambdaRetryResult is the outcome of one run of ProcessLambdaRetries.*/
+type LambdaRetryResult struct {
+	Attached    int
+	Failed      int
+	DeadLetters int
+}
+
+/*IsLambdaInFallback returns whether chunks are attached with local PoW because the lambda kept failing.*/
+func IsLambdaInFallback() bool {
+	lambdaHealth.mutex.Lock()
+	defer lambdaHealth.mutex.Unlock()
+
+	return LambdaClock().Before(lambdaHealth.fallbackUntil)
+}
+
+/*ResetLambdaHealth forgets the failures of the lambda and ends its fallback.*/
+func ResetLambdaHealth() {
+	lambdaHealth.mutex.Lock()
+	defer lambdaHealth.mutex.Unlock()
+
+	lambdaHealth.consecutiveFailures = 0
+	lambdaHealth.fallbackUntil = time.Time{}
+}
+
+/*GetLambdaRetryDelay doubles the LAMBDA_RETRY_BASE_DELAY for each failed attempt, up to MaxLambdaRetryDelay.*/
+func GetLambdaRetryDelay(attempts int) time.Duration {
+	delay := oyster_utils.GetEnvDuration("LAMBDA_RETRY_BASE_DELAY", 30*time.Second)
+	for i := 1; i < attempts && delay < MaxLambdaRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > MaxLambdaRetryDelay {
+		delay = MaxLambdaRetryDelay
+	}
+	return delay
+}
+
+/*ProcessLambdaRetries attempts the due batches of the retry queue again.  While the lambda is in fallback, the
+batches are attached with local PoW instead.*/
+func ProcessLambdaRetries() (LambdaRetryResult, error) {
+	result := LambdaRetryResult{}
+
+	retries, err := models.GetDueLambdaRetries(LambdaRetryBatchSize)
+	if err != nil {
+		return result, err
+	}
+
+	maxAttempts := oyster_utils.GetEnvInt("LAMBDA_MAX_ATTEMPTS", 5)
+	for _, retry := range retries {
+		chunks := []*awsgateway.HooknodeChunk{}
+		if err := json.Unmarshal([]byte(retry.Payload), &chunks); err != nil {
+			// the payload can never be sent, so there is no point in more attempts
+			oyster_utils.LogIfError(retry.RecordFailedAttempt(err.Error(), 0, time.Now()), nil)
+			PrometheusWrapper.CounterIncrement(PrometheusWrapper.CounterLambdaDeadLetters)
+			result.DeadLetters++
+			continue
+		}
+
+		if err := attachLambdaBatch(chunks); err != nil {
+			nextAttemptAt := time.Now().Add(GetLambdaRetryDelay(retry.Attempts + 1))
+			if err := retry.RecordFailedAttempt(err.Error(), maxAttempts, nextAttemptAt); err != nil {
+				return result, err
+			}
+			if retry.Status == models.LambdaRetryDeadLetter {
+				PrometheusWrapper.CounterIncrement(PrometheusWrapper.CounterLambdaDeadLetters)
+				oyster_utils.LogIfError(fmt.Errorf("lambda batch %v of %v chunks moved to the dead letter "+
+					"state after %v attempts: %v", retry.ID, retry.NumChunks, retry.Attempts, err), nil)
+				result.DeadLetters++
+			} else {
+				result.Failed++
+			}
+			continue
+		}
+
+		if err := models.DeleteLambdaRetry(retry); err != nil {
+			return result, err
+		}
+		result.Attached += retry.NumChunks
+	}
+	return result, nil
+}
+
+/*attachLambdaBatch sends the batch to the lambda, or attaches it with local PoW while the lambda is in fallback.*/
+func attachLambdaBatch(chkBatch []*awsgateway.HooknodeChunk) error {
+	if IsLambdaInFallback() {
+		return getLambdaFallbackPow().AttachChunks(toChunkData(chkBatch))
+	}
+
+	err := InvokeHooknodeFunc(&awsgateway.HooknodeReq{
+		Provider: IriNodes.GetNode().URI,
+		Chunks:   chkBatch,
+	})
+	recordLambdaResult(err)
+	return err
+}
+
+/*enqueueLambdaRetry stores a batch which the lambda failed to attach, so that it is attempted again later.*/
+func enqueueLambdaRetry(chkBatch []*awsgateway.HooknodeChunk, invokeErr error) {
+	payload, err := json.Marshal(chkBatch)
+	if err != nil {
+		oyster_utils.LogIfError(err, nil)
+		return
+	}
+
+	_, err = models.CreateLambdaRetry(string(payload), len(chkBatch), invokeErr.Error(),
+		time.Now().Add(GetLambdaRetryDelay(1)))
+	oyster_utils.LogIfError(err, nil)
+}
+
+func recordLambdaResult(err error) {
+	lambdaHealth.mutex.Lock()
+	defer lambdaHealth.mutex.Unlock()
+
+	if err == nil {
+		lambdaHealth.consecutiveFailures = 0
+		return
+	}
+
+	PrometheusWrapper.CounterIncrement(PrometheusWrapper.CounterLambdaFailures)
+	lambdaHealth.consecutiveFailures++
+	if lambdaHealth.consecutiveFailures >= oyster_utils.GetEnvInt("LAMBDA_FALLBACK_THRESHOLD", 3) {
+		lambdaHealth.consecutiveFailures = 0
+		lambdaHealth.fallbackUntil = LambdaClock().Add(oyster_utils.GetEnvDuration("LAMBDA_FALLBACK_DURATION", 5*time.Minute))
+		oyster_utils.LogIfError(fmt.Errorf("lambda keeps failing, attaching chunks with local PoW until %v",
+			lambdaHealth.fallbackUntil), nil)
+	}
+}
+
+func getLambdaFallbackPow() PowProvider {
+	if LambdaFallbackPow == nil {
+		LambdaFallbackPow = NewPowProvider(PowProviderLocal)
+	}
+	return LambdaFallbackPow
+}
+
+func toChunkData(chkBatch []*awsgateway.HooknodeChunk) []oyster_utils.ChunkData {
+	chunks := make([]oyster_utils.ChunkData, len(chkBatch))
+	for i, chk := range chkBatch {
+		chunks[i] = oyster_utils.ChunkData{
+			Address: chk.Address,
+			Message: string(chk.Message),
+		}
+	}
+	return chunks
+}
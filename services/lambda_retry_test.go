@@ -0,0 +1,116 @@
+package services_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/services/awsgateway"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+func Test_GetLambdaRetryDelay(t *testing.T) {
+	os.Setenv("LAMBDA_RETRY_BASE_DELAY", "1m")
+	defer os.Unsetenv("LAMBDA_RETRY_BASE_DELAY")
+
+	oyster_utils.AssertTrue(services.GetLambdaRetryDelay(1) == time.Minute, t, "Expected the base delay")
+	oyster_utils.AssertTrue(services.GetLambdaRetryDelay(3) == 4*time.Minute, t, "Expected the delay to double")
+	oyster_utils.AssertTrue(services.GetLambdaRetryDelay(20) == services.MaxLambdaRetryDelay, t,
+		"Expected the delay to be capped")
+}
+
+func Test_ProcessLambdaRetries_Attached(t *testing.T) {
+	resetLambdaRetries(t)
+	defer mockInvokeHooknode(nil)()
+
+	createDueLambdaRetry(t, 2)
+
+	result, err := services.ProcessLambdaRetries()
+	oyster_utils.AssertNoError(err, t, "")
+	oyster_utils.AssertTrue(result.Attached == 2, t, "Expected the chunks to be attached")
+
+	retries, _ := models.GetDueLambdaRetries(10)
+	oyster_utils.AssertTrue(len(retries) == 0, t, "Expected the attached retry to be removed")
+}
+
+func Test_ProcessLambdaRetries_DeadLetter(t *testing.T) {
+	resetLambdaRetries(t)
+	defer mockInvokeHooknode(errors.New("lambda timed out"))()
+	os.Setenv("LAMBDA_MAX_ATTEMPTS", "2")
+	defer os.Unsetenv("LAMBDA_MAX_ATTEMPTS")
+	os.Setenv("LAMBDA_FALLBACK_THRESHOLD", "100")
+	defer os.Unsetenv("LAMBDA_FALLBACK_THRESHOLD")
+
+	createDueLambdaRetry(t, 1)
+
+	result, err := services.ProcessLambdaRetries()
+	oyster_utils.AssertNoError(err, t, "")
+	oyster_utils.AssertTrue(result.DeadLetters == 1, t, "Expected the retry to use up its attempts")
+
+	counts, _ := models.GetLambdaRetryCounts()
+	oyster_utils.AssertTrue(counts[models.LambdaRetryDeadLetter] == 1, t, "Expected a dead letter")
+}
+
+func Test_ProcessLambdaRetries_Fallback(t *testing.T) {
+	resetLambdaRetries(t)
+	defer services.ResetLambdaHealth()
+	defer mockInvokeHooknode(errors.New("lambda timed out"))()
+	os.Setenv("LAMBDA_FALLBACK_THRESHOLD", "1")
+	defer os.Unsetenv("LAMBDA_FALLBACK_THRESHOLD")
+	os.Setenv("LAMBDA_FALLBACK_DURATION", "1m")
+	defer os.Unsetenv("LAMBDA_FALLBACK_DURATION")
+	now := time.Now()
+	services.LambdaClock = func() time.Time { return now }
+	defer func() { services.LambdaClock = time.Now }()
+
+	fallbackPow := services.NewFakePowProvider()
+	services.LambdaFallbackPow = fallbackPow
+	defer func() { services.LambdaFallbackPow = nil }()
+
+	createDueLambdaRetry(t, 1)
+	createDueLambdaRetry(t, 1)
+
+	// The first retry fails on the lambda and puts it in fallback, the second one is attached locally.
+	result, err := services.ProcessLambdaRetries()
+	oyster_utils.AssertNoError(err, t, "")
+	oyster_utils.AssertTrue(result.Failed == 1, t, "Expected the first retry to fail")
+	oyster_utils.AssertTrue(result.Attached == 1, t, "Expected the second retry to be attached locally")
+	oyster_utils.AssertTrue(len(fallbackPow.AttachedChunks) == 1, t, "Expected local PoW for the chunk")
+
+	now = now.Add(time.Minute)
+	oyster_utils.AssertTrue(!services.IsLambdaInFallback(), t, "Expected the fallback to be over")
+}
+
+func mockInvokeHooknode(err error) func() {
+	original := services.InvokeHooknodeFunc
+	services.InvokeHooknodeFunc = func(req *awsgateway.HooknodeReq) error {
+		return err
+	}
+	return func() {
+		services.InvokeHooknodeFunc = original
+	}
+}
+
+func createDueLambdaRetry(t *testing.T, numChunks int) {
+	chunks := make([]*awsgateway.HooknodeChunk, numChunks)
+	for i := range chunks {
+		chunks[i] = &awsgateway.HooknodeChunk{
+			Address: oyster_utils.RandSeq(81, oyster_utils.TrytesAlphabet),
+			Message: "ABC",
+			Tag:     services.OysterTagHook,
+		}
+	}
+	payload, _ := json.Marshal(chunks)
+
+	_, err := models.CreateLambdaRetry(string(payload), numChunks, "lambda timed out", time.Now().Add(-time.Minute))
+	oyster_utils.AssertNoError(err, t, "")
+}
+
+func resetLambdaRetries(t *testing.T) {
+	services.ResetLambdaHealth()
+	oyster_utils.AssertNoError(models.DB.RawQuery("DELETE FROM lambda_retries").Exec(), t, "")
+}
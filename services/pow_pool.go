@@ -0,0 +1,248 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+/*PowPoolConfig decides how many channels the PoW pool may have.*/
+type PowPoolConfig struct {
+	MinChannels int
+	/*MaxChannels is the CPU budget of the pool, each channel does its proof of work on one CPU.*/
+	MaxChannels int
+	/*TargetDrainTime is how long the pool should take to attach the backlog of chunks.*/
+	TargetDrainTime time.Duration
+	/*AdjustInterval is how often the pool is resized.  0 means the pool keeps its initial size.*/
+	AdjustInterval time.Duration
+}
+
+var (
+	// channelMutex guards Channel and PowProcs, which change when the pool is resized.
+	channelMutex = &sync.RWMutex{}
+	// trackerMutex guards the ChunkTrackers of the channels and PoWFrequency.
+	trackerMutex = &sync.Mutex{}
+	// resizeMutex makes sure only one resize of the pool runs at a time.
+	resizeMutex = &sync.Mutex{}
+)
+
+/*GetPowPoolConfig reads the config of the pool from the POW_CPU_BUDGET, POW_POOL_MIN_CHANNELS,
+POW_POOL_TARGET_DRAIN_TIME and POW_POOL_ADJUST_INTERVAL env vars.*/
+func GetPowPoolConfig() PowPoolConfig {
+	defaultMaxChannels := runtime.NumCPU()
+	if defaultMaxChannels != 1 {
+		defaultMaxChannels--
+	}
+
+	config := PowPoolConfig{
+		MinChannels:     oyster_utils.GetEnvInt("POW_POOL_MIN_CHANNELS", 1),
+		MaxChannels:     oyster_utils.GetEnvInt("POW_CPU_BUDGET", defaultMaxChannels),
+		TargetDrainTime: oyster_utils.GetEnvDuration("POW_POOL_TARGET_DRAIN_TIME", 5*time.Minute),
+		AdjustInterval:  oyster_utils.GetEnvDuration("POW_POOL_ADJUST_INTERVAL", 30*time.Second),
+	}
+	if config.MinChannels < 1 {
+		config.MinChannels = 1
+	}
+	if config.MaxChannels < config.MinChannels {
+		config.MaxChannels = config.MinChannels
+	}
+	return config
+}
+
+/*GetDesiredPowPoolSize returns the number of channels which attach backlogChunks within the TargetDrainTime,
+when each channel attaches chunksPerSecond.  Without a measured throughput a backlog gets every channel of the
+budget.*/
+func GetDesiredPowPoolSize(backlogChunks int, chunksPerSecond float64, config PowPoolConfig) int {
+	desired := config.MinChannels
+	switch {
+	case backlogChunks <= 0:
+	case chunksPerSecond <= 0 || config.TargetDrainTime <= 0:
+		desired = config.MaxChannels
+	default:
+		chunksPerChannel := chunksPerSecond * config.TargetDrainTime.Seconds()
+		desired = int(math.Ceil(float64(backlogChunks) / chunksPerChannel))
+	}
+
+	return int(math.Max(float64(config.MinChannels), math.Min(float64(config.MaxChannels), float64(desired))))
+}
+
+/*GetPowPoolSize returns the number of channels in the pool.*/
+func GetPowPoolSize() int {
+	channelMutex.RLock()
+	defer channelMutex.RUnlock()
+
+	return len(Channel)
+}
+
+/*GetChannelThroughput returns how many chunks per second the channel attached in its recent PoW jobs.*/
+func GetChannelThroughput(channel PowChannel) float64 {
+	trackerMutex.Lock()
+	defer trackerMutex.Unlock()
+
+	return getChannelThroughput(channel)
+}
+
+/*GetChannelThroughputs returns the throughput of every channel in the pool by ChannelID.*/
+func GetChannelThroughputs() map[string]float64 {
+	throughputs := make(map[string]float64)
+	for _, channel := range getPowChannels() {
+		throughputs[channel.ChannelID] = GetChannelThroughput(channel)
+	}
+	return throughputs
+}
+
+/*GetPowBacklog returns the number of chunks of the ready sessions which have not been attached yet.*/
+func GetPowBacklog() (int, error) {
+	sessions, err := models.GetReadySessions()
+	if err != nil {
+		return 0, err
+	}
+
+	backlog := 0
+	for _, session := range sessions {
+		backlog += session.GetNumChunksToAttach()
+	}
+	return backlog, nil
+}
+
+/*AdjustPowPool resizes the pool to the backlog of chunks and the average throughput of the channels.*/
+func AdjustPowPool(config PowPoolConfig) error {
+	backlog, err := GetPowBacklog()
+	if err != nil {
+		return err
+	}
+
+	size := GetDesiredPowPoolSize(backlog, getAverageThroughput(), config)
+	return ResizePowPool(size)
+}
+
+/*ResizePowPool adds or removes channels until the pool has size channels.  A removed channel finishes its
+current PoW job, and chunks which are still sent to it go to another channel.*/
+func ResizePowPool(size int) error {
+	if size < 1 {
+		return errors.New("the PoW pool needs at least one channel")
+	}
+
+	resizeMutex.Lock()
+	defer resizeMutex.Unlock()
+
+	for GetPowPoolSize() < size {
+		channel, err := models.AddChannel()
+		if err != nil {
+			return err
+		}
+		addPowChannel(channel.ChannelID)
+	}
+
+	for _, channel := range getPowChannels() {
+		if GetPowPoolSize() <= size {
+			break
+		}
+		// Delete it from the db first, so that no more chunks are assigned to it.
+		if err := models.DeleteChannel(channel.ChannelID); err != nil {
+			return err
+		}
+		removePowChannel(channel.ChannelID)
+	}
+	return nil
+}
+
+func runPowPoolAdjuster(config PowPoolConfig) {
+	if config.AdjustInterval <= 0 || config.MinChannels == config.MaxChannels {
+		return
+	}
+
+	for range time.Tick(config.AdjustInterval) {
+		oyster_utils.LogIfError(AdjustPowPool(config), nil)
+	}
+}
+
+func addPowChannel(channelID string) {
+	chunkTracker := make([]ChunkTracker, 0)
+	powChannel := PowChannel{
+		ChannelID:     channelID,
+		Channel:       make(chan PowJob),
+		ChunkTrackers: &chunkTracker,
+		done:          make(chan struct{}),
+	}
+
+	channelMutex.Lock()
+	Channel[channelID] = powChannel
+	PowProcs = len(Channel)
+	channelMutex.Unlock()
+
+	// start the worker
+	go PowWorker(powChannel.Channel, powChannel.done, channelID, nil)
+}
+
+func removePowChannel(channelID string) {
+	channelMutex.Lock()
+	defer channelMutex.Unlock()
+
+	powChannel, ok := Channel[channelID]
+	if !ok {
+		return
+	}
+	delete(Channel, channelID)
+	PowProcs = len(Channel)
+	close(powChannel.done)
+}
+
+func getPowChannel(channelID string) (PowChannel, bool) {
+	channelMutex.RLock()
+	defer channelMutex.RUnlock()
+
+	powChannel, ok := Channel[channelID]
+	return powChannel, ok
+}
+
+func getPowChannels() []PowChannel {
+	channelMutex.RLock()
+	defer channelMutex.RUnlock()
+
+	channels := make([]PowChannel, 0, len(Channel))
+	for _, powChannel := range Channel {
+		channels = append(channels, powChannel)
+	}
+	return channels
+}
+
+func getAverageThroughput() float64 {
+	trackerMutex.Lock()
+	defer trackerMutex.Unlock()
+
+	total := 0.0
+	measured := 0
+	for _, channel := range getPowChannels() {
+		if throughput := getChannelThroughput(channel); throughput > 0 {
+			total += throughput
+			measured++
+		}
+	}
+	if measured == 0 {
+		return 0
+	}
+	return total / float64(measured)
+}
+
+func getChannelThroughput(channel PowChannel) float64 {
+	if channel.ChunkTrackers == nil {
+		return 0
+	}
+
+	var totalTime time.Duration
+	chunksCount := 0
+	for _, tracker := range *(channel.ChunkTrackers) {
+		totalTime += tracker.ElapsedTime
+		chunksCount += tracker.ChunkCount
+	}
+	if totalTime <= 0 {
+		return 0
+	}
+	return float64(chunksCount) / totalTime.Seconds()
+}
@@ -0,0 +1,80 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/oysterprotocol/brokernode/models"
+	"github.com/oysterprotocol/brokernode/services"
+)
+
+func Test_GetDesiredPowPoolSize(t *testing.T) {
+	config := services.PowPoolConfig{MinChannels: 1, MaxChannels: 4, TargetDrainTime: time.Minute}
+
+	if size := services.GetDesiredPowPoolSize(0, 1, config); size != 1 {
+		t.Fatalf("GetDesiredPowPoolSize:  without a backlog the pool should shrink to 1 channel, got %v", size)
+	}
+	if size := services.GetDesiredPowPoolSize(100, 0, config); size != 4 {
+		t.Fatalf("GetDesiredPowPoolSize:  without a measured throughput the pool should use the whole "+
+			"budget, got %v", size)
+	}
+	// each channel attaches 60 chunks within the target drain time
+	if size := services.GetDesiredPowPoolSize(150, 1, config); size != 3 {
+		t.Fatalf("GetDesiredPowPoolSize:  150 chunks at 60 chunks per channel need 3 channels, got %v", size)
+	}
+	if size := services.GetDesiredPowPoolSize(10000, 1, config); size != 4 {
+		t.Fatalf("GetDesiredPowPoolSize:  the pool should not grow beyond the budget, got %v", size)
+	}
+}
+
+func Test_GetChannelThroughput(t *testing.T) {
+	chunkTracker := []services.ChunkTracker{
+		{ElapsedTime: 10 * time.Second, ChunkCount: 20},
+		{ElapsedTime: 10 * time.Second, ChunkCount: 40},
+	}
+	channel := services.PowChannel{ChunkTrackers: &chunkTracker}
+
+	if throughput := services.GetChannelThroughput(channel); throughput != 3 {
+		t.Fatalf("GetChannelThroughput:  60 chunks in 20 seconds should be 3 chunks per second, got %v", throughput)
+	}
+	if throughput := services.GetChannelThroughput(services.PowChannel{}); throughput != 0 {
+		t.Fatalf("GetChannelThroughput:  a channel without measurements should have no throughput, got %v",
+			throughput)
+	}
+}
+
+func Test_ResizePowPool(t *testing.T) {
+	initialSize := services.GetPowPoolSize()
+	defer services.ResizePowPool(initialSize)
+
+	if err := services.ResizePowPool(initialSize + 2); err != nil {
+		t.Fatalf("ResizePowPool:  unexpected error growing the pool: %v", err)
+	}
+	assertPowPoolSize(t, initialSize+2)
+
+	if err := services.ResizePowPool(1); err != nil {
+		t.Fatalf("ResizePowPool:  unexpected error shrinking the pool: %v", err)
+	}
+	assertPowPoolSize(t, 1)
+
+	if err := services.ResizePowPool(0); err == nil {
+		t.Fatalf("ResizePowPool:  the pool should not shrink to 0 channels")
+	}
+}
+
+func assertPowPoolSize(t *testing.T, size int) {
+	if services.GetPowPoolSize() != size || services.PowProcs != size {
+		t.Fatalf("ResizePowPool:  expected %v channels in the pool, got %v", size, services.GetPowPoolSize())
+	}
+
+	channels := []models.ChunkChannel{}
+	models.DB.RawQuery("SELECT * FROM chunk_channels").All(&channels)
+	if len(channels) != size {
+		t.Fatalf("ResizePowPool:  expected %v channels in the db, got %v", size, len(channels))
+	}
+	for _, channel := range channels {
+		if _, ok := services.Channel[channel.ChannelID]; !ok {
+			t.Fatalf("ResizePowPool:  channel %v is in the db but not in the pool", channel.ChannelID)
+		}
+	}
+}
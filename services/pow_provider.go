@@ -0,0 +1,213 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+
+	giota "github.com/iotaledger/iota.go/api"
+	"github.com/iotaledger/iota.go/bundle"
+	"github.com/iotaledger/iota.go/pow"
+	"github.com/iotaledger/iota.go/transaction"
+	"github.com/iotaledger/iota.go/trinary"
+	"github.com/oysterprotocol/brokernode/services/awsgateway"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+const (
+	/*PowProviderLocal does the proof of work on the broker's CPU.*/
+	PowProviderLocal = "local"
+	/*PowProviderRemote asks the IRI node to do the proof of work with attachToTangle.*/
+	PowProviderRemote = "remote"
+	/*PowProviderLambda sends the chunks to the hooknode lambdas, which do the proof of work and broadcast them.*/
+	PowProviderLambda = "lambda"
+	/*PowProviderFake does not attach anything.  It is meant for tests and local development.*/
+	PowProviderFake = "fake"
+)
+
+/*PowProvider does the proof of work for chunks and broadcasts them to the tangle.*/
+type PowProvider interface {
+	/*Name is used in the logs to tell which provider attached the chunks.*/
+	Name() string
+	/*AttachChunks returns ErrAttachPending if the chunks were only queued, and are attached later.*/
+	AttachChunks(chunks []oyster_utils.ChunkData) error
+}
+
+/*ErrAttachPending is returned by AttachChunks and DoPoW when the chunks were queued to be attached rather than
+attached.  Callers must not consider the chunks attached until they are verified on the tangle.*/
+var ErrAttachPending = errors.New("chunks were queued to be attached")
+
+/*Pow is the PowProvider selected by the POW_PROVIDER env var.  The PowWorkers and DoPoW attach chunks with it.*/
+var Pow PowProvider
+
+var startLambdaWorkersOnce sync.Once
+
+/*NewPowProvider returns a new PowProvider of the given providerType.  Unknown types fall back to the local provider.*/
+func NewPowProvider(providerType string) PowProvider {
+	switch providerType {
+	case PowProviderRemote:
+		return &remotePowProvider{}
+	case PowProviderLambda:
+		startLambdaWorkersOnce.Do(func() {
+			for i := 0; i < awsgateway.MaxConcurrency; i++ {
+				go lambdaWorker(lambdaChan)
+			}
+			if LambdaFallbackPow == nil {
+				LambdaFallbackPow = NewPowProvider(PowProviderLocal)
+			}
+		})
+		return &lambdaPowProvider{}
+	case PowProviderFake:
+		return NewFakePowProvider()
+	default:
+		return &localPowProvider{name: powName, powFunc: bestPow}
+	}
+}
+
+/*getPowProviderType reads POW_PROVIDER.  If it is not set, the lambda provider is used when ENABLE_LAMBDA is
+true and the local provider otherwise.*/
+func getPowProviderType() string {
+	if v := strings.ToLower(os.Getenv("POW_PROVIDER")); v != "" {
+		return v
+	}
+	if os.Getenv("ENABLE_LAMBDA") == "true" {
+		return PowProviderLambda
+	}
+	return PowProviderLocal
+}
+
+type localPowProvider struct {
+	name    string
+	powFunc pow.ProofOfWorkFunc
+}
+
+func (p *localPowProvider) Name() string {
+	return PowProviderLocal + ":" + p.name
+}
+
+func (p *localPowProvider) AttachChunks(chunks []oyster_utils.ChunkData) error {
+	bdl, err := prepareChunkTransfers(chunks)
+	if err != nil {
+		return err
+	}
+
+	transactions, err := transaction.AsTransactionObjects(bdl, nil)
+	if err != nil {
+		oyster_utils.LogIfError(err, nil)
+		return err
+	}
+
+	transactionsToApprove, err := getTransactionsToApprove()
+	if err != nil {
+		oyster_utils.LogIfError(err, nil)
+		return err
+	}
+
+	return doPowAndBroadcast(
+		transactionsToApprove.BranchTransaction,
+		transactionsToApprove.TrunkTransaction,
+		minDepth,
+		transactions,
+		minWeightMag,
+		p.powFunc,
+		[]string{""})
+}
+
+type remotePowProvider struct{}
+
+func (p *remotePowProvider) Name() string {
+	return PowProviderRemote
+}
+
+func (p *remotePowProvider) AttachChunks(chunks []oyster_utils.ChunkData) error {
+	bdl, err := prepareChunkTransfers(chunks)
+	if err != nil {
+		return err
+	}
+
+	// remoteAPI has no local proof of work function, so attachToTangle runs on the IRI node.
+	node := IriNodes.GetNode()
+	_, err = node.remoteAPI.SendTrytes(bdl, uint64(minDepth), uint64(minWeightMag))
+	IriNodes.ReportError(node, err)
+	oyster_utils.LogIfError(err, nil)
+	return err
+}
+
+type lambdaPowProvider struct{}
+
+func (p *lambdaPowProvider) Name() string {
+	return PowProviderLambda
+}
+
+/*AttachChunks queues the chunks for the lambda workers and returns ErrAttachPending before they are attached.
+While the lambda is in fallback, the chunks are attached with local PoW right away.*/
+func (p *lambdaPowProvider) AttachChunks(chunks []oyster_utils.ChunkData) error {
+	if IsLambdaInFallback() {
+		return getLambdaFallbackPow().AttachChunks(chunks)
+	}
+	if err := batchPowOnLambda(&chunks); err != nil {
+		return err
+	}
+	return ErrAttachPending
+}
+
+/*FakePowProvider records the chunks it is asked to attach instead of attaching them, and fails with Err if it
+is set.*/
+type FakePowProvider struct {
+	mutex          sync.Mutex
+	AttachedChunks []oyster_utils.ChunkData
+	Err            error
+}
+
+/*NewFakePowProvider returns a FakePowProvider which attaches every chunk successfully.*/
+func NewFakePowProvider() *FakePowProvider {
+	return &FakePowProvider{}
+}
+
+func (p *FakePowProvider) Name() string {
+	return PowProviderFake
+}
+
+func (p *FakePowProvider) AttachChunks(chunks []oyster_utils.ChunkData) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.Err != nil {
+		return p.Err
+	}
+	for _, chunk := range chunks {
+		if _, err := trinary.NewTrytes(chunk.Address); err != nil {
+			return errors.New("invalid chunk address: " + err.Error())
+		}
+	}
+	p.AttachedChunks = append(p.AttachedChunks, chunks...)
+	return nil
+}
+
+/*prepareChunkTransfers turns the chunks into the trytes of a bundle of zero value transactions.*/
+func prepareChunkTransfers(chunks []oyster_utils.ChunkData) ([]trinary.Trytes, error) {
+	transfersArray := make([]bundle.Transfer, len(chunks))
+
+	for i, chunk := range chunks {
+		address, err := trinary.NewTrytes(chunk.Address)
+		if err != nil {
+			oyster_utils.LogIfError(err, nil)
+			return nil, err
+		}
+		transfersArray[i].Address = address
+		transfersArray[i].Value = uint64(0)
+		transfersArray[i].Message, err = trinary.NewTrytes(chunk.Message)
+		if err != nil {
+			oyster_utils.LogIfError(err, nil)
+			return nil, err
+		}
+		transfersArray[i].Tag = OysterTag
+	}
+
+	node := IriNodes.GetNode()
+	bdl, err := node.api.PrepareTransfers(seed, transfersArray, giota.PrepareTransfersOptions{})
+	IriNodes.ReportError(node, err)
+	oyster_utils.LogIfError(err, nil)
+	return bdl, err
+}
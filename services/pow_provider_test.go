@@ -0,0 +1,44 @@
+package services_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/oysterprotocol/brokernode/services"
+	"github.com/oysterprotocol/brokernode/utils"
+)
+
+func Test_FakePowProvider_AttachChunks(t *testing.T) {
+	provider := services.NewPowProvider(services.PowProviderFake).(*services.FakePowProvider)
+
+	chunks := []oyster_utils.ChunkData{
+		{Address: oyster_utils.RandSeq(81, oyster_utils.TrytesAlphabet), Message: "ABC", Idx: 1},
+		{Address: oyster_utils.RandSeq(81, oyster_utils.TrytesAlphabet), Message: "DEF", Idx: 2},
+	}
+	oyster_utils.AssertNoError(provider.AttachChunks(chunks), t, "")
+	oyster_utils.AssertTrue(len(provider.AttachedChunks) == 2, t, "Expected 2 attached chunks")
+	oyster_utils.AssertTrue(provider.AttachedChunks[1].Idx == 2, t, "Expected chunks to be attached in order")
+}
+
+func Test_FakePowProvider_Error(t *testing.T) {
+	provider := services.NewFakePowProvider()
+	provider.Err = errors.New("pow failed")
+
+	chunks := []oyster_utils.ChunkData{
+		{Address: oyster_utils.RandSeq(81, oyster_utils.TrytesAlphabet), Message: "ABC"},
+	}
+	oyster_utils.AssertError(provider.AttachChunks(chunks), t, "Expected the error of the provider")
+	oyster_utils.AssertTrue(len(provider.AttachedChunks) == 0, t, "Expected no attached chunks")
+}
+
+func Test_FakePowProvider_InvalidAddress(t *testing.T) {
+	provider := services.NewFakePowProvider()
+
+	chunks := []oyster_utils.ChunkData{{Address: "not trytes", Message: "ABC"}}
+	oyster_utils.AssertError(provider.AttachChunks(chunks), t, "Expected an error for an invalid address")
+}
+
+func Test_NewPowProvider_DefaultsToLocal(t *testing.T) {
+	provider := services.NewPowProvider("unknown")
+	oyster_utils.AssertContainString(provider.Name(), services.PowProviderLocal, t)
+}
@@ -22,11 +22,19 @@ type HistogramData func(histogram *prometheus.HistogramVec, data float64)
 // TimeNow Utility to Get Current Time
 type TimeNow func() (start time.Time)
 
+// PrepareCounter Return Collection Of Counters
+type PrepareCounter func(name string, help string, labelNames ...string) (counter *prometheus.CounterVec)
+
+// CounterIncrement Increment A Counter For The Given Labels
+type CounterIncrement func(counter *prometheus.CounterVec, labelValues ...string)
+
 type PrometheusService struct {
 	PrepareHistogram
 	HistogramSeconds
 	HistogramData
 	TimeNow
+	PrepareCounter
+	CounterIncrement
 	HistogramTreasuresResourceVerifyAndClaim       *prometheus.HistogramVec
 	HistogramSignTreasureGetUnsigned               *prometheus.HistogramVec
 	HistogramSignTreasureSetSigned                 *prometheus.HistogramVec
@@ -34,6 +42,12 @@ type PrometheusService struct {
 	HistogramUploadSessionResourceUpdate           *prometheus.HistogramVec
 	HistogramUploadSessionResourceCreateBeta       *prometheus.HistogramVec
 	HistogramUploadSessionResourceGetPaymentStatus *prometheus.HistogramVec
+	HistogramUploadSessionResourceDelete           *prometheus.HistogramVec
+	HistogramQuoteResourceCreate                   *prometheus.HistogramVec
+	HistogramDownloadResourceGet                   *prometheus.HistogramVec
+	HistogramSessionProgressResourceGet            *prometheus.HistogramVec
+	HistogramBrokernodeResourceList                *prometheus.HistogramVec
+	HistogramBrokernodeResourceCreate              *prometheus.HistogramVec
 	HistogramWebnodeResourceCreate                 *prometheus.HistogramVec
 	HistogramTransactionBrokernodeResourceCreate   *prometheus.HistogramVec
 	HistogramTransactionBrokernodeResourceUpdate   *prometheus.HistogramVec
@@ -55,6 +69,15 @@ type PrometheusService struct {
 	HistogramRemoveUnpaidUploadSession             *prometheus.HistogramVec
 	HistogramUpdateTimeOutDataMaps                 *prometheus.HistogramVec
 	HistogramVerifyDataMaps                        *prometheus.HistogramVec
+	HistogramIngestUploadBatches                   *prometheus.HistogramVec
+	HistogramReverifyCompletedUploads              *prometheus.HistogramVec
+	HistogramReconcilePeerSessions                 *prometheus.HistogramVec
+	HistogramCheckBrokernodes                      *prometheus.HistogramVec
+	HistogramAnnounceBrokernode                    *prometheus.HistogramVec
+	CounterJobPanics                               *prometheus.CounterVec
+	CounterLambdaFailures                          *prometheus.CounterVec
+	CounterLambdaDeadLetters                       *prometheus.CounterVec
+	CounterUploadQuotaRejections                   *prometheus.CounterVec
 }
 
 func init() {
@@ -65,6 +88,12 @@ func init() {
 	histogramUploadSessionResourceUpdate := prepareHistogram("upload_session_resource_update_seconds", "HistogramUploadSessionResourceUpdateSeconds", "code")
 	histogramUploadSessionResourceCreateBeta := prepareHistogram("upload_session_resource_create_beta_seconds", "HistogramUploadSessionResourceCreateBetaSeconds", "code")
 	histogramUploadSessionResourceGetPaymentStatus := prepareHistogram("upload_session_resource_get_payment_status_seconds", "HistogramUploadSessionResourceGetPaymentStatusSeconds", "code")
+	histogramUploadSessionResourceDelete := prepareHistogram("upload_session_resource_delete_seconds", "HistogramUploadSessionResourceDeleteSeconds", "code")
+	histogramQuoteResourceCreate := prepareHistogram("quote_resource_create_seconds", "HistogramQuoteResourceCreateSeconds", "code")
+	histogramDownloadResourceGet := prepareHistogram("download_resource_get_seconds", "HistogramDownloadResourceGetSeconds", "code")
+	histogramSessionProgressResourceGet := prepareHistogram("session_progress_resource_get_seconds", "HistogramSessionProgressResourceGetSeconds", "code")
+	histogramBrokernodeResourceList := prepareHistogram("brokernode_resource_list_seconds", "HistogramBrokernodeResourceListSeconds", "code")
+	histogramBrokernodeResourceCreate := prepareHistogram("brokernode_resource_create_seconds", "HistogramBrokernodeResourceCreateSeconds", "code")
 	histogramWebnodeResourceCreate := prepareHistogram("webnode_resource_create_seconds", "HistogramWebnodeResourceCreateSeconds", "code")
 	histogramTransactionBrokernodeResourceCreate := prepareHistogram("transaction_brokernode_resource_create_seconds", "HistogramTransactionBrokernodeResourceCreateSeconds", "code")
 	histogramTransactionBrokernodeResourceUpdate := prepareHistogram("transaction_brokernode_resource_update_seconds", "HistogramTransactionBrokernodeResourceUpdateSeconds", "code")
@@ -86,12 +115,23 @@ func init() {
 	histogramRemoveUnpaidUploadSession := prepareHistogram("remove_unpaid_upload_session_seconds", "HistogramRemoveUnpaidUploadSession", "code")
 	histogramUpdateTimeOutDataMaps := prepareHistogram("update_time_out_datamaps_seconds", "HistogramUpdateTimeOutDataMaps", "code")
 	histogramVerifyDataMaps := prepareHistogram("verify_datamaps_seconds", "HistogramVerifyDataMaps", "code")
+	histogramIngestUploadBatches := prepareHistogram("ingest_upload_batches_seconds", "HistogramIngestUploadBatches", "code")
+	histogramReverifyCompletedUploads := prepareHistogram("reverify_completed_uploads_seconds", "HistogramReverifyCompletedUploads", "code")
+	histogramReconcilePeerSessions := prepareHistogram("reconcile_peer_sessions_seconds", "HistogramReconcilePeerSessions", "code")
+	histogramCheckBrokernodes := prepareHistogram("check_brokernodes_seconds", "HistogramCheckBrokernodes", "code")
+	histogramAnnounceBrokernode := prepareHistogram("announce_brokernode_seconds", "HistogramAnnounceBrokernode", "code")
+	counterJobPanics := prepareCounter("job_panics_total", "CounterJobPanics", "job")
+	counterLambdaFailures := prepareCounter("lambda_invocation_failures_total", "CounterLambdaFailures")
+	counterLambdaDeadLetters := prepareCounter("lambda_dead_letters_total", "CounterLambdaDeadLetters")
+	counterUploadQuotaRejections := prepareCounter("upload_quota_rejections_total", "CounterUploadQuotaRejections", "quota")
 
 	PrometheusWrapper = PrometheusService{
 		PrepareHistogram: prepareHistogram,
 		HistogramSeconds: histogramSeconds,
 		HistogramData:    histogramData,
 		TimeNow:          timeNow,
+		PrepareCounter:   prepareCounter,
+		CounterIncrement: counterIncrement,
 		HistogramTreasuresResourceVerifyAndClaim:       histogramTreasuresResourceVerifyAndClaim,
 		HistogramSignTreasureGetUnsigned:               histogramSignTreasureGetUnsigned,
 		HistogramSignTreasureSetSigned:                 histogramSignTreasureSetSigned,
@@ -99,6 +139,12 @@ func init() {
 		HistogramUploadSessionResourceUpdate:           histogramUploadSessionResourceUpdate,
 		HistogramUploadSessionResourceCreateBeta:       histogramUploadSessionResourceCreateBeta,
 		HistogramUploadSessionResourceGetPaymentStatus: histogramUploadSessionResourceGetPaymentStatus,
+		HistogramUploadSessionResourceDelete:           histogramUploadSessionResourceDelete,
+		HistogramQuoteResourceCreate:                   histogramQuoteResourceCreate,
+		HistogramDownloadResourceGet:                   histogramDownloadResourceGet,
+		HistogramSessionProgressResourceGet:            histogramSessionProgressResourceGet,
+		HistogramBrokernodeResourceList:                histogramBrokernodeResourceList,
+		HistogramBrokernodeResourceCreate:              histogramBrokernodeResourceCreate,
 		HistogramWebnodeResourceCreate:                 histogramWebnodeResourceCreate,
 		HistogramTransactionBrokernodeResourceCreate:   histogramTransactionBrokernodeResourceCreate,
 		HistogramTransactionBrokernodeResourceUpdate:   histogramTransactionBrokernodeResourceUpdate,
@@ -120,6 +166,15 @@ func init() {
 		HistogramRemoveUnpaidUploadSession:             histogramRemoveUnpaidUploadSession,
 		HistogramUpdateTimeOutDataMaps:                 histogramUpdateTimeOutDataMaps,
 		HistogramVerifyDataMaps:                        histogramVerifyDataMaps,
+		HistogramIngestUploadBatches:                   histogramIngestUploadBatches,
+		HistogramReverifyCompletedUploads:              histogramReverifyCompletedUploads,
+		HistogramReconcilePeerSessions:                 histogramReconcilePeerSessions,
+		HistogramCheckBrokernodes:                      histogramCheckBrokernodes,
+		HistogramAnnounceBrokernode:                    histogramAnnounceBrokernode,
+		CounterJobPanics:                               counterJobPanics,
+		CounterLambdaFailures:                          counterLambdaFailures,
+		CounterLambdaDeadLetters:                       counterLambdaDeadLetters,
+		CounterUploadQuotaRejections:                   counterUploadQuotaRejections,
 	}
 
 	prometheus.MustRegister(newPrometheusCollector())
@@ -158,3 +213,19 @@ func histogramSeconds(histogram *prometheus.HistogramVec, start time.Time) {
 func histogramData(histogram *prometheus.HistogramVec, data float64) {
 	histogram.WithLabelValues("500").Observe(data)
 }
+
+// PrepareCounter Utility to prepare and build a counter
+func prepareCounter(name string, help string, labelNames ...string) (counter *prometheus.CounterVec) {
+	counter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: name,
+		Help: help,
+	}, labelNames)
+
+	prometheus.Register(counter)
+	return counter
+}
+
+// Utility to increment a counter
+func counterIncrement(counter *prometheus.CounterVec, labelValues ...string) {
+	counter.WithLabelValues(labelValues...).Inc()
+}
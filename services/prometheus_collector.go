@@ -13,6 +13,9 @@ type PrometheusCollector struct {
 	badgerNumBytesWritten *prometheus.Desc
 	badgerNumGet          *prometheus.Desc
 	badgerNumPut          *prometheus.Desc
+	powPoolSize           *prometheus.Desc
+	powChannelThroughput  *prometheus.Desc
+	iriNodeHealthy        *prometheus.Desc
 }
 
 //You must create a constructor for you collector that
@@ -37,6 +40,15 @@ func newPrometheusCollector() *PrometheusCollector {
 		badgerNumPut: prometheus.NewDesc("badger_puts_total",
 			"Show Badger PUT Operation", nil, nil,
 		),
+		powPoolSize: prometheus.NewDesc("pow_pool_channels",
+			"Show the number of channels in the PoW pool", nil, nil,
+		),
+		powChannelThroughput: prometheus.NewDesc("pow_channel_chunks_per_second",
+			"Show the recent throughput of each PoW channel", []string{"channel_id"}, nil,
+		),
+		iriNodeHealthy: prometheus.NewDesc("iri_node_healthy",
+			"Show whether each IRI node passed its last health check", []string{"uri"}, nil,
+		),
 	}
 }
 
@@ -49,6 +61,9 @@ func (collector *PrometheusCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- collector.badgerNumBytesWritten
 	ch <- collector.badgerNumGet
 	ch <- collector.badgerNumPut
+	ch <- collector.powPoolSize
+	ch <- collector.powChannelThroughput
+	ch <- collector.iriNodeHealthy
 }
 
 // Collect implements Prometheus Collector interface.
@@ -61,4 +76,17 @@ func (collector *PrometheusCollector) Collect(ch chan<- prometheus.Metric) {
 	ch <- prometheus.MustNewConstMetric(collector.badgerNumBytesWritten, prometheus.GaugeValue, float64(y.NumBytesWritten.Value()))
 	ch <- prometheus.MustNewConstMetric(collector.badgerNumGet, prometheus.GaugeValue, float64(y.NumGets.Value()))
 	ch <- prometheus.MustNewConstMetric(collector.badgerNumPut, prometheus.GaugeValue, float64(y.NumPuts.Value()))
+	ch <- prometheus.MustNewConstMetric(collector.powPoolSize, prometheus.GaugeValue, float64(GetPowPoolSize()))
+	for channelID, throughput := range GetChannelThroughputs() {
+		ch <- prometheus.MustNewConstMetric(collector.powChannelThroughput, prometheus.GaugeValue, throughput, channelID)
+	}
+	if IriNodes != nil {
+		for _, status := range IriNodes.GetStatuses() {
+			healthy := 0.0
+			if status.Healthy {
+				healthy = 1
+			}
+			ch <- prometheus.MustNewConstMetric(collector.iriNodeHealthy, prometheus.GaugeValue, healthy, status.URI)
+		}
+	}
 }
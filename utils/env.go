@@ -0,0 +1,53 @@
+package oyster_utils
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+/*GetEnvInt parses the env var as a non-negative int, or returns defaultValue if it is not set or not valid.*/
+func GetEnvInt(envName string, defaultValue int) int {
+	v := os.Getenv(envName)
+	if v == "" {
+		return defaultValue
+	}
+	value, err := strconv.Atoi(v)
+	if err != nil || value < 0 {
+		LogIfError(fmt.Errorf("invalid %v: %v", envName, v), nil)
+		return defaultValue
+	}
+	return value
+}
+
+/*GetEnvDuration parses the env var as a duration such as "90s", or returns defaultDuration if it is not set or
+not valid.*/
+func GetEnvDuration(envName string, defaultDuration time.Duration) time.Duration {
+	v := os.Getenv(envName)
+	if v == "" {
+		return defaultDuration
+	}
+	duration, err := time.ParseDuration(v)
+	if err != nil || duration < 0 {
+		LogIfError(fmt.Errorf("invalid %v: %v", envName, v), nil)
+		return defaultDuration
+	}
+	return duration
+}
+
+/*GetEnvDecimal parses the env var as a non-negative decimal, or returns 0 if it is not set or not valid.*/
+func GetEnvDecimal(envName string) decimal.Decimal {
+	v := os.Getenv(envName)
+	if v == "" {
+		return decimal.Zero
+	}
+	value, err := decimal.NewFromString(v)
+	if err != nil || value.LessThan(decimal.Zero) {
+		LogIfError(fmt.Errorf("invalid %v: %v", envName, v), nil)
+		return decimal.Zero
+	}
+	return value
+}
@@ -0,0 +1,42 @@
+package oyster_utils_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/oysterprotocol/brokernode/utils"
+	"github.com/shopspring/decimal"
+)
+
+func Test_GetEnvInt(t *testing.T) {
+	defer os.Unsetenv("TEST_ENV_INT")
+
+	oyster_utils.AssertTrue(oyster_utils.GetEnvInt("TEST_ENV_INT", 3) == 3, t, "")
+
+	os.Setenv("TEST_ENV_INT", "5")
+	oyster_utils.AssertTrue(oyster_utils.GetEnvInt("TEST_ENV_INT", 3) == 5, t, "")
+
+	os.Setenv("TEST_ENV_INT", "-1")
+	oyster_utils.AssertTrue(oyster_utils.GetEnvInt("TEST_ENV_INT", 3) == 3, t, "")
+}
+
+func Test_GetEnvDuration(t *testing.T) {
+	defer os.Unsetenv("TEST_ENV_DURATION")
+
+	os.Setenv("TEST_ENV_DURATION", "90s")
+	oyster_utils.AssertTrue(oyster_utils.GetEnvDuration("TEST_ENV_DURATION", time.Minute) == 90*time.Second, t, "")
+
+	os.Setenv("TEST_ENV_DURATION", "abc")
+	oyster_utils.AssertTrue(oyster_utils.GetEnvDuration("TEST_ENV_DURATION", time.Minute) == time.Minute, t, "")
+}
+
+func Test_GetEnvDecimal(t *testing.T) {
+	defer os.Unsetenv("TEST_ENV_DECIMAL")
+
+	os.Setenv("TEST_ENV_DECIMAL", "0.25")
+	oyster_utils.AssertTrue(oyster_utils.GetEnvDecimal("TEST_ENV_DECIMAL").Equal(decimal.NewFromFloat(0.25)), t, "")
+
+	os.Setenv("TEST_ENV_DECIMAL", "-2")
+	oyster_utils.AssertTrue(oyster_utils.GetEnvDecimal("TEST_ENV_DECIMAL").Equal(decimal.Zero), t, "")
+}
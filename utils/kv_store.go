@@ -145,6 +145,14 @@ func GetBadgerDirName(dirs []string) string {
 	return buildBadgerName(dirs, string(os.PathSeparator))
 }
 
+/*GetUniqueKvStoreDir returns the directory the unique DB of dbID stores its files in.*/
+func GetUniqueKvStoreDir(dbID []string) string {
+	if os.Getenv("GO_ENV") == "test" {
+		return badgerDirTest + string(os.PathSeparator) + GetBadgerDirName(dbID)
+	}
+	return badgerDir + string(os.PathSeparator) + GetBadgerDirName(dbID)
+}
+
 /*GetBadgerDBName will make a DB name from an array of strings
 will_look_like_this
 */
@@ -546,6 +554,35 @@ func BatchGetFromUniqueDB(dbID []string, ks *KVKeys) (kvs *KVPairs, err error) {
 	return
 }
 
+/*GetAllKeysFromUniqueDB returns every key stored in a specific DB without loading the values.*/
+func GetAllKeysFromUniqueDB(dbID []string) (KVKeys, error) {
+	var keys KVKeys
+	db := GetOrInitUniqueBadgerDB(dbID)
+	if db == nil {
+		err := errors.New("cannot get keys in GetAllKeysFromUniqueDB because of " +
+			"failure in GetOrInitUniqueBadgerDB")
+		LogIfError(err, map[string]interface{}{
+			"dbID": fmt.Sprint(dbID),
+		})
+		return keys, err
+	}
+
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			keys = append(keys, string(it.Item().KeyCopy(nil)))
+		}
+		return nil
+	})
+	LogIfError(err, map[string]interface{}{"dbID": fmt.Sprint(dbID)})
+
+	return keys, err
+}
+
 /*BatchGet returns KVPairs for a set of keys. It won't treat Key missing as error.*/
 func BatchGet(ks *KVKeys) (kvs *KVPairs, err error) {
 	kvs = &KVPairs{}
@@ -160,18 +160,28 @@ func Sha256ToAddress(hashString string) string {
 
 /*ComputeSectorDataMapAddress computes a particular sectorIdx addresses in term of DataMaps. Limit by maxNumbOfHashes.*/
 func ComputeSectorDataMapAddress(genHash string, sectorIdx int, maxNumOfHashes int) []string {
-	var addr []string
+	return computeDataMapAddresses(genHash, int64(sectorIdx*FileSectorInChunkSize), maxNumOfHashes)
+}
 
+/*ComputeChunkAddresses computes the addresses of the chunks of a file from startIdx, by following the hash chain
+from the genesis hash.*/
+func ComputeChunkAddresses(genHash string, startIdx int64, numOfChunks int) ([]string, error) {
+	if _, err := hex.DecodeString(genHash); err != nil {
+		return nil, errors.New("genesis hash is not a valid hex string")
+	}
+	return computeDataMapAddresses(genHash, startIdx, numOfChunks), nil
+}
+
+/*computeDataMapAddresses computes numOfHashes addresses of the data map from startIdx.*/
+func computeDataMapAddresses(genHash string, startIdx int64, numOfHashes int) []string {
 	currHash := genHash
-	for i := 0; i < sectorIdx*FileSectorInChunkSize; i++ {
+	for i := int64(0); i < startIdx; i++ {
 		currHash = HashHex(currHash, sha256.New())
 	}
 
-	for i := 0; i < maxNumOfHashes; i++ {
-		obfuscatedHash := HashHex(currHash, sha512.New384())
-		currAddr := string(MakeAddress(obfuscatedHash))
-
-		addr = append(addr, currAddr)
+	addr := make([]string, 0, numOfHashes)
+	for i := 0; i < numOfHashes; i++ {
+		addr = append(addr, Sha256ToAddress(currHash))
 		currHash = HashHex(currHash, sha256.New())
 	}
 	return addr
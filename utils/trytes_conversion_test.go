@@ -92,3 +92,34 @@ func Test_MakeAddress(t *testing.T) {
 		}
 	}
 }
+
+func Test_ComputeChunkAddresses(t *testing.T) {
+	genHash := "abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789"
+
+	addr, err := oyster_utils.ComputeChunkAddresses(genHash, 0, 5)
+	oyster_utils.AssertNoError(err, t, "")
+	oyster_utils.AssertTrue(len(addr) == 5, t, "")
+	oyster_utils.AssertStringEqual(addr[0], oyster_utils.Sha256ToAddress(genHash), t)
+
+	// starting further along the hash chain gives the same addresses
+	laterAddr, err := oyster_utils.ComputeChunkAddresses(genHash, 2, 3)
+	oyster_utils.AssertNoError(err, t, "")
+	for i := range laterAddr {
+		oyster_utils.AssertStringEqual(laterAddr[i], addr[i+2], t)
+	}
+
+	_, err = oyster_utils.ComputeChunkAddresses("not a hash", 0, 5)
+	oyster_utils.AssertError(err, t, "")
+}
+
+func Test_ComputeSectorDataMapAddress(t *testing.T) {
+	genHash := "abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789"
+
+	addr := oyster_utils.ComputeSectorDataMapAddress(genHash, 1, 3)
+	chunkAddr, err := oyster_utils.ComputeChunkAddresses(genHash, int64(oyster_utils.FileSectorInChunkSize), 3)
+	oyster_utils.AssertNoError(err, t, "")
+	oyster_utils.AssertTrue(len(addr) == 3, t, "")
+	for i := range addr {
+		oyster_utils.AssertStringEqual(addr[i], chunkAddr[i], t)
+	}
+}
@@ -51,8 +51,12 @@ const (
 var isRavenEnabled bool = true
 var logErrorTags map[string]string
 
+/*BrokerInstanceID identifies this broker process among the replicas which share one database.*/
+var BrokerInstanceID string
+
 func init() {
 	isRavenEnabled = os.Getenv("RAVEN_ENABLED") != "false"
+	BrokerInstanceID = getBrokerInstanceID()
 
 	isOysterPay := "enabled"
 	if PaymentMode == UserIsPaying {
@@ -72,6 +76,23 @@ func init() {
 	}
 }
 
+func getBrokerInstanceID() string {
+	if v := os.Getenv("BROKER_INSTANCE_ID"); v != "" {
+		return v
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "broker"
+	}
+	// math/rand is not seeded yet, so use a uuid to tell apart replicas on hosts with the same name.
+	id, err := uuid.NewV4()
+	if err != nil {
+		return hostname
+	}
+	return hostname + "-" + id.String()[:8]
+}
+
 /*IsInUnitTest returns true if it is running in test mode.*/
 func IsInUnitTest() bool {
 	// Check whether current is in unit test mode.
@@ -168,6 +189,12 @@ func GetTotalFileChunkIncludingBuriedPearlsUsingNumChunks(numChunks int) int {
 	return numChunks + int(math.Ceil(float64(numChunks)/float64(FileSectorInChunkSize)))
 }
 
+/*GetNumChunksExcludingBuriedPearls is the inverse of GetTotalFileChunkIncludingBuriedPearlsUsingNumChunks.  It returns
+the number of chunks the client uploads for a file whose total chunks, including the buried pearls, is totalChunks.*/
+func GetNumChunksExcludingBuriedPearls(totalChunks int) int {
+	return totalChunks - int(math.Ceil(float64(totalChunks)/float64(FileSectorInChunkSize+1)))
+}
+
 /*TransformIndexWithBuriedIndexes transforms index with correct position for insertion after considering the buried indexes.*/
 func TransformIndexWithBuriedIndexes(index int, treasureIdxMap []int) int {
 	if len(treasureIdxMap) == 0 {
@@ -279,6 +306,60 @@ func MergeIndexes(a []int, b []int, sectorSize int, numChunks int) ([]int, error
 	return merged, nil
 }
 
+/*IndexRange is an inclusive range of chunk indexes.*/
+type IndexRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+/*IndexesToRanges collapses a sorted []int of unique indexes into the fewest inclusive ranges.*/
+func IndexesToRanges(indexes []int) []IndexRange {
+	ranges := []IndexRange{}
+	for _, idx := range indexes {
+		if len(ranges) > 0 && ranges[len(ranges)-1].End+1 == idx {
+			ranges[len(ranges)-1].End = idx
+			continue
+		}
+		ranges = append(ranges, IndexRange{Start: idx, End: idx})
+	}
+	return ranges
+}
+
+/*PartitionIndexes splits [0, numIndexes) into numParts contiguous ranges whose sizes differ by at most 1.  The
+larger ranges come first.*/
+func PartitionIndexes(numIndexes int, numParts int) []IndexRange {
+	ranges := []IndexRange{}
+	start := 0
+	for i := 0; i < numParts; i++ {
+		size := numIndexes / numParts
+		if i < numIndexes%numParts {
+			size++
+		}
+		ranges = append(ranges, IndexRange{Start: start, End: start + size - 1})
+		start += size
+	}
+	return ranges
+}
+
+/*GetMissingIndexRanges returns the ranges within [0, numIndexes) that are not in the sorted []int of unique indexes.*/
+func GetMissingIndexRanges(indexes []int, numIndexes int) []IndexRange {
+	ranges := []IndexRange{}
+	next := 0
+	for _, idx := range indexes {
+		if idx >= numIndexes {
+			break
+		}
+		if idx > next {
+			ranges = append(ranges, IndexRange{Start: next, End: idx - 1})
+		}
+		next = idx + 1
+	}
+	if next < numIndexes {
+		ranges = append(ranges, IndexRange{Start: next, End: numIndexes - 1})
+	}
+	return ranges
+}
+
 func RandSeq(length int, sequence []rune) string {
 	b := make([]rune, length)
 	for i := range b {
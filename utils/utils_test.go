@@ -74,6 +74,20 @@ func Test_GetTotalFileChunkIncludingBuriedPearlsUsingNumChunks_HugeFileSize(t *t
 	oyster_utils.AssertTrue(v == (oyster_utils.FileSectorInChunkSize*60)+500+61, t, "")
 }
 
+func Test_GetNumChunksExcludingBuriedPearls_SmallFileSize(t *testing.T) {
+	v := oyster_utils.GetNumChunksExcludingBuriedPearls(11)
+
+	oyster_utils.AssertTrue(v == 10, t, "")
+}
+
+func Test_GetNumChunksExcludingBuriedPearls_SectorBoundary(t *testing.T) {
+	for _, numChunks := range []int{oyster_utils.FileSectorInChunkSize, oyster_utils.FileSectorInChunkSize + 1} {
+		totalChunks := oyster_utils.GetTotalFileChunkIncludingBuriedPearlsUsingNumChunks(numChunks)
+
+		oyster_utils.AssertTrue(oyster_utils.GetNumChunksExcludingBuriedPearls(totalChunks) == numChunks, t, "")
+	}
+}
+
 func Test_TransformIndexWithBuriedIndexes_NoBuriedIndexes(t *testing.T) {
 	index := oyster_utils.TransformIndexWithBuriedIndexes(10, []int{})
 
@@ -308,7 +322,57 @@ func Test_IntMax(t *testing.T) {
 	oyster_utils.AssertTrue(v == 2, t, "")
 }
 
+func Test_IndexesToRanges_Empty(t *testing.T) {
+	ranges := oyster_utils.IndexesToRanges([]int{})
+
+	oyster_utils.AssertTrue(len(ranges) == 0, t, "")
+}
+
+func Test_IndexesToRanges(t *testing.T) {
+	ranges := oyster_utils.IndexesToRanges([]int{0, 1, 2, 5, 7, 8})
+
+	compareIndexRanges(t, ranges, []oyster_utils.IndexRange{{Start: 0, End: 2}, {Start: 5, End: 5}, {Start: 7, End: 8}})
+}
+
+func Test_GetMissingIndexRanges_NoIndexes(t *testing.T) {
+	ranges := oyster_utils.GetMissingIndexRanges([]int{}, 10)
+
+	compareIndexRanges(t, ranges, []oyster_utils.IndexRange{{Start: 0, End: 9}})
+}
+
+func Test_GetMissingIndexRanges_AllIndexes(t *testing.T) {
+	ranges := oyster_utils.GetMissingIndexRanges([]int{0, 1, 2}, 3)
+
+	oyster_utils.AssertTrue(len(ranges) == 0, t, "")
+}
+
+func Test_GetMissingIndexRanges(t *testing.T) {
+	ranges := oyster_utils.GetMissingIndexRanges([]int{1, 2, 5, 9}, 10)
+
+	compareIndexRanges(t, ranges, []oyster_utils.IndexRange{{Start: 0, End: 0}, {Start: 3, End: 4}, {Start: 6, End: 8}})
+}
+
+func Test_PartitionIndexes(t *testing.T) {
+	ranges := oyster_utils.PartitionIndexes(10, 3)
+
+	compareIndexRanges(t, ranges, []oyster_utils.IndexRange{{Start: 0, End: 3}, {Start: 4, End: 6}, {Start: 7, End: 9}})
+}
+
+func Test_PartitionIndexes_Even(t *testing.T) {
+	ranges := oyster_utils.PartitionIndexes(10, 2)
+
+	compareIndexRanges(t, ranges, []oyster_utils.IndexRange{{Start: 0, End: 4}, {Start: 5, End: 9}})
+}
+
 // Private helper methods
+func compareIndexRanges(t *testing.T, a []oyster_utils.IndexRange, b []oyster_utils.IndexRange) {
+
+	oyster_utils.AssertTrue(len(a) == len(b), t, "a and b must have the same len")
+	for i := 0; i < len(a) && i < len(b); i++ {
+		oyster_utils.AssertTrue(a[i] == b[i], t, "a and b value are different")
+	}
+}
+
 func compareIntsArray(t *testing.T, a []int, b []int) {
 
 	oyster_utils.AssertTrue(len(a) == len(b), t, "a and b must have the same len")